@@ -0,0 +1,81 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{expr: "* * * * *"},
+		{expr: "*/15 * * * *"},
+		{expr: "0 9-18/3 * * 1-5"},
+		{expr: "0,30 8 1,15 * *"},
+		{expr: "5/10 * * * *"},
+		{expr: "0 0 * * 7"},
+		{expr: "0 0 * * 5-7"},
+		{expr: " @daily "},
+		{expr: "@hourly"},
+		{expr: "", wantErr: true},
+		{expr: "* * * *", wantErr: true},
+		{expr: "* * * * * *", wantErr: true},
+		{expr: "60 * * * *", wantErr: true},
+		{expr: "* 24 * * *", wantErr: true},
+		{expr: "* * 0 * *", wantErr: true},
+		{expr: "* * * 13 *", wantErr: true},
+		{expr: "* * * * 8", wantErr: true},
+		{expr: "*/0 * * * *", wantErr: true},
+		{expr: "10-5 * * * *", wantErr: true},
+		{expr: "a * * * *", wantErr: true},
+		{expr: "1-x * * * *", wantErr: true},
+		{expr: "@reboot", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) err = %v, wantErr %v", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// 2024-05-01 是星期三
+	base := time.Date(2024, 5, 1, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr  string
+		after time.Time
+		want  time.Time
+	}{
+		{expr: "* * * * *", after: base, want: time.Date(2024, 5, 1, 10, 8, 0, 0, time.UTC)},
+		{expr: "*/15 * * * *", after: base, want: time.Date(2024, 5, 1, 10, 15, 0, 0, time.UTC)},
+		{expr: "5/10 * * * *", after: base, want: time.Date(2024, 5, 1, 10, 15, 0, 0, time.UTC)},
+		{expr: "0 9-18/3 * * *", after: base, want: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+		{expr: "@daily", after: base, want: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)},
+		{expr: "@monthly", after: base, want: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * 0", after: base, want: time.Date(2024, 5, 5, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * 7", after: base, want: time.Date(2024, 5, 5, 0, 0, 0, 0, time.UTC)},
+		// 日期和星期都有限制时满足其一即可：5月3日是星期五，早于10日
+		{expr: "0 0 10 * 5", after: base, want: time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)},
+		// 只限制日期时星期不参与匹配
+		{expr: "0 0 10 * *", after: base, want: time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 29 2 *", after: time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC), want: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// 一年内没有匹配的时间
+		{expr: "0 0 29 2 *", after: base, want: time.Time{}},
+		{expr: "0 0 30 2 *", after: base, want: time.Time{}},
+	}
+
+	for _, tt := range tests {
+		schedule, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.expr, err)
+		}
+		if got := schedule.Next(tt.after); !got.Equal(tt.want) {
+			t.Errorf("Next(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package promtext
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// WriteFamily 按Prometheus文本格式输出一组指标，lines为已格式化的样本行，排序后输出保证结果稳定
+func WriteFamily(w io.Writer, name, help, typ string, lines []string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, EscapeHelp(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+
+	sort.Strings(lines)
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// Line 格式化一行样本
+func Line(name string, names, values []string, v float64) string {
+	return name + FormatLabels(names, values) + " " + FormatValue(v)
+}
+
+// FormatLabels 格式化标签，标签值中的反斜杠、引号和换行需要转义
+func FormatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// EscapeHelp 帮助文本中的反斜杠和换行需要转义
+func EscapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+// FormatValue 格式化取值，特殊值使用Prometheus约定的写法
+func FormatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
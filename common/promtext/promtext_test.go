@@ -0,0 +1,64 @@
+package promtext
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestFormatLabels(t *testing.T) {
+	tests := []struct {
+		names, values []string
+		want          string
+	}{
+		{nil, nil, ""},
+		{[]string{"a"}, []string{"1"}, `{a="1"}`},
+		{[]string{"a", "b"}, []string{"x", "y"}, `{a="x",b="y"}`},
+		{[]string{"path"}, []string{`C:\tmp`}, `{path="C:\\tmp"}`},
+		{[]string{"name"}, []string{`say "hi"`}, `{name="say \"hi\""}`},
+		{[]string{"text"}, []string{"a\nb"}, `{text="a\nb"}`},
+	}
+	for _, tt := range tests {
+		if got := FormatLabels(tt.names, tt.values); got != tt.want {
+			t.Errorf("FormatLabels(%q, %q) = %s, want %s", tt.names, tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		v    float64
+		want string
+	}{
+		{0, "0"},
+		{1.5, "1.5"},
+		{-2, "-2"},
+		{1e21, "1e+21"},
+		{math.NaN(), "NaN"},
+		{math.Inf(1), "+Inf"},
+		{math.Inf(-1), "-Inf"},
+	}
+	for _, tt := range tests {
+		if got := FormatValue(tt.v); got != tt.want {
+			t.Errorf("FormatValue(%v) = %s, want %s", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeHelp(t *testing.T) {
+	if got := EscapeHelp("a\\b\n\"c\""); got != `a\\b\n"c"` {
+		t.Errorf("EscapeHelp = %s", got)
+	}
+}
+
+func TestWriteFamily(t *testing.T) {
+	var buf bytes.Buffer
+	WriteFamily(&buf, "up", "是否在线", "gauge", []string{
+		Line("up", []string{"node"}, []string{"b"}, 0),
+		Line("up", []string{"node"}, []string{"a"}, 1),
+	})
+	want := "# HELP up 是否在线\n# TYPE up gauge\nup{node=\"a\"} 1\nup{node=\"b\"} 0\n"
+	if buf.String() != want {
+		t.Errorf("WriteFamily =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
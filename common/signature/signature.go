@@ -0,0 +1,172 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 面板与节点之间签名请求使用的请求头
+const (
+	HeaderNodeID    = "X-Node-ID"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderNonce     = "X-Nonce"
+	HeaderSignature = "X-Signature"
+)
+
+// MaxClockSkew 签名时间戳允许的最大偏差，同时也是nonce的保留时间
+const MaxClockSkew = 5 * time.Minute
+
+// ClockSkewError 签名有效但时间戳超出允许范围，Skew为请求时间戳与本地时间之差（对方时钟偏快时为正）
+type ClockSkewError struct {
+	Skew time.Duration
+}
+
+func (e *ClockSkewError) Error() string {
+	return fmt.Sprintf("请求时间戳超出允许范围，时钟偏差 %v", e.Skew.Round(time.Second))
+}
+
+// SigningKey 由节点密钥派生签名密钥，双方均使用该值计算HMAC
+func SigningKey(nodeKey string) []byte {
+	sum := sha256.Sum256([]byte(nodeKey))
+	return sum[:]
+}
+
+// SignRequest 为请求添加签名头，签名覆盖方法、路径、请求体哈希、时间戳和nonce
+func SignRequest(req *http.Request, body []byte, nodeID string, key []byte) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("生成nonce失败: %v", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonceHex := hex.EncodeToString(nonce)
+
+	req.Header.Set(HeaderNodeID, nodeID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonceHex)
+	req.Header.Set(HeaderSignature, computeSignature(key, req.Method, requestPath(req), body, timestamp, nonceHex, nodeID))
+	return nil
+}
+
+// VerifyRequest 校验请求签名、时间戳和nonce，nonce在有效期内只能使用一次
+func VerifyRequest(req *http.Request, body []byte, key []byte, nonces *NonceCache) error {
+	_, err := VerifyRequestKeys(req, body, [][]byte{key}, nonces)
+	return err
+}
+
+// VerifyRequestKeys 使用多个候选密钥校验请求签名，返回匹配的密钥下标，
+// 用于密钥轮换期间新旧密钥同时有效
+func VerifyRequestKeys(req *http.Request, body []byte, keys [][]byte, nonces *NonceCache) (int, error) {
+	nodeID := req.Header.Get(HeaderNodeID)
+	timestamp := req.Header.Get(HeaderTimestamp)
+	nonce := req.Header.Get(HeaderNonce)
+	signature := req.Header.Get(HeaderSignature)
+
+	if nodeID == "" || timestamp == "" || nonce == "" || signature == "" {
+		return -1, fmt.Errorf("缺少签名信息")
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return -1, fmt.Errorf("无效的时间戳")
+	}
+
+	// 逐个比较所有候选密钥，不提前返回
+	matched := -1
+	for i, key := range keys {
+		expected := computeSignature(key, req.Method, requestPath(req), body, timestamp, nonce, nodeID)
+		if hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) && matched < 0 {
+			matched = i
+		}
+	}
+	if matched < 0 {
+		return -1, fmt.Errorf("签名无效")
+	}
+
+	// 先校验签名再检查时间戳，超出范围时返回的时钟偏差来自持有密钥的一方，可以用于告警
+	skew := time.Until(time.Unix(ts, 0))
+	if skew > MaxClockSkew || skew < -MaxClockSkew {
+		return -1, &ClockSkewError{Skew: skew}
+	}
+
+	// 签名通过后再记录nonce，避免伪造请求占用nonce
+	if !nonces.Use(nodeID+":"+nonce, time.Now()) {
+		return -1, fmt.Errorf("重复的请求")
+	}
+
+	return matched, nil
+}
+
+// 请求路径，包含查询参数
+func requestPath(req *http.Request) string {
+	path := req.URL.EscapedPath()
+	if req.URL.RawQuery != "" {
+		path += "?" + req.URL.RawQuery
+	}
+	return path
+}
+
+// 计算签名
+func computeSignature(key []byte, method, path string, body []byte, timestamp, nonce, nodeID string) string {
+	bodyHash := sha256.Sum256(body)
+	canonical := strings.Join([]string{
+		strings.ToUpper(method),
+		path,
+		hex.EncodeToString(bodyHash[:]),
+		timestamp,
+		nonce,
+		nodeID,
+	}, "\n")
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(canonical))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NonceCache 记录有效期内已使用的nonce，用于防止重放
+type NonceCache struct {
+	seen   map[string]time.Time
+	ttl    time.Duration
+	lastGC time.Time
+	mutex  sync.Mutex
+}
+
+// 创建nonce缓存
+func NewNonceCache(ttl time.Duration) *NonceCache {
+	return &NonceCache{
+		seen: make(map[string]time.Time),
+		ttl:  ttl,
+	}
+}
+
+// Use 记录nonce，已在有效期内使用过时返回false
+func (c *NonceCache) Use(nonce string, now time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// 定期清理过期的nonce
+	if now.Sub(c.lastGC) > c.ttl {
+		for n, expiry := range c.seen {
+			if now.After(expiry) {
+				delete(c.seen, n)
+			}
+		}
+		c.lastGC = now
+	}
+
+	if expiry, ok := c.seen[nonce]; ok && now.Before(expiry) {
+		return false
+	}
+
+	// 时间戳允许前后偏差，nonce需保留两倍时长
+	c.seen[nonce] = now.Add(2 * c.ttl)
+	return true
+}
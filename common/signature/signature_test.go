@@ -0,0 +1,144 @@
+package signature
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyRequestKeys(t *testing.T) {
+	oldKey := SigningKey("nk_old")
+	newKey := SigningKey("nk_new")
+	body := []byte(`{"status":"ok"}`)
+
+	tests := []struct {
+		name    string
+		signKey []byte
+		keys    [][]byte
+		modify  func(*http.Request)
+		body    []byte
+		want    int
+		wantErr bool
+	}{
+		{name: "单个密钥", signKey: newKey, keys: [][]byte{newKey}, body: body, want: 0},
+		{name: "轮换期间旧密钥", signKey: oldKey, keys: [][]byte{newKey, oldKey}, body: body, want: 1},
+		{name: "密钥错误", signKey: SigningKey("nk_other"), keys: [][]byte{newKey}, body: body, wantErr: true},
+		{name: "请求体被篡改", signKey: newKey, keys: [][]byte{newKey}, body: []byte(`{"status":"bad"}`), wantErr: true},
+		{name: "路径被篡改", signKey: newKey, keys: [][]byte{newKey}, body: body, wantErr: true, modify: func(r *http.Request) {
+			r.URL.Path = "/api/node/other"
+		}},
+		{name: "节点ID被篡改", signKey: newKey, keys: [][]byte{newKey}, body: body, wantErr: true, modify: func(r *http.Request) {
+			r.Header.Set(HeaderNodeID, "node-2")
+		}},
+		{name: "时间戳过期", signKey: newKey, keys: [][]byte{newKey}, body: body, wantErr: true, modify: func(r *http.Request) {
+			r.Header.Set(HeaderTimestamp, strconv.FormatInt(time.Now().Add(-2*MaxClockSkew).Unix(), 10))
+		}},
+		{name: "缺少签名", signKey: newKey, keys: [][]byte{newKey}, body: body, wantErr: true, modify: func(r *http.Request) {
+			r.Header.Del(HeaderSignature)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "http://panel/api/node/heartbeat?x=1", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := SignRequest(req, body, "node-1", tt.signKey); err != nil {
+				t.Fatal(err)
+			}
+			if tt.modify != nil {
+				tt.modify(req)
+			}
+
+			got, err := VerifyRequestKeys(req, tt.body, tt.keys, NewNonceCache(MaxClockSkew))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("matched = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRequestRejectsReplay(t *testing.T) {
+	key := SigningKey("nk_key")
+	nonces := NewNonceCache(MaxClockSkew)
+
+	req, err := http.NewRequest("GET", "http://node/api/config", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SignRequest(req, nil, "node-1", key); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyRequest(req, nil, key, nonces); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	if err := VerifyRequest(req, nil, key, nonces); err == nil {
+		t.Fatal("重放的请求应被拒绝")
+	}
+}
+
+func TestNonceCache(t *testing.T) {
+	cache := NewNonceCache(time.Minute)
+	now := time.Now()
+
+	if !cache.Use("a", now) {
+		t.Fatal("首次使用应成功")
+	}
+	if cache.Use("a", now.Add(time.Minute)) {
+		t.Fatal("有效期内重复使用应失败")
+	}
+	if !cache.Use("a", now.Add(3*time.Minute)) {
+		t.Fatal("过期后应可再次使用")
+	}
+}
+
+func TestVerifyRequestClockSkew(t *testing.T) {
+	key := SigningKey("nk_key")
+
+	// 按指定时间戳签名，模拟时钟偏差较大的一方
+	signAt := func(signKey []byte, offset time.Duration) *http.Request {
+		req, err := http.NewRequest("POST", "http://panel/api/node/heartbeat", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		timestamp := strconv.FormatInt(time.Now().Add(offset).Unix(), 10)
+		req.Header.Set(HeaderNodeID, "node-1")
+		req.Header.Set(HeaderTimestamp, timestamp)
+		req.Header.Set(HeaderNonce, "nonce")
+		req.Header.Set(HeaderSignature, computeSignature(signKey, req.Method, requestPath(req), nil, timestamp, "nonce", "node-1"))
+		return req
+	}
+
+	tests := []struct {
+		name     string
+		signKey  []byte
+		offset   time.Duration
+		wantSkew bool
+	}{
+		{name: "时钟偏快", signKey: key, offset: 10 * time.Minute, wantSkew: true},
+		{name: "时钟偏慢", signKey: key, offset: -time.Hour, wantSkew: true},
+		{name: "允许范围内", signKey: key, offset: MaxClockSkew - time.Minute},
+		{name: "签名无效时不返回偏差", signKey: SigningKey("nk_other"), offset: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyRequest(signAt(tt.signKey, tt.offset), nil, key, NewNonceCache(MaxClockSkew))
+			skewErr, ok := err.(*ClockSkewError)
+			if ok != tt.wantSkew {
+				t.Fatalf("err = %v, wantSkew %v", err, tt.wantSkew)
+			}
+			if ok {
+				if diff := skewErr.Skew - tt.offset; diff > 2*time.Second || diff < -2*time.Second {
+					t.Errorf("Skew = %v, want %v", skewErr.Skew, tt.offset)
+				}
+			}
+		})
+	}
+}
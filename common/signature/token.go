@@ -0,0 +1,67 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// HeaderTargetToken 源节点访问目标节点测速接口时携带的令牌
+const HeaderTargetToken = "X-Speedtest-Token"
+
+// TargetClaims 面板随测试下发的目标令牌内容，使用目标节点的签名密钥签发
+type TargetClaims struct {
+	TestID       string `json:"test_id"`
+	SourceNodeID string `json:"source_node_id"`
+	TargetNodeID string `json:"target_node_id"`
+	ExpiresAt    int64  `json:"exp"` // 过期时间（Unix秒）
+}
+
+// SignTargetToken 签发目标令牌，格式为 Base64(内容).十六进制HMAC
+func SignTargetToken(key []byte, claims TargetClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + tokenMAC(key, encoded), nil
+}
+
+// VerifyTargetToken 校验目标令牌的签名、有效期以及目标节点是否为本节点
+func VerifyTargetToken(token string, key []byte, targetNodeID string, now time.Time) (*TargetClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("无效的令牌格式")
+	}
+	if !hmac.Equal([]byte(tokenMAC(key, parts[0])), []byte(strings.ToLower(parts[1]))) {
+		return nil, fmt.Errorf("令牌签名无效")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("无效的令牌内容")
+	}
+	var claims TargetClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("无效的令牌内容")
+	}
+	if claims.TargetNodeID != targetNodeID {
+		return nil, fmt.Errorf("令牌不是签发给本节点的")
+	}
+	if now.Unix() > claims.ExpiresAt {
+		return nil, fmt.Errorf("令牌已过期")
+	}
+	return &claims, nil
+}
+
+// 计算令牌签名，加上用途前缀，避免与请求签名混用
+func tokenMAC(key []byte, encoded string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("speedtest-target\n" + encoded))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,58 @@
+package signature
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyTargetToken(t *testing.T) {
+	key := SigningKey("nk_target")
+	now := time.Unix(1700000000, 0)
+	claims := TargetClaims{
+		TestID:       "test-1",
+		SourceNodeID: "node-1",
+		TargetNodeID: "node-2",
+		ExpiresAt:    now.Add(time.Minute).Unix(),
+	}
+	token, err := SignTargetToken(key, claims)
+	if err != nil {
+		t.Fatalf("SignTargetToken: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		key     []byte
+		target  string
+		now     time.Time
+		wantErr bool
+	}{
+		{name: "有效令牌", token: token, key: key, target: "node-2", now: now},
+		{name: "恰好到期", token: token, key: key, target: "node-2", now: now.Add(time.Minute)},
+		{name: "已过期", token: token, key: key, target: "node-2", now: now.Add(time.Minute + time.Second), wantErr: true},
+		{name: "其他节点", token: token, key: key, target: "node-3", now: now, wantErr: true},
+		{name: "密钥错误", token: token, key: SigningKey("nk_other"), target: "node-2", now: now, wantErr: true},
+		{name: "内容被篡改", token: "x" + token, key: key, target: "node-2", now: now, wantErr: true},
+		{name: "格式错误", token: strings.Replace(token, ".", "", 1), key: key, target: "node-2", now: now, wantErr: true},
+		{name: "空令牌", token: "", key: key, target: "node-2", now: now, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyTargetToken(tt.token, tt.key, tt.target, tt.now)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("应返回错误")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyTargetToken: %v", err)
+			}
+			if *got != claims {
+				t.Fatalf("令牌内容 = %+v, 期望 %+v", *got, claims)
+			}
+		})
+	}
+}
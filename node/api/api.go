@@ -1,15 +1,17 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
-	"time"
-
-	"github.com/gin-gonic/gin"
+	"strings"
 
+	"节点管理测速项目/common/signature"
+	"节点管理测速项目/node/auth"
 	"节点管理测速项目/node/config"
-	"节点管理测速项目/node/speedtest"
 )
 
 // 响应结构
@@ -19,275 +21,128 @@ type Response struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
-// 测速任务请求
-type SpeedtestRequest struct {
-	TargetURL    string `json:"target_url"`
-	Type         string `json:"type"`         // "download", "upload", "ping", "full"
-	Size         int    `json:"size"`         // 测试文件大小(MB)
-	Timeout      int    `json:"timeout"`      // 超时时间(秒)
-	TaskID       string `json:"task_id"`      // 任务ID
-	CallbackURL  string `json:"callback_url"` // 回调URL
-}
-
-// 节点状态
-type NodeStatus struct {
-	NodeName    string    `json:"node_name"`
-	Version     string    `json:"version"`
-	CPUUsage    float64   `json:"cpu_usage"`
-	MemoryUsage float64   `json:"memory_usage"`
-	DiskUsage   float64   `json:"disk_usage"`
-	Uptime      int64     `json:"uptime"`
-	StartTime   time.Time `json:"start_time"`
-}
-
 var (
-	router      *gin.Engine
-	startTime   time.Time
-	apiVersion  = "1.0.0"
-	nodeStatus  NodeStatus
+	// 已使用的请求nonce，防止重放
+	nonceCache = signature.NewNonceCache(signature.MaxClockSkew)
 )
 
-// 初始化API服务
-func InitAPI() *gin.Engine {
-	// 记录启动时间
-	startTime = time.Now()
-
-	// 创建Gin路由
-	gin.SetMode(gin.ReleaseMode)
-	router = gin.New()
-	router.Use(gin.Recovery())
-	router.Use(LoggerMiddleware())
-	router.Use(AuthMiddleware())
+// 签名校验时读取请求体的最大长度
+const maxSignedBodySize = 10 << 20
 
-	// 注册路由
-	router.GET("/api/status", handleStatus)
-	router.POST("/api/speedtest", handleSpeedtest)
-	router.GET("/api/speedtest/:task_id", handleGetSpeedtestResult)
-	router.POST("/api/config", handleUpdateConfig)
-	router.GET("/api/config", handleGetConfig)
+// Register 在节点服务上注册面板管理接口，签名由节点服务外层的RequireSignature校验
+func Register(mux *http.ServeMux) {
+	mux.HandleFunc("/api/config", handleConfig)
+}
 
-	// 更新节点状态
-	updateNodeStatus()
-	go func() {
-		ticker := time.NewTicker(30 * time.Second)
-		for range ticker.C {
-			updateNodeStatus()
+// RequireSignature 除公开路径外，所有请求都必须带有面板使用节点密钥计算的签名
+func RequireSignature(next http.Handler) http.Handler {
+	signed := AuthMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPublicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
 		}
-	}()
-
-	return router
+		signed.ServeHTTP(w, r)
+	})
 }
 
-// 日志中间件
-func LoggerMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		start := time.Now()
-		path := c.Request.URL.Path
-		method := c.Request.Method
-
-		c.Next()
-
-		latency := time.Since(start)
-		statusCode := c.Writer.Status()
-		log.Printf("[API] %s %s %d %s", method, path, statusCode, latency)
+// 无需签名的路径：运行状态、指标和其他节点访问的测速接口
+func isPublicPath(path string) bool {
+	switch path {
+	case "/", "/api/status", "/metrics":
+		return true
 	}
+	return strings.HasPrefix(path, auth.PeerPathPrefix)
 }
 
-// 认证中间件
-func AuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// 获取节点密钥
-		nodeKey := config.GetConfig().NodeKey
+// AuthMiddleware 认证中间件，校验面板使用节点密钥签名的请求
+func AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := config.GetConfig()
 
-		// 检查请求头中的密钥
-		authKey := c.GetHeader("X-Node-Key")
-		if authKey == "" {
-			// 也接受查询参数中的密钥
-			authKey = c.Query("node_key")
+		// 读取请求体用于签名校验，之后还原供后续处理使用
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxSignedBodySize))
+		if err != nil {
+			writeJSON(w, http.StatusUnauthorized, Response{Code: 401, Message: "读取请求体失败"})
+			return
 		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
 
-		// 验证密钥
-		if authKey != nodeKey {
-			c.JSON(http.StatusUnauthorized, Response{
-				Code:    401,
-				Message: "未授权访问",
-			})
-			c.Abort()
+		// 签名中的节点ID必须是本节点
+		if cfg.NodeID != "" && r.Header.Get(signature.HeaderNodeID) != cfg.NodeID {
+			writeJSON(w, http.StatusUnauthorized, Response{Code: 401, Message: "节点ID不匹配"})
 			return
 		}
 
-		c.Next()
-	}
-}
-
-// 处理获取节点状态请求
-func handleStatus(c *gin.Context) {
-	c.JSON(http.StatusOK, Response{
-		Code:    0,
-		Message: "成功",
-		Data:    nodeStatus,
-	})
-}
-
-// 处理测速请求
-func handleSpeedtest(c *gin.Context) {
-	var req SpeedtestRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, Response{
-			Code:    400,
-			Message: "无效的请求参数",
-		})
-		return
-	}
-
-	// 设置默认值
-	if req.Timeout <= 0 {
-		req.Timeout = config.GetConfig().SpeedtestTimeout
-	}
-	if req.Size <= 0 {
-		req.Size = 100 // 默认100MB
-	}
-
-	// 创建测速任务
-	go func() {
-		var result *speedtest.Result
-		var err error
-
-		switch req.Type {
-		case "download":
-			result, err = speedtest.TestDownload(req.TargetURL, req.Size, req.Timeout)
-		case "upload":
-			result, err = speedtest.TestUpload(req.TargetURL, req.Size, req.Timeout)
-		case "ping":
-			result, err = speedtest.TestPing(req.TargetURL, config.GetConfig().PingCount)
-		case "full":
-			result, err = speedtest.TestFull(req.TargetURL, req.Size, req.Timeout)
-		default:
-			log.Printf("未知的测速类型: %s", req.Type)
+		if cfg.NodeKey == "" {
+			writeJSON(w, http.StatusUnauthorized, Response{Code: 401, Message: "节点密钥未配置"})
 			return
 		}
 
-		// 测速完成后回调
-		if req.CallbackURL != "" {
-			sendCallback(req.CallbackURL, req.TaskID, result, err)
+		if err := signature.VerifyRequest(r, body, signature.SigningKey(cfg.NodeKey), nonceCache); err != nil {
+			log.Printf("请求签名校验失败: %s %s: %v", r.Method, r.URL.Path, err)
+			writeJSON(w, http.StatusUnauthorized, Response{Code: 401, Message: "未授权访问"})
+			return
 		}
-	}()
 
-	c.JSON(http.StatusOK, Response{
-		Code:    0,
-		Message: "测速任务已创建",
-		Data: map[string]string{
-			"task_id": req.TaskID,
-		},
+		next.ServeHTTP(w, r)
 	})
 }
 
-// 处理获取测速结果请求
-func handleGetSpeedtestResult(c *gin.Context) {
-	taskID := c.Param("task_id")
-	
-	// 这里应该从存储中获取测速结果
-	// 由于我们是异步执行测速任务，需要一个存储机制来保存结果
-	// 这里简化处理，返回任务不存在
-	c.JSON(http.StatusNotFound, Response{
-		Code:    404,
-		Message: "测速任务不存在或尚未完成",
-	})
+// 写入JSON响应
+func writeJSON(w http.ResponseWriter, status int, resp Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// 处理配置接口，GET获取当前配置，POST更新配置
+func handleConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		handleGetConfig(w, r)
+	case http.MethodPost, http.MethodPut:
+		handleUpdateConfig(w, r)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, Response{Code: 405, Message: "不支持的请求方法"})
+	}
 }
 
 // 处理更新配置请求
-func handleUpdateConfig(c *gin.Context) {
-	var cfg config.Config
-	if err := c.ShouldBindJSON(&cfg); err != nil {
-		c.JSON(http.StatusBadRequest, Response{
-			Code:    400,
-			Message: "无效的配置参数",
-		})
+func handleUpdateConfig(w http.ResponseWriter, r *http.Request) {
+	// 以当前配置为基础，只更新请求中提供的字段
+	cfg := *config.GetConfig()
+	cfg.NodeKey = ""
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Code: 400, Message: "无效的配置参数"})
 		return
 	}
 
-	// 更新配置
-	config.UpdateConfig(cfg)
+	// 校验并应用配置，任一组件应用失败时整体回滚，节点保持原配置运行
+	if err := config.UpdateConfig(cfg); err != nil {
+		if verr, ok := err.(*config.ValidationError); ok {
+			writeJSON(w, http.StatusBadRequest, Response{
+				Code:    400,
+				Message: verr.Error(),
+				Data:    verr.Fields,
+			})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, Response{Code: 500, Message: err.Error()})
+		return
+	}
 
-	c.JSON(http.StatusOK, Response{
-		Code:    0,
-		Message: "配置已更新",
-	})
+	log.Printf("已应用面板下发的配置")
+	writeJSON(w, http.StatusOK, Response{Code: 0, Message: "配置已更新"})
 }
 
 // 处理获取配置请求
-func handleGetConfig(c *gin.Context) {
+func handleGetConfig(w http.ResponseWriter, r *http.Request) {
 	cfg := config.GetConfig()
 
 	// 敏感信息处理
 	cfgCopy := *cfg
-	cfgCopy.NodeKey = "******" // 隐藏节点密钥
+	cfgCopy.NodeKey = config.MaskedNodeKey // 隐藏节点密钥
 
-	c.JSON(http.StatusOK, Response{
-		Code:    0,
-		Message: "成功",
-		Data:    cfgCopy,
-	})
+	writeJSON(w, http.StatusOK, Response{Code: 0, Message: "成功", Data: cfgCopy})
 }
-
-// 发送测速结果回调
-func sendCallback(callbackURL string, taskID string, result *speedtest.Result, err error) {
-	// 准备回调数据
-	callbackData := map[string]interface{}{
-		"task_id": taskID,
-		"success": err == nil,
-	}
-
-	if err != nil {
-		callbackData["error"] = err.Error()
-	} else if result != nil {
-		callbackData["result"] = result
-	}
-
-	// 序列化数据
-	jsonData, err := json.Marshal(callbackData)
-	if err != nil {
-		log.Printf("序列化回调数据失败: %v", err)
-		return
-	}
-
-	// 发送HTTP请求
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	req, err := http.NewRequest("POST", callbackURL, nil)
-	if err != nil {
-		log.Printf("创建回调请求失败: %v", err)
-		return
-	}
-
-	// 设置请求头
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Node-Key", config.GetConfig().NodeKey)
-
-	// 发送请求
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("发送回调请求失败: %v", err)
-		return
-	}
-	defer resp.Body.Close()
-
-	log.Printf("测速结果回调发送成功: %s, 状态码: %d", callbackURL, resp.StatusCode)
-}
-
-// 更新节点状态
-func updateNodeStatus() {
-	// 这里应该实现获取系统资源使用情况的逻辑
-	// 简化处理，使用模拟数据
-	nodeStatus = NodeStatus{
-		NodeName:    config.GetConfig().NodeName,
-		Version:     apiVersion,
-		CPUUsage:    30.5,
-		MemoryUsage: 45.2,
-		DiskUsage:   60.8,
-		Uptime:      int64(time.Since(startTime).Seconds()),
-		StartTime:   startTime,
-	}
-} 
\ No newline at end of file
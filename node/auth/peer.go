@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+)
+
+// PanelCommonName 面板证书的CN，除测速接口外节点只接受持有该证书的连接
+const PanelCommonName = "node-speedtest-panel"
+
+// PeerPathPrefix 其他节点可以访问的路径前缀，节点之间测速时使用
+const PeerPathPrefix = "/speedtest/"
+
+// RequirePanel 限制TLS连接只能由面板访问，其他节点只能访问测速接口。
+// TLS握手接受同一CA签发的任意证书（面板或其他节点），之后按证书CN限制可访问的路径；
+// 测速接口中的下载和上传还需要面板签发的目标令牌，管理接口还需要请求签名
+func RequirePanel(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && !strings.HasPrefix(r.URL.Path, PeerPathPrefix) {
+			certs := r.TLS.PeerCertificates
+			if len(certs) == 0 || certs[0].Subject.CommonName != PanelCommonName {
+				http.Error(w, "只接受面板证书", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
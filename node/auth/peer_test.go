@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequirePanel(t *testing.T) {
+	handler := RequirePanel(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	peer := func(cn string) *tls.ConnectionState {
+		return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: cn}}}}
+	}
+
+	tests := []struct {
+		name string
+		path string
+		tls  *tls.ConnectionState
+		want int
+	}{
+		{name: "未启用TLS", path: "/api/config", want: http.StatusOK},
+		{name: "面板访问管理接口", path: "/api/config", tls: peer(PanelCommonName), want: http.StatusOK},
+		{name: "节点访问管理接口", path: "/api/config", tls: peer("node-2"), want: http.StatusForbidden},
+		{name: "节点访问测速接口", path: "/speedtest/download", tls: peer("node-2"), want: http.StatusOK},
+		{name: "面板访问测速接口", path: "/speedtest/ping", tls: peer(PanelCommonName), want: http.StatusOK},
+		{name: "没有证书", path: "/api/status", tls: &tls.ConnectionState{}, want: http.StatusForbidden},
+		{name: "路径前缀不完整", path: "/speedtest", tls: peer("node-2"), want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.TLS = tt.tls
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("状态码 = %d, 期望 %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
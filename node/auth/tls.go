@@ -0,0 +1,412 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"节点管理测速项目/common/signature"
+	"节点管理测速项目/node/config"
+)
+
+// CertManager 管理节点证书的申请、加载和到期前轮换
+type CertManager struct {
+	dir    string
+	cert   *tls.Certificate
+	caPool *x509.CertPool
+	// 面板在心跳中下发的已吊销证书序列号
+	revoked map[string]bool
+	mutex   sync.RWMutex
+}
+
+// 证书接口响应
+type certificateResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Certificate   string `json:"certificate"`
+		CACertificate string `json:"ca_certificate"`
+	} `json:"data"`
+}
+
+// 创建证书管理器，证书保存在指定目录
+func NewCertManager(dir string) *CertManager {
+	return &CertManager{dir: dir}
+}
+
+func (m *CertManager) certPath() string { return filepath.Join(m.dir, "node.crt") }
+func (m *CertManager) keyPath() string  { return filepath.Join(m.dir, "node.key") }
+func (m *CertManager) caPath() string   { return filepath.Join(m.dir, "ca.crt") }
+
+// Ensure 加载本地证书，不存在或即将过期时向面板申请新证书
+func (m *CertManager) Ensure() error {
+	if err := m.Load(); err != nil {
+		log.Printf("加载节点证书失败，将重新申请: %v", err)
+	}
+
+	if !m.NeedsRenewal() {
+		return nil
+	}
+	return m.Renew()
+}
+
+// NeedsRenewal 判断证书是否缺失或剩余有效期不足三分之一
+func (m *CertManager) NeedsRenewal() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if m.cert == nil || m.cert.Leaf == nil {
+		return true
+	}
+	leaf := m.cert.Leaf
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	return time.Until(leaf.NotAfter) < lifetime/3
+}
+
+// NotAfter 返回当前证书的到期时间，未加载证书时返回零值
+func (m *CertManager) NotAfter() time.Time {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if m.cert == nil || m.cert.Leaf == nil {
+		return time.Time{}
+	}
+	return m.cert.Leaf.NotAfter
+}
+
+// StartRotation 定期检查证书有效期并在到期前续期
+func (m *CertManager) StartRotation(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			if !m.NeedsRenewal() {
+				continue
+			}
+			if err := m.Renew(); err != nil {
+				log.Printf("节点证书续期失败: %v", err)
+			}
+		}
+	}()
+}
+
+// Load 从目录加载证书、私钥和CA
+func (m *CertManager) Load() error {
+	caPEM, err := ioutil.ReadFile(m.caPath())
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("CA证书格式无效")
+	}
+
+	cert, err := tls.LoadX509KeyPair(m.certPath(), m.keyPath())
+	if err != nil {
+		return err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	m.cert = &cert
+	m.caPool = pool
+	m.mutex.Unlock()
+
+	log.Printf("节点证书已加载，有效期至 %s", cert.Leaf.NotAfter.Format("2006-01-02"))
+	return nil
+}
+
+// Renew 生成新私钥并向面板申请证书，成功后立即生效
+func (m *CertManager) Renew() error {
+	cfg := config.GetConfig()
+	if cfg.PanelURL == "" || cfg.NodeID == "" || cfg.NodeKey == "" {
+		return fmt.Errorf("面板URL、节点ID或节点密钥未设置")
+	}
+
+	if err := os.MkdirAll(m.dir, 0700); err != nil {
+		return fmt.Errorf("创建证书目录失败: %v", err)
+	}
+
+	// 首次申请时下载并校验面板CA
+	m.mutex.RLock()
+	hasCA := m.caPool != nil
+	m.mutex.RUnlock()
+	if !hasCA {
+		if err := m.FetchCA(cfg.PanelURL, cfg.PanelCAFingerprint); err != nil {
+			return err
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("生成节点私钥失败: %v", err)
+	}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: cfg.NodeID},
+	}, key)
+	if err != nil {
+		return fmt.Errorf("生成证书请求失败: %v", err)
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"csr": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimRight(cfg.PanelURL, "/")+"/api/node/certificate", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := signature.SignRequest(req, body, cfg.NodeID, signature.SigningKey(cfg.NodeKey)); err != nil {
+		return err
+	}
+
+	// 申请和续期都只依靠请求签名，不出示原证书：过期或已吊销的证书会被面板拒绝握手
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: m.tlsConfig(false)},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("申请节点证书失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result certificateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("解析证书响应失败: %v", err)
+	}
+	if result.Code != 0 {
+		return fmt.Errorf("面板拒绝签发证书: %s", result.Message)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	certPEM := []byte(result.Data.Certificate)
+
+	// 校验返回的证书与私钥匹配后再写入磁盘
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		return fmt.Errorf("面板返回的证书无效: %v", err)
+	}
+	if err := writeFileAtomic(m.keyPath(), keyPEM, 0600); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(m.certPath(), certPEM, 0644); err != nil {
+		return err
+	}
+	if result.Data.CACertificate != "" {
+		if err := writeFileAtomic(m.caPath(), []byte(result.Data.CACertificate), 0644); err != nil {
+			return err
+		}
+	}
+
+	log.Println("节点证书申请成功")
+	return m.Load()
+}
+
+// FetchCA 下载面板CA证书，配置了指纹时必须匹配
+func (m *CertManager) FetchCA(panelURL, fingerprint string) error {
+	// 此时尚未信任任何CA，安全性由指纹校验保证
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	resp, err := client.Get(strings.TrimRight(panelURL, "/") + "/api/ca.crt")
+	if err != nil {
+		return fmt.Errorf("下载面板CA失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("下载面板CA失败，状态码: %d", resp.StatusCode)
+	}
+
+	caPEM, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取面板CA失败: %v", err)
+	}
+
+	block, _ := pem.Decode(caPEM)
+	if block == nil {
+		return fmt.Errorf("面板CA格式无效")
+	}
+	sum := sha256.Sum256(block.Bytes)
+	actual := hex.EncodeToString(sum[:])
+
+	if fingerprint == "" {
+		log.Printf("警告: 未配置面板CA指纹，首次信任面板CA: %s", actual)
+	} else if !strings.EqualFold(strings.ReplaceAll(fingerprint, ":", ""), actual) {
+		return fmt.Errorf("面板CA指纹不匹配，期望 %s，实际 %s", fingerprint, actual)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("面板CA格式无效")
+	}
+	if err := os.MkdirAll(m.dir, 0700); err != nil {
+		return fmt.Errorf("创建证书目录失败: %v", err)
+	}
+	if err := writeFileAtomic(m.caPath(), caPEM, 0644); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	m.caPool = pool
+	m.mutex.Unlock()
+	return nil
+}
+
+// ClientTLSConfig 连接面板时使用的TLS配置，只信任面板CA并出示节点证书，
+// 证书轮换后无需重建配置
+func (m *CertManager) ClientTLSConfig() *tls.Config {
+	return m.tlsConfig(true)
+}
+
+// BootstrapTLSConfig 只校验面板证书、不出示节点证书的TLS配置，用于注册节点
+func (m *CertManager) BootstrapTLSConfig() *tls.Config {
+	return m.tlsConfig(false)
+}
+
+// 连接面板的TLS配置，presentCert为true时出示未过期的节点证书
+func (m *CertManager) tlsConfig(presentCert bool) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// 由VerifyConnection使用当前CA校验，以便CA在运行中加载
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			m.mutex.RLock()
+			pool := m.caPool
+			m.mutex.RUnlock()
+
+			if pool == nil {
+				return fmt.Errorf("尚未获取面板CA")
+			}
+			if len(cs.PeerCertificates) == 0 {
+				return fmt.Errorf("面板未出示证书")
+			}
+
+			opts := x509.VerifyOptions{
+				Roots:         pool,
+				DNSName:       cs.ServerName,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			if _, err := cs.PeerCertificates[0].Verify(opts); err != nil {
+				return err
+			}
+			if m.isRevoked(cs.PeerCertificates[0]) {
+				return fmt.Errorf("对方证书已被吊销")
+			}
+			return nil
+		},
+		// 没有证书或证书已过期时不出示证书，面板仍可校验请求签名
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			m.mutex.RLock()
+			defer m.mutex.RUnlock()
+			if !presentCert || m.cert == nil || m.cert.Leaf == nil || time.Now().After(m.cert.Leaf.NotAfter) {
+				return &tls.Certificate{}, nil
+			}
+			return m.cert, nil
+		},
+	}
+}
+
+// ServerTLSConfig 节点监听使用的TLS配置，要求对方出示同一CA签发的证书，
+// 持有节点证书的连接只能访问测速接口，由RequirePanel限制
+func (m *CertManager) ServerTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// 每次握手使用当前的证书和CA
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			m.mutex.RLock()
+			defer m.mutex.RUnlock()
+
+			if m.cert == nil || m.caPool == nil {
+				return nil, fmt.Errorf("节点证书尚未签发")
+			}
+
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*m.cert},
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				ClientCAs:    m.caPool,
+				// 被删除节点的证书在过期前仍能通过CA校验，按面板下发的吊销列表拒绝
+				VerifyPeerCertificate: func(_ [][]byte, chains [][]*x509.Certificate) error {
+					for _, chain := range chains {
+						if len(chain) > 0 && m.isRevoked(chain[0]) {
+							return fmt.Errorf("证书已被吊销")
+						}
+					}
+					return nil
+				},
+			}, nil
+		},
+	}
+}
+
+// SetRevoked 更新已吊销的证书序列号（十六进制），之后的握手拒绝出示这些证书的节点。
+// 列表只保存在内存中，节点重启后由第一次心跳重新获取
+func (m *CertManager) SetRevoked(serials []string) {
+	revoked := make(map[string]bool, len(serials))
+	for _, serial := range serials {
+		revoked[strings.ToLower(serial)] = true
+	}
+
+	m.mutex.Lock()
+	m.revoked = revoked
+	m.mutex.Unlock()
+}
+
+// 检查证书是否已被面板吊销，序列号格式与面板一致
+func (m *CertManager) isRevoked(cert *x509.Certificate) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.revoked[cert.SerialNumber.Text(16)]
+}
+
+// IsCertificateRejected 判断连接错误是否因面板拒绝节点证书（如证书已被吊销）
+func IsCertificateRejected(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "tls: bad certificate")
+}
+
+// 先写临时文件再重命名，避免证书文件写到一半
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, perm); err != nil {
+		return fmt.Errorf("写入 %s 失败: %v", path, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("保存 %s 失败: %v", path, err)
+	}
+	return nil
+}
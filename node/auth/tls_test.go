@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// 生成测试用的CA和由其签发的证书
+func testCertificates(t *testing.T, serials ...int64) (*x509.CertPool, []*x509.Certificate) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	var certs []*x509.Certificate
+	for _, serial := range serials {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "node"},
+			DNSNames:     []string{"node"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, _ := x509.ParseCertificate(der)
+		certs = append(certs, cert)
+	}
+	return pool, certs
+}
+
+func TestRevokedPeerCertificates(t *testing.T) {
+	pool, certs := testCertificates(t, 0x1a2b, 0x3c4d)
+	m := &CertManager{cert: &tls.Certificate{Leaf: certs[0]}, caPool: pool}
+
+	server, err := m.ServerTLSConfig().GetConfigForClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := m.ClientTLSConfig()
+	verify := func(cert *x509.Certificate) (serverErr, clientErr error) {
+		serverErr = server.VerifyPeerCertificate(nil, [][]*x509.Certificate{{cert}})
+		clientErr = client.VerifyConnection(tls.ConnectionState{
+			ServerName:       "node",
+			PeerCertificates: []*x509.Certificate{cert},
+		})
+		return
+	}
+
+	// 面板下发吊销列表之前两个证书都有效
+	for _, cert := range certs {
+		if serverErr, clientErr := verify(cert); serverErr != nil || clientErr != nil {
+			t.Fatalf("证书 %x: server=%v client=%v", cert.SerialNumber, serverErr, clientErr)
+		}
+	}
+
+	// 序列号按十六进制比较，不区分大小写
+	m.SetRevoked([]string{"3C4D"})
+	if serverErr, clientErr := verify(certs[0]); serverErr != nil || clientErr != nil {
+		t.Errorf("未吊销的证书被拒绝: server=%v client=%v", serverErr, clientErr)
+	}
+	if serverErr, clientErr := verify(certs[1]); serverErr == nil || clientErr == nil {
+		t.Errorf("已吊销的证书被接受: server=%v client=%v", serverErr, clientErr)
+	}
+
+	// 新的列表替换旧的列表，例如证书过期后面板不再下发
+	m.SetRevoked([]string{})
+	if serverErr, clientErr := verify(certs[1]); serverErr != nil || clientErr != nil {
+		t.Errorf("不在吊销列表中的证书被拒绝: server=%v client=%v", serverErr, clientErr)
+	}
+}
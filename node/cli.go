@@ -0,0 +1,558 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"节点管理测速项目/node/auth"
+	"节点管理测速项目/node/config"
+	"节点管理测速项目/node/speedtest"
+	"节点管理测速项目/node/update"
+)
+
+// 命令行子命令，供现场排查时在没有面板的情况下使用
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands = []command{
+	{"test", "在本机执行一次测速并输出结果，不上报面板", runTestCommand},
+	{"status", "查看节点凭据、本地服务、面板连接、证书和待上报结果", runStatusCommand},
+	{"config", "校验配置文件，列出所有无效的配置项", runConfigCommand},
+	{"enroll", "使用注册令牌注册节点并写入配置文件", runEnrollCommand},
+}
+
+// 执行子命令并返回进程退出码
+func runCommand(name string, args []string) int {
+	// 子命令的输出只写到终端，运行日志默认不显示
+	log.SetOutput(ioutil.Discard)
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(args)
+		}
+	}
+
+	if name != "help" {
+		fmt.Fprintf(os.Stderr, "未知的子命令: %s\n\n", name)
+	}
+	printCommandUsage()
+	if name != "help" {
+		return 2
+	}
+	return 0
+}
+
+// 打印子命令用法
+func printCommandUsage() {
+	fmt.Fprintln(os.Stderr, "用法: node-speedtest [-config 配置文件] [参数]    启动节点服务")
+	fmt.Fprintln(os.Stderr, "      node-speedtest <子命令> [参数]")
+	fmt.Fprintln(os.Stderr, "\n子命令:")
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	w.Flush()
+	fmt.Fprintln(os.Stderr, "\n所有子命令均支持 -config 参数，使用 node-speedtest <子命令> -h 查看详细参数")
+}
+
+// 创建子命令参数集，统一添加 -config 参数
+func newCommandFlags(name, usage string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	configPath := fs.String("config", "config.json", "配置文件路径")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "用法: node-speedtest %s\n\n", usage)
+		fs.PrintDefaults()
+	}
+	return fs, configPath
+}
+
+// 加载配置，配置文件不存在时只使用默认值和环境变量，不创建文件
+func loadCommandConfig(path string) (*config.Config, error) {
+	if _, err := os.Stat(path); err == nil {
+		config.SetConfigPath(path)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err := config.Load(); err != nil {
+		return nil, err
+	}
+	return config.GetConfig(), nil
+}
+
+// 以缩进格式输出JSON
+func printJSON(v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "序列化输出失败: %v\n", err)
+		return
+	}
+	fmt.Println(string(data))
+}
+
+// test 子命令：直接调用测速管理器执行测试
+func runTestCommand(args []string) int {
+	fs, configPath := newCommandFlags("test", "test --type download --target URL [--threads N] [--timeout 秒] [--json]")
+	testType := fs.String("type", "download", "测试类型: download, upload, ping, full")
+	target := fs.String("target", "", "测试目标URL，为空时使用面板的测速接口")
+	threads := fs.Int("threads", 0, "线程数，为0时使用配置中的线程数")
+	timeout := fs.Int("timeout", 0, "超时时间（秒），为0时使用 speedtest_timeout")
+	jsonOutput := fs.Bool("json", false, "以JSON格式输出结果")
+	verbose := fs.Bool("verbose", false, "将运行日志输出到标准错误")
+	fs.Parse(args)
+
+	if *verbose {
+		log.SetOutput(os.Stderr)
+	}
+
+	cfg, err := loadCommandConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "加载配置失败: %v\n", err)
+		return 1
+	}
+
+	req := speedtest.SpeedTestRequest{
+		ID:           fmt.Sprintf("cli-%d", time.Now().UnixNano()),
+		SourceNodeID: cfg.NodeID,
+		TargetURL:    *target,
+		Type:         speedtest.SpeedTestType(*testType),
+		Timeout:      *timeout,
+		Threads:      *threads,
+	}
+	switch req.Type {
+	case speedtest.TypeDownload, speedtest.TypeFull:
+		if req.Threads == 0 {
+			req.Threads = cfg.DownloadThreads
+		}
+	case speedtest.TypeUpload:
+		if req.Threads == 0 {
+			req.Threads = cfg.UploadThreads
+		}
+	case speedtest.TypePing:
+	default:
+		fmt.Fprintf(os.Stderr, "无效的测试类型: %s\n", *testType)
+		return 2
+	}
+	if req.Timeout == 0 {
+		req.Timeout = cfg.SpeedtestTimeout
+	}
+	if req.TargetURL == "" && cfg.PanelURL == "" {
+		fmt.Fprintln(os.Stderr, "未指定 --target，且配置中没有面板地址")
+		return 2
+	}
+
+	if !*jsonOutput {
+		targetName := req.TargetURL
+		if targetName == "" {
+			targetName = cfg.PanelURL + "（面板）"
+		}
+		fmt.Printf("正在执行%s测试: %s\n", req.Type, targetName)
+	}
+
+	manager := speedtest.NewSpeedTestManager(cfg.PanelURL, cfg.NodeID, cfg.NodeKey)
+	result := manager.RunLocal(req)
+
+	if *jsonOutput {
+		printJSON(result)
+	} else {
+		printTestResult(result)
+	}
+
+	if result.Status != speedtest.StatusCompleted {
+		return 1
+	}
+	return 0
+}
+
+// 以表格形式输出测速结果
+func printTestResult(r speedtest.SpeedTestResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "状态\t%s\n", r.Status)
+	if r.Type == speedtest.TypePing || r.Type == speedtest.TypeFull {
+		fmt.Fprintf(w, "延迟\t%.2f ms\n", r.Ping)
+		fmt.Fprintf(w, "抖动\t%.2f ms\n", r.Jitter)
+		fmt.Fprintf(w, "丢包率\t%.1f%%\n", r.PacketLoss)
+	}
+	if r.Type == speedtest.TypeDownload || r.Type == speedtest.TypeFull {
+		fmt.Fprintf(w, "下载速度\t%.2f Mbps\n", r.DownloadSpeed)
+	}
+	if r.Type == speedtest.TypeUpload || r.Type == speedtest.TypeFull {
+		fmt.Fprintf(w, "上传速度\t%.2f Mbps\n", r.UploadSpeed)
+	}
+	fmt.Fprintf(w, "耗时\t%v\n", time.Duration(r.Duration)*time.Millisecond)
+	if r.Error != "" {
+		fmt.Fprintf(w, "错误\t%s\n", r.Error)
+	}
+	w.Flush()
+}
+
+// 节点状态，status 子命令的输出
+type nodeStatus struct {
+	Version           string    `json:"version"`
+	ConfigPath        string    `json:"config_path"`
+	NodeID            string    `json:"node_id"`
+	NodeName          string    `json:"node_name"`
+	PanelURL          string    `json:"panel_url"`
+	Service           string    `json:"service"`                      // 本地服务状态
+	Panel             string    `json:"panel"`                        // 面板连接和认证状态
+	TLSEnabled        bool      `json:"tls_enabled"`                  // 是否启用双向TLS
+	CertificateExpiry time.Time `json:"certificate_expiry,omitempty"` // 节点证书到期时间
+	Certificate       string    `json:"certificate,omitempty"`        // 节点证书状态
+	PendingResults    int       `json:"pending_results"`              // 待上报的测试结果数量
+	UpdateStatus      string    `json:"update_status"`                // 最近一次自动更新的结果
+	FailedVersion     string    `json:"failed_version"`               // 回滚过的版本
+	OK                bool      `json:"ok"`                           // 本地服务和面板连接均正常
+}
+
+// status 子命令：检查本地服务和面板连接，汇总本地状态
+func runStatusCommand(args []string) int {
+	fs, configPath := newCommandFlags("status", "status [--json]")
+	jsonOutput := fs.Bool("json", false, "以JSON格式输出")
+	fs.Parse(args)
+
+	cfg, err := loadCommandConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "加载配置失败: %v\n", err)
+		return 1
+	}
+
+	status := nodeStatus{
+		Version:    version,
+		ConfigPath: *configPath,
+		NodeID:     cfg.NodeID,
+		NodeName:   cfg.NodeName,
+		PanelURL:   cfg.PanelURL,
+		TLSEnabled: cfg.TLSEnabled,
+	}
+
+	// 启用TLS时加载本地证书，用于连接面板
+	if cfg.TLSEnabled {
+		certManager := auth.NewCertManager(filepath.Join(cfg.DataDir, "tls"))
+		if err := certManager.Load(); err != nil {
+			status.Certificate = fmt.Sprintf("无法加载: %v", err)
+		} else {
+			status.CertificateExpiry = certManager.NotAfter()
+			status.Certificate = "有效"
+			if certManager.NeedsRenewal() {
+				status.Certificate = "即将到期，等待续期"
+			}
+			panelTLS = certManager.ClientTLSConfig()
+		}
+	}
+
+	// 心跳会上报自动更新状态，需先读取以免覆盖面板上的记录
+	if u, err := update.NewUpdater(version, cfg.DataDir, nil); err == nil {
+		updater = u
+		status.UpdateStatus, status.FailedVersion = u.Status()
+	}
+
+	status.Service = checkLocalService(cfg)
+	status.Panel = checkPanel()
+	status.PendingResults = speedtest.NewOutbox(cfg.DataDir).Len()
+	status.OK = status.Service == "运行中" && status.Panel == "正常"
+
+	if *jsonOutput {
+		printJSON(status)
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "版本\t%s\n", status.Version)
+		fmt.Fprintf(w, "配置文件\t%s\n", status.ConfigPath)
+		fmt.Fprintf(w, "节点ID\t%s\n", status.NodeID)
+		fmt.Fprintf(w, "节点名称\t%s\n", status.NodeName)
+		fmt.Fprintf(w, "面板地址\t%s\n", status.PanelURL)
+		fmt.Fprintf(w, "本地服务\t%s\n", status.Service)
+		fmt.Fprintf(w, "面板连接\t%s\n", status.Panel)
+		if status.TLSEnabled {
+			if status.CertificateExpiry.IsZero() {
+				fmt.Fprintf(w, "节点证书\t%s\n", status.Certificate)
+			} else {
+				fmt.Fprintf(w, "节点证书\t%s，有效期至 %s\n", status.Certificate, status.CertificateExpiry.Format("2006-01-02 15:04"))
+			}
+		}
+		fmt.Fprintf(w, "待上报结果\t%d\n", status.PendingResults)
+		if status.UpdateStatus != "" {
+			fmt.Fprintf(w, "自动更新\t%s\n", status.UpdateStatus)
+		}
+		w.Flush()
+	}
+
+	if !status.OK {
+		return 1
+	}
+	return 0
+}
+
+// 检查本地节点服务是否在运行
+func checkLocalService(cfg *config.Config) string {
+	address := net.JoinHostPort("127.0.0.1", cfg.ListenPort)
+
+	// 启用TLS时节点服务只接受面板证书，只检查端口是否在监听
+	if cfg.TLSEnabled {
+		conn, err := net.DialTimeout("tcp", address, 3*time.Second)
+		if err != nil {
+			return fmt.Sprintf("未运行: %v", err)
+		}
+		conn.Close()
+		return "运行中"
+	}
+
+	client := &http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Get("http://" + address + "/api/status")
+	if err != nil {
+		return fmt.Sprintf("未运行: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Sprintf("响应异常: %v", err)
+	}
+	if result.Version != version {
+		return fmt.Sprintf("运行中（版本 %s）", result.Version)
+	}
+	return "运行中"
+}
+
+// 发送一次心跳，检查面板是否可达以及节点凭据是否有效
+func checkPanel() string {
+	// 使用ping接口检查，不会更新节点状态或领取测试
+	resp, err := panelRequest("POST", "/api/node/ping", []byte("{}"), 10*time.Second)
+	if err != nil {
+		return fmt.Sprintf("无法连接: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "面板版本过旧，不支持连通性检查"
+	default:
+		return fmt.Sprintf("响应状态码异常: %d", resp.StatusCode)
+	}
+
+	// 面板的错误以响应中的code返回
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Sprintf("响应异常: %v", err)
+	}
+	switch result.Code {
+	case 0:
+		return "正常"
+	case 401:
+		return "认证失败，请检查节点ID和密钥"
+	case 404:
+		return "面板上不存在该节点"
+	default:
+		return fmt.Sprintf("面板返回错误: %s", result.Message)
+	}
+}
+
+// config 子命令，目前只有 validate
+func runConfigCommand(args []string) int {
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Fprintln(os.Stderr, "用法: node-speedtest config validate [--json]")
+		return 2
+	}
+
+	fs, configPath := newCommandFlags("config", "config validate [--json]")
+	jsonOutput := fs.Bool("json", false, "以JSON格式输出")
+	fs.Parse(args[1:])
+
+	var fields []config.FieldError
+	if _, err := os.Stat(*configPath); err != nil {
+		fields = append(fields, config.FieldError{Field: "config", Message: fmt.Sprintf("无法读取配置文件: %v", err)})
+	} else if data, err := ioutil.ReadFile(*configPath); err != nil {
+		fields = append(fields, config.FieldError{Field: "config", Message: fmt.Sprintf("无法读取配置文件: %v", err)})
+	} else if err := json.Unmarshal(data, &config.Config{}); err != nil {
+		// 节点服务在配置文件无法解析时会使用默认配置，这里直接报错
+		fields = append(fields, config.FieldError{Field: "config", Message: fmt.Sprintf("配置文件格式错误: %v", err)})
+	} else {
+		fields = validateConfig(*configPath)
+	}
+
+	if *jsonOutput {
+		if fields == nil {
+			fields = []config.FieldError{}
+		}
+		printJSON(map[string]interface{}{
+			"valid":  len(fields) == 0,
+			"errors": fields,
+		})
+	} else if len(fields) == 0 {
+		fmt.Printf("配置有效: %s\n", *configPath)
+	} else {
+		fmt.Printf("配置无效: %s\n", *configPath)
+		for _, f := range fields {
+			fmt.Printf("  %s: %s\n", f.Field, f.Message)
+		}
+	}
+
+	if len(fields) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// 加载配置并校验所有配置项和本地定时任务
+func validateConfig(path string) []config.FieldError {
+	cfg, err := loadCommandConfig(path)
+	if err != nil {
+		return []config.FieldError{{Field: "config", Message: err.Error()}}
+	}
+
+	var fields []config.FieldError
+	if err := cfg.Validate(); err != nil {
+		if verr, ok := err.(*config.ValidationError); ok {
+			fields = append(fields, verr.Fields...)
+		} else {
+			fields = append(fields, config.FieldError{Field: "config", Message: err.Error()})
+		}
+	}
+	return fields
+}
+
+// enroll 子命令：使用注册令牌换取节点凭据并写入配置文件
+func runEnrollCommand(args []string) int {
+	fs, configPath := newCommandFlags("enroll", "enroll --panel URL --token et_... [--name 名称] [--ca-fingerprint 指纹]")
+	panelURL := fs.String("panel", "", "面板地址")
+	token := fs.String("token", "", "注册令牌（et_ 开头）")
+	name := fs.String("name", "", "节点名称，令牌未预设名称时使用，默认为主机名")
+	fingerprint := fs.String("ca-fingerprint", "", "面板CA指纹，设置后启用双向TLS")
+	force := fs.Bool("force", false, "配置中已有节点凭据时仍然重新注册")
+	fs.Parse(args)
+
+	if *token == "" {
+		fs.Usage()
+		return 2
+	}
+	if !strings.HasPrefix(*token, "et_") {
+		fmt.Fprintln(os.Stderr, "注册令牌应以 et_ 开头")
+		return 2
+	}
+
+	// 注册需要写入配置文件，文件不存在时创建
+	config.SetConfigPath(*configPath)
+	if err := config.Load(); err != nil {
+		fmt.Fprintf(os.Stderr, "加载配置失败: %v\n", err)
+		return 1
+	}
+	newConfig := *config.GetConfig()
+
+	if newConfig.NodeID != "" && !*force {
+		fmt.Fprintf(os.Stderr, "配置中已有节点ID %s，如需重新注册请使用 --force\n", newConfig.NodeID)
+		return 1
+	}
+	if *panelURL != "" {
+		newConfig.PanelURL = strings.TrimRight(*panelURL, "/")
+	}
+	if newConfig.PanelURL == "" {
+		fmt.Fprintln(os.Stderr, "未指定 --panel，且配置中没有面板地址")
+		return 2
+	}
+
+	hostname := *name
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	credentials, err := enrollNode(newConfig.PanelURL, *token, hostname, *fingerprint, newConfig.DataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "节点注册失败: %v\n", err)
+		return 1
+	}
+
+	newConfig.NodeID = credentials.NodeID
+	newConfig.NodeKey = credentials.NodeKey
+	newConfig.NodeName = credentials.NodeName
+	if *fingerprint == "" {
+		*fingerprint = credentials.CAFingerprint
+	}
+	if *fingerprint != "" {
+		newConfig.TLSEnabled = true
+		newConfig.PanelCAFingerprint = *fingerprint
+	}
+
+	if err := config.SaveEnrollment(newConfig); err != nil {
+		fmt.Fprintf(os.Stderr, "保存配置失败: %v\n", err)
+		fmt.Fprintf(os.Stderr, "节点已在面板注册，请手动写入配置: node_id=%s node_key=%s\n", credentials.NodeID, credentials.NodeKey)
+		return 1
+	}
+	// 配置文件包含节点密钥，只允许所有者读写
+	if err := os.Chmod(*configPath, 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "设置配置文件权限失败: %v\n", err)
+	}
+
+	fmt.Printf("节点注册成功\n节点ID: %s\n节点名称: %s\n配置已写入 %s，重启节点服务后生效\n",
+		credentials.NodeID, credentials.NodeName, *configPath)
+	return 0
+}
+
+// 面板注册接口返回的节点凭据
+type enrollCredentials struct {
+	NodeID        string `json:"node_id"`
+	NodeKey       string `json:"node_key"`
+	NodeName      string `json:"node_name"`
+	CAFingerprint string `json:"ca_fingerprint"`
+}
+
+// 调用面板注册接口。面板启用TLS时证书由内置CA签发，提供CA指纹时先下载并校验CA，
+// 注册请求只信任该CA
+func enrollNode(panelURL, token, hostname, fingerprint, dataDir string) (*enrollCredentials, error) {
+	body, err := json.Marshal(map[string]string{
+		"token":    token,
+		"hostname": hostname,
+		"version":  version,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	if fingerprint != "" && strings.HasPrefix(panelURL, "https://") {
+		certManager := auth.NewCertManager(filepath.Join(dataDir, "tls"))
+		if err := certManager.FetchCA(panelURL, fingerprint); err != nil {
+			return nil, err
+		}
+		client.Transport = &http.Transport{TLSClientConfig: certManager.BootstrapTLSConfig()}
+	}
+	resp, err := client.Post(panelURL+"/api/enroll", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Code    int               `json:"code"`
+		Message string            `json:"message"`
+		Data    enrollCredentials `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("解析面板响应失败（状态码 %d）: %v", resp.StatusCode, err)
+	}
+	if result.Code != 0 {
+		return nil, fmt.Errorf("%s", result.Message)
+	}
+	if result.Data.NodeID == "" || result.Data.NodeKey == "" {
+		return nil, fmt.Errorf("面板未返回节点凭据")
+	}
+	return &result.Data, nil
+}
@@ -1,11 +1,20 @@
 package config
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+
+	"节点管理测速项目/common/cron"
+	"节点管理测速项目/node/speedtest"
 )
 
 // Config 表示节点的配置结构
@@ -13,6 +22,7 @@ type Config struct {
 	// 基本配置
 	ListenPort   string `json:"listen_port"`    // 监听端口
 	PanelURL     string `json:"panel_url"`      // 面板URL
+	NodeID       string `json:"node_id"`        // 节点ID
 	NodeKey      string `json:"node_key"`       // 节点密钥
 	NodeName     string `json:"node_name"`      // 节点名称
 	LogPath      string `json:"log_path"`       // 日志路径
@@ -26,6 +36,76 @@ type Config struct {
 	DownloadThreads  int `json:"download_threads"`    // 下载测试线程数
 	UploadThreads    int `json:"upload_threads"`      // 上传测试线程数
 	PingCount        int `json:"ping_count"`          // Ping测试次数
+
+	// 关闭配置
+	ShutdownTimeout int `json:"shutdown_timeout"` // 关闭时等待运行中测试完成的时间（秒），超时后取消
+
+	// TLS配置
+	TLSEnabled         bool   `json:"tls_enabled"`          // 是否启用与面板的双向TLS
+	PanelCAFingerprint string `json:"panel_ca_fingerprint"` // 面板CA证书的SHA-256指纹
+
+	// 自动更新配置
+	UpdatePublicKey       string `json:"update_public_key"`       // 发布清单的ed25519公钥（Base64），为空时不自动更新
+	UpdateRollbackTimeout int    `json:"update_rollback_timeout"` // 新版本需在该时间内完成心跳，否则回滚（秒）
+
+	// 监控配置
+	MetricsPort string `json:"metrics_port"` // 单独提供 /metrics 的端口，为空时使用监听端口
+
+	// 本地定时任务（面板不可达时仍会执行）
+	Schedules []ScheduleJob `json:"schedules"`
+}
+
+// ScheduleJob 表示节点本地定时测速任务
+type ScheduleJob struct {
+	Name         string `json:"name"`           // 任务名称
+	Target       string `json:"target"`         // 测试目标URL
+	TargetNodeID string `json:"target_node_id"` // 目标节点ID（可选，用于面板归档）
+	Type         string `json:"type"`           // 测试类型: download, upload, ping, full
+	Cron         string `json:"cron"`           // Cron表达式（分 时 日 月 周）
+	Timeout      int    `json:"timeout"`        // 超时时间（秒），为0时使用speedtest_timeout
+}
+
+// Validate 检查定时任务的测试目标、类型和Cron表达式，返回无效的字段。
+// 任务名称的唯一性由 Config.Validate 检查
+func (j ScheduleJob) Validate() []FieldError {
+	var fields []FieldError
+	if j.Target == "" {
+		fields = append(fields, FieldError{Field: "target", Message: "不能为空"})
+	}
+	switch speedtest.SpeedTestType(j.Type) {
+	case speedtest.TypeDownload, speedtest.TypeUpload, speedtest.TypePing, speedtest.TypeFull:
+	default:
+		fields = append(fields, FieldError{Field: "type", Message: fmt.Sprintf("应为 download、upload、ping 或 full，当前为 %q", j.Type)})
+	}
+	if _, err := cron.Parse(j.Cron); err != nil {
+		fields = append(fields, FieldError{Field: "cron", Message: err.Error()})
+	}
+	return fields
+}
+
+// MaskedNodeKey 对外展示时替代节点密钥的占位符
+const MaskedNodeKey = "******"
+
+// ChangeFunc 配置变更回调，返回错误时本次变更将被回滚
+type ChangeFunc func(oldCfg, newCfg *Config) error
+
+// FieldError 表示单个配置字段的校验错误
+type FieldError struct {
+	Field   string `json:"field"`   // 字段名
+	Message string `json:"message"` // 错误说明
+}
+
+// ValidationError 汇总配置校验失败的所有字段
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", f.Field, f.Message))
+	}
+	return "配置校验失败: " + strings.Join(msgs, "; ")
 }
 
 var (
@@ -33,6 +113,11 @@ var (
 	once   sync.Once
 	mu     sync.RWMutex
 	configPath string
+	loadErr    error
+
+	// 串行化配置变更，保证回调按顺序执行
+	applyMu   sync.Mutex
+	listeners []ChangeFunc
 )
 
 // SetConfigPath 设置配置文件路径
@@ -40,27 +125,47 @@ func SetConfigPath(path string) {
 	configPath = path
 }
 
+// 默认配置
+func defaultConfig() *Config {
+	return &Config{
+		ListenPort:        "8081",
+		PanelURL:          "",
+		NodeID:            "",
+		NodeKey:           "",
+		NodeName:          "",
+		LogPath:           "./node.log",
+		DataDir:           "./data",
+		HeartbeatInterval: 30,
+		SpeedtestTimeout:  120,
+		DownloadThreads:   4,
+		UploadThreads:     2,
+		PingCount:         10,
+		ShutdownTimeout:   30,
+
+		UpdateRollbackTimeout: 120,
+	}
+}
+
 // GetConfig 获取配置单例
 func GetConfig() *Config {
 	once.Do(func() {
-		config = &Config{
-			// 默认配置
-			ListenPort:        "8081",
-			PanelURL:          "",
-			NodeKey:           "",
-			NodeName:          "",
-			LogPath:           "./node.log",
-			DataDir:           "./data",
-			HeartbeatInterval: 30,
-			SpeedtestTimeout:  120,
-			DownloadThreads:   4,
-			UploadThreads:     2,
-			PingCount:         10,
-		}
+		config = defaultConfig()
+		sources = newSources()
 		
-		// 尝试从文件加载配置
+		// 尝试从文件加载配置，文件无法读取或格式错误时不再继续
 		if configPath != "" {
-			loadConfig()
+			if loadErr = loadConfig(); loadErr != nil {
+				log.Printf("加载配置文件失败: %v", loadErr)
+				return
+			}
+		}
+
+		// 环境变量和命令行参数优先于配置文件
+		mu.Lock()
+		loadErr = applyOverrides(config, sources)
+		mu.Unlock()
+		if loadErr != nil {
+			log.Printf("应用配置覆盖失败: %v", loadErr)
 		}
 	})
 	
@@ -69,8 +174,14 @@ func GetConfig() *Config {
 	return config
 }
 
+// Load 初始化配置并返回配置文件、环境变量或命令行参数中的错误
+func Load() error {
+	GetConfig()
+	return loadErr
+}
+
 // 从文件加载配置
-func loadConfig() {
+func loadConfig() error {
 	mu.Lock()
 	defer mu.Unlock()
 	
@@ -78,23 +189,23 @@ func loadConfig() {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		// 配置文件不存在，创建默认配置
 		saveConfig()
-		return
+		return nil
 	}
 	
 	// 读取配置文件
 	data, err := ioutil.ReadFile(configPath)
 	if err != nil {
-		log.Printf("读取配置文件失败: %v，将使用默认配置", err)
-		return
+		return fmt.Errorf("读取配置文件失败: %v", err)
 	}
 	
 	// 解析配置
 	if err := json.Unmarshal(data, config); err != nil {
-		log.Printf("解析配置文件失败: %v，将使用默认配置", err)
-		return
+		return fmt.Errorf("解析配置文件 %s 失败: %v", configPath, err)
 	}
+	markFileSources(data, sources)
 	
 	log.Printf("成功从 %s 加载配置", configPath)
+	return nil
 }
 
 // SaveConfig 保存配置到文件
@@ -105,43 +216,270 @@ func SaveConfig() error {
 	return saveConfig()
 }
 
-// UpdateConfig 更新配置
-func UpdateConfig(newConfig Config) {
+// OnChange 注册配置变更回调，运行中的组件借此热更新
+func OnChange(fn ChangeFunc) {
+	applyMu.Lock()
+	defer applyMu.Unlock()
+
+	listeners = append(listeners, fn)
+}
+
+// Validate 校验配置，返回包含所有无效字段的错误
+func (c *Config) Validate() error {
+	var fields []FieldError
+	addError := func(field, format string, args ...interface{}) {
+		fields = append(fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	checkRange := func(field string, value, min, max int) {
+		if value < min || value > max {
+			addError(field, "取值应在 %d-%d 之间，当前为 %d", min, max, value)
+		}
+	}
+
+	if port, err := strconv.Atoi(c.ListenPort); err != nil || port < 1 || port > 65535 {
+		addError("listen_port", "应为 1-65535 之间的端口号，当前为 %q", c.ListenPort)
+	}
+
+	if c.MetricsPort != "" {
+		if port, err := strconv.Atoi(c.MetricsPort); err != nil || port < 1 || port > 65535 {
+			addError("metrics_port", "应为 1-65535 之间的端口号，当前为 %q", c.MetricsPort)
+		} else if c.MetricsPort == c.ListenPort {
+			addError("metrics_port", "不能与 listen_port 相同，使用监听端口时留空即可")
+		}
+	}
+
+	if c.PanelURL != "" {
+		u, err := url.Parse(c.PanelURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			addError("panel_url", "应为 http:// 或 https:// 开头的完整地址，当前为 %q", c.PanelURL)
+		}
+	}
+
+	if c.TLSEnabled && !strings.HasPrefix(c.PanelURL, "https://") {
+		addError("tls_enabled", "启用TLS时 panel_url 必须以 https:// 开头")
+	}
+
+	if strings.ContainsAny(c.NodeKey, " \t\r\n") {
+		addError("node_key", "不能包含空白字符")
+	}
+	if len(c.NodeName) > 64 {
+		addError("node_name", "长度不能超过 64 个字符")
+	}
+	if c.LogPath == "" {
+		addError("log_path", "不能为空")
+	}
+	if c.DataDir == "" {
+		addError("data_dir", "不能为空")
+	}
+
+	checkRange("heartbeat_interval", c.HeartbeatInterval, 10, 3600)
+	checkRange("speedtest_timeout", c.SpeedtestTimeout, 10, 3600)
+	checkRange("download_threads", c.DownloadThreads, 1, 64)
+	checkRange("upload_threads", c.UploadThreads, 1, 64)
+	checkRange("ping_count", c.PingCount, 1, 1000)
+	checkRange("shutdown_timeout", c.ShutdownTimeout, 1, 600)
+	checkRange("update_rollback_timeout", c.UpdateRollbackTimeout, 30, 3600)
+
+	if c.UpdatePublicKey != "" {
+		if key, err := base64.StdEncoding.DecodeString(c.UpdatePublicKey); err != nil || len(key) != 32 {
+			addError("update_public_key", "应为Base64编码的ed25519公钥")
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, job := range c.Schedules {
+		prefix := fmt.Sprintf("schedules[%d].", i)
+		if job.Name == "" {
+			addError(prefix+"name", "不能为空")
+		} else if names[job.Name] {
+			addError(prefix+"name", "任务名称重复: %s", job.Name)
+		}
+		names[job.Name] = true
+		for _, f := range job.Validate() {
+			addError(prefix+f.Field, "%s", f.Message)
+		}
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// UpdateConfig 校验并应用新配置，成功后保存到文件。
+// 节点ID用于签名、证书和测速结果，运行中的组件不会切换，因此不能通过该接口修改
+func UpdateConfig(newConfig Config) error {
+	mu.RLock()
+	currentID := config.NodeID
+	mu.RUnlock()
+
+	if currentID != "" && newConfig.NodeID != "" && newConfig.NodeID != currentID {
+		return &ValidationError{Fields: []FieldError{{Field: "node_id", Message: "运行中不能修改，请修改配置文件后重启节点"}}}
+	}
+	return updateConfig(newConfig)
+}
+
+// SaveEnrollment 保存注册获得的节点凭据，允许替换节点ID，新的节点ID在节点服务重启后生效
+func SaveEnrollment(newConfig Config) error {
+	return updateConfig(newConfig)
+}
+
+// 应用并保存新配置，未提供的节点ID和密钥沿用当前值
+func updateConfig(newConfig Config) error {
+	mu.RLock()
+	current := *config
+	mu.RUnlock()
+
+	// 未提供或为占位符时保留原节点ID和密钥
+	if newConfig.NodeKey == "" || newConfig.NodeKey == MaskedNodeKey {
+		newConfig.NodeKey = current.NodeKey
+	}
+	if newConfig.NodeID == "" {
+		newConfig.NodeID = current.NodeID
+	}
+	// 发布公钥是自动更新的信任根，不能由提供清单和程序的面板修改，只能通过配置文件、环境变量或命令行参数设置
+	newConfig.UpdatePublicKey = current.UpdatePublicKey
+
+	oldConfig, err := applyConfig(newConfig)
+	if err != nil {
+		return err
+	}
+
 	mu.Lock()
-	defer mu.Unlock()
-	
-	// 更新配置
-	config.ListenPort = newConfig.ListenPort
-	config.PanelURL = newConfig.PanelURL
-	config.NodeKey = newConfig.NodeKey
-	config.NodeName = newConfig.NodeName
-	config.LogPath = newConfig.LogPath
-	config.DataDir = newConfig.DataDir
-	config.HeartbeatInterval = newConfig.HeartbeatInterval
-	config.SpeedtestTimeout = newConfig.SpeedtestTimeout
-	config.DownloadThreads = newConfig.DownloadThreads
-	config.UploadThreads = newConfig.UploadThreads
-	config.PingCount = newConfig.PingCount
-	
-	// 保存到文件
-	saveConfig()
+	markChangedSources(&oldConfig, &newConfig, SourceAPI)
+	mu.Unlock()
+
+	return SaveConfig()
 }
 
-// 保存配置到文件（内部使用，已加锁）
+// Reload 从配置文件重新加载并应用配置，失败时保持当前配置
+func Reload() error {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %v", err)
+	}
+
+	// 按默认值、配置文件、环境变量、命令行参数的顺序重新构建
+	newConfig := defaultConfig()
+	newSources := newSources()
+	if err := json.Unmarshal(data, newConfig); err != nil {
+		return fmt.Errorf("解析配置文件失败: %v", err)
+	}
+	markFileSources(data, newSources)
+	if err := applyOverrides(newConfig, newSources); err != nil {
+		return err
+	}
+
+	// 节点ID只在重启后生效
+	mu.RLock()
+	currentID := config.NodeID
+	mu.RUnlock()
+	if currentID != "" && newConfig.NodeID != currentID {
+		log.Printf("节点ID已修改为 %s，重启节点后生效，当前继续使用 %s", newConfig.NodeID, currentID)
+		newConfig.NodeID = currentID
+	}
+
+	if _, err := applyConfig(*newConfig); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	sources = newSources
+	mu.Unlock()
+
+	log.Printf("成功从 %s 重新加载配置", configPath)
+	return nil
+}
+
+// 应用新配置并通知各组件，任一组件失败时回滚所有已应用的变更，成功时返回旧配置
+func applyConfig(newConfig Config) (Config, error) {
+	applyMu.Lock()
+	defer applyMu.Unlock()
+
+	if err := newConfig.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	mu.Lock()
+	oldConfig := *config
+	*config = newConfig
+	mu.Unlock()
+
+	for i, fn := range listeners {
+		if err := fn(&oldConfig, &newConfig); err != nil {
+			log.Printf("应用配置失败，开始回滚: %v", err)
+
+			mu.Lock()
+			*config = oldConfig
+			mu.Unlock()
+
+			for j := i - 1; j >= 0; j-- {
+				if rerr := listeners[j](&newConfig, &oldConfig); rerr != nil {
+					log.Printf("回滚配置失败: %v", rerr)
+				}
+			}
+
+			return Config{}, fmt.Errorf("应用配置失败，已回滚: %v", err)
+		}
+	}
+
+	return oldConfig, nil
+}
+
+// 保存配置到文件（内部使用，已加锁）。只写入默认值、配置文件和面板下发的配置项，
+// 环境变量和命令行参数的覆盖值不写回文件，文件中原有的值保持不变
 func saveConfig() error {
-	// 将配置序列化为JSON
-	data, err := json.MarshalIndent(config, "", "  ")
+	var fileValues map[string]json.RawMessage
+	if data, err := ioutil.ReadFile(configPath); err == nil {
+		if err := json.Unmarshal(data, &fileValues); err != nil {
+			return fmt.Errorf("解析配置文件 %s 失败: %v", configPath, err)
+		}
+	}
+
+	current, err := json.Marshal(config)
 	if err != nil {
 		log.Printf("序列化配置失败: %v", err)
 		return err
 	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(current, &values); err != nil {
+		return err
+	}
+
+	// 按结构体字段顺序输出，保持配置文件的可读性
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	first := true
+	for _, key := range FieldNames() {
+		value := values[key]
+		switch sources[key] {
+		case SourceEnv, SourceFlag:
+			var ok bool
+			if value, ok = fileValues[key]; !ok {
+				continue
+			}
+		}
+
+		if !first {
+			buf.WriteString(",")
+		}
+		first = false
+		name, _ := json.Marshal(key)
+		buf.WriteString("\n  ")
+		buf.Write(name)
+		buf.WriteString(": ")
+		if err := json.Indent(&buf, value, "  ", "  "); err != nil {
+			return err
+		}
+	}
+	buf.WriteString("\n}\n")
 	
 	// 写入文件
-	if err := ioutil.WriteFile(configPath, data, 0644); err != nil {
+	if err := ioutil.WriteFile(configPath, buf.Bytes(), 0644); err != nil {
 		log.Printf("写入配置文件失败: %v", err)
 		return err
 	}
 	
 	log.Printf("成功保存配置到 %s", configPath)
 	return nil
-} 
\ No newline at end of file
+}
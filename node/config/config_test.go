@@ -0,0 +1,225 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveConfigKeepsOverridesOutOfFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configPath = filepath.Join(dir, "config.json")
+	defer func() { configPath = "" }()
+
+	fileData := []byte(`{"panel_url": "http://panel:8080", "node_key": "nk_file", "listen_port": "8081"}`)
+	if err := ioutil.WriteFile(configPath, fileData, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config = defaultConfig()
+	sources = newSources()
+	if err := json.Unmarshal(fileData, config); err != nil {
+		t.Fatal(err)
+	}
+	markFileSources(fileData, sources)
+
+	// 节点密钥和端口来自环境变量或命令行参数，名称由面板下发
+	config.NodeKey = "nk_env"
+	sources["node_key"] = SourceEnv
+	config.ListenPort = "9000"
+	sources["listen_port"] = SourceFlag
+	config.MetricsPort = "9100"
+	sources["metrics_port"] = SourceEnv
+	config.NodeName = "edge-1"
+	sources["node_name"] = SourceAPI
+
+	if err := saveConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved map[string]interface{}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("保存的配置不是有效的JSON: %v\n%s", err, data)
+	}
+
+	tests := []struct {
+		key     string
+		want    interface{}
+		present bool
+	}{
+		{"node_key", "nk_file", true},
+		{"listen_port", "8081", true},
+		{"metrics_port", nil, false},
+		{"node_name", "edge-1", true},
+		{"panel_url", "http://panel:8080", true},
+		{"heartbeat_interval", float64(30), true},
+	}
+	for _, tt := range tests {
+		got, ok := saved[tt.key]
+		if ok != tt.present {
+			t.Errorf("%s present = %v, want %v", tt.key, ok, tt.present)
+			continue
+		}
+		if ok && got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigRejectsMalformedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configPath = filepath.Join(dir, "config.json")
+	defer func() { configPath = "" }()
+
+	if err := ioutil.WriteFile(configPath, []byte(`{"panel_url": "http://panel:8080",}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config = defaultConfig()
+	sources = newSources()
+	if err := loadConfig(); err == nil {
+		t.Fatal("格式错误的配置文件应返回错误")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		fields []string
+	}{
+		{"默认配置", func(c *Config) {}, nil},
+		{"端口无效", func(c *Config) { c.ListenPort = "abc" }, []string{"listen_port"}},
+		{"指标端口与监听端口相同", func(c *Config) { c.MetricsPort = c.ListenPort }, []string{"metrics_port"}},
+		{"TLS需要https", func(c *Config) {
+			c.PanelURL = "http://panel"
+			c.TLSEnabled = true
+		}, []string{"tls_enabled"}},
+		{"多个错误", func(c *Config) {
+			c.HeartbeatInterval = 1
+			c.PingCount = 0
+		}, []string{"heartbeat_interval", "ping_count"}},
+		{"任务名称重复", func(c *Config) {
+			job := ScheduleJob{Name: "a", Target: "http://node:8081", Type: "ping", Cron: "*/5 * * * *"}
+			c.Schedules = []ScheduleJob{job, job}
+		}, []string{"schedules[1].name"}},
+		{"任务目标类型和Cron无效", func(c *Config) {
+			c.Schedules = []ScheduleJob{{Name: "a", Type: "trace", Cron: "* * *"}}
+		}, []string{"schedules[0].target", "schedules[0].type", "schedules[0].cron"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if len(tt.fields) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			verr, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("err = %v, want *ValidationError", err)
+			}
+			if len(verr.Fields) != len(tt.fields) {
+				t.Fatalf("fields = %v, want %v", verr.Fields, tt.fields)
+			}
+			for i, f := range verr.Fields {
+				if f.Field != tt.fields[i] {
+					t.Errorf("field[%d] = %s, want %s", i, f.Field, tt.fields[i])
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateConfigKeepsUpdatePublicKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configPath = filepath.Join(dir, "config.json")
+	defer func() { configPath = "" }()
+
+	localKey := "11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="
+	config = defaultConfig()
+	config.UpdatePublicKey = localKey
+	sources = newSources()
+	sources["update_public_key"] = SourceFile
+
+	// 面板下发的配置中替换了发布公钥
+	newConfig := *config
+	newConfig.NodeName = "edge-1"
+	newConfig.UpdatePublicKey = "O2onvM62pC1io6jQKm8Nc2UyFXcd4kOmOsBIoYtZ2ik="
+	if err := UpdateConfig(newConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config
+	if cfg.NodeName != "edge-1" {
+		t.Errorf("node_name = %q, want edge-1", cfg.NodeName)
+	}
+	if cfg.UpdatePublicKey != localKey {
+		t.Errorf("update_public_key = %q, want %q", cfg.UpdatePublicKey, localKey)
+	}
+	if sources["update_public_key"] != SourceFile {
+		t.Errorf("update_public_key 来源 = %s, want %s", sources["update_public_key"], SourceFile)
+	}
+}
+
+func TestUpdateConfigRejectsNodeIDChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configPath = filepath.Join(dir, "config.json")
+	defer func() { configPath = "" }()
+
+	config = defaultConfig()
+	config.NodeID = "node-1"
+	sources = newSources()
+
+	// 面板下发的配置修改了节点ID，整体拒绝，其他字段也不应用
+	newConfig := *config
+	newConfig.NodeID = "node-2"
+	newConfig.NodeName = "edge-1"
+	err = UpdateConfig(newConfig)
+	verr, ok := err.(*ValidationError)
+	if !ok || len(verr.Fields) != 1 || verr.Fields[0].Field != "node_id" {
+		t.Fatalf("err = %v, want node_id 校验错误", err)
+	}
+	if config.NodeID != "node-1" || config.NodeName != "" {
+		t.Errorf("配置被修改: node_id=%q node_name=%q", config.NodeID, config.NodeName)
+	}
+
+	// 未修改节点ID时正常应用
+	newConfig.NodeID = "node-1"
+	if err := UpdateConfig(newConfig); err != nil {
+		t.Fatal(err)
+	}
+	if config.NodeName != "edge-1" {
+		t.Errorf("node_name = %q, want edge-1", config.NodeName)
+	}
+
+	// 注册命令保存新的节点凭据
+	newConfig.NodeID = "node-2"
+	if err := SaveEnrollment(newConfig); err != nil {
+		t.Fatal(err)
+	}
+	if config.NodeID != "node-2" {
+		t.Errorf("node_id = %q, want node-2", config.NodeID)
+	}
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// 配置项来源，优先级从低到高：默认值、配置文件、环境变量、命令行参数
+const (
+	SourceDefault = "default" // 默认值
+	SourceFile    = "file"    // 配置文件
+	SourceEnv     = "env"     // 环境变量
+	SourceFlag    = "flag"    // 命令行参数
+	SourceAPI     = "api"     // 运行时由面板下发
+)
+
+// EnvPrefix 覆盖配置项的环境变量前缀，如 NODE_LISTEN_PORT
+const EnvPrefix = "NODE_"
+
+// Entry 表示一个配置项的生效值及其来源
+type Entry struct {
+	Key    string `json:"key"`    // 配置项名称
+	Value  string `json:"value"`  // 生效值（JSON编码）
+	Source string `json:"source"` // 来源
+}
+
+var (
+	// 各配置项生效值的来源
+	sources map[string]string
+
+	// 命令行参数覆盖值
+	flagOverrides = make(map[string]string)
+)
+
+// FieldNames 返回所有配置项名称（即JSON字段名）
+func FieldNames() []string {
+	t := reflect.TypeOf(Config{})
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if name := jsonName(t.Field(i)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// EnvName 返回配置项对应的环境变量名
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(key)
+}
+
+// FlagName 返回配置项对应的命令行参数名
+func FlagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// RegisterFlags 为每个配置项注册命令行参数，如 -listen-port 8082
+func RegisterFlags(fs *flag.FlagSet) {
+	for _, key := range FieldNames() {
+		key := key
+		usage := fmt.Sprintf("覆盖配置项 %s（环境变量 %s）", key, EnvName(key))
+		fs.Func(FlagName(key), usage, func(value string) error {
+			// 提前检查取值类型，便于在解析参数时报错
+			if err := setField(&Config{}, key, value); err != nil {
+				return err
+			}
+			flagOverrides[key] = value
+			return nil
+		})
+	}
+}
+
+// Describe 返回所有配置项的生效值和来源，节点密钥会被隐藏
+func Describe() []Entry {
+	cfg := GetConfig()
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	entries := make([]Entry, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		key := jsonName(t.Field(i))
+		if key == "" {
+			continue
+		}
+
+		value, _ := json.Marshal(v.Field(i).Interface())
+		if key == "node_key" && cfg.NodeKey != "" {
+			value, _ = json.Marshal(MaskedNodeKey)
+		}
+
+		entries = append(entries, Entry{
+			Key:    key,
+			Value:  string(value),
+			Source: sources[key],
+		})
+	}
+	return entries
+}
+
+// 初始化所有配置项来源为默认值
+func newSources() map[string]string {
+	src := make(map[string]string)
+	for _, key := range FieldNames() {
+		src[key] = SourceDefault
+	}
+	return src
+}
+
+// 记录配置文件中出现的配置项
+func markFileSources(data []byte, src map[string]string) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return
+	}
+	for key := range raw {
+		if _, ok := src[key]; ok {
+			src[key] = SourceFile
+		}
+	}
+}
+
+// 依次应用环境变量和命令行参数
+func applyOverrides(cfg *Config, src map[string]string) error {
+	for _, key := range FieldNames() {
+		value, ok := os.LookupEnv(EnvName(key))
+		if !ok {
+			continue
+		}
+		if err := setField(cfg, key, value); err != nil {
+			return fmt.Errorf("环境变量 %s 无效: %v", EnvName(key), err)
+		}
+		src[key] = SourceEnv
+	}
+
+	for key, value := range flagOverrides {
+		if err := setField(cfg, key, value); err != nil {
+			return fmt.Errorf("命令行参数 -%s 无效: %v", FlagName(key), err)
+		}
+		src[key] = SourceFlag
+	}
+
+	return nil
+}
+
+// 记录运行时被修改的配置项
+func markChangedSources(oldCfg, newCfg *Config, source string) {
+	oldValue := reflect.ValueOf(oldCfg).Elem()
+	newValue := reflect.ValueOf(newCfg).Elem()
+	t := oldValue.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := jsonName(t.Field(i))
+		if key == "" {
+			continue
+		}
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			sources[key] = source
+		}
+	}
+}
+
+// 按配置项名称设置字段，字符串和整数直接转换，其余类型按JSON解析
+func setField(cfg *Config, key, value string) error {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if jsonName(t.Field(i)) != key {
+			continue
+		}
+
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s 应为整数，当前为 %q", key, value)
+			}
+			field.SetInt(int64(n))
+		default:
+			ptr := reflect.New(field.Type())
+			if err := json.Unmarshal([]byte(value), ptr.Interface()); err != nil {
+				return fmt.Errorf("%s 应为JSON格式: %v", key, err)
+			}
+			field.Set(ptr.Elem())
+		}
+		return nil
+	}
+
+	return fmt.Errorf("未知的配置项: %s", key)
+}
+
+// 获取字段的JSON名称
+func jsonName(f reflect.StructField) string {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	if idx := strings.Index(tag, ","); idx >= 0 {
+		tag = tag[:idx]
+	}
+	return tag
+}
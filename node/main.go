@@ -1,42 +1,72 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
 	"time"
+
+	"节点管理测速项目/common/signature"
+	"节点管理测速项目/node/api"
+	"节点管理测速项目/node/auth"
+	"节点管理测速项目/node/config"
+	"节点管理测速项目/node/metrics"
+	"节点管理测速项目/node/scheduler"
+	"节点管理测速项目/node/speedtest"
+	"节点管理测速项目/node/sysinfo"
+	"节点管理测速项目/node/update"
 )
 
-// 配置结构体
-type Config struct {
-	ListenPort        string `json:"listen_port"`
-	LogPath           string `json:"log_path"`
-	PanelURL          string `json:"panel_url"`
-	NodeID            string `json:"node_id"`
-	NodeKey           string `json:"node_key"`
-	HeartbeatInterval int    `json:"heartbeat_interval"`
-	DownloadThreads   int    `json:"download_threads"`
-	UploadThreads     int    `json:"upload_threads"`
-	PingCount         int    `json:"ping_count"`
-}
+// 节点版本，发布时通过 -ldflags "-X main.version=vX.Y.Z" 设置
+var version = "v1.0.0"
 
-// 全局配置变量
-var config Config
+var (
+	// 心跳定时器，配置变更时重置间隔
+	heartbeatTicker *time.Ticker
 
-// 加载配置文件
-func loadConfig(configPath string) error {
-	file, err := os.Open(configPath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
+	// 当前运行的HTTP服务，监听端口变更时替换
+	server   *http.Server
+	serverMu sync.Mutex
 
-	decoder := json.NewDecoder(file)
-	return decoder.Decode(&config)
+	// 单独端口的指标服务，未配置指标端口时为nil
+	metricsServer *http.Server
+
+	// 启用TLS时连接面板和监听端口使用的配置，未启用时为nil
+	panelTLS  *tls.Config
+	serverTLS *tls.Config
+
+	// 节点证书管理器，未启用TLS时为nil
+	certManager *auth.CertManager
+
+	// 自动更新器，未配置发布公钥时为nil
+	updater *update.Updater
+
+	// 测速管理器，节点服务启动后设置，命令行工具中为nil
+	testManager *speedtest.SpeedTestManager
+)
+
+// 打印生效的配置及其来源
+func printConfig() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "配置项\t生效值\t来源\t环境变量")
+	for _, entry := range config.Describe() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.Key, entry.Value, entry.Source, config.EnvName(entry.Key))
+	}
+	w.Flush()
 }
 
 // 初始化日志
@@ -60,58 +90,224 @@ func initLogger(logPath string) (*os.File, error) {
 	return logFile, nil
 }
 
-// 发送心跳包到面板
-func sendHeartbeat() {
-	if config.PanelURL == "" || config.NodeID == "" || config.NodeKey == "" {
-		log.Println("面板URL、节点ID或节点密钥未设置，无法发送心跳")
-		return
+// 向面板发送签名请求
+func panelRequest(method, path string, body []byte, timeout time.Duration) (*http.Response, error) {
+	cfg := config.GetConfig()
+	if cfg.PanelURL == "" || cfg.NodeID == "" || cfg.NodeKey == "" {
+		return nil, fmt.Errorf("面板URL、节点ID或节点密钥未设置")
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(cfg.PanelURL, "/")+path, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// 添加签名头
+	req.Header.Set("Content-Type", "application/json")
+	if err := signature.SignRequest(req, body, cfg.NodeID, signature.SigningKey(cfg.NodeKey)); err != nil {
+		return nil, err
 	}
 
-	heartbeatURL := fmt.Sprintf("%s/api/node/heartbeat", config.PanelURL)
 	client := &http.Client{
-		Timeout: 10 * time.Second,
+		Timeout: timeout,
+	}
+	if panelTLS != nil {
+		client.Transport = &http.Transport{TLSClientConfig: panelTLS}
+	}
+	return client.Do(req)
+}
+
+// 心跳数据，包含节点版本、监听端口、系统资源使用情况和自动更新状态，shutdown表示节点即将关闭。
+// 只有节点服务在运行时才领取面板下发的测试，命令行工具发送的心跳不会领取
+func heartbeatPayload(shutdown bool) ([]byte, error) {
+	stats := sysinfo.Collect()
+	heartbeat := map[string]interface{}{
+		"version":     version,
+		"listen_port": config.GetConfig().ListenPort,
+		"timestamp":   time.Now(), // 面板据此计算节点的时钟偏差
+		"cpu":         stats.CPU,
+		"memory":      stats.Memory,
+		"disk":        stats.Disk,
+		"uptime":      stats.Uptime,
+		"load":        stats.Load,
+		"network_rx":  stats.NetworkRx,
+		"network_tx":  stats.NetworkTx,
+	}
+	if shutdown {
+		heartbeat["shutdown"] = true
+	} else if testManager != nil {
+		heartbeat["accept_tests"] = true
 	}
+	if updater != nil {
+		status, failedVersion := updater.Status()
+		heartbeat["update_status"] = status
+		heartbeat["failed_version"] = failedVersion
+	}
+	return json.Marshal(heartbeat)
+}
 
-	// 构建请求
-	req, err := http.NewRequest("POST", heartbeatURL, nil)
+// 发送心跳包到面板，面板通知有新版本时启动自动更新，下发测试时立即执行
+func sendHeartbeat() {
+	body, err := heartbeatPayload(false)
 	if err != nil {
-		log.Printf("创建心跳请求失败: %v", err)
+		log.Printf("序列化心跳数据失败: %v", err)
 		return
 	}
 
-	// 添加认证头
-	req.Header.Set("Node-ID", config.NodeID)
-	req.Header.Set("Node-Key", config.NodeKey)
-	req.Header.Set("Content-Type", "application/json")
-
 	// 发送请求
-	resp, err := client.Do(req)
+	resp, err := panelRequest("POST", "/api/node/heartbeat", body, 10*time.Second)
 	if err != nil {
+		metrics.HeartbeatFailures.Inc()
 		log.Printf("发送心跳失败: %v", err)
+
+		// 证书被吊销时面板拒绝握手，仅凭请求签名重新申请证书
+		if certManager != nil && auth.IsCertificateRejected(err) {
+			log.Println("面板拒绝了节点证书，重新申请证书")
+			if err := certManager.Renew(); err != nil {
+				log.Printf("重新申请节点证书失败: %v", err)
+			}
+		}
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		metrics.HeartbeatFailures.Inc()
 		log.Printf("心跳响应状态码异常: %d", resp.StatusCode)
 		return
 	}
 
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    struct {
+			Update *struct {
+				Version string `json:"version"`
+			} `json:"update"`
+			Tests          []speedtest.SpeedTestRequest `json:"tests"`
+			RevokedSerials []string                     `json:"revoked_serials"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		log.Printf("解析心跳响应失败: %v", err)
+	}
+
+	// 面板的错误以响应中的code返回，例如签名无效或时钟偏差过大
+	if result.Code != 0 {
+		metrics.HeartbeatFailures.Inc()
+		log.Printf("面板拒绝了心跳: %s", result.Message)
+		return
+	}
+	metrics.HeartbeatLastSuccess.Set(float64(time.Now().Unix()))
+
 	log.Println("心跳发送成功")
+
+	// 未启用TLS的面板不下发吊销列表
+	if certManager != nil && result.Data.RevokedSerials != nil {
+		certManager.SetRevoked(result.Data.RevokedSerials)
+	}
+
+	if updater != nil {
+		updater.Confirm()
+		if result.Data.Update != nil {
+			updater.Offer(result.Data.Update.Version, config.GetConfig().UpdatePublicKey)
+		}
+	}
+
+	for _, req := range result.Data.Tests {
+		if testManager == nil {
+			break
+		}
+		if _, err := testManager.StartTest(req); err != nil {
+			log.Printf("启动面板下发的测试 %s 失败: %v", req.ID, err)
+			continue
+		}
+		log.Printf("已启动面板下发的测试: %s -> %s (%s)", req.SourceNodeID, req.TargetNodeID, req.Type)
+	}
 }
 
-// 启动心跳定时任务
-func startHeartbeatTask() {
-	interval := time.Duration(config.HeartbeatInterval) * time.Second
+// 通知面板节点即将关闭，面板将节点标记为维护中而不是故障
+func sendShutdownHeartbeat() {
+	body, err := heartbeatPayload(true)
+	if err != nil {
+		log.Printf("序列化心跳数据失败: %v", err)
+		return
+	}
+
+	resp, err := panelRequest("POST", "/api/node/heartbeat", body, 5*time.Second)
+	if err != nil {
+		log.Printf("发送关闭通知失败: %v", err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("关闭通知响应状态码异常: %d", resp.StatusCode)
+		return
+	}
+	log.Println("已通知面板节点即将关闭")
+}
+
+// 优雅关闭：停止接受新测试，等待运行中的测试完成或在期限后取消，
+// 上报并补报结果后关闭HTTP服务和指标服务
+func shutdown(manager *speedtest.SpeedTestManager, localScheduler *scheduler.Scheduler) {
+	cfg := config.GetConfig()
+	timeout := time.Duration(cfg.ShutdownTimeout) * time.Second
+	log.Printf("开始关闭节点服务，最长等待 %v", timeout)
+
+	localScheduler.Stop()
+	if heartbeatTicker != nil {
+		heartbeatTicker.Stop()
+	}
+	sendShutdownHeartbeat()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if cancelled := manager.Drain(ctx); cancelled > 0 {
+		log.Printf("已取消 %d 个未完成的测试", cancelled)
+	}
+
+	serverMu.Lock()
+	srv := server
+	serverMu.Unlock()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if srv != nil {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("关闭HTTP服务失败: %v", err)
+		}
+	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			log.Printf("关闭指标服务失败: %v", err)
+		}
+	}
+
+	log.Println("节点服务已关闭")
+}
+
+// 计算心跳间隔，过短时使用默认值
+func heartbeatInterval(seconds int) time.Duration {
+	interval := time.Duration(seconds) * time.Second
 	if interval < 10*time.Second {
 		interval = 30 * time.Second
 	}
+	return interval
+}
 
-	ticker := time.NewTicker(interval)
+// 启动心跳定时任务
+func startHeartbeatTask() {
+	interval := heartbeatInterval(config.GetConfig().HeartbeatInterval)
+
+	heartbeatTicker = time.NewTicker(interval)
 	go func() {
 		for {
 			select {
-			case <-ticker.C:
+			case <-heartbeatTicker.C:
 				sendHeartbeat()
 			}
 		}
@@ -120,23 +316,109 @@ func startHeartbeatTask() {
 	log.Printf("心跳任务启动，间隔: %v", interval)
 }
 
+// 在指定端口启动HTTP服务，成功后关闭旧服务
+func startServer(port string) error {
+	// 先监听新端口，失败时旧服务保持不变
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+	scheme := "http"
+	if serverTLS != nil {
+		listener = tls.NewListener(listener, serverTLS)
+		scheme = "https"
+	}
+
+	// 启用TLS时只接受面板证书，管理接口还需校验面板签名
+	srv := &http.Server{Handler: auth.RequirePanel(api.RequireSignature(http.DefaultServeMux))}
+	go func() {
+		if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("HTTP服务异常退出: %v", err)
+		}
+	}()
+
+	serverMu.Lock()
+	oldServer := server
+	server = srv
+	serverMu.Unlock()
+
+	if oldServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := oldServer.Shutdown(ctx); err != nil {
+			log.Printf("关闭旧HTTP服务失败: %v", err)
+		}
+	}
+
+	log.Printf("节点服务启动，监听地址: %s://localhost:%s", scheme, port)
+	return nil
+}
+
+// 将配置变更应用到心跳任务和HTTP服务
+func applyConfigChange(oldCfg, newCfg *config.Config) error {
+	if newCfg.ListenPort != oldCfg.ListenPort {
+		if err := startServer(newCfg.ListenPort); err != nil {
+			return fmt.Errorf("监听端口 %s 失败: %v", newCfg.ListenPort, err)
+		}
+	}
+
+	if newCfg.HeartbeatInterval != oldCfg.HeartbeatInterval && heartbeatTicker != nil {
+		interval := heartbeatInterval(newCfg.HeartbeatInterval)
+		heartbeatTicker.Reset(interval)
+		log.Printf("心跳间隔已更新: %v", interval)
+	}
+
+	if newCfg.TLSEnabled != oldCfg.TLSEnabled {
+		log.Printf("TLS开关变更将在重启后生效: %v", newCfg.TLSEnabled)
+	}
+
+	if newCfg.MetricsPort != oldCfg.MetricsPort {
+		log.Printf("指标端口变更将在重启后生效: %s", newCfg.MetricsPort)
+	}
+
+	if newCfg.LogPath != oldCfg.LogPath {
+		log.Printf("日志路径变更将在重启后生效: %s", newCfg.LogPath)
+	}
+
+	return nil
+}
+
 // 主函数
 func main() {
+	// test、status等子命令执行后直接退出，不启动节点服务
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	fmt.Println("节点管理测速系统 - 节点服务")
-	fmt.Println("版本: v1.0.0")
+	fmt.Printf("版本: %s\n", version)
 
-	// 解析命令行参数
+	// 解析命令行参数，每个配置项均可通过同名参数覆盖
 	configPath := flag.String("config", "config.json", "配置文件路径")
+	showConfig := flag.Bool("print-config", false, "打印生效的配置及其来源后退出")
+	showVersion := flag.Bool("version", false, "打印版本后退出")
+	config.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
-	// 加载配置
-	if err := loadConfig(*configPath); err != nil {
+	if *showVersion {
+		return
+	}
+
+	// 加载配置，优先级：默认值 < 配置文件 < NODE_*环境变量 < 命令行参数
+	config.SetConfigPath(*configPath)
+	if err := config.Load(); err != nil {
 		fmt.Printf("加载配置失败: %v\n", err)
 		os.Exit(1)
 	}
+	cfg := config.GetConfig()
+
+	if *showConfig {
+		printConfig()
+		return
+	}
 
 	// 初始化日志
-	logFile, err := initLogger(config.LogPath)
+	logFile, err := initLogger(cfg.LogPath)
 	if err != nil {
 		fmt.Printf("初始化日志失败: %v\n", err)
 		os.Exit(1)
@@ -144,12 +426,74 @@ func main() {
 	defer logFile.Close()
 
 	log.Println("节点服务启动")
-	log.Printf("配置加载成功，监听端口: %s", config.ListenPort)
+	log.Printf("配置加载成功，监听端口: %s", cfg.ListenPort)
+	if err := cfg.Validate(); err != nil {
+		log.Printf("配置存在问题，请检查配置文件: %v", err)
+	}
+
+	// 启用TLS时申请节点证书，之后与面板的通信均使用双向TLS
+	if cfg.TLSEnabled {
+		certManager = auth.NewCertManager(filepath.Join(cfg.DataDir, "tls"))
+		if err := certManager.Ensure(); err != nil {
+			log.Printf("获取节点证书失败，稍后重试: %v", err)
+		}
+		certManager.StartRotation(time.Hour)
+		panelTLS = certManager.ClientTLSConfig()
+		serverTLS = certManager.ServerTLSConfig()
+	}
+
+	// 检查上一次自动更新，新版本需在超时时间内完成心跳
+	if cfg.UpdatePublicKey != "" {
+		updater, err = update.NewUpdater(version, cfg.DataDir, panelRequest)
+		if err != nil {
+			log.Printf("初始化自动更新失败: %v", err)
+		} else {
+			updater.Resume(time.Duration(cfg.UpdateRollbackTimeout) * time.Second)
+		}
+	}
 
-	// 启动心跳任务
+	// 启动本地定时测速，面板不可达时结果缓存在待上报队列中
+	manager := speedtest.NewSpeedTestManager(cfg.PanelURL, cfg.NodeID, cfg.NodeKey)
+	outbox := speedtest.NewOutbox(cfg.DataDir)
+	manager.SetOutbox(outbox)
+	if panelTLS != nil {
+		manager.SetPanelTLS(panelTLS)
+		manager.SetTargetTLS(panelTLS)
+	}
+	manager.StartOutboxFlush(time.Minute)
+	testManager = manager
+
+	// 启动心跳任务，面板通过心跳响应下发测试
 	startHeartbeatTask()
 
-	// 设置HTTP路由
+	localScheduler := scheduler.NewScheduler(manager, cfg.NodeID)
+	if err := localScheduler.SetJobs(cfg.Schedules); err != nil {
+		log.Printf("加载本地定时任务失败: %v", err)
+	}
+	localScheduler.Start()
+
+	// 注册配置变更回调，按顺序应用，任一失败时整体回滚
+	config.OnChange(func(oldCfg, newCfg *config.Config) error {
+		return localScheduler.SetJobs(newCfg.Schedules)
+	})
+	config.OnChange(func(oldCfg, newCfg *config.Config) error {
+		manager.SetPanel(newCfg.PanelURL, newCfg.NodeKey)
+		return nil
+	})
+	config.OnChange(applyConfigChange)
+
+	// 注册采集时计算的指标
+	metrics.BuildInfo.Set(1, version)
+	metrics.NewGaugeFunc("node_speedtest_active_tests", "正在运行的测试数量", func() float64 {
+		return float64(manager.ActiveCount())
+	})
+	metrics.NewGaugeFunc("node_speedtest_outbox_depth", "待上报面板的测试结果数量", func() float64 {
+		return float64(outbox.Len())
+	})
+
+	// 设置HTTP路由，面板通过 /api/config 下发配置，校验失败或应用失败时保持原配置
+	manager.RegisterTargets(http.DefaultServeMux)
+	api.Register(http.DefaultServeMux)
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "节点管理测速系统 - 节点服务正在运行")
 	})
@@ -158,16 +502,57 @@ func main() {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status": "running",
-			"version": "v1.0.0",
+			"version": version,
 		})
 	})
 
+	// 启用TLS时监听端口只接受面板证书，可以通过单独的端口提供指标
+	if cfg.MetricsPort != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{Addr: ":" + cfg.MetricsPort, Handler: metricsMux}
+		go func() {
+			log.Printf("指标服务启动，监听地址: http://localhost:%s/metrics", cfg.MetricsPort)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("指标服务异常退出: %v", err)
+			}
+		}()
+	} else {
+		http.Handle("/metrics", metrics.Handler())
+	}
+
 	// 启动HTTP服务器
-	serverAddr := ":" + config.ListenPort
-	fmt.Printf("节点服务启动，监听地址: http://localhost%s\n", serverAddr)
-	log.Printf("节点服务启动，监听地址: http://localhost%s", serverAddr)
-	
-	if err := http.ListenAndServe(serverAddr, nil); err != nil {
+	fmt.Printf("节点服务启动，监听地址: http://localhost:%s\n", cfg.ListenPort)
+	if err := startServer(cfg.ListenPort); err != nil {
 		log.Fatalf("服务器启动失败: %v", err)
 	}
-} 
\ No newline at end of file
+
+	// 收到SIGHUP时从磁盘重新加载配置，收到SIGINT或SIGTERM时优雅关闭
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	for sig := range sigCh {
+		if sig == syscall.SIGHUP {
+			log.Println("收到SIGHUP信号，重新加载配置")
+			if err := config.Reload(); err != nil {
+				log.Printf("重新加载配置失败，继续使用当前配置: %v", err)
+			}
+			continue
+		}
+
+		log.Printf("收到%v信号", sig)
+		fmt.Println("正在关闭节点服务，再次按 Ctrl+C 立即退出")
+
+		// 关闭过程中再次收到信号时立即退出
+		go func() {
+			for sig := range sigCh {
+				if sig != syscall.SIGHUP {
+					log.Printf("再次收到%v信号，立即退出", sig)
+					os.Exit(1)
+				}
+			}
+		}()
+
+		shutdown(manager, localScheduler)
+		return
+	}
+}
\ No newline at end of file
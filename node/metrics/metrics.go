@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"节点管理测速项目/common/promtext"
+)
+
+// 指标类型
+const (
+	typeCounter = "counter"
+	typeGauge   = "gauge"
+)
+
+// Family 一组同名指标，按标签值区分
+type Family struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	samples map[string]*sample
+	fn      func() float64 // 采集时计算的无标签指标
+	mutex   sync.Mutex
+}
+
+// 单个标签组合的取值
+type sample struct {
+	labelValues []string
+	value       float64
+}
+
+var (
+	families []*Family
+	registry sync.Mutex
+)
+
+// 注册指标，名称重复时直接panic，属于编程错误
+func register(f *Family) *Family {
+	registry.Lock()
+	defer registry.Unlock()
+
+	for _, existing := range families {
+		if existing.name == f.name {
+			panic("指标重复注册: " + f.name)
+		}
+	}
+	families = append(families, f)
+	return f
+}
+
+// NewCounter 注册只增不减的计数器
+func NewCounter(name, help string, labels ...string) *Family {
+	return register(&Family{name: name, help: help, typ: typeCounter, labels: labels, samples: make(map[string]*sample)})
+}
+
+// NewGauge 注册可任意设置的仪表
+func NewGauge(name, help string, labels ...string) *Family {
+	return register(&Family{name: name, help: help, typ: typeGauge, labels: labels, samples: make(map[string]*sample)})
+}
+
+// NewGaugeFunc 注册在采集时通过函数计算取值的仪表，函数会在每次采集时调用
+func NewGaugeFunc(name, help string, fn func() float64) *Family {
+	return register(&Family{name: name, help: help, typ: typeGauge, fn: fn})
+}
+
+// 获取标签组合对应的取值，调用时需持有锁
+func (f *Family) sample(labelValues []string) *sample {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("指标 %s 需要 %d 个标签值，实际为 %d", f.name, len(f.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.samples[key]
+	if !ok {
+		s = &sample{labelValues: append([]string(nil), labelValues...)}
+		f.samples[key] = s
+	}
+	return s
+}
+
+// Add 增加指定标签组合的取值
+func (f *Family) Add(v float64, labelValues ...string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.sample(labelValues).value += v
+}
+
+// Inc 将指定标签组合的取值加1
+func (f *Family) Inc(labelValues ...string) {
+	f.Add(1, labelValues...)
+}
+
+// Set 设置指定标签组合的取值，计数器不应调用
+func (f *Family) Set(v float64, labelValues ...string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.sample(labelValues).value = v
+}
+
+// 按Prometheus文本格式输出一组指标
+func (f *Family) write(w io.Writer) {
+	if f.fn != nil {
+		promtext.WriteFamily(w, f.name, f.help, f.typ, []string{promtext.Line(f.name, nil, nil, f.fn())})
+		return
+	}
+
+	f.mutex.Lock()
+	lines := make([]string, 0, len(f.samples))
+	for _, s := range f.samples {
+		lines = append(lines, promtext.Line(f.name, f.labels, s.labelValues, s.value))
+	}
+	f.mutex.Unlock()
+
+	promtext.WriteFamily(w, f.name, f.help, f.typ, lines)
+}
+
+// Handler 返回 /metrics 处理函数，输出所有已注册的指标
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registry.Lock()
+		list := append([]*Family(nil), families...)
+		registry.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		for _, f := range list {
+			f.write(w)
+		}
+	})
+}
@@ -0,0 +1,28 @@
+package metrics
+
+// 节点指标，由测速管理器、测速目标接口和心跳任务更新
+var (
+	// 测速次数
+	TestsTotal = NewCounter("node_speedtest_tests_total", "已完成的测速次数，按测试类型和状态区分", "type", "status")
+
+	// 每个测试目标最近一次测速的结果
+	LastSuccess       = NewGauge("node_speedtest_last_success", "最近一次测速是否成功（1成功，0失败）", "target", "type")
+	LastTimestamp     = NewGauge("node_speedtest_last_timestamp_seconds", "最近一次测速的完成时间（Unix时间戳）", "target", "type")
+	LastDuration      = NewGauge("node_speedtest_last_duration_seconds", "最近一次测速的耗时（秒）", "target", "type")
+	LastDownloadSpeed = NewGauge("node_speedtest_last_download_mbps", "最近一次成功测速的下载速度（Mbps）", "target", "type")
+	LastUploadSpeed   = NewGauge("node_speedtest_last_upload_mbps", "最近一次成功测速的上传速度（Mbps）", "target", "type")
+	LastPing          = NewGauge("node_speedtest_last_ping_ms", "最近一次成功测速的延迟（毫秒）", "target", "type")
+	LastJitter        = NewGauge("node_speedtest_last_jitter_ms", "最近一次成功测速的抖动（毫秒）", "target", "type")
+	LastPacketLoss    = NewGauge("node_speedtest_last_packet_loss_percent", "最近一次成功测速的丢包率（百分比）", "target", "type")
+
+	// 本节点作为测速目标时收发的字节数
+	TargetRequests = NewCounter("node_speedtest_target_requests_total", "测速目标接口的请求次数，按接口区分", "endpoint")
+	ServedBytes    = NewCounter("node_speedtest_served_bytes_total", "测速目标接口收发的字节数，按接口区分", "endpoint")
+
+	// 心跳
+	HeartbeatFailures    = NewCounter("node_speedtest_heartbeat_failures_total", "发送心跳失败的次数")
+	HeartbeatLastSuccess = NewGauge("node_speedtest_heartbeat_last_success_timestamp_seconds", "最近一次心跳成功的时间（Unix时间戳）")
+
+	// 版本信息，取值恒为1
+	BuildInfo = NewGauge("node_speedtest_build_info", "节点版本信息", "version")
+)
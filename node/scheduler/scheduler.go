@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"节点管理测速项目/common/cron"
+	"节点管理测速项目/node/config"
+	"节点管理测速项目/node/speedtest"
+)
+
+// 已解析的本地定时任务
+type job struct {
+	config.ScheduleJob
+	schedule *cron.Schedule
+	lastID   string
+}
+
+// Scheduler 在节点本地按Cron表达式执行测速，不依赖面板下发任务
+type Scheduler struct {
+	manager *speedtest.SpeedTestManager
+	nodeID  string
+	jobs    []*job
+	mutex   sync.Mutex
+	stop    chan struct{}
+}
+
+// 创建本地调度器
+func NewScheduler(manager *speedtest.SpeedTestManager, nodeID string) *Scheduler {
+	return &Scheduler{
+		manager: manager,
+		nodeID:  nodeID,
+	}
+}
+
+// ValidateJob 检查定时任务配置是否有效，检查项与配置校验一致
+func ValidateJob(j config.ScheduleJob) error {
+	if j.Name == "" {
+		return fmt.Errorf("任务名称不能为空")
+	}
+	if fields := j.Validate(); len(fields) > 0 {
+		return fmt.Errorf("任务 %s 的 %s %s", j.Name, fields[0].Field, fields[0].Message)
+	}
+	return nil
+}
+
+// 设置定时任务列表，任一任务无效时保持原任务不变
+func (s *Scheduler) SetJobs(jobs []config.ScheduleJob) error {
+	parsed := make([]*job, 0, len(jobs))
+	for _, j := range jobs {
+		if err := ValidateJob(j); err != nil {
+			return err
+		}
+		schedule, _ := cron.Parse(j.Cron)
+		parsed = append(parsed, &job{ScheduleJob: j, schedule: schedule})
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.jobs = parsed
+
+	log.Printf("本地定时任务已加载: %d 个", len(parsed))
+	return nil
+}
+
+// 启动调度循环，每分钟检查一次任务
+func (s *Scheduler) Start() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+
+	go s.run(s.stop)
+}
+
+// 停止调度循环
+func (s *Scheduler) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// 调度循环
+func (s *Scheduler) run(stop chan struct{}) {
+	for {
+		// 对齐到下一分钟
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		timer := time.NewTimer(next.Sub(now))
+
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.dispatch(next)
+		}
+	}
+}
+
+// 执行当前分钟需要触发的任务
+func (s *Scheduler) dispatch(at time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, j := range s.jobs {
+		if !j.schedule.Matches(at) {
+			continue
+		}
+
+		// 上一次执行尚未结束时跳过，避免同一任务重叠
+		if j.lastID != "" {
+			if result, ok := s.manager.GetTestResult(j.lastID); ok && result.Status == speedtest.StatusRunning {
+				log.Printf("本地定时任务 %s 上次执行尚未结束，跳过本次", j.Name)
+				continue
+			}
+		}
+
+		timeout := j.Timeout
+		if timeout <= 0 {
+			timeout = config.GetConfig().SpeedtestTimeout
+		}
+
+		req := speedtest.SpeedTestRequest{
+			ID:           fmt.Sprintf("local-%s-%s-%d", s.nodeID, j.Name, at.Unix()),
+			SourceNodeID: s.nodeID,
+			TargetNodeID: j.TargetNodeID,
+			TargetURL:    j.Target,
+			Type:         speedtest.SpeedTestType(j.Type),
+			Timeout:      timeout,
+		}
+
+		if _, err := s.manager.StartTest(req); err != nil {
+			log.Printf("启动本地定时任务 %s 失败: %v", j.Name, err)
+			continue
+		}
+
+		j.lastID = req.ID
+		log.Printf("本地定时任务 %s 已启动: %s", j.Name, req.ID)
+	}
+}
@@ -0,0 +1,201 @@
+package speedtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// 待上报结果的最大缓存数量，超出后丢弃最旧的结果
+const maxOutboxSize = 10000
+
+// 死信文件最多保留的结果数量
+const maxDeadLetterSize = 1000
+
+// RejectedError 表示面板明确拒绝了该结果（4xx状态码或响应中的4xx code），重试不会成功
+type RejectedError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *RejectedError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("面板拒绝测试结果，状态码: %d, %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("面板拒绝测试结果，状态码: %d", e.StatusCode)
+}
+
+// 判断错误是否为面板的永久拒绝
+func IsRejected(err error) bool {
+	_, ok := err.(*RejectedError)
+	return ok
+}
+
+// Outbox 缓存上报失败的测试结果，面板恢复后按顺序补报
+type Outbox struct {
+	path     string
+	deadPath string
+	pending  []SpeedTestResult
+	mutex    sync.Mutex
+	// 保证同一时间只有一个补报过程，避免重复上报
+	flushing sync.Mutex
+}
+
+// 创建待上报队列，并从数据目录恢复上次未上报的结果
+func NewOutbox(dataDir string) *Outbox {
+	o := &Outbox{
+		path:     filepath.Join(dataDir, "outbox.json"),
+		deadPath: filepath.Join(dataDir, "outbox.dead.json"),
+	}
+
+	data, err := ioutil.ReadFile(o.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("读取待上报结果失败: %v", err)
+		}
+		return o
+	}
+
+	if err := json.Unmarshal(data, &o.pending); err != nil {
+		log.Printf("解析待上报结果失败: %v", err)
+		return o
+	}
+
+	log.Printf("恢复待上报结果 %d 条", len(o.pending))
+	return o
+}
+
+// 加入一条待上报结果
+func (o *Outbox) Add(result SpeedTestResult) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.pending = append(o.pending, result)
+	if len(o.pending) > maxOutboxSize {
+		dropped := len(o.pending) - maxOutboxSize
+		o.pending = o.pending[dropped:]
+		log.Printf("待上报队列已满，丢弃最旧的 %d 条结果", dropped)
+	}
+
+	o.save()
+}
+
+// 获取待上报结果数量
+func (o *Outbox) Len() int {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return len(o.pending)
+}
+
+// 按顺序补报结果，返回成功上报的数量。被面板拒绝（4xx）的结果移入死信文件后继续补报，
+// 遇到网络错误或5xx时停止，等待下次补报。发送期间不持有队列锁
+func (o *Outbox) Flush(send func(SpeedTestResult) error) int {
+	o.flushing.Lock()
+	defer o.flushing.Unlock()
+
+	o.mutex.Lock()
+	batch := make([]SpeedTestResult, len(o.pending))
+	copy(batch, o.pending)
+	o.mutex.Unlock()
+
+	done := make(map[string]bool)
+	var rejected []SpeedTestResult
+	sent := 0
+	for _, result := range batch {
+		err := send(result)
+		if err == nil {
+			done[result.ID] = true
+			sent++
+			continue
+		}
+		if !IsRejected(err) {
+			break
+		}
+		log.Printf("测试结果 %s 被面板拒绝，移入死信文件: %v", result.ID, err)
+		done[result.ID] = true
+		rejected = append(rejected, result)
+	}
+
+	if len(done) == 0 {
+		return 0
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	// 补报期间可能有新结果加入，只移除已处理的结果
+	remaining := o.pending[:0]
+	for _, result := range o.pending {
+		if !done[result.ID] {
+			remaining = append(remaining, result)
+		}
+	}
+	o.pending = remaining
+	o.save()
+
+	if len(rejected) > 0 {
+		o.appendDead(rejected)
+	}
+
+	return sent
+}
+
+// 将被面板拒绝的结果写入死信文件，便于人工排查
+func (o *Outbox) Reject(result SpeedTestResult) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.appendDead([]SpeedTestResult{result})
+}
+
+// 追加到死信文件（内部使用，已加锁）
+func (o *Outbox) appendDead(results []SpeedTestResult) {
+	var dead []SpeedTestResult
+	if data, err := ioutil.ReadFile(o.deadPath); err == nil {
+		if err := json.Unmarshal(data, &dead); err != nil {
+			log.Printf("解析死信文件失败，将重新创建: %v", err)
+			dead = nil
+		}
+	}
+
+	dead = append(dead, results...)
+	if len(dead) > maxDeadLetterSize {
+		dead = dead[len(dead)-maxDeadLetterSize:]
+	}
+
+	writeJSONFile(o.deadPath, dead)
+}
+
+// 保存到文件（内部使用，已加锁）
+func (o *Outbox) save() {
+	writeJSONFile(o.path, o.pending)
+}
+
+// 原子写入JSON文件
+func writeJSONFile(path string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("序列化待上报结果失败: %v", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Printf("创建数据目录失败: %v", err)
+		return
+	}
+
+	// 先写临时文件再重命名，避免写入中断导致文件损坏
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		log.Printf("写入待上报结果失败: %v", err)
+		return
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		log.Printf("保存待上报结果失败: %v", err)
+	}
+}
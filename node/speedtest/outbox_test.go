@@ -0,0 +1,124 @@
+package speedtest
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutboxFlush(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses map[string]error
+		wantSent  int
+		wantLeft  []string
+		wantDead  []string
+	}{
+		{
+			name:     "全部成功",
+			wantSent: 3,
+		},
+		{
+			name:      "网络错误时停止",
+			responses: map[string]error{"b": errors.New("connection refused")},
+			wantSent:  1,
+			wantLeft:  []string{"b", "c"},
+		},
+		{
+			name:      "被拒绝的结果移入死信文件并继续",
+			responses: map[string]error{"a": &RejectedError{StatusCode: 400}},
+			wantSent:  2,
+			wantDead:  []string{"a"},
+		},
+		{
+			name: "拒绝后遇到网络错误",
+			responses: map[string]error{
+				"a": &RejectedError{StatusCode: 404},
+				"b": errors.New("timeout"),
+			},
+			wantSent: 0,
+			wantLeft: []string{"b", "c"},
+			wantDead: []string{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "outbox")
+			if err != nil {
+				t.Fatal(err)
+			}
+			o := NewOutbox(dir)
+			for _, id := range []string{"a", "b", "c"} {
+				o.Add(SpeedTestResult{ID: id})
+			}
+
+			sent := o.Flush(func(result SpeedTestResult) error {
+				return tt.responses[result.ID]
+			})
+			if sent != tt.wantSent {
+				t.Errorf("sent = %d, want %d", sent, tt.wantSent)
+			}
+
+			if got := ids(o.pending); !equalIDs(got, tt.wantLeft) {
+				t.Errorf("pending = %v, want %v", got, tt.wantLeft)
+			}
+
+			// 重新加载应得到相同的待上报结果
+			if got := ids(NewOutbox(dir).pending); !equalIDs(got, tt.wantLeft) {
+				t.Errorf("reloaded pending = %v, want %v", got, tt.wantLeft)
+			}
+
+			var dead []SpeedTestResult
+			if data, err := ioutil.ReadFile(filepath.Join(dir, "outbox.dead.json")); err == nil {
+				if err := json.Unmarshal(data, &dead); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := ids(dead); !equalIDs(got, tt.wantDead) {
+				t.Errorf("dead = %v, want %v", got, tt.wantDead)
+			}
+		})
+	}
+}
+
+func TestOutboxFlushKeepsConcurrentAdds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := NewOutbox(dir)
+	o.Add(SpeedTestResult{ID: "a"})
+
+	// 发送期间加入的新结果不能被补报过程覆盖
+	o.Flush(func(result SpeedTestResult) error {
+		o.Add(SpeedTestResult{ID: "late"})
+		return nil
+	})
+
+	if got := ids(o.pending); !equalIDs(got, []string{"late"}) {
+		t.Errorf("pending = %v, want [late]", got)
+	}
+}
+
+func ids(results []SpeedTestResult) []string {
+	var out []string
+	for _, r := range results {
+		out = append(out, r.ID)
+	}
+	return out
+}
+
+func equalIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,8 +14,12 @@ import (
 	"math"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
+
+	"节点管理测速项目/common/signature"
+	"节点管理测速项目/node/metrics"
 )
 
 // SpeedTestType 表示测速类型
@@ -36,8 +41,12 @@ const (
 	StatusCompleted SpeedTestStatus = "completed" // 已完成
 	StatusFailed    SpeedTestStatus = "failed"    // 失败
 	StatusTimeout   SpeedTestStatus = "timeout"   // 超时
+	StatusCancelled SpeedTestStatus = "cancelled" // 节点关闭时取消
 )
 
+// ErrShuttingDown 节点正在关闭，不再接受新的测试
+var ErrShuttingDown = errors.New("节点正在关闭，不再接受新的测试")
+
 // SpeedTestResult 表示测速结果
 type SpeedTestResult struct {
 	ID            string          `json:"id"`             // 测试ID
@@ -65,6 +74,11 @@ type SpeedTestRequest struct {
 	Type         SpeedTestType `json:"type"`          // 测试类型
 	Timeout      int           `json:"timeout"`       // 超时时间（秒）
 	Threads      int           `json:"threads"`       // 线程数
+
+	// 目标节点的地址，未设置TargetURL时按测试类型访问其测速接口
+	TargetBaseURL string `json:"target_base_url"`
+	TargetToken   string `json:"target_token"` // 面板签发的目标令牌，访问目标节点测速接口时携带
+	Size          int    `json:"size"`         // 下载测速的数据量（MB）
 }
 
 // 测速管理器
@@ -75,6 +89,13 @@ type SpeedTestManager struct {
 	nodeID      string
 	nodeKey     string
 	httpClient  *http.Client
+	panelClient *http.Client
+	outbox      *Outbox
+
+	// 关闭时使用：draining后拒绝新测试，关闭cancel后取消剩余测试
+	draining bool
+	cancel   chan struct{}
+	reports  sync.WaitGroup
 }
 
 // 创建新的测速管理器
@@ -87,6 +108,52 @@ func NewSpeedTestManager(panelURL, nodeID, nodeKey string) *SpeedTestManager {
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		panelClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		cancel: make(chan struct{}),
+	}
+}
+
+// 设置访问目标节点使用的TLS配置，启用TLS后节点之间使用面板签发的证书认证
+func (m *SpeedTestManager) SetTargetTLS(tlsConfig *tls.Config) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.httpClient = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+}
+
+// 测速目标的地址：优先使用请求中的URL，其次是目标节点的测速接口，最后是面板
+func (m *SpeedTestManager) targetURL(req SpeedTestRequest, path string) string {
+	if req.TargetURL != "" {
+		return req.TargetURL
+	}
+	base := req.TargetBaseURL
+	if base == "" {
+		base = m.panelURL
+	}
+	return strings.TrimRight(base, "/") + path
+}
+
+// 访问目标节点测速接口时携带的令牌，访问自定义URL时不发送
+func targetToken(req SpeedTestRequest) string {
+	if req.TargetURL != "" || req.TargetBaseURL == "" {
+		return ""
+	}
+	return req.TargetToken
+}
+
+// 设置连接面板使用的TLS配置，测速请求仍使用默认配置
+func (m *SpeedTestManager) SetPanelTLS(tlsConfig *tls.Config) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.panelClient = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
 	}
 }
 
@@ -94,6 +161,10 @@ func NewSpeedTestManager(panelURL, nodeID, nodeKey string) *SpeedTestManager {
 func (m *SpeedTestManager) StartTest(req SpeedTestRequest) (*SpeedTestResult, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+
+	if m.draining {
+		return nil, ErrShuttingDown
+	}
 	
 	// 创建测试结果
 	result := &SpeedTestResult{
@@ -128,20 +199,7 @@ func (m *SpeedTestManager) StartTest(req SpeedTestRequest) (*SpeedTestResult, er
 		// 启动测试协程
 		go func() {
 			defer close(done)
-			
-			// 根据测试类型执行不同的测试
-			switch req.Type {
-			case TypeDownload:
-				err = m.runDownloadTest(req, result)
-			case TypeUpload:
-				err = m.runUploadTest(req, result)
-			case TypePing:
-				err = m.runPingTest(req, result)
-			case TypeFull:
-				err = m.runFullTest(req, result)
-			default:
-				err = errors.New("未知的测试类型")
-			}
+			err = m.runTest(req, result)
 		}()
 		
 		// 等待测试完成或超时
@@ -152,6 +210,10 @@ func (m *SpeedTestManager) StartTest(req SpeedTestRequest) (*SpeedTestResult, er
 			// 测试超时
 			err = errors.New("测试超时")
 			result.Status = StatusTimeout
+		case <-m.cancel:
+			// 节点关闭前未能完成
+			err = errors.New("节点正在关闭，测试已取消")
+			result.Status = StatusCancelled
 		}
 		
 		// 完成测试
@@ -163,7 +225,7 @@ func (m *SpeedTestManager) StartTest(req SpeedTestRequest) (*SpeedTestResult, er
 		
 		if err != nil {
 			result.Error = err.Error()
-			if result.Status != StatusTimeout {
+			if result.Status != StatusTimeout && result.Status != StatusCancelled {
 				result.Status = StatusFailed
 			}
 			log.Printf("测速失败: %v", err)
@@ -171,9 +233,14 @@ func (m *SpeedTestManager) StartTest(req SpeedTestRequest) (*SpeedTestResult, er
 			result.Status = StatusCompleted
 			log.Printf("测速完成: %+v", *result)
 		}
+		m.recordMetrics(req, *result)
 		
 		// 上报结果到面板
-		go m.reportTestResult(*result)
+		m.reports.Add(1)
+		go func(result SpeedTestResult) {
+			defer m.reports.Done()
+			m.reportTestResult(result)
+		}(*result)
 		
 		// 一段时间后清理测试结果
 		go func() {
@@ -187,6 +254,65 @@ func (m *SpeedTestManager) StartTest(req SpeedTestRequest) (*SpeedTestResult, er
 	return result, nil
 }
 
+// RunLocal 在当前协程中执行测速并返回结果，不上报面板，用于命令行诊断
+func (m *SpeedTestManager) RunLocal(req SpeedTestRequest) SpeedTestResult {
+	result := &SpeedTestResult{
+		ID:           req.ID,
+		SourceNodeID: req.SourceNodeID,
+		TargetNodeID: req.TargetNodeID,
+		Type:         req.Type,
+		Status:       StatusRunning,
+		StartTime:    time.Now(),
+	}
+
+	timeout := time.Duration(req.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = 120 * time.Second
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- m.runTest(req, result)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(timeout):
+		err = errors.New("测试超时")
+		result.Status = StatusTimeout
+	}
+
+	result.EndTime = time.Now()
+	result.Duration = result.EndTime.Sub(result.StartTime).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		if result.Status != StatusTimeout {
+			result.Status = StatusFailed
+		}
+	} else {
+		result.Status = StatusCompleted
+	}
+
+	return *result
+}
+
+// 根据测试类型执行不同的测试
+func (m *SpeedTestManager) runTest(req SpeedTestRequest, result *SpeedTestResult) error {
+	switch req.Type {
+	case TypeDownload:
+		return m.runDownloadTest(req, result)
+	case TypeUpload:
+		return m.runUploadTest(req, result)
+	case TypePing:
+		return m.runPingTest(req, result)
+	case TypeFull:
+		return m.runFullTest(req, result)
+	default:
+		return errors.New("未知的测试类型")
+	}
+}
+
 // 获取测试结果
 func (m *SpeedTestManager) GetTestResult(testID string) (*SpeedTestResult, bool) {
 	m.mutex.RLock()
@@ -196,6 +322,55 @@ func (m *SpeedTestManager) GetTestResult(testID string) (*SpeedTestResult, bool)
 	return result, exists
 }
 
+// ActiveCount 返回正在运行的测试数量
+func (m *SpeedTestManager) ActiveCount() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	count := 0
+	for _, test := range m.activeTests {
+		if test.Status == StatusRunning {
+			count++
+		}
+	}
+	return count
+}
+
+// 记录测速结果指标，调用时需持有锁
+func (m *SpeedTestManager) recordMetrics(req SpeedTestRequest, result SpeedTestResult) {
+	testType := string(result.Type)
+	metrics.TestsTotal.Inc(testType, string(result.Status))
+
+	// 未指定目标时测试的是面板的测速接口
+	target := req.TargetURL
+	if target == "" {
+		target = m.panelURL
+	}
+
+	success := 0.0
+	if result.Status == StatusCompleted {
+		success = 1
+	}
+	metrics.LastSuccess.Set(success, target, testType)
+	metrics.LastTimestamp.Set(float64(result.EndTime.Unix()), target, testType)
+	metrics.LastDuration.Set(float64(result.Duration)/1000, target, testType)
+	if result.Status != StatusCompleted {
+		return
+	}
+
+	if result.Type == TypePing || result.Type == TypeFull {
+		metrics.LastPing.Set(result.Ping, target, testType)
+		metrics.LastJitter.Set(result.Jitter, target, testType)
+		metrics.LastPacketLoss.Set(result.PacketLoss, target, testType)
+	}
+	if result.Type == TypeDownload || result.Type == TypeFull {
+		metrics.LastDownloadSpeed.Set(result.DownloadSpeed, target, testType)
+	}
+	if result.Type == TypeUpload || result.Type == TypeFull {
+		metrics.LastUploadSpeed.Set(result.UploadSpeed, target, testType)
+	}
+}
+
 // 获取所有活跃测试
 func (m *SpeedTestManager) GetAllTests() []SpeedTestResult {
 	m.mutex.RLock()
@@ -214,11 +389,12 @@ func (m *SpeedTestManager) runDownloadTest(req SpeedTestRequest, result *SpeedTe
 	log.Printf("开始下载测速: %s -> %s", req.SourceNodeID, req.TargetNodeID)
 	
 	// 确定目标URL
-	targetURL := req.TargetURL
-	if targetURL == "" {
-		// 如果没有提供URL，使用默认测试URL
-		targetURL = fmt.Sprintf("%s/speedtest/download?size=100", m.panelURL)
+	size := req.Size
+	if size <= 0 {
+		size = 100
 	}
+	targetURL := m.targetURL(req, fmt.Sprintf("/speedtest/download?size=%d", size))
+	token := targetToken(req)
 	
 	// 确定线程数
 	threads := req.Threads
@@ -248,6 +424,9 @@ func (m *SpeedTestManager) runDownloadTest(req SpeedTestRequest, result *SpeedTe
 			// 设置请求头
 			req.Header.Set("Cache-Control", "no-cache")
 			req.Header.Set("User-Agent", "NodeSpeedTest/1.0")
+			if token != "" {
+				req.Header.Set(signature.HeaderTargetToken, token)
+			}
 			
 			// 执行请求
 			startTime := time.Now()
@@ -298,11 +477,8 @@ func (m *SpeedTestManager) runUploadTest(req SpeedTestRequest, result *SpeedTest
 	log.Printf("开始上传测速: %s -> %s", req.SourceNodeID, req.TargetNodeID)
 	
 	// 确定目标URL
-	targetURL := req.TargetURL
-	if targetURL == "" {
-		// 如果没有提供URL，使用默认测试URL
-		targetURL = fmt.Sprintf("%s/speedtest/upload", m.panelURL)
-	}
+	targetURL := m.targetURL(req, "/speedtest/upload")
+	token := targetToken(req)
 	
 	// 确定线程数
 	threads := req.Threads
@@ -339,6 +515,9 @@ func (m *SpeedTestManager) runUploadTest(req SpeedTestRequest, result *SpeedTest
 			// 设置请求头
 			req.Header.Set("Content-Type", "application/octet-stream")
 			req.Header.Set("User-Agent", "NodeSpeedTest/1.0")
+			if token != "" {
+				req.Header.Set(signature.HeaderTargetToken, token)
+			}
 			
 			// 执行请求
 			startTime := time.Now()
@@ -389,12 +568,7 @@ func (m *SpeedTestManager) runPingTest(req SpeedTestRequest, result *SpeedTestRe
 	log.Printf("开始Ping测试: %s -> %s", req.SourceNodeID, req.TargetNodeID)
 	
 	// 确定目标主机
-	host := req.TargetURL
-	if host == "" {
-		// 如果没有提供URL，尝试解析目标节点的IP
-		// 实际应用中应该从面板获取节点IP
-		host = fmt.Sprintf("%s/speedtest/ping", m.panelURL)
-	}
+	host := m.targetURL(req, "/speedtest/ping")
 	
 	// 准备测试
 	count := 10 // 默认ping 10次
@@ -493,40 +667,165 @@ func (m *SpeedTestManager) runFullTest(req SpeedTestRequest, result *SpeedTestRe
 	return nil
 }
 
-// 上报测试结果到面板
+// 更新面板地址和节点密钥，配置热更新时调用
+func (m *SpeedTestManager) SetPanel(panelURL, nodeKey string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.panelURL = panelURL
+	m.nodeKey = nodeKey
+}
+
+// 设置待上报队列，上报失败的结果将缓存并在面板恢复后补报
+func (m *SpeedTestManager) SetOutbox(outbox *Outbox) {
+	m.outbox = outbox
+}
+
+// 启动待上报结果的定时补报任务
+func (m *SpeedTestManager) StartOutboxFlush(interval time.Duration) {
+	if m.outbox == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			if m.outbox.Len() == 0 {
+				continue
+			}
+			if sent := m.outbox.Flush(m.sendTestResult); sent > 0 {
+				log.Printf("已补报测试结果 %d 条，剩余 %d 条", sent, m.outbox.Len())
+			}
+		}
+	}()
+}
+
+// Drain 停止接受新测试并等待运行中的测试完成，超过ctx期限时取消剩余测试，
+// 随后等待结果上报完成并补报待上报队列，返回被取消的测试数量
+func (m *SpeedTestManager) Drain(ctx context.Context) int {
+	m.mutex.Lock()
+	m.draining = true
+	m.mutex.Unlock()
+
+	cancelled := 0
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for m.ActiveCount() > 0 {
+		select {
+		case <-ticker.C:
+			continue
+		case <-ctx.Done():
+		}
+
+		// 已到期限，取消剩余测试并等待其结束
+		cancelled = m.ActiveCount()
+		close(m.cancel)
+		for m.ActiveCount() > 0 {
+			<-ticker.C
+		}
+	}
+
+	// 等待结果上报，上报失败的结果会进入待上报队列
+	done := make(chan struct{})
+	go func() {
+		m.reports.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		log.Println("等待测试结果上报超时")
+	}
+
+	if m.outbox != nil && m.outbox.Len() > 0 {
+		sent := m.outbox.Flush(m.sendTestResult)
+		log.Printf("关闭前补报测试结果 %d 条，剩余 %d 条", sent, m.outbox.Len())
+	}
+
+	return cancelled
+}
+
+// 上报测试结果到面板，失败时加入待上报队列
 func (m *SpeedTestManager) reportTestResult(result SpeedTestResult) {
+	if err := m.sendTestResult(result); err != nil {
+		log.Printf("上报测试结果失败: %v", err)
+		if IsRejected(err) {
+			// 面板明确拒绝的结果重试也不会成功，直接写入死信文件
+			if m.outbox != nil {
+				m.outbox.Reject(result)
+			}
+			return
+		}
+		if m.outbox != nil {
+			m.outbox.Add(result)
+			log.Printf("测试结果已加入待上报队列: %s", result.ID)
+		}
+		return
+	}
+
+	log.Printf("成功上报测试结果: %s", result.ID)
+}
+
+// 发送测试结果到面板
+func (m *SpeedTestManager) sendTestResult(result SpeedTestResult) error {
+	m.mutex.RLock()
+	panelURL, nodeKey, client := m.panelURL, m.nodeKey, m.panelClient
+	m.mutex.RUnlock()
+
+	if panelURL == "" {
+		return errors.New("面板URL未设置")
+	}
+
 	// 准备请求体
 	body, err := json.Marshal(result)
 	if err != nil {
-		log.Printf("序列化测试结果失败: %v", err)
-		return
+		return fmt.Errorf("序列化测试结果失败: %v", err)
 	}
 	
 	// 创建HTTP请求
-	url := fmt.Sprintf("%s/api/node/speedtest/result", m.panelURL)
+	url := fmt.Sprintf("%s/api/node/speedtest/result", panelURL)
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
 	if err != nil {
-		log.Printf("创建HTTP请求失败: %v", err)
-		return
+		return fmt.Errorf("创建HTTP请求失败: %v", err)
 	}
 	
 	// 设置请求头
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Node-Key", m.nodeKey)
+	if err := signature.SignRequest(req, body, m.nodeID, signature.SigningKey(nodeKey)); err != nil {
+		return err
+	}
 	
 	// 执行请求
-	resp, err := m.httpClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
-		log.Printf("上报测试结果失败: %v", err)
-		return
+		return err
 	}
 	defer resp.Body.Close()
 	
-	// 检查响应状态
+	// 面板的错误通常以HTTP 200和响应中的code返回，例如签名无效或数据校验失败
+	var payload struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("上报测试结果失败，状态码: %d", resp.StatusCode)
-		return
+		payload.Code = resp.StatusCode
+	} else if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return fmt.Errorf("解析面板响应失败: %v", err)
 	}
-	
-	log.Printf("成功上报测试结果: %s", result.ID)
-} 
\ No newline at end of file
+	if payload.Code == 0 {
+		return nil
+	}
+
+	// 认证失败、限流和超时可能随密钥更新或稍后重试恢复，其余4xx视为永久拒绝
+	switch payload.Code {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusTooManyRequests:
+	default:
+		if payload.Code >= 400 && payload.Code < 500 {
+			return &RejectedError{StatusCode: payload.Code, Message: payload.Message}
+		}
+	}
+	if payload.Message != "" {
+		return fmt.Errorf("状态码: %d, %s", payload.Code, payload.Message)
+	}
+	return fmt.Errorf("状态码: %d", payload.Code)
+}
\ No newline at end of file
@@ -0,0 +1,46 @@
+package speedtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSendTestResult(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantErr  bool
+		rejected bool
+	}{
+		{"上报成功", http.StatusOK, `{"code":0,"message":"success"}`, false, false},
+		// 面板的ErrorResponse以HTTP 200返回，错误在code中
+		{"签名无效可重试", http.StatusOK, `{"code":401,"message":"无效的请求签名"}`, true, false},
+		{"无权上报可重试", http.StatusOK, `{"code":403,"message":"节点无权上报该测试"}`, true, false},
+		{"数据无效时拒绝", http.StatusOK, `{"code":400,"message":"无效的测试结果"}`, true, true},
+		{"面板内部错误可重试", http.StatusInternalServerError, `{"code":500}`, true, false},
+		{"HTTP 404时拒绝", http.StatusNotFound, ``, true, true},
+		{"响应无法解析可重试", http.StatusOK, `<html>`, true, false},
+	}
+	for _, tt := range tests {
+		panel := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/node/speedtest/result" {
+				t.Errorf("%s: 请求路径 %s", tt.name, r.URL.Path)
+			}
+			w.WriteHeader(tt.status)
+			w.Write([]byte(tt.body))
+		}))
+
+		m := NewSpeedTestManager(panel.URL, "node-1", "key")
+		err := m.sendTestResult(SpeedTestResult{ID: "a", Status: StatusCompleted})
+		panel.Close()
+
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if IsRejected(err) != tt.rejected {
+			t.Errorf("%s: IsRejected(%v) = %v, want %v", tt.name, err, IsRejected(err), tt.rejected)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package speedtest
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"节点管理测速项目/common/signature"
+	"节点管理测速项目/node/metrics"
+)
+
+// 作为测速目标时的限制
+const (
+	defaultTargetDownloadSize = 100  // 默认下载大小（MB）
+	maxTargetDownloadSize     = 1000 // 单次下载上限（MB）
+	maxTargetUploadSize       = 1000 // 单次上传上限（MB）
+)
+
+// 下载接口重复发送的随机数据块
+var targetPayload = func() []byte {
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+	return data
+}()
+
+// RegisterTargets 注册测速目标接口，其他节点可以对本节点执行下载、上传和Ping测试。
+// 下载和上传需要携带面板随测试下发的目标令牌，Ping开销很小，无需令牌
+func (m *SpeedTestManager) RegisterTargets(mux *http.ServeMux) {
+	mux.Handle("/speedtest/download", m.requireTargetToken(http.HandlerFunc(handleTargetDownload)))
+	mux.Handle("/speedtest/upload", m.requireTargetToken(http.HandlerFunc(handleTargetUpload)))
+	mux.HandleFunc("/speedtest/ping", handleTargetPing)
+}
+
+// 校验面板使用本节点密钥签发的目标令牌，令牌只在对应测试的超时时间内有效
+func (m *SpeedTestManager) requireTargetToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mutex.RLock()
+		nodeID, nodeKey := m.nodeID, m.nodeKey
+		m.mutex.RUnlock()
+
+		token := r.Header.Get(signature.HeaderTargetToken)
+		if token == "" || nodeKey == "" {
+			http.Error(w, "缺少测速令牌", http.StatusUnauthorized)
+			return
+		}
+		if _, err := signature.VerifyTargetToken(token, signature.SigningKey(nodeKey), nodeID, time.Now()); err != nil {
+			log.Printf("测速令牌校验失败: %s %s: %v", r.Method, r.URL.Path, err)
+			http.Error(w, "无效的测速令牌", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// 下载测试目标，返回 size 参数指定大小（MB）的随机数据
+func handleTargetDownload(w http.ResponseWriter, r *http.Request) {
+	size, err := strconv.Atoi(r.URL.Query().Get("size"))
+	if err != nil || size <= 0 {
+		size = defaultTargetDownloadSize
+	}
+	if size > maxTargetDownloadSize {
+		size = maxTargetDownloadSize
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(size*len(targetPayload)))
+	w.Header().Set("Cache-Control", "no-store")
+
+	var sent int64
+	for i := 0; i < size; i++ {
+		n, err := w.Write(targetPayload)
+		sent += int64(n)
+		if err != nil {
+			break
+		}
+	}
+	metrics.TargetRequests.Inc("download")
+	metrics.ServedBytes.Add(float64(sent), "download")
+}
+
+// 上传测试目标，读取并丢弃请求体
+func handleTargetUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "只支持POST请求", http.StatusMethodNotAllowed)
+		return
+	}
+
+	received, _ := io.Copy(ioutil.Discard, io.LimitReader(r.Body, maxTargetUploadSize<<20))
+	metrics.TargetRequests.Inc("upload")
+	metrics.ServedBytes.Add(float64(received), "upload")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"received": received})
+}
+
+// Ping测试目标，立即返回
+func handleTargetPing(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusNoContent)
+	metrics.TargetRequests.Inc("ping")
+}
@@ -0,0 +1,46 @@
+package sysinfo
+
+import (
+	"sync"
+)
+
+// Stats 节点的系统资源使用情况，随心跳上报给面板
+type Stats struct {
+	CPU       float64    `json:"cpu"`        // CPU使用率（百分比），为两次采集之间的平均值
+	Memory    float64    `json:"memory"`     // 内存使用率（百分比）
+	Disk      float64    `json:"disk"`       // 根分区使用率（百分比）
+	Uptime    int64      `json:"uptime"`     // 系统运行时间（秒）
+	Load      [3]float64 `json:"load"`       // 系统负载（1分钟、5分钟、15分钟）
+	NetworkRx int64      `json:"network_rx"` // 除回环接口外的接收字节数
+	NetworkTx int64      `json:"network_tx"` // 除回环接口外的发送字节数
+}
+
+// CPU时间采样，用于计算两次采集之间的使用率
+type cpuSample struct {
+	busy  uint64
+	total uint64
+}
+
+var (
+	lastCPU cpuSample
+	mutex   sync.Mutex
+)
+
+// Collect 采集系统资源使用情况，无法读取的项保持为零值。
+// 第一次采集的CPU使用率为系统启动以来的平均值
+func Collect() Stats {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	var stats Stats
+	collect(&stats)
+	return stats
+}
+
+// 根据两次采样计算CPU使用率
+func cpuPercent(prev, cur cpuSample) float64 {
+	if cur.total <= prev.total || cur.busy < prev.busy {
+		return 0
+	}
+	return float64(cur.busy-prev.busy) / float64(cur.total-prev.total) * 100
+}
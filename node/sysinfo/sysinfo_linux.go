@@ -0,0 +1,155 @@
+//go:build linux
+
+package sysinfo
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+func collect(stats *Stats) {
+	if cur, ok := readCPU(); ok {
+		stats.CPU = cpuPercent(lastCPU, cur)
+		lastCPU = cur
+	}
+	stats.Memory = readMemory()
+	stats.Disk = readDisk("/")
+	stats.Uptime = readUptime()
+	stats.Load = readLoad()
+	stats.NetworkRx, stats.NetworkTx = readNetwork()
+}
+
+// 读取 /proc/stat 第一行的CPU时间，iowait和idle计为空闲
+func readCPU() (cpuSample, bool) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return cpuSample{}, false
+	}
+	line := strings.SplitN(string(data), "\n", 2)[0]
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return cpuSample{}, false
+	}
+
+	var sample cpuSample
+	for i, field := range fields[1:] {
+		// guest和guest_nice已计入user和nice
+		if i >= 8 {
+			break
+		}
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return cpuSample{}, false
+		}
+		sample.total += value
+		if i != 3 && i != 4 {
+			sample.busy += value
+		}
+	}
+	return sample, true
+}
+
+// 根据 /proc/meminfo 的 MemTotal 和 MemAvailable 计算内存使用率
+func readMemory() float64 {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	var total, available float64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = value
+		case "MemAvailable:":
+			available = value
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return (total - available) / total * 100
+}
+
+// 分区使用率，与df一致不计入为root保留的空间
+func readDisk(path string) float64 {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0
+	}
+	used := float64(fs.Blocks-fs.Bfree) * float64(fs.Bsize)
+	usable := used + float64(fs.Bavail)*float64(fs.Bsize)
+	if usable == 0 {
+		return 0
+	}
+	return used / usable * 100
+}
+
+func readUptime() int64 {
+	data, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0
+	}
+	uptime, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+	return int64(uptime)
+}
+
+func readLoad() [3]float64 {
+	var load [3]float64
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return load
+	}
+	fields := strings.Fields(string(data))
+	for i := 0; i < 3 && i < len(fields); i++ {
+		load[i], _ = strconv.ParseFloat(fields[i], 64)
+	}
+	return load
+}
+
+// 汇总 /proc/net/dev 中除回环接口外的收发字节数
+func readNetwork() (int64, int64) {
+	file, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return 0, 0
+	}
+	defer file.Close()
+
+	var rx, tx int64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		name, counters, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.TrimSpace(name) == "lo" {
+			continue
+		}
+		fields := strings.Fields(counters)
+		if len(fields) < 9 {
+			continue
+		}
+		r, _ := strconv.ParseInt(fields[0], 10, 64)
+		t, _ := strconv.ParseInt(fields[8], 10, 64)
+		rx += r
+		tx += t
+	}
+	return rx, tx
+}
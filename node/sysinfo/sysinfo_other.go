@@ -0,0 +1,6 @@
+//go:build !linux
+
+package sysinfo
+
+// 其他系统暂不采集资源使用情况，上报零值
+func collect(stats *Stats) {}
@@ -0,0 +1,378 @@
+package update
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"节点管理测速项目/node/auth"
+)
+
+// 新版本启动失败的最大次数，超过后直接回滚
+const maxStartAttempts = 3
+
+// Requester 向面板发送签名请求
+type Requester func(method, path string, body []byte, timeout time.Duration) (*http.Response, error)
+
+// 更新状态，保存在数据目录中，重启后由新版本读取
+type state struct {
+	PendingVersion  string    `json:"pending_version"`  // 等待确认的新版本
+	PreviousVersion string    `json:"previous_version"` // 更新前的版本
+	BackupPath      string    `json:"backup_path"`      // 旧版本程序备份路径
+	StartedAt       time.Time `json:"started_at"`       // 更新时间
+	Attempts        int       `json:"attempts"`         // 新版本启动次数
+	FailedVersion   string    `json:"failed_version"`   // 最近一次回滚的版本
+	Status          string    `json:"status"`           // 最近一次更新的结果
+}
+
+// 面板发布清单接口响应
+type manifestResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Manifest  string `json:"manifest"`
+		Signature string `json:"signature"`
+	} `json:"data"`
+}
+
+// Updater 从面板下载经过签名的节点程序并替换自身，新版本未能按时完成心跳时回滚
+type Updater struct {
+	version   string
+	execPath  string
+	statePath string
+	request   Requester
+	state     state
+	running   bool
+	timer     *time.Timer
+	mutex     sync.Mutex
+}
+
+// 创建更新器，version为当前运行的版本
+func NewUpdater(version, dataDir string, request Requester) (*Updater, error) {
+	execPath, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("获取程序路径失败: %v", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(execPath); err == nil {
+		execPath = resolved
+	}
+
+	u := &Updater{
+		version:   version,
+		execPath:  execPath,
+		statePath: filepath.Join(dataDir, "update_state.json"),
+		request:   request,
+	}
+
+	data, err := ioutil.ReadFile(u.statePath)
+	if err == nil {
+		if err := json.Unmarshal(data, &u.state); err != nil {
+			log.Printf("解析更新状态失败，忽略: %v", err)
+		}
+	}
+	return u, nil
+}
+
+// Resume 启动时检查上一次更新，新版本需在超时时间内完成心跳，否则回滚到旧版本
+func (u *Updater) Resume(timeout time.Duration) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if u.state.PendingVersion == "" {
+		return
+	}
+
+	// 当前运行的不是待确认的版本，说明替换未生效或已被人工回滚
+	if u.state.PendingVersion != u.version {
+		log.Printf("更新到 %s 未生效，当前版本: %s", u.state.PendingVersion, u.version)
+		os.Remove(u.state.BackupPath)
+		u.state.Status = fmt.Sprintf("更新到 %s 未生效", u.state.PendingVersion)
+		u.state.PendingVersion = ""
+		u.saveState()
+		return
+	}
+
+	u.state.Attempts++
+	u.saveState()
+	if u.state.Attempts > maxStartAttempts {
+		u.rollback(fmt.Sprintf("新版本已启动 %d 次仍未确认", u.state.Attempts-1))
+		return
+	}
+
+	log.Printf("等待新版本 %s 完成心跳，超时时间: %v", u.version, timeout)
+	u.timer = time.AfterFunc(timeout, func() {
+		u.mutex.Lock()
+		defer u.mutex.Unlock()
+		if u.state.PendingVersion == u.version {
+			u.rollback(fmt.Sprintf("新版本在 %v 内未能完成心跳", timeout))
+		}
+	})
+}
+
+// Confirm 心跳成功后调用，确认新版本可用并删除旧版本备份
+func (u *Updater) Confirm() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if u.state.PendingVersion == "" || u.state.PendingVersion != u.version {
+		return
+	}
+	if u.timer != nil {
+		u.timer.Stop()
+	}
+
+	os.Remove(u.state.BackupPath)
+	log.Printf("已确认更新到 %s", u.version)
+	u.state.Status = fmt.Sprintf("已从 %s 更新到 %s", u.state.PreviousVersion, u.version)
+	u.state.PendingVersion = ""
+	u.state.Attempts = 0
+	u.saveState()
+}
+
+// Status 返回最近一次更新的结果和回滚过的版本，随心跳上报面板
+func (u *Updater) Status() (string, string) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.state.Status, u.state.FailedVersion
+}
+
+// Offer 面板通知有新版本时调用，在后台完成下载、校验和替换
+func (u *Updater) Offer(target, publicKey string) {
+	u.mutex.Lock()
+	if u.running || target == u.version || target == u.state.FailedVersion || u.state.PendingVersion != "" {
+		u.mutex.Unlock()
+		return
+	}
+	u.running = true
+	u.mutex.Unlock()
+
+	go func() {
+		err := u.apply(target, publicKey)
+
+		u.mutex.Lock()
+		defer u.mutex.Unlock()
+		u.running = false
+		if err != nil {
+			log.Printf("更新到 %s 失败: %v", target, err)
+			u.state.Status = fmt.Sprintf("更新到 %s 失败: %v", target, err)
+			u.saveState()
+		}
+	}()
+}
+
+// 下载并安装新版本，成功后重启进程
+func (u *Updater) apply(target, publicKey string) error {
+	if publicKey == "" {
+		return fmt.Errorf("未配置发布公钥，无法校验节点程序")
+	}
+	key, err := auth.ParseReleasePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := u.fetchManifest(key)
+	if err != nil {
+		return err
+	}
+	if manifest.Version != target {
+		return fmt.Errorf("发布清单版本 %s 与目标版本不一致", manifest.Version)
+	}
+
+	binary, ok := manifest.Binaries[runtime.GOARCH]
+	if !ok {
+		return fmt.Errorf("发布清单中没有 %s 架构的节点程序", runtime.GOARCH)
+	}
+
+	log.Printf("开始更新到 %s", target)
+	newPath := u.execPath + ".new"
+	if err := u.download(runtime.GOARCH, newPath, binary); err != nil {
+		os.Remove(newPath)
+		return err
+	}
+
+	// 确认新程序可以在本机运行
+	if err := checkVersion(newPath, target); err != nil {
+		os.Remove(newPath)
+		return err
+	}
+
+	// 保留旧版本用于回滚，再用重命名原子替换程序文件
+	backupPath := u.execPath + ".old"
+	os.Remove(backupPath)
+	if err := os.Link(u.execPath, backupPath); err != nil {
+		if err := copyFile(u.execPath, backupPath); err != nil {
+			os.Remove(newPath)
+			return fmt.Errorf("备份当前程序失败: %v", err)
+		}
+	}
+	if err := os.Rename(newPath, u.execPath); err != nil {
+		os.Remove(newPath)
+		return fmt.Errorf("替换程序失败: %v", err)
+	}
+
+	u.mutex.Lock()
+	u.state = state{
+		PendingVersion:  target,
+		PreviousVersion: u.version,
+		BackupPath:      backupPath,
+		StartedAt:       time.Now(),
+		FailedVersion:   u.state.FailedVersion,
+		Status:          fmt.Sprintf("正在更新到 %s", target),
+	}
+	u.saveState()
+	u.mutex.Unlock()
+
+	log.Printf("节点程序已替换为 %s，正在重启", target)
+	return restart(u.execPath)
+}
+
+// 获取并校验发布清单
+func (u *Updater) fetchManifest(key []byte) (*auth.ReleaseManifest, error) {
+	resp, err := u.request("GET", "/api/node/update/manifest", nil, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("获取发布清单失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result manifestResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("解析发布清单响应失败: %v", err)
+	}
+	if result.Code != 0 {
+		return nil, fmt.Errorf("获取发布清单失败: %s", result.Message)
+	}
+
+	return auth.VerifyReleaseManifest([]byte(result.Data.Manifest), []byte(result.Data.Signature), key)
+}
+
+// 下载节点程序并校验大小和SHA-256
+func (u *Updater) download(arch, path string, binary auth.ReleaseBinary) error {
+	resp, err := u.request("GET", "/api/node/update/binary/"+arch, nil, 10*time.Minute)
+	if err != nil {
+		return fmt.Errorf("下载节点程序失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("下载节点程序失败，状态码: %d", resp.StatusCode)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %v", err)
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(resp.Body, binary.Size+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("下载节点程序失败: %v", err)
+	}
+
+	if size != binary.Size {
+		return fmt.Errorf("节点程序大小不一致，期望 %d，实际 %d", binary.Size, size)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(sum, binary.SHA256) {
+		return fmt.Errorf("节点程序校验和不一致，期望 %s，实际 %s", binary.SHA256, sum)
+	}
+	return nil
+}
+
+// 回滚到旧版本并重启，调用时需持有锁
+func (u *Updater) rollback(reason string) {
+	log.Printf("更新到 %s 失败，回滚到 %s: %s", u.state.PendingVersion, u.state.PreviousVersion, reason)
+
+	if err := os.Rename(u.state.BackupPath, u.execPath); err != nil {
+		log.Printf("回滚失败，请手动恢复 %s: %v", u.state.BackupPath, err)
+		return
+	}
+
+	u.state.FailedVersion = u.state.PendingVersion
+	u.state.Status = fmt.Sprintf("更新到 %s 失败，已回滚: %s", u.state.PendingVersion, reason)
+	u.state.PendingVersion = ""
+	u.state.Attempts = 0
+	u.saveState()
+
+	if err := restart(u.execPath); err != nil {
+		log.Printf("回滚后重启失败: %v", err)
+	}
+}
+
+// 保存更新状态，调用时需持有锁
+func (u *Updater) saveState() {
+	data, err := json.MarshalIndent(u.state, "", "  ")
+	if err != nil {
+		log.Printf("序列化更新状态失败: %v", err)
+		return
+	}
+
+	tmpPath := u.statePath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		log.Printf("保存更新状态失败: %v", err)
+		return
+	}
+	if err := os.Rename(tmpPath, u.statePath); err != nil {
+		log.Printf("保存更新状态失败: %v", err)
+	}
+}
+
+// 运行新程序的 -version 参数，确认版本一致且能在本机运行
+func checkVersion(path, target string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, path, "-version").Output()
+	if err != nil {
+		return fmt.Errorf("新程序无法运行: %v", err)
+	}
+	if !bytes.Contains(output, []byte(target)) {
+		return fmt.Errorf("新程序版本不一致: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// 以相同参数和环境变量重新执行程序，进程ID保持不变
+func restart(execPath string) error {
+	return syscall.Exec(execPath, os.Args, os.Environ())
+}
+
+// 复制文件并保留权限
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,247 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"../models"
+	"../notify"
+)
+
+// 串行评估，避免同一节点对的两个结果同时上报时重复触发告警
+var mutex sync.Mutex
+
+// 测试结果没有异常检测记录（基线样本不足），不评估异常规则
+var errNoBaseline = errors.New("基线样本不足")
+
+// EvaluateResult 用一次测试结果评估所有适用的告警规则，只评估成功的测试
+func EvaluateResult(result *models.SpeedTestResult) {
+	if result.Status != models.SpeedTestStatusCompleted {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	rules, err := models.GetAlertRules()
+	if err != nil {
+		log.Printf("读取告警规则失败: %v", err)
+		return
+	}
+
+	tags := nodeTags(result.SourceNodeID, result.TargetNodeID)
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.Enabled || !matchesPair(rule.SourceNodeID, rule.TargetNodeID, rule.Tag, result.SourceNodeID, result.TargetNodeID, tags) {
+			continue
+		}
+		if _, ok := result.Metric(rule.Metric); !ok {
+			continue
+		}
+
+		value, err := ruleValue(rule, result)
+		if err == errNoBaseline {
+			continue
+		}
+		if err == nil {
+			err = record(rule, result.SourceNodeID, result.TargetNodeID, value, result.ID, tags)
+		}
+		if err != nil {
+			log.Printf("评估告警规则 %s 失败: %v", rule.Name, err)
+		}
+	}
+}
+
+// RuleChanged 规则修改、停用或删除后清除评估状态，并将触发中的告警标记为已恢复
+func RuleChanged(ruleID, message string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if err := models.ResetAlertRuleStates(ruleID); err != nil {
+		return err
+	}
+	alerts, err := models.ResolveRuleAlerts(ruleID, message)
+	if err != nil {
+		return err
+	}
+	for i := range alerts {
+		announce(&alerts[i])
+	}
+	return nil
+}
+
+// 记录规则的一次评估：连续超过阈值达到次数时触发告警，已触发的告警在指标恢复后标记为已恢复。
+// 节点规则的targetNodeID为空
+func record(rule *models.AlertRule, sourceNodeID, targetNodeID string, value float64, resultID string, tags map[string][]string) error {
+	breached := breaches(rule, value)
+
+	count, err := models.UpdateAlertRuleState(rule.ID, sourceNodeID, targetNodeID, breached)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	firing, err := models.GetFiringAlert(rule.ID, sourceNodeID, targetNodeID)
+	if err != nil {
+		return err
+	}
+
+	// 已有触发中的告警时只更新最新值，不重复触发
+	if firing != nil {
+		firing.LastValue = value
+		firing.LastEvaluatedAt = now
+		if !breached {
+			firing.State = models.AlertStateResolved
+			firing.ResolvedAt = now
+			firing.Message = fmt.Sprintf("%s 已恢复，当前值 %.2f", describe(rule), value)
+		}
+		if err := models.SaveAlert(firing); err != nil {
+			return err
+		}
+		if !breached {
+			announce(firing)
+		}
+		return nil
+	}
+
+	if !breached || count < rule.Consecutive {
+		return nil
+	}
+
+	alert := &models.Alert{
+		RuleID:          rule.ID,
+		RuleName:        rule.Name,
+		Severity:        rule.Severity,
+		SourceNodeID:    sourceNodeID,
+		TargetNodeID:    targetNodeID,
+		State:           models.AlertStateFiring,
+		Value:           value,
+		LastValue:       value,
+		Threshold:       rule.Threshold,
+		Message:         fmt.Sprintf("%s，当前值 %.2f，连续 %d 次", describe(rule), value, count),
+		ResultID:        resultID,
+		StartedAt:       now,
+		LastEvaluatedAt: now,
+	}
+
+	silenced, err := isSilenced(rule.ID, sourceNodeID, targetNodeID, tags, now)
+	if err != nil {
+		return err
+	}
+	alert.Silenced = silenced
+
+	if err := models.SaveAlert(alert); err != nil {
+		return err
+	}
+	announce(alert)
+	return nil
+}
+
+// 计算规则在节点对上的指标值，聚合时使用包括本次结果在内的最近若干次测试，
+// 异常规则使用本次结果的偏离程度
+func ruleValue(rule *models.AlertRule, result *models.SpeedTestResult) (float64, error) {
+	if rule.Aggregation == AggregationAnomaly {
+		score, err := models.GetAnomalyScore(result.ID, rule.Metric)
+		if err != nil {
+			return 0, err
+		}
+		if score == nil {
+			return 0, errNoBaseline
+		}
+		return score.Score, nil
+	}
+
+	value, _ := result.Metric(rule.Metric)
+	if rule.Aggregation == AggregationLast || rule.Window <= 1 {
+		return value, nil
+	}
+
+	recent, err := models.GetRecentMetricResults(result.SourceNodeID, result.TargetNodeID, rule.Metric, rule.Window)
+	if err != nil {
+		return 0, err
+	}
+	values := make([]float64, 0, len(recent))
+	for i := range recent {
+		if v, ok := recent[i].Metric(rule.Metric); ok {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		values = append(values, value)
+	}
+	return aggregate(values, rule.Aggregation), nil
+}
+
+// 检查节点或节点对是否处于生效的静默规则中
+func isSilenced(ruleID, sourceNodeID, targetNodeID string, tags map[string][]string, now time.Time) (bool, error) {
+	silences, err := models.GetSilences(now)
+	if err != nil {
+		return false, err
+	}
+	for _, silence := range silences {
+		if silence.RuleID != "" && silence.RuleID != ruleID {
+			continue
+		}
+		if matchesPair(silence.SourceNodeID, silence.TargetNodeID, silence.Tag, sourceNodeID, targetNodeID, tags) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// 检查节点对是否在规则或静默的适用范围内，标签匹配源节点或目标节点。
+// 节点告警的目标节点为空，只按源节点匹配
+func matchesPair(sourceNodeID, targetNodeID, tag, source, target string, tags map[string][]string) bool {
+	if sourceNodeID != "" && sourceNodeID != source {
+		return false
+	}
+	if targetNodeID != "" && targetNodeID != target {
+		return false
+	}
+	if tag == "" {
+		return true
+	}
+	return hasTag(tags[source], tag) || hasTag(tags[target], tag)
+}
+
+// 读取节点的标签，节点已删除时没有标签
+func nodeTags(ids ...string) map[string][]string {
+	tags := make(map[string][]string, len(ids))
+	for _, id := range ids {
+		if node, err := models.GetNode(id); err == nil {
+			tags[id] = node.Tags
+		}
+	}
+	return tags
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.TrimSpace(t) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// 记录告警的触发和恢复并发送到通知渠道，静默中的告警不提示
+func announce(alert *models.Alert) {
+	if alert.Silenced {
+		return
+	}
+	subject := alert.SourceNodeID
+	if alert.TargetNodeID != "" {
+		subject += " -> " + alert.TargetNodeID
+	}
+	switch alert.State {
+	case models.AlertStateFiring:
+		log.Printf("[告警][%s] %s: %s %s", alert.Severity, alert.RuleName, subject, alert.Message)
+	case models.AlertStateResolved:
+		log.Printf("[恢复] %s: %s %s", alert.RuleName, subject, alert.Message)
+	}
+	notify.SendAlert(alert)
+}
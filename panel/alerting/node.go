@@ -0,0 +1,145 @@
+package alerting
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"../../common/signature"
+	"../models"
+)
+
+// 节点指标，由存活检查定期评估
+const (
+	MetricNodeOffline  = "node_offline"  // 离线时长（分钟）
+	MetricCPU          = "cpu"           // CPU使用率（百分比）
+	MetricMemory       = "memory"        // 内存使用率（百分比）
+	MetricDisk         = "disk"          // 硬盘使用率（百分比）
+	MetricVersionDrift = "version_drift" // 版本与目标版本不一致时为1，否则为0
+	MetricClockSkew    = "clock_skew"    // 时钟偏差的绝对值（秒）
+)
+
+func isNodeMetric(metric string) bool {
+	switch metric {
+	case MetricNodeOffline, MetricCPU, MetricMemory, MetricDisk, MetricVersionDrift, MetricClockSkew:
+		return true
+	}
+	return false
+}
+
+// EvaluateNodes 用节点当前的心跳数据评估所有节点规则
+func EvaluateNodes(nodes []models.Node) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	rules, err := models.GetAlertRules()
+	if err != nil {
+		log.Printf("读取告警规则失败: %v", err)
+		return
+	}
+
+	now := time.Now()
+	versions := targetVersions(nodes)
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.Enabled || !isNodeMetric(rule.Metric) {
+			continue
+		}
+
+		for j := range nodes {
+			node := &nodes[j]
+			tags := map[string][]string{node.ID: node.Tags}
+			if !matchesPair(rule.SourceNodeID, "", rule.Tag, node.ID, "", tags) {
+				continue
+			}
+
+			value, ok := nodeValue(rule.Metric, node, versions, now)
+			if !ok {
+				continue
+			}
+			if err := record(rule, node.ID, "", value, "", tags); err != nil {
+				log.Printf("评估告警规则 %s 失败: %v", rule.Name, err)
+			}
+		}
+	}
+}
+
+// 计算节点指标的当前值，数据不可信时（例如节点不在线时的资源使用率）不评估，保持原有告警状态。
+// 主动关闭的维护中节点不计为离线
+func nodeValue(metric string, node *models.Node, versions map[string]string, now time.Time) (float64, bool) {
+	if metric == MetricNodeOffline {
+		switch node.Status {
+		case models.NodeStatusOnline:
+			return 0, true
+		case models.NodeStatusOffline, models.NodeStatusError:
+			if node.LastSeen.IsZero() {
+				return 0, false
+			}
+			return now.Sub(node.LastSeen).Minutes(), true
+		}
+		return 0, false
+	}
+
+	// 时钟偏差超出签名允许的范围时节点的请求都会被拒绝，节点显示为离线，
+	// 此时的偏差来自被拒绝请求中的时间戳，仍然需要评估
+	if metric == MetricClockSkew && math.Abs(node.ClockSkew) > signature.MaxClockSkew.Seconds() {
+		return math.Abs(node.ClockSkew), true
+	}
+
+	if node.Status != models.NodeStatusOnline {
+		return 0, false
+	}
+
+	switch metric {
+	case MetricCPU:
+		return node.CPU, true
+	case MetricMemory:
+		return node.Memory, true
+	case MetricDisk:
+		return node.Disk, true
+	case MetricClockSkew:
+		return math.Abs(node.ClockSkew), true
+	case MetricVersionDrift:
+		target := versions[node.Group]
+		if node.Version == "" || target == "" {
+			return 0, false
+		}
+		if node.Version != target {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// 各分组节点应运行的版本：有更新发布记录时为发布的版本，否则为所有节点中最常见的版本
+func targetVersions(nodes []models.Node) map[string]string {
+	counts := make(map[string]int)
+	common := ""
+	for _, node := range nodes {
+		if node.Version == "" {
+			continue
+		}
+		counts[node.Version]++
+		if counts[node.Version] > counts[common] || (counts[node.Version] == counts[common] && node.Version > common) {
+			common = node.Version
+		}
+	}
+
+	versions := make(map[string]string)
+	for _, node := range nodes {
+		if _, ok := versions[node.Group]; ok {
+			continue
+		}
+		versions[node.Group] = common
+		rollout, err := models.GetUpdateRolloutForGroup(node.Group)
+		if err != nil {
+			log.Printf("查询节点更新发布记录失败: %v", err)
+			continue
+		}
+		if rollout != nil && rollout.Version != "" {
+			versions[node.Group] = rollout.Version
+		}
+	}
+	return versions
+}
@@ -0,0 +1,144 @@
+package alerting
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"../models"
+)
+
+// 聚合方式
+const (
+	AggregationLast = "last"
+	AggregationAvg  = "avg"
+	AggregationMin  = "min"
+	AggregationMax  = "max"
+	AggregationP95  = "p95"
+
+	// 本次结果偏离节点对基线的标准差倍数，速度低于基线或延迟高于基线时分别为负数和正数
+	AggregationAnomaly = "anomaly"
+)
+
+// 聚合窗口和连续次数的上限
+const (
+	maxWindow      = 100
+	maxConsecutive = 100
+)
+
+// ValidateRule 校验告警规则，并为未设置的聚合方式、窗口、连续次数和严重程度填充默认值
+func ValidateRule(rule *models.AlertRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return fmt.Errorf("规则名称不能为空")
+	}
+	if models.MetricTestTypes(rule.Metric) == nil && !isNodeMetric(rule.Metric) {
+		return fmt.Errorf("无效的指标: %s", rule.Metric)
+	}
+
+	// 节点规则按节点评估当前状态，不做聚合
+	if isNodeMetric(rule.Metric) {
+		if rule.TargetNodeID != "" {
+			return fmt.Errorf("节点指标 %s 不能指定目标节点", rule.Metric)
+		}
+		if rule.Aggregation != "" && rule.Aggregation != AggregationLast {
+			return fmt.Errorf("节点指标 %s 不支持聚合", rule.Metric)
+		}
+		// 版本偏差只有是否一致两种取值
+		if rule.Metric == MetricVersionDrift && rule.Operator == "" {
+			rule.Operator = ">="
+			rule.Threshold = 1
+		}
+	}
+
+	if rule.Aggregation == "" {
+		rule.Aggregation = AggregationLast
+	}
+	switch rule.Aggregation {
+	case AggregationLast, AggregationAnomaly:
+		rule.Window = 1
+	case AggregationAvg, AggregationMin, AggregationMax, AggregationP95:
+		if rule.Window < 1 || rule.Window > maxWindow {
+			return fmt.Errorf("聚合窗口应为 1-%d 次测试", maxWindow)
+		}
+	default:
+		return fmt.Errorf("无效的聚合方式: %s", rule.Aggregation)
+	}
+
+	switch rule.Operator {
+	case "<", "<=", ">", ">=":
+	default:
+		return fmt.Errorf("无效的比较运算符: %s", rule.Operator)
+	}
+
+	if rule.Consecutive == 0 {
+		rule.Consecutive = 1
+	}
+	if rule.Consecutive < 1 || rule.Consecutive > maxConsecutive {
+		return fmt.Errorf("连续次数应为 1-%d", maxConsecutive)
+	}
+
+	if rule.Severity == "" {
+		rule.Severity = models.SeverityWarning
+	}
+	if models.SeverityLevel(rule.Severity) < 0 {
+		return fmt.Errorf("无效的严重程度: %s", rule.Severity)
+	}
+	return nil
+}
+
+// 判断指标值是否超过阈值
+func breaches(rule *models.AlertRule, value float64) bool {
+	switch rule.Operator {
+	case "<":
+		return value < rule.Threshold
+	case "<=":
+		return value <= rule.Threshold
+	case ">":
+		return value > rule.Threshold
+	case ">=":
+		return value >= rule.Threshold
+	}
+	return false
+}
+
+// 按聚合方式计算一组指标值，p95使用最近秩法
+func aggregate(values []float64, aggregation string) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	switch aggregation {
+	case AggregationAvg:
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values))
+	case AggregationMin, AggregationMax, AggregationP95:
+		sorted := append([]float64(nil), values...)
+		sort.Float64s(sorted)
+		switch aggregation {
+		case AggregationMin:
+			return sorted[0]
+		case AggregationMax:
+			return sorted[len(sorted)-1]
+		}
+		rank := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+		return sorted[rank]
+	default:
+		return values[0]
+	}
+}
+
+// 规则的可读描述，例如 "p95(ping, 10) > 80"
+func describe(rule *models.AlertRule) string {
+	expr := rule.Metric
+	if rule.Aggregation == AggregationAnomaly {
+		expr = fmt.Sprintf("anomaly(%s)", rule.Metric)
+	} else if rule.Aggregation != AggregationLast {
+		expr = fmt.Sprintf("%s(%s, %d)", rule.Aggregation, rule.Metric, rule.Window)
+	}
+	return fmt.Sprintf("%s %s %g", expr, rule.Operator, rule.Threshold)
+}
@@ -0,0 +1,230 @@
+package anomaly
+
+import (
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"../config"
+	"../models"
+)
+
+// 正态分布下MAD与标准差的换算系数
+const madScale = 1.4826
+
+// 基线标准差的下限：不低于中位数的1%，也不低于各指标的最小有意义变化，
+// 避免历史结果完全相同时（例如丢包率一直为0）任何微小波动都被标记为异常
+const minRelativeDeviation = 0.01
+
+var minDeviation = map[string]float64{
+	models.MetricDownloadSpeed: 0.5, // Mbps
+	models.MetricUploadSpeed:   0.5, // Mbps
+	models.MetricPing:          0.5, // 毫秒
+	models.MetricJitter:        0.5, // 毫秒
+	models.MetricPacketLoss:    0.5, // 百分比
+}
+
+// Settings 异常检测参数
+type Settings struct {
+	Window      int     `json:"window"`       // 基线使用的最近测试次数
+	MinSamples  int     `json:"min_samples"`  // 基线的最少样本数
+	Threshold   float64 `json:"threshold"`    // 偏离超过该倍数的标准差时为异常
+	SeasonHours int     `json:"season_hours"` // 相同时段的范围（前后小时数），12表示不区分时段
+}
+
+// CurrentSettings 返回当前的异常检测参数，系统设置优先于配置文件
+func CurrentSettings() Settings {
+	cfg := config.GetConfig()
+	settings := Settings{
+		Window:      models.GetIntSetting("anomaly_window", cfg.AnomalyWindow),
+		MinSamples:  models.GetIntSetting("anomaly_min_samples", cfg.AnomalyMinSamples),
+		Threshold:   models.GetFloatSetting("anomaly_threshold", cfg.AnomalyThreshold),
+		SeasonHours: models.GetIntSetting("anomaly_season_hours", cfg.AnomalySeasonHours),
+	}
+	if settings.MinSamples < 3 {
+		settings.MinSamples = 3
+	}
+	if settings.Window < settings.MinSamples {
+		settings.Window = settings.MinSamples
+	}
+	if settings.Threshold <= 0 {
+		settings.Threshold = 3
+	}
+	if settings.SeasonHours <= 0 || settings.SeasonHours > 12 {
+		settings.SeasonHours = 12
+	}
+	return settings
+}
+
+// Baseline 节点对某个指标在某一时刻的基线
+type Baseline struct {
+	Metric    string  `json:"metric"`
+	Median    float64 `json:"median"`
+	Deviation float64 `json:"deviation"` // 稳健标准差
+	Samples   int     `json:"samples"`
+	Seasonal  bool    `json:"seasonal"` // 是否只使用相同时段的历史结果
+}
+
+// Detect 将成功的测试结果与节点对的基线比较，记录各指标的偏离程度，基线样本不足的指标不记录
+func Detect(result *models.SpeedTestResult) {
+	if result.Status != models.SpeedTestStatusCompleted {
+		return
+	}
+
+	settings := CurrentSettings()
+	var scores []models.AnomalyScore
+	for _, metric := range models.Metrics {
+		value, ok := result.Metric(metric)
+		if !ok {
+			continue
+		}
+
+		baseline, err := compute(result.SourceNodeID, result.TargetNodeID, metric, result.StartTime, settings)
+		if err != nil {
+			log.Printf("计算测速结果 %s 的 %s 基线失败: %v", result.ID, metric, err)
+			return
+		}
+		if baseline == nil {
+			continue
+		}
+
+		score := (value - baseline.Median) / baseline.Deviation
+		scores = append(scores, models.AnomalyScore{
+			ResultID:     result.ID,
+			SourceNodeID: result.SourceNodeID,
+			TargetNodeID: result.TargetNodeID,
+			Metric:       metric,
+			Value:        value,
+			Baseline:     baseline.Median,
+			Deviation:    baseline.Deviation,
+			Score:        score,
+			Samples:      baseline.Samples,
+			Seasonal:     baseline.Seasonal,
+			Anomalous:    math.Abs(score) > settings.Threshold,
+			Degraded:     degraded(metric, score),
+			StartTime:    result.StartTime,
+		})
+	}
+
+	if err := models.SaveAnomalyScores(result.ID, scores); err != nil {
+		log.Printf("保存测速结果 %s 的异常检测结果失败: %v", result.ID, err)
+		return
+	}
+	for _, score := range scores {
+		if score.Anomalous {
+			log.Printf("测速结果 %s 的 %s 异常: %.2f，基线 %.2f±%.2f，偏离 %.1f 倍标准差",
+				result.ID, score.Metric, score.Value, score.Baseline, score.Deviation, score.Score)
+		}
+	}
+}
+
+// Baselines 返回节点对各指标在at时刻的基线，样本不足的指标不返回
+func Baselines(sourceNodeID, targetNodeID string, at time.Time) ([]Baseline, error) {
+	settings := CurrentSettings()
+	baselines := []Baseline{}
+	for _, metric := range models.Metrics {
+		baseline, err := compute(sourceNodeID, targetNodeID, metric, at, settings)
+		if err != nil {
+			return nil, err
+		}
+		if baseline != nil {
+			baselines = append(baselines, *baseline)
+		}
+	}
+	return baselines, nil
+}
+
+// 用at之前的历史结果计算基线：优先使用一天中相同时段的最近Window次结果，
+// 相同时段的样本不足时使用不区分时段的最近Window次结果，仍不足时返回nil
+func compute(sourceNodeID, targetNodeID, metric string, at time.Time, settings Settings) (*Baseline, error) {
+	seasonal := settings.SeasonHours < 12
+	limit := settings.Window
+	if seasonal {
+		// 相同时段的结果分散在更长的历史中，多取一些再筛选
+		limit = settings.Window * 24 / (2*settings.SeasonHours + 1)
+		if limit > 2000 {
+			limit = 2000
+		}
+	}
+
+	history, err := models.GetMetricHistory(sourceNodeID, targetNodeID, metric, at, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var all, season []float64
+	for i := range history {
+		value, _ := history[i].Metric(metric)
+		if len(all) < settings.Window {
+			all = append(all, value)
+		}
+		if seasonal && len(season) < settings.Window && hourDistance(history[i].StartTime, at) <= float64(settings.SeasonHours) {
+			season = append(season, value)
+		}
+	}
+
+	values := all
+	if seasonal && len(season) >= settings.MinSamples {
+		values = season
+	} else {
+		seasonal = false
+	}
+	if len(values) < settings.MinSamples {
+		return nil, nil
+	}
+
+	median, mad := medianMAD(values)
+	deviation := math.Max(madScale*mad, math.Max(minRelativeDeviation*math.Abs(median), minDeviation[metric]))
+	return &Baseline{
+		Metric:    metric,
+		Median:    median,
+		Deviation: deviation,
+		Samples:   len(values),
+		Seasonal:  seasonal,
+	}, nil
+}
+
+// 两个时刻在一天中的时间差（小时），跨越零点时按较短的一侧计算
+func hourDistance(a, b time.Time) float64 {
+	const day = 24 * 60 * 60
+	diff := math.Abs(float64(secondOfDay(a) - secondOfDay(b)))
+	if diff > day/2 {
+		diff = day - diff
+	}
+	return diff / 3600
+}
+
+func secondOfDay(t time.Time) int {
+	t = t.UTC()
+	return t.Hour()*3600 + t.Minute()*60 + t.Second()
+}
+
+// 返回中位数和绝对中位差
+func medianMAD(values []float64) (float64, float64) {
+	m := median(values)
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - m)
+	}
+	return m, median(deviations)
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// 判断偏离方向是否为变差：速度越高越好，延迟、抖动和丢包越低越好
+func degraded(metric string, score float64) bool {
+	switch metric {
+	case models.MetricDownloadSpeed, models.MetricUploadSpeed:
+		return score < 0
+	}
+	return score > 0
+}
@@ -0,0 +1,81 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	"../models"
+)
+
+func TestMedianMAD(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		median float64
+		mad    float64
+	}{
+		{"单个值", []float64{5}, 5, 0},
+		{"奇数个", []float64{3, 1, 2}, 2, 1},
+		{"偶数个取中间两个的平均", []float64{4, 1, 3, 2}, 2.5, 1},
+		{"相同的值", []float64{7, 7, 7, 7}, 7, 0},
+		{"离群值不影响结果", []float64{10, 11, 9, 10, 1000}, 10, 1},
+	}
+	for _, tt := range tests {
+		input := append([]float64(nil), tt.values...)
+		median, mad := medianMAD(input)
+		if median != tt.median || mad != tt.mad {
+			t.Errorf("%s: medianMAD(%v) = %v, %v, want %v, %v", tt.name, tt.values, median, mad, tt.median, tt.mad)
+		}
+		for i := range input {
+			if input[i] != tt.values[i] {
+				t.Errorf("%s: medianMAD 修改了输入", tt.name)
+				break
+			}
+		}
+	}
+}
+
+func TestHourDistance(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 3, 1, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		a, b time.Time
+		want float64
+	}{
+		{at(10, 0), at(10, 0), 0},
+		{at(10, 0), at(12, 30), 2.5},
+		{at(23, 0), at(1, 0), 2},
+		{at(0, 0), at(12, 0), 12},
+		// 不同日期只比较一天中的时间
+		{at(6, 0), at(7, 0).AddDate(0, 0, -3), 1},
+		// 按UTC计算，不受时区影响
+		{at(6, 0).In(time.FixedZone("UTC+8", 8*3600)), at(6, 0), 0},
+	}
+	for _, tt := range tests {
+		if got := hourDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("hourDistance(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDegraded(t *testing.T) {
+	tests := []struct {
+		metric string
+		score  float64
+		want   bool
+	}{
+		{models.MetricDownloadSpeed, -3, true},
+		{models.MetricDownloadSpeed, 3, false},
+		{models.MetricUploadSpeed, -1, true},
+		{models.MetricPing, 3, true},
+		{models.MetricPing, -3, false},
+		{models.MetricJitter, 2, true},
+		{models.MetricPacketLoss, 2, true},
+	}
+	for _, tt := range tests {
+		if got := degraded(tt.metric, tt.score); got != tt.want {
+			t.Errorf("degraded(%s, %v) = %v, want %v", tt.metric, tt.score, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"../alerting"
+	"../models"
+)
+
+// 保存告警规则请求
+type SaveAlertRuleRequest struct {
+	Name         string  `json:"name" binding:"required"`
+	Enabled      *bool   `json:"enabled"` // 未设置时默认启用
+	Metric       string  `json:"metric" binding:"required"`
+	Aggregation  string  `json:"aggregation"`
+	Window       int     `json:"window"`
+	Operator     string  `json:"operator"`
+	Threshold    float64 `json:"threshold"`
+	Consecutive  int     `json:"consecutive"`
+	Severity     string  `json:"severity"`
+	SourceNodeID string  `json:"source_node_id"`
+	TargetNodeID string  `json:"target_node_id"`
+	Tag          string  `json:"tag"`
+}
+
+// 将请求内容应用到告警规则
+func (req *SaveAlertRuleRequest) apply(rule *models.AlertRule) {
+	rule.Name = req.Name
+	rule.Enabled = req.Enabled == nil || *req.Enabled
+	rule.Metric = req.Metric
+	rule.Aggregation = req.Aggregation
+	rule.Window = req.Window
+	rule.Operator = req.Operator
+	rule.Threshold = req.Threshold
+	rule.Consecutive = req.Consecutive
+	rule.Severity = req.Severity
+	rule.SourceNodeID = strings.TrimSpace(req.SourceNodeID)
+	rule.TargetNodeID = strings.TrimSpace(req.TargetNodeID)
+	rule.Tag = strings.TrimSpace(req.Tag)
+}
+
+// 创建静默规则请求，未设置开始时间时立即生效，结束时间和持续时间二选一
+type CreateSilenceRequest struct {
+	RuleID       string    `json:"rule_id"`
+	SourceNodeID string    `json:"source_node_id"`
+	TargetNodeID string    `json:"target_node_id"`
+	Tag          string    `json:"tag"`
+	Comment      string    `json:"comment"`
+	StartsAt     time.Time `json:"starts_at"`
+	EndsAt       time.Time `json:"ends_at"`
+	Duration     int       `json:"duration"` // 持续时间（分钟）
+}
+
+// 获取所有告警规则
+func GetAlertRulesHandler(c *gin.Context) {
+	rules, err := models.GetAlertRules()
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+	if rules == nil {
+		rules = []models.AlertRule{}
+	}
+
+	SuccessResponse(c, gin.H{
+		"rules": rules,
+		"total": len(rules),
+	})
+}
+
+// 获取单个告警规则
+func GetAlertRuleHandler(c *gin.Context) {
+	rule, err := models.GetAlertRule(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, 404, err.Error())
+		return
+	}
+
+	SuccessResponse(c, rule)
+}
+
+// 创建告警规则
+func CreateAlertRuleHandler(c *gin.Context) {
+	var req SaveAlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的请求数据: %v", err))
+		return
+	}
+
+	rule := &models.AlertRule{CreatedBy: c.GetString("username")}
+	req.apply(rule)
+	if err := alerting.ValidateRule(rule); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if err := models.SaveAlertRule(rule); err != nil {
+		APIError(c, err)
+		return
+	}
+
+	log.Printf("用户 %s 创建了告警规则 %s (%s)", c.GetString("username"), rule.Name, rule.ID)
+	SuccessResponse(c, rule)
+}
+
+// 更新告警规则，触发中的告警标记为已恢复，按新规则重新计数
+func UpdateAlertRuleHandler(c *gin.Context) {
+	rule, err := models.GetAlertRule(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, 404, err.Error())
+		return
+	}
+
+	var req SaveAlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的请求数据: %v", err))
+		return
+	}
+
+	req.apply(rule)
+	if err := alerting.ValidateRule(rule); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if err := models.SaveAlertRule(rule); err != nil {
+		APIError(c, err)
+		return
+	}
+	if err := alerting.RuleChanged(rule.ID, "告警规则已修改"); err != nil {
+		APIError(c, err)
+		return
+	}
+
+	SuccessResponse(c, rule)
+}
+
+// 删除告警规则，告警历史保留
+func DeleteAlertRuleHandler(c *gin.Context) {
+	if err := models.DeleteAlertRule(c.Param("id")); err != nil {
+		ErrorResponse(c, 404, err.Error())
+		return
+	}
+	if err := alerting.RuleChanged(c.Param("id"), "告警规则已删除"); err != nil {
+		APIError(c, err)
+		return
+	}
+
+	SuccessResponse(c, gin.H{"message": "告警规则已删除"})
+}
+
+// 查询告警历史，可按状态、规则和节点过滤
+func GetAlertsHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		ErrorResponse(c, 400, "无效的数量，应为1到1000")
+		return
+	}
+
+	state := models.AlertState(c.Query("state"))
+	if state != "" && state != models.AlertStateFiring && state != models.AlertStateResolved {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的告警状态: %s", state))
+		return
+	}
+
+	alerts, err := models.GetAlerts(models.AlertFilter{
+		State:  state,
+		RuleID: c.Query("rule"),
+		NodeID: c.Query("node"),
+		Limit:  limit,
+	})
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	SuccessResponse(c, gin.H{
+		"alerts": alerts,
+		"total":  len(alerts),
+	})
+}
+
+// 获取单个告警
+func GetAlertHandler(c *gin.Context) {
+	alert, err := models.GetAlert(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, 404, err.Error())
+		return
+	}
+
+	SuccessResponse(c, alert)
+}
+
+// 获取静默规则，active=true时只返回当前生效的
+func GetSilencesHandler(c *gin.Context) {
+	var activeAt time.Time
+	if c.Query("active") == "true" {
+		activeAt = time.Now()
+	}
+
+	silences, err := models.GetSilences(activeAt)
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	SuccessResponse(c, gin.H{
+		"silences": silences,
+		"total":    len(silences),
+	})
+}
+
+// 创建静默规则
+func CreateSilenceHandler(c *gin.Context) {
+	var req CreateSilenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的请求数据: %v", err))
+		return
+	}
+
+	silence := &models.Silence{
+		RuleID:       strings.TrimSpace(req.RuleID),
+		SourceNodeID: strings.TrimSpace(req.SourceNodeID),
+		TargetNodeID: strings.TrimSpace(req.TargetNodeID),
+		Tag:          strings.TrimSpace(req.Tag),
+		Comment:      strings.TrimSpace(req.Comment),
+		StartsAt:     req.StartsAt,
+		EndsAt:       req.EndsAt,
+		CreatedBy:    c.GetString("username"),
+	}
+	if silence.StartsAt.IsZero() {
+		silence.StartsAt = time.Now()
+	}
+
+	switch {
+	case !req.EndsAt.IsZero() && req.Duration != 0:
+		ErrorResponse(c, 400, "结束时间和持续时间只能设置一个")
+		return
+	case req.Duration > 0:
+		silence.EndsAt = silence.StartsAt.Add(time.Duration(req.Duration) * time.Minute)
+	case req.EndsAt.IsZero():
+		ErrorResponse(c, 400, "需要设置结束时间或持续时间")
+		return
+	}
+	if !silence.EndsAt.After(silence.StartsAt) {
+		ErrorResponse(c, 400, "结束时间必须晚于开始时间")
+		return
+	}
+
+	if silence.RuleID != "" {
+		if _, err := models.GetAlertRule(silence.RuleID); err != nil {
+			ErrorResponse(c, 400, err.Error())
+			return
+		}
+	}
+
+	if err := models.SaveSilence(silence); err != nil {
+		APIError(c, err)
+		return
+	}
+
+	log.Printf("用户 %s 创建了静默规则 %s，%s 至 %s", c.GetString("username"), silence.ID,
+		silence.StartsAt.Format(time.RFC3339), silence.EndsAt.Format(time.RFC3339))
+	SuccessResponse(c, silence)
+}
+
+// 删除静默规则
+func DeleteSilenceHandler(c *gin.Context) {
+	if err := models.DeleteSilence(c.Param("id")); err != nil {
+		ErrorResponse(c, 404, err.Error())
+		return
+	}
+
+	SuccessResponse(c, gin.H{"message": "静默规则已删除"})
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"../anomaly"
+	"../models"
+)
+
+// 查询异常结果，可按节点、节点对和指标过滤
+func GetAnomaliesHandler(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil || days < 1 || days > 90 {
+		ErrorResponse(c, 400, "无效的天数，应为1到90")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		ErrorResponse(c, 400, "无效的数量，应为1到1000")
+		return
+	}
+	metric := c.Query("metric")
+	if metric != "" && models.MetricTestTypes(metric) == nil {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的指标: %s", metric))
+		return
+	}
+
+	anomalies, err := models.GetAnomalies(models.AnomalyFilter{
+		NodeID:       c.Query("node"),
+		SourceNodeID: c.Query("source"),
+		TargetNodeID: c.Query("target"),
+		Metric:       metric,
+		Since:        time.Now().AddDate(0, 0, -days),
+		Limit:        limit,
+	})
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	SuccessResponse(c, gin.H{
+		"anomalies": anomalies,
+		"total":     len(anomalies),
+	})
+}
+
+// 获取节点对当前时段各指标的基线和异常检测参数
+func GetBaselinesHandler(c *gin.Context) {
+	sourceNodeID := c.Query("source")
+	targetNodeID := c.Query("target")
+	if sourceNodeID == "" || targetNodeID == "" {
+		ErrorResponse(c, 400, "必须指定源节点和目标节点")
+		return
+	}
+
+	baselines, err := anomaly.Baselines(sourceNodeID, targetNodeID, time.Now())
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	SuccessResponse(c, gin.H{
+		"source_node_id": sourceNodeID,
+		"target_node_id": targetNodeID,
+		"baselines":      baselines,
+		"settings":       anomaly.CurrentSettings(),
+	})
+}
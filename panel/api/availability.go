@@ -0,0 +1,84 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"../models"
+)
+
+// 可用率统计窗口的上限（小时）
+const maxAvailabilityHours = 24 * 90
+
+// 解析统计窗口，默认最近24小时
+func availabilityWindow(c *gin.Context) (time.Time, time.Time, bool) {
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", "24"))
+	if err != nil || hours <= 0 || hours > maxAvailabilityHours {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的统计时长，应为1到%d小时", maxAvailabilityHours))
+		return time.Time{}, time.Time{}, false
+	}
+
+	now := time.Now()
+	return now.Add(-time.Duration(hours) * time.Hour), now, true
+}
+
+// 获取所有节点在统计窗口内的可用率
+func GetAvailabilityHandler(c *gin.Context) {
+	since, now, ok := availabilityWindow(c)
+	if !ok {
+		return
+	}
+
+	nodes, err := models.GetAllNodes()
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	availability, err := models.GetAllNodeAvailability(nodes, since, now)
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	SuccessResponse(c, gin.H{
+		"since": since,
+		"nodes": availability,
+	})
+}
+
+// 获取单个节点在统计窗口内的可用率和状态变更记录
+func GetNodeAvailabilityHandler(c *gin.Context) {
+	nodeID := c.Param("id")
+	node, err := models.GetNode(nodeID)
+	if err != nil {
+		ErrorResponse(c, 404, fmt.Sprintf("节点不存在: %s", nodeID))
+		return
+	}
+
+	since, now, ok := availabilityWindow(c)
+	if !ok {
+		return
+	}
+
+	availability, err := models.GetNodeAvailability(node, since, now)
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	history, err := models.GetNodeStatusHistory(node.ID, since)
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	SuccessResponse(c, gin.H{
+		"since":        since,
+		"availability": availability,
+		"history":      history,
+	})
+}
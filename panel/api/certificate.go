@@ -0,0 +1,105 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"../auth"
+	"../config"
+	"../models"
+)
+
+// 节点证书请求
+type NodeCertificateRequest struct {
+	CSR string `json:"csr" binding:"required"` // PEM格式的证书签名请求
+}
+
+// 节点证书响应
+type NodeCertificateResponse struct {
+	Certificate   string    `json:"certificate"`    // PEM格式的节点证书
+	CACertificate string    `json:"ca_certificate"` // PEM格式的CA证书
+	Serial        string    `json:"serial"`         // 证书序列号
+	ExpiresAt     time.Time `json:"expires_at"`     // 过期时间
+}
+
+// 为节点签发证书，首次申请和到期前续期均使用此接口
+func IssueNodeCertificateHandler(c *gin.Context) {
+	ca := auth.GetCA()
+	if ca == nil {
+		ErrorResponse(c, 400, "面板未启用TLS")
+		return
+	}
+
+	var req NodeCertificateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的请求数据: %v", err))
+		return
+	}
+
+	nodeID := c.GetString("nodeID")
+	node, err := models.GetNode(nodeID)
+	if err != nil {
+		ErrorResponse(c, 404, fmt.Sprintf("节点不存在: %s", nodeID))
+		return
+	}
+
+	validity := time.Duration(config.GetConfig().NodeCertValidity) * 24 * time.Hour
+	if validity <= 0 {
+		validity = 90 * 24 * time.Hour
+	}
+
+	certPEM, cert, err := ca.IssueNodeCertificate(node.ID, node.IP, []byte(req.CSR), validity)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	// 记录证书以便吊销
+	record := &models.NodeCertificate{
+		Serial:    auth.SerialString(cert),
+		NodeID:    node.ID,
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}
+	if err := models.SaveNodeCertificate(record); err != nil {
+		APIError(c, err)
+		return
+	}
+
+	SuccessResponse(c, NodeCertificateResponse{
+		Certificate:   string(certPEM),
+		CACertificate: string(ca.CertPEM()),
+		Serial:        record.Serial,
+		ExpiresAt:     cert.NotAfter,
+	})
+}
+
+// 获取面板CA证书，节点首次连接时下载并校验指纹
+func GetCACertificateHandler(c *gin.Context) {
+	ca := auth.GetCA()
+	if ca == nil {
+		c.String(http.StatusNotFound, "面板未启用TLS")
+		return
+	}
+
+	c.Header("X-CA-Fingerprint", ca.Fingerprint())
+	c.Data(http.StatusOK, "application/x-pem-file", ca.CertPEM())
+}
+
+// 获取节点证书列表
+func GetNodeCertificatesHandler(c *gin.Context) {
+	nodeID := c.Param("id")
+	certs, err := models.GetNodeCertificates(nodeID)
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	SuccessResponse(c, gin.H{
+		"certificates": certs,
+		"total":        len(certs),
+	})
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"../auth"
+	"../models"
+)
+
+// 注册令牌的默认值和上限
+const (
+	defaultEnrollmentTokenTTL = 24      // 默认有效期（小时）
+	maxEnrollmentTokenTTL     = 30 * 24 // 最长有效期（小时）
+	maxEnrollmentTokenUses    = 1000    // 最大使用次数
+)
+
+// 创建注册令牌请求
+type CreateEnrollmentTokenRequest struct {
+	NodeName  string   `json:"node_name"`  // 预设节点名称
+	Tags      []string `json:"tags"`       // 预设节点标签
+	Group     string   `json:"group"`      // 预设节点分组
+	MaxUses   int      `json:"max_uses"`   // 最大使用次数，默认1次
+	ExpiresIn int      `json:"expires_in"` // 有效期（小时），默认24小时
+}
+
+// 创建注册令牌响应，明文令牌只在此时返回一次
+type CreateEnrollmentTokenResponse struct {
+	Token          string                 `json:"token"`           // 明文令牌
+	Command        string                 `json:"command"`         // 安装命令
+	EnrollmentInfo models.EnrollmentToken `json:"enrollment_info"` // 令牌信息
+}
+
+// 节点注册请求
+type EnrollNodeRequest struct {
+	Token    string `json:"token" binding:"required"` // 注册令牌
+	Hostname string `json:"hostname"`                 // 节点主机名，令牌未预设名称时作为节点名称
+	IP       string `json:"ip"`                       // 节点IP，为空时使用请求来源地址
+	Version  string `json:"version"`                  // 节点版本
+}
+
+// 节点注册响应，包含节点的永久凭据
+type EnrollNodeResponse struct {
+	NodeID        string `json:"node_id"`        // 节点ID
+	NodeKey       string `json:"node_key"`       // 节点密钥
+	NodeName      string `json:"node_name"`      // 节点名称
+	CAFingerprint string `json:"ca_fingerprint"` // 面板CA指纹，未启用TLS时为空
+}
+
+// 创建注册令牌
+func CreateEnrollmentTokenHandler(c *gin.Context) {
+	var req CreateEnrollmentTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的请求数据: %v", err))
+		return
+	}
+
+	if req.MaxUses == 0 {
+		req.MaxUses = 1
+	}
+	if req.MaxUses < 0 || req.MaxUses > maxEnrollmentTokenUses {
+		ErrorResponse(c, 400, fmt.Sprintf("使用次数必须在1到%d之间", maxEnrollmentTokenUses))
+		return
+	}
+	if req.ExpiresIn == 0 {
+		req.ExpiresIn = defaultEnrollmentTokenTTL
+	}
+	if req.ExpiresIn < 0 || req.ExpiresIn > maxEnrollmentTokenTTL {
+		ErrorResponse(c, 400, fmt.Sprintf("有效期必须在1到%d小时之间", maxEnrollmentTokenTTL))
+		return
+	}
+
+	token, hash, err := auth.GenerateEnrollmentToken()
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	record := &models.EnrollmentToken{
+		Hash:      hash,
+		Prefix:    auth.NodeKeyPrefix(token),
+		NodeName:  strings.TrimSpace(req.NodeName),
+		Tags:      req.Tags,
+		Group:     strings.TrimSpace(req.Group),
+		MaxUses:   req.MaxUses,
+		ExpiresAt: time.Now().Add(time.Duration(req.ExpiresIn) * time.Hour),
+		CreatedBy: c.GetString("username"),
+	}
+	if err := models.CreateEnrollmentToken(record); err != nil {
+		APIError(c, err)
+		return
+	}
+
+	// 安装命令只包含令牌，节点安装时用令牌换取永久凭据
+	command := installCommand(panelBaseURL(c), token)
+
+	c.Header("Cache-Control", "no-store")
+	SuccessResponse(c, CreateEnrollmentTokenResponse{
+		Token:          token,
+		Command:        command,
+		EnrollmentInfo: *record,
+	})
+}
+
+// 获取注册令牌列表
+func GetEnrollmentTokensHandler(c *gin.Context) {
+	tokens, err := models.GetEnrollmentTokens()
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	SuccessResponse(c, gin.H{
+		"tokens": tokens,
+		"total":  len(tokens),
+	})
+}
+
+// 吊销注册令牌，已注册的节点不受影响
+func RevokeEnrollmentTokenHandler(c *gin.Context) {
+	if err := models.RevokeEnrollmentToken(c.Param("id")); err != nil {
+		ErrorResponse(c, 404, err.Error())
+		return
+	}
+
+	SuccessResponse(c, nil)
+}
+
+// 节点使用注册令牌换取节点ID和密钥
+func EnrollNodeHandler(c *gin.Context) {
+	var req EnrollNodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的请求数据: %v", err))
+		return
+	}
+
+	if !auth.IsEnrollmentToken(req.Token) {
+		ErrorResponse(c, 401, "无效的注册令牌")
+		return
+	}
+
+	token, err := models.UseEnrollmentToken(auth.HashToken(req.Token))
+	if err != nil {
+		log.Printf("节点注册失败，来源: %s，原因: %v", c.ClientIP(), err)
+		ErrorResponse(c, 401, err.Error())
+		return
+	}
+
+	// 令牌预设的名称优先，其次使用节点上报的主机名
+	name := token.NodeName
+	if name == "" {
+		name = strings.TrimSpace(req.Hostname)
+	}
+	if name == "" {
+		name = "node-" + c.ClientIP()
+	}
+	ip := strings.TrimSpace(req.IP)
+	if ip == "" {
+		ip = c.ClientIP()
+	}
+
+	node := &models.Node{
+		ID:        uuid.New().String(),
+		Name:      name,
+		IP:        ip,
+		Status:    models.NodeStatusOffline,
+		LastSeen:  time.Now(),
+		CreatedAt: time.Now(),
+		Tags:      token.Tags,
+		Group:     token.Group,
+		Version:   req.Version,
+	}
+	if err := models.SaveNode(node); err != nil {
+		releaseEnrollmentToken(token.ID)
+		APIError(c, err)
+		return
+	}
+
+	nodeKey, _, err := issueNodeKey(node.ID)
+	if err != nil {
+		models.DeleteNode(node.ID)
+		releaseEnrollmentToken(token.ID)
+		APIError(c, err)
+		return
+	}
+
+	caFingerprint := ""
+	if ca := auth.GetCA(); ca != nil {
+		caFingerprint = ca.Fingerprint()
+	}
+
+	log.Printf("节点 %s (%s) 通过注册令牌 %s 完成注册", node.Name, node.ID, token.Prefix)
+
+	c.Header("Cache-Control", "no-store")
+	SuccessResponse(c, EnrollNodeResponse{
+		NodeID:        node.ID,
+		NodeKey:       nodeKey,
+		NodeName:      node.Name,
+		CAFingerprint: caFingerprint,
+	})
+}
+
+// 归还令牌使用次数
+func releaseEnrollmentToken(id string) {
+	if err := models.ReleaseEnrollmentToken(id); err != nil {
+		log.Printf("归还注册令牌使用次数失败: %v", err)
+	}
+}
+
+// 生成节点安装命令。启用TLS时面板证书由内置CA签发，命令先下载CA并校验指纹，
+// 之后下载安装脚本、注册和下载节点程序都只信任该CA
+func installCommand(panelURL, args string) string {
+	ca := auth.GetCA()
+	if ca == nil {
+		return fmt.Sprintf("curl -L %s/api/install.sh | bash -s -- %s", panelURL, args)
+	}
+
+	fingerprint := ca.Fingerprint()
+	return fmt.Sprintf("curl -fsSk %[1]s/api/ca.crt -o /tmp/panel-ca.crt && "+
+		"[ \"$(openssl x509 -in /tmp/panel-ca.crt -outform DER | sha256sum | cut -d' ' -f1)\" = \"%[2]s\" ] && "+
+		"curl -L --cacert /tmp/panel-ca.crt %[1]s/api/install.sh | bash -s -- %[3]s --ca-fingerprint=%[2]s",
+		panelURL, fingerprint, args)
+}
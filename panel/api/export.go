@@ -0,0 +1,270 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"../models"
+	"../report"
+)
+
+const (
+	// 单次导出的最大测速结果数
+	maxExportRows = 1000000
+	// 导出时每次从数据库读取的结果数
+	exportPageSize = 1000
+)
+
+// 一列的中英文表头
+type exportColumn struct {
+	key string
+	zh  string
+	en  string
+}
+
+var resultColumns = []exportColumn{
+	{"id", "测试ID", "Test ID"},
+	{"source_node", "源节点", "Source node"},
+	{"source_node_id", "源节点ID", "Source node ID"},
+	{"target_node", "目标节点", "Target node"},
+	{"target_node_id", "目标节点ID", "Target node ID"},
+	{"type", "测试类型", "Type"},
+	{"status", "状态", "Status"},
+	{"start_time", "开始时间", "Start time"},
+	{"end_time", "结束时间", "End time"},
+	{"duration", "耗时（毫秒）", "Duration (ms)"},
+	{"download_speed", "下载速度（Mbps）", "Download (Mbps)"},
+	{"upload_speed", "上传速度（Mbps）", "Upload (Mbps)"},
+	{"ping", "Ping延迟（毫秒）", "Ping (ms)"},
+	{"jitter", "抖动（毫秒）", "Jitter (ms)"},
+	{"packet_loss", "丢包率（%）", "Packet loss (%)"},
+	{"error_message", "错误信息", "Error"},
+}
+
+var nodeColumns = []exportColumn{
+	{"id", "节点ID", "Node ID"},
+	{"name", "名称", "Name"},
+	{"ip", "IP地址", "IP address"},
+	{"location", "位置", "Location"},
+	{"group", "分组", "Group"},
+	{"tags", "标签", "Tags"},
+	{"status", "状态", "Status"},
+	{"version", "版本", "Version"},
+	{"last_seen", "最后心跳", "Last seen"},
+	{"created_at", "创建时间", "Created at"},
+	{"cpu", "CPU使用率（%）", "CPU (%)"},
+	{"memory", "内存使用率（%）", "Memory (%)"},
+	{"disk", "硬盘使用率（%）", "Disk (%)"},
+	{"uptime", "运行时间（秒）", "Uptime (s)"},
+	{"description", "描述", "Description"},
+}
+
+// 表格中测试类型、测试状态和节点状态的中文名称，英文表格使用原值
+var exportValueNames = map[string]string{
+	string(models.SpeedTestTypeDownload):    "下载测速",
+	string(models.SpeedTestTypeUpload):      "上传测速",
+	string(models.SpeedTestTypePing):        "Ping测试",
+	string(models.SpeedTestTypeFull):        "全面测试",
+	string(models.SpeedTestStatusPending):   "等待中",
+	string(models.SpeedTestStatusRunning):   "运行中",
+	string(models.SpeedTestStatusCompleted): "已完成",
+	string(models.SpeedTestStatusFailed):    "失败",
+	string(models.SpeedTestStatusTimeout):   "超时",
+	string(models.SpeedTestStatusCancelled): "已取消",
+	string(models.NodeStatusOnline):         "在线",
+	string(models.NodeStatusOffline):        "离线",
+	string(models.NodeStatusError):          "错误",
+	string(models.NodeStatusMaintenance):    "维护中",
+}
+
+// 一次导出：格式、语言和写出的表格
+type export struct {
+	format string
+	lang   string
+	writer report.Writer
+}
+
+// 解析导出格式和语言。lang为zh或en，未指定时按Accept-Language选择，默认中文
+func parseExport(c *gin.Context) (*export, error) {
+	e := &export{format: c.DefaultQuery("format", report.FormatCSV), lang: c.Query("lang")}
+	if e.format != report.FormatCSV && e.format != report.FormatNDJSON && e.format != report.FormatXLSX {
+		return nil, fmt.Errorf("无效的导出格式: %s，应为csv、ndjson或xlsx", e.format)
+	}
+	if e.lang == "" {
+		e.lang = "zh"
+		if strings.HasPrefix(strings.ToLower(c.GetHeader("Accept-Language")), "en") {
+			e.lang = "en"
+		}
+	}
+	if e.lang != "zh" && e.lang != "en" {
+		return nil, fmt.Errorf("无效的语言: %s，应为zh或en", e.lang)
+	}
+	return e, nil
+}
+
+// 设置下载响应头并写出表头，之后的错误只能记录日志
+func (e *export) start(c *gin.Context, name, sheetZH, sheetEN string, columns []exportColumn) error {
+	filename := fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102-150405"), e.format)
+	c.Header("Content-Type", report.ContentType(e.format))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	sheet := sheetZH
+	if e.lang == "en" {
+		sheet = sheetEN
+	}
+	writer, err := report.NewWriter(e.format, c.Writer, sheet)
+	if err != nil {
+		return err
+	}
+	e.writer = writer
+
+	header := make([]report.Column, len(columns))
+	for i, column := range columns {
+		header[i] = report.Column{Key: column.key, Title: column.zh}
+		if e.lang == "en" {
+			header[i].Title = column.en
+		}
+	}
+	return e.writer.Header(header)
+}
+
+// 枚举值在中文表格中显示为中文名称，NDJSON保留原值便于程序处理
+func (e *export) value(value string) string {
+	if e.lang == "zh" && e.format != report.FormatNDJSON {
+		if name, ok := exportValueNames[value]; ok {
+			return name
+		}
+	}
+	return value
+}
+
+// 导出测速结果，过滤和排序条件与结果列表相同，按页从数据库读取并逐行写出
+func ExportSpeedTestResultsHandler(c *gin.Context) {
+	e, err := parseExport(c)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+	q, err := parseResultQuery(c)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+	total, err := models.CountSpeedTestResults(q)
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+	if total > maxExportRows {
+		ErrorResponse(c, 400, fmt.Sprintf("符合条件的结果有 %d 条，单次最多导出 %d 条，请缩小时间范围", total, maxExportRows))
+		return
+	}
+	names := make(map[string]string)
+	if nodes, err := models.GetAllNodes(); err == nil {
+		for _, node := range nodes {
+			names[node.ID] = node.Name
+		}
+	}
+
+	if err := e.start(c, "speedtest-results", "测速结果", "Results", resultColumns); err != nil {
+		log.Printf("导出测速结果失败: %v", err)
+		return
+	}
+	q.Limit = exportPageSize
+	for {
+		results, next, err := models.QuerySpeedTestResults(q)
+		if err != nil {
+			log.Printf("导出测速结果失败: %v", err)
+			return
+		}
+		for i := range results {
+			if err := e.writer.Row(e.resultRow(&results[i], names)); err != nil {
+				log.Printf("导出测速结果失败: %v", err)
+				return
+			}
+		}
+		c.Writer.Flush()
+		if next == "" {
+			break
+		}
+		q.Cursor = next
+	}
+	if err := e.writer.Close(); err != nil {
+		log.Printf("导出测速结果失败: %v", err)
+	}
+}
+
+// 一行测速结果，该类型的测试不提供的指标为空
+func (e *export) resultRow(result *models.SpeedTestResult, names map[string]string) []interface{} {
+	row := []interface{}{
+		result.ID,
+		names[result.SourceNodeID],
+		result.SourceNodeID,
+		names[result.TargetNodeID],
+		result.TargetNodeID,
+		e.value(string(result.Type)),
+		e.value(string(result.Status)),
+		result.StartTime,
+		result.EndTime,
+		result.Duration,
+	}
+	for _, metric := range models.Metrics {
+		if value, ok := result.Metric(metric); ok && result.Status == models.SpeedTestStatusCompleted {
+			row = append(row, value)
+		} else {
+			row = append(row, nil)
+		}
+	}
+	return append(row, result.ErrorMessage)
+}
+
+// 导出节点清单
+func ExportNodesHandler(c *gin.Context) {
+	e, err := parseExport(c)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+	nodes, err := models.GetAllNodes()
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	if err := e.start(c, "nodes", "节点", "Nodes", nodeColumns); err != nil {
+		log.Printf("导出节点失败: %v", err)
+		return
+	}
+	for _, node := range nodes {
+		row := []interface{}{
+			node.ID,
+			node.Name,
+			node.IP,
+			node.Location,
+			node.Group,
+			strings.Join(node.Tags, ","),
+			e.value(string(node.Status)),
+			node.Version,
+			node.LastSeen,
+			node.CreatedAt,
+			node.CPU,
+			node.Memory,
+			node.Disk,
+			node.Uptime,
+			node.Description,
+		}
+		if err := e.writer.Row(row); err != nil {
+			log.Printf("导出节点失败: %v", err)
+			return
+		}
+	}
+	if err := e.writer.Close(); err != nil {
+		log.Printf("导出节点失败: %v", err)
+	}
+}
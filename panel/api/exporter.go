@@ -0,0 +1,15 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"../exporter"
+)
+
+// 获取导出目标的运行状态，包括队列长度、已写入和丢弃的数据数以及最后一次错误
+func GetExportersHandler(c *gin.Context) {
+	SuccessResponse(c, gin.H{
+		"exporters": exporter.Statuses(),
+		"types":     exporter.Types(),
+	})
+}
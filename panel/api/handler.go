@@ -8,6 +8,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"../../common/signature"
 )
 
 // 节点认证结构体
@@ -92,16 +94,14 @@ func (h *APIHandler) handleNodeDownload(w http.ResponseWriter, r *http.Request)
 	// 获取节点架构
 	arch := strings.TrimPrefix(r.URL.Path, "/api/download/node-")
 	
-	// 获取节点密钥
-	key := r.URL.Query().Get("key")
-	if key == "" {
-		http.Error(w, "缺少节点密钥", http.StatusBadRequest)
+	// 验证节点签名，节点密钥不出现在URL中
+	nodeID := r.Header.Get(signature.HeaderNodeID)
+	if nodeID == "" {
+		http.Error(w, "缺少请求签名", http.StatusUnauthorized)
 		return
 	}
-	
-	// 验证节点密钥（实际应用中应该查询数据库验证）
-	if !h.validateNodeKey(key) {
-		http.Error(w, "无效的节点密钥", http.StatusUnauthorized)
+	if err := verifyNodeSignature(r, nodeID, nil); err != nil {
+		http.Error(w, "无效的请求签名", http.StatusUnauthorized)
 		return
 	}
 	
@@ -139,13 +139,6 @@ func (h *APIHandler) handlePing(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// 验证节点密钥
-func (h *APIHandler) validateNodeKey(key string) bool {
-	// 实际应用中应该查询数据库验证
-	// 这里简单实现，只检查密钥长度和格式
-	return len(key) == 32 && !strings.Contains(key, " ")
-}
-
 // 注册API路由
 func RegisterAPIRoutes(mux *http.ServeMux, config *Config) error {
 	handler, err := NewAPIHandler(config)
@@ -3,21 +3,26 @@ package api
 import (
 	"encoding/json"
 	"fmt"
-	"html/template"
+	"text/template"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"../../common/signature"
+	"../anomaly"
 	"../auth"
 	"../config"
+	"../exporter"
 	"../models"
+	"../scheduler"
 )
 
 // 响应结构
@@ -109,6 +114,7 @@ func RegisterNodeHandler(c *gin.Context) {
 		CreatedAt:   time.Now(),
 		Description: req.Description,
 		Tags:        req.Tags,
+		Group:       req.Group,
 		Version:     req.Version,
 	}
 
@@ -118,10 +124,15 @@ func RegisterNodeHandler(c *gin.Context) {
 		return
 	}
 
-	// 生成节点密钥
-	secretKey := fmt.Sprintf("sk_%s_%d", node.ID, time.Now().Unix())
+	// 生成节点密钥，面板只保存哈希
+	secretKey, _, err := issueNodeKey(node.ID)
+	if err != nil {
+		APIError(c, err)
+		return
+	}
 
-	// 返回节点ID和密钥
+	// 返回节点ID和密钥，密钥只返回这一次
+	c.Header("Cache-Control", "no-store")
 	SuccessResponse(c, models.NodeRegisterResponse{
 		ID:        node.ID,
 		SecretKey: secretKey,
@@ -151,6 +162,7 @@ func UpdateNodeHandler(c *gin.Context) {
 	existingNode.Location = req.Location
 	existingNode.Description = req.Description
 	existingNode.Tags = req.Tags
+	existingNode.Group = req.Group
 
 	// 保存更新后的节点
 	if err := models.SaveNode(existingNode); err != nil {
@@ -172,6 +184,18 @@ func DeleteNodeHandler(c *gin.Context) {
 		return
 	}
 
+	// 吊销节点证书，已删除节点无法再通过TLS连接面板
+	if err := models.RevokeNodeCertificates(nodeID); err != nil {
+		APIError(c, err)
+		return
+	}
+
+	// 删除节点密钥
+	if err := models.DeleteNodeKeys(nodeID); err != nil {
+		APIError(c, err)
+		return
+	}
+
 	// 删除节点
 	if err := models.DeleteNode(nodeID); err != nil {
 		APIError(c, err)
@@ -181,6 +205,20 @@ func DeleteNodeHandler(c *gin.Context) {
 	SuccessResponse(c, gin.H{"message": "节点已删除"})
 }
 
+// 节点连通性检查，只校验签名，不更新节点状态也不领取测试
+func NodePingHandler(c *gin.Context) {
+	nodeID := c.GetString("nodeID")
+	if _, err := models.GetNode(nodeID); err != nil {
+		ErrorResponse(c, 404, fmt.Sprintf("节点不存在: %s", nodeID))
+		return
+	}
+
+	SuccessResponse(c, gin.H{
+		"node_id": nodeID,
+		"time":    time.Now(),
+	})
+}
+
 // 节点心跳
 func NodeHeartbeatHandler(c *gin.Context) {
 	var heartbeat models.NodeHeartbeat
@@ -189,8 +227,20 @@ func NodeHeartbeatHandler(c *gin.Context) {
 		return
 	}
 
-	// 设置心跳时间
-	heartbeat.Timestamp = time.Now()
+	// 节点ID以签名认证的结果为准
+	heartbeat.ID = c.GetString("nodeID")
+	node, err := models.GetNode(heartbeat.ID)
+	if err != nil {
+		ErrorResponse(c, 404, fmt.Sprintf("节点不存在: %s", heartbeat.ID))
+		return
+	}
+
+	// 根据节点上报的时间计算时钟偏差，旧版本节点不上报时间时记为0，然后以面板时间为准
+	now := time.Now()
+	if !heartbeat.Timestamp.IsZero() {
+		heartbeat.ClockSkew = heartbeat.Timestamp.Sub(now).Seconds()
+	}
+	heartbeat.Timestamp = now
 
 	// 更新节点心跳
 	if err := models.UpdateNodeHeartbeat(&heartbeat); err != nil {
@@ -198,7 +248,43 @@ func NodeHeartbeatHandler(c *gin.Context) {
 		return
 	}
 
-	SuccessResponse(c, gin.H{"message": "心跳更新成功"})
+	exporter.PublishHeartbeat(node, &heartbeat)
+
+	// 记录状态变更，例如离线节点恢复心跳或节点即将关闭
+	if status := heartbeat.NodeStatus(); status != node.Status {
+		reason := "恢复心跳"
+		if heartbeat.Shutdown {
+			reason = "节点即将关闭"
+		}
+		if err := models.RecordNodeStatusChange(node.ID, node.Status, status, reason, heartbeat.Timestamp); err != nil {
+			log.Printf("记录节点 %s 状态变更失败: %v", node.ID, err)
+		}
+	}
+
+	response := gin.H{"message": "心跳更新成功"}
+	if heartbeat.Shutdown {
+		log.Printf("节点 %s (%s) 即将关闭，标记为维护中", node.Name, node.ID)
+	} else {
+		if version := offeredUpdate(node, &heartbeat); version != "" {
+			response["update"] = gin.H{"version": version}
+		}
+		// 启用TLS时下发已吊销的节点证书，节点之间的连接同样拒绝这些证书
+		if auth.GetCA() != nil {
+			serials, err := models.GetRevokedCertificateSerials()
+			if err != nil {
+				log.Printf("获取已吊销证书失败: %v", err)
+			} else {
+				response["revoked_serials"] = serials
+			}
+		}
+		// 下发等待中的测试，命令行工具发送的心跳不领取
+		if heartbeat.AcceptTests {
+			if tests := scheduler.Claim(node); len(tests) > 0 {
+				response["tests"] = tests
+			}
+		}
+	}
+	SuccessResponse(c, response)
 }
 
 // 测速API处理函数
@@ -211,37 +297,13 @@ func StartSpeedTestHandler(c *gin.Context) {
 		return
 	}
 
-	// 检查源节点和目标节点是否存在
-	_, err := models.GetNode(req.SourceNodeID)
-	if err != nil {
-		ErrorResponse(c, 404, fmt.Sprintf("源节点不存在: %s", req.SourceNodeID))
-		return
-	}
-
-	_, err = models.GetNode(req.TargetNodeID)
+	// 创建等待中的测试，源节点在下一次心跳时领取
+	result, err := scheduler.Enqueue(req)
 	if err != nil {
-		ErrorResponse(c, 404, fmt.Sprintf("目标节点不存在: %s", req.TargetNodeID))
-		return
-	}
-
-	// 创建测速结果
-	result := &models.SpeedTestResult{
-		ID:           uuid.New().String(),
-		SourceNodeID: req.SourceNodeID,
-		TargetNodeID: req.TargetNodeID,
-		Type:         req.Type,
-		Status:       models.SpeedTestStatusPending,
-		StartTime:    time.Now(),
-	}
-
-	// 保存测速结果
-	if err := models.SaveSpeedTestResult(result); err != nil {
-		APIError(c, err)
+		ErrorResponse(c, 400, err.Error())
 		return
 	}
 
-	// TODO: 向源节点发送测速请求
-
 	SuccessResponse(c, gin.H{
 		"id":      result.ID,
 		"message": "测速任务已创建",
@@ -256,59 +318,58 @@ func GetSpeedTestResultHandler(c *gin.Context) {
 		ErrorResponse(c, 404, fmt.Sprintf("测速结果不存在: %s", resultID))
 		return
 	}
+	results := []models.SpeedTestResult{*result}
+	if err := models.AttachAnomalies(results); err != nil {
+		APIError(c, err)
+		return
+	}
 
-	SuccessResponse(c, result)
+	SuccessResponse(c, results[0])
 }
 
-// 获取所有测速结果
+// 按条件查询测速结果，默认按开始时间倒序，使用next_cursor获取下一页。
+// 旧的page参数按偏移量分页并返回总数，count=true时也返回总数
 func GetSpeedTestResultsHandler(c *gin.Context) {
-	// 获取分页参数
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
-	
-	// 获取过滤参数
-	nodeID := c.Query("nodeId")
-	
-	var results []models.SpeedTestResult
-	var err error
-	
-	if nodeID != "" {
-		// 获取指定节点的测速结果
-		results, err = models.GetNodeSpeedTestResults(nodeID)
-	} else {
-		// 获取所有测速结果
-		results, err = models.GetAllSpeedTestResults()
+	q, err := parseResultQuery(c)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
 	}
-	
+	page, err := parseResultPage(c, &q)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	results, next, err := models.QuerySpeedTestResults(q)
 	if err != nil {
 		APIError(c, err)
 		return
 	}
-	
-	// 简单的分页处理
-	start := (page - 1) * pageSize
-	end := start + pageSize
-	if start >= len(results) {
-		start = 0
-		end = 0
+	if err := models.AttachAnomalies(results); err != nil {
+		APIError(c, err)
+		return
+	}
+
+	response := gin.H{
+		"results":     results,
+		"next_cursor": next,
+		"limit":       q.Limit,
 	}
-	if end > len(results) {
-		end = len(results)
+	if page > 0 || c.Query("count") == "true" {
+		total, err := models.CountSpeedTestResults(q)
+		if err != nil {
+			APIError(c, err)
+			return
+		}
+		response["total"] = total
 	}
-	
-	pagedResults := results
-	if start < len(results) {
-		pagedResults = results[start:end]
-	} else {
-		pagedResults = []models.SpeedTestResult{}
+	if page > 0 {
+		response["page"] = page
+		response["pageSize"] = q.Limit
 	}
-	
-	SuccessResponse(c, gin.H{
-		"results": pagedResults,
-		"total":   len(results),
-		"page":    page,
-		"pageSize": pageSize,
-	})
+
+	SuccessResponse(c, response)
 }
 
 // 更新测速结果
@@ -339,7 +400,7 @@ func UpdateSpeedTestResultHandler(c *gin.Context) {
 	existingResult.PacketLoss = req.PacketLoss
 	existingResult.ErrorMessage = req.ErrorMessage
 	
-	// 保存更新后的测速结果
+	// 保存更新后的测速结果，手动修改的结果不再做异常检测和告警评估
 	if err := models.SaveSpeedTestResult(existingResult); err != nil {
 		APIError(c, err)
 		return
@@ -348,6 +409,61 @@ func UpdateSpeedTestResultHandler(c *gin.Context) {
 	SuccessResponse(c, existingResult)
 }
 
+// 节点上报测速结果，面板创建的任务更新原记录，节点本地任务新建记录
+func ReportSpeedTestResultHandler(c *gin.Context) {
+	var result models.SpeedTestResult
+	if err := c.ShouldBindJSON(&result); err != nil {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的测速结果: %v", err))
+		return
+	}
+	if result.ID == "" {
+		ErrorResponse(c, 400, "测速结果缺少ID")
+		return
+	}
+
+	// 源节点以签名认证的结果为准，不允许覆盖其他节点的结果
+	nodeID := c.GetString("nodeID")
+	existing, err := models.GetSpeedTestResult(result.ID)
+	if err == nil && existing.SourceNodeID != nodeID {
+		ErrorResponse(c, 403, "无权更新其他节点的测速结果")
+		return
+	}
+	result.SourceNodeID = nodeID
+
+	// 已完成的结果重复上报时（如待上报队列重试）保持原记录不变
+	if existing != nil && existing.Status == models.SpeedTestStatusCompleted {
+		SuccessResponse(c, gin.H{"id": result.ID, "duplicate": true})
+		return
+	}
+
+	// 面板下发的测试保留创建时的目标、类型、来源和参数
+	result.MeshRunID = ""
+	if existing != nil {
+		result.TargetNodeID = existing.TargetNodeID
+		result.Type = existing.Type
+		result.ScheduleID = existing.ScheduleID
+		result.MeshRunID = existing.MeshRunID
+		result.Timeout = existing.Timeout
+		result.Threads = existing.Threads
+		result.Size = existing.Size
+	}
+
+	if err := models.SaveSpeedTestResult(&result); err != nil {
+		APIError(c, err)
+		return
+	}
+
+	// 结果首次完成时做异常检测、告警评估和推送
+	processResult(&result, existing)
+
+	// 全网格测速的本轮测试结束后立即下发下一轮
+	if result.MeshRunID != "" && result.Status != models.SpeedTestStatusRunning {
+		go scheduler.AdvanceMeshRun(result.MeshRunID)
+	}
+
+	SuccessResponse(c, gin.H{"id": result.ID})
+}
+
 // 用户API处理函数
 
 // 用户登录
@@ -525,7 +641,7 @@ func GetSettingsHandler(c *gin.Context) {
 	if nodeTimeout != "" {
 		settings["node_timeout"] = nodeTimeout
 	} else {
-		settings["node_timeout"] = "60" // 默认值
+		settings["node_timeout"] = strconv.Itoa(config.GetConfig().NodeTimeout) // 配置文件中的值
 	}
 	
 	// 获取节点检查间隔设置
@@ -537,7 +653,7 @@ func GetSettingsHandler(c *gin.Context) {
 	if nodeCheckInterval != "" {
 		settings["node_check_interval"] = nodeCheckInterval
 	} else {
-		settings["node_check_interval"] = "30" // 默认值
+		settings["node_check_interval"] = strconv.Itoa(config.GetConfig().NodeCheckInterval) // 配置文件中的值
 	}
 	
 	// 获取测速超时设置
@@ -561,9 +677,40 @@ func GetSettingsHandler(c *gin.Context) {
 	if maxConcurrentTests != "" {
 		settings["max_concurrent_tests"] = maxConcurrentTests
 	} else {
-		settings["max_concurrent_tests"] = "3" // 默认值
+		settings["max_concurrent_tests"] = strconv.Itoa(config.GetConfig().MaxConcurrentTests) // 配置文件中的值
+	}
+	
+	// 获取每个节点的最大并发测试数设置
+	maxTestsPerNode, err := models.GetSetting("max_tests_per_node")
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+	if maxTestsPerNode != "" {
+		settings["max_tests_per_node"] = maxTestsPerNode
+	} else {
+		settings["max_tests_per_node"] = strconv.Itoa(config.GetConfig().MaxTestsPerNode) // 配置文件中的值
+	}
+	
+	// 获取排队优先级提升时间设置
+	queueAgingTime, err := models.GetSetting("queue_aging_time")
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+	if queueAgingTime != "" {
+		settings["queue_aging_time"] = queueAgingTime
+	} else {
+		settings["queue_aging_time"] = strconv.Itoa(config.GetConfig().QueueAgingTime) // 配置文件中的值
 	}
 	
+	// 获取异常检测设置
+	anomalySettings := anomaly.CurrentSettings()
+	settings["anomaly_window"] = strconv.Itoa(anomalySettings.Window)
+	settings["anomaly_min_samples"] = strconv.Itoa(anomalySettings.MinSamples)
+	settings["anomaly_threshold"] = strconv.FormatFloat(anomalySettings.Threshold, 'f', -1, 64)
+	settings["anomaly_season_hours"] = strconv.Itoa(anomalySettings.SeasonHours)
+	
 	SuccessResponse(c, settings)
 }
 
@@ -575,6 +722,31 @@ func UpdateSettingsHandler(c *gin.Context) {
 		return
 	}
 	
+	// 调度器读取的设置必须为正整数
+	for _, key := range []string{"max_concurrent_tests", "max_tests_per_node", "queue_aging_time",
+		"anomaly_window", "anomaly_min_samples", "anomaly_season_hours"} {
+		value, ok := settings[key]
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(value); err != nil || n <= 0 {
+			ErrorResponse(c, 400, fmt.Sprintf("设置 %s 应为正整数", key))
+			return
+		}
+	}
+	if value, ok := settings["anomaly_season_hours"]; ok {
+		if n, _ := strconv.Atoi(value); n > 12 {
+			ErrorResponse(c, 400, "设置 anomaly_season_hours 应为 1-12")
+			return
+		}
+	}
+	if value, ok := settings["anomaly_threshold"]; ok {
+		if f, err := strconv.ParseFloat(value, 64); err != nil || f <= 0 {
+			ErrorResponse(c, 400, "设置 anomaly_threshold 应为正数")
+			return
+		}
+	}
+	
 	// 更新设置
 	for key, value := range settings {
 		if err := models.SaveSetting(key, value); err != nil {
@@ -610,20 +782,16 @@ func GetStatsHandler(c *gin.Context) {
 		}
 	}
 	
-	// 获取所有测速结果
-	results, err := models.GetAllSpeedTestResults()
+	// 统计测速次数
+	totalTests, err := models.CountSpeedTestResults(models.ResultQuery{})
 	if err != nil {
 		APIError(c, err)
 		return
 	}
-	
-	// 统计今日测速次数
-	todayTests := 0
-	today := time.Now().Truncate(24 * time.Hour)
-	for _, result := range results {
-		if result.StartTime.After(today) {
-			todayTests++
-		}
+	todayTests, err := models.CountSpeedTestResults(models.ResultQuery{From: time.Now().Truncate(24 * time.Hour)})
+	if err != nil {
+		APIError(c, err)
+		return
 	}
 	
 	// TODO: 获取面板服务器的系统信息
@@ -633,7 +801,7 @@ func GetStatsHandler(c *gin.Context) {
 		"offlineNodes": offlineNodes,
 		"totalNodes":   len(nodes),
 		"todayTests":   todayTests,
-		"totalTests":   len(results),
+		"totalTests":   totalTests,
 		"cpuUsage":     30, // 示例值，应该从实际系统获取
 		"memoryUsage":  40, // 示例值，应该从实际系统获取
 		"diskUsage":    50, // 示例值，应该从实际系统获取
@@ -649,15 +817,7 @@ func GetInstallScriptHandler(c *gin.Context) {
 	c.Header("Content-Disposition", "attachment; filename=install.sh")
 
 	// 获取面板URL
-	panelURL := config.GetConfig().PanelURL
-	if panelURL == "" {
-		// 如果配置中没有设置面板URL，则使用请求中的Host
-		scheme := "http"
-		if c.Request.TLS != nil {
-			scheme = "https"
-		}
-		panelURL = fmt.Sprintf("%s://%s", scheme, c.Request.Host)
-	}
+	panelURL := panelBaseURL(c)
 
 	// 读取安装脚本模板
 	templatePath := "./web/install_template.sh"
@@ -668,7 +828,7 @@ func GetInstallScriptHandler(c *gin.Context) {
 		return
 	}
 
-	// 解析模板
+	// 解析模板，安装脚本不是HTML，使用text/template避免转义公钥中的字符
 	tmpl, err := template.New("install").Parse(string(templateContent))
 	if err != nil {
 		log.Printf("解析安装脚本模板失败: %v", err)
@@ -681,13 +841,15 @@ func GetInstallScriptHandler(c *gin.Context) {
 	
 	// 准备模板数据
 	data := struct {
-		PanelURL      string
-		GithubRepo    string
-		GithubVersion string
+		PanelURL        string
+		GithubRepo      string
+		GithubVersion   string
+		UpdatePublicKey string
 	}{
-		PanelURL:      config.PanelURL,
-		GithubRepo:    config.GithubRepo,
-		GithubVersion: config.GithubVersion,
+		PanelURL:        panelURL,
+		GithubRepo:      config.GithubRepo,
+		GithubVersion:   config.GithubVersion,
+		UpdatePublicKey: config.UpdatePublicKey,
 	}
 
 	// 执行模板
@@ -699,7 +861,20 @@ func GetInstallScriptHandler(c *gin.Context) {
 	}
 }
 
-// 生成节点安装命令
+// 获取面板URL，配置中没有设置时使用请求中的Host
+func panelBaseURL(c *gin.Context) string {
+	if panelURL := config.GetConfig().PanelURL; panelURL != "" {
+		return panelURL
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, c.Request.Host)
+}
+
+// 生成节点安装命令，同时为节点生成新密钥
 func GenerateInstallCommandHandler(c *gin.Context) {
 	nodeID := c.Param("id")
 	
@@ -711,33 +886,29 @@ func GenerateInstallCommandHandler(c *gin.Context) {
 	}
 
 	// 获取面板URL
-	panelURL := config.GetConfig().PanelURL
-	if panelURL == "" {
-		// 如果配置中没有设置面板URL，则使用请求中的Host
-		scheme := "http"
-		if c.Request.TLS != nil {
-			scheme = "https"
-		}
-		panelURL = fmt.Sprintf("%s://%s", scheme, c.Request.Host)
-	}
-
-	// 生成节点密钥
-	nodeKey := fmt.Sprintf("nk_%s_%d", node.ID, time.Now().Unix())
+	panelURL := panelBaseURL(c)
 
-	// 保存节点密钥（实际项目中应该加密存储）
-	node.SecretKey = nodeKey
-	if err := models.SaveNode(node); err != nil {
+	// 生成安装命令会轮换节点密钥，因此只接受POST。已安装节点的旧密钥在宽限期内仍然有效
+	nodeKey, _, expiresAt, err := rotateNodeKey(node.ID, defaultKeyGracePeriod())
+	if err != nil {
 		APIError(c, err)
 		return
 	}
 
-	// 生成安装命令
-	installCommand := fmt.Sprintf("curl -L %s/api/install.sh | bash -s -- %s \"%s\"", panelURL, nodeKey, node.Name)
+	// 生成安装命令，启用TLS时附带CA指纹，安装和节点首次连接时据此校验面板CA
+	command := installCommand(panelURL, fmt.Sprintf("%s \"%s\" --node-id=%s", nodeKey, node.Name, node.ID))
+	caFingerprint := ""
+	if ca := auth.GetCA(); ca != nil {
+		caFingerprint = ca.Fingerprint()
+	}
 
+	c.Header("Cache-Control", "no-store")
 	SuccessResponse(c, gin.H{
-		"command": installCommand,
+		"command": command,
 		"node_key": nodeKey,
 		"panel_url": panelURL,
+		"ca_fingerprint": caFingerprint,
+		"old_key_expires_at": expiresAt,
 	})
 }
 
@@ -745,33 +916,40 @@ func GenerateInstallCommandHandler(c *gin.Context) {
 func DownloadNodeHandler(c *gin.Context) {
 	arch := c.Param("arch") // 例如：node-amd64, node-arm64, node-arm
 
-	// 验证节点密钥
-	nodeKey := c.Query("key")
-	if nodeKey == "" {
-		c.String(http.StatusUnauthorized, "未提供节点密钥")
+	// 验证节点签名，安装脚本使用节点密钥签名，密钥不会出现在URL和访问日志中。
+	// 此时节点还没有证书，不检查客户端证书
+	nodeID := c.GetHeader(signature.HeaderNodeID)
+	if nodeID == "" {
+		c.String(http.StatusUnauthorized, "缺少请求签名")
 		return
 	}
-
-	// 验证节点密钥（实际项目中应该验证密钥是否有效）
-	// 这里简化处理，只检查密钥格式
-	if len(nodeKey) < 10 || nodeKey[:3] != "nk_" {
-		c.String(http.StatusUnauthorized, "无效的节点密钥")
+	if err := verifyNodeSignature(c.Request, nodeID, nil); err != nil {
+		log.Printf("节点 %s 下载节点程序签名校验失败: %v", nodeID, err)
+		c.String(http.StatusUnauthorized, "无效的请求签名")
 		return
 	}
 
 	// 根据架构选择节点程序文件
-	var nodeBinary string
 	switch arch {
-	case "node-amd64":
-		nodeBinary = "./bin/node-amd64"
-	case "node-arm64":
-		nodeBinary = "./bin/node-arm64"
-	case "node-arm":
-		nodeBinary = "./bin/node-arm"
+	case "node-amd64", "node-arm64", "node-arm":
 	default:
 		c.String(http.StatusBadRequest, "不支持的架构")
 		return
 	}
+	nodeBinary := filepath.Join(config.GetConfig().ReleaseDir, arch)
+
+	// 存在发布清单时只提供与清单一致的节点程序
+	checksum := ""
+	if manifest, _, _, err := loadReleaseManifest(); err == nil {
+		path, binary, err := releaseBinary(manifest, strings.TrimPrefix(arch, "node-"))
+		if err != nil {
+			log.Printf("节点程序校验失败: %v", err)
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		nodeBinary = path
+		checksum = binary.SHA256
+	}
 
 	// 检查文件是否存在
 	if _, err := os.Stat(nodeBinary); os.IsNotExist(err) {
@@ -782,6 +960,9 @@ func DownloadNodeHandler(c *gin.Context) {
 	// 设置响应头
 	c.Header("Content-Type", "application/octet-stream")
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filepath.Base(nodeBinary)))
+	if checksum != "" {
+		c.Header("X-Checksum-SHA256", checksum)
+	}
 	
 	// 发送文件
 	c.File(nodeBinary)
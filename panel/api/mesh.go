@@ -0,0 +1,202 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"../models"
+	"../scheduler"
+)
+
+// 测速矩阵默认使用最近7天的结果，最多90天
+const (
+	defaultMeshMatrixDays = 7
+	maxMeshMatrixDays     = 90
+)
+
+// 创建全网格测速请求，node_ids和tag二选一
+type CreateMeshRunRequest struct {
+	Name    string               `json:"name"`
+	NodeIDs []string             `json:"node_ids"`
+	Tag     string               `json:"tag"`
+	Type    models.SpeedTestType `json:"type" binding:"required"`
+	Timeout int                  `json:"timeout"`
+	Threads int                  `json:"threads"`
+	Size    int                  `json:"size"`
+}
+
+// 全网格测速响应，附带各状态的测试数量
+type MeshRunResponse struct {
+	models.MeshRun
+	Tests map[models.SpeedTestStatus]int `json:"tests"`
+	Total int                            `json:"total_tests"`
+}
+
+func meshRunResponse(run models.MeshRun) (MeshRunResponse, error) {
+	counts, err := models.CountMeshRunTests(run.ID)
+	if err != nil {
+		return MeshRunResponse{}, err
+	}
+	n := len(run.NodeIDs)
+	return MeshRunResponse{MeshRun: run, Tests: counts, Total: n * (n - 1)}, nil
+}
+
+// 获取最近的全网格测速
+func GetMeshRunsHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		ErrorResponse(c, 400, "无效的数量，应为1到100")
+		return
+	}
+
+	runs, err := models.GetMeshRuns(limit)
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	responses := make([]MeshRunResponse, 0, len(runs))
+	for _, run := range runs {
+		response, err := meshRunResponse(run)
+		if err != nil {
+			APIError(c, err)
+			return
+		}
+		responses = append(responses, response)
+	}
+
+	SuccessResponse(c, gin.H{
+		"runs":  responses,
+		"total": len(responses),
+	})
+}
+
+// 获取单个全网格测速的进度
+func GetMeshRunHandler(c *gin.Context) {
+	run, err := models.GetMeshRun(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, 404, err.Error())
+		return
+	}
+
+	response, err := meshRunResponse(*run)
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+	SuccessResponse(c, response)
+}
+
+// 创建全网格测速并下发第一轮测试
+func CreateMeshRunHandler(c *gin.Context) {
+	var req CreateMeshRunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的请求数据: %v", err))
+		return
+	}
+
+	nodeIDs, err := scheduler.MeshNodeIDs(req.NodeIDs, strings.TrimSpace(req.Tag))
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	run := &models.MeshRun{
+		Name:      strings.TrimSpace(req.Name),
+		NodeIDs:   nodeIDs,
+		Type:      req.Type,
+		Timeout:   req.Timeout,
+		Threads:   req.Threads,
+		Size:      req.Size,
+		CreatedBy: c.GetString("username"),
+	}
+	if run.Name == "" {
+		run.Name = fmt.Sprintf("全网格测速 %s", time.Now().Format("2006-01-02 15:04"))
+	}
+
+	if err := scheduler.StartMeshRun(run); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	log.Printf("用户 %s 创建了全网格测速 %s (%s)，共 %d 个节点、%d 轮",
+		c.GetString("username"), run.Name, run.ID, len(run.NodeIDs), run.TotalRounds)
+
+	response, err := meshRunResponse(*run)
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+	SuccessResponse(c, response)
+}
+
+// 取消全网格测速
+func CancelMeshRunHandler(c *gin.Context) {
+	if _, err := models.GetMeshRun(c.Param("id")); err != nil {
+		ErrorResponse(c, 404, err.Error())
+		return
+	}
+
+	run, err := scheduler.CancelMeshRun(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	response, err := meshRunResponse(*run)
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+	SuccessResponse(c, response)
+}
+
+// 获取节点之间的测速矩阵。run指定全网格测速时使用该次测速的节点和结果，
+// 否则按nodes（逗号分隔）或tag选择节点，使用最近days天的结果
+func GetMeshMatrixHandler(c *gin.Context) {
+	if runID := c.Query("run"); runID != "" {
+		run, err := models.GetMeshRun(runID)
+		if err != nil {
+			ErrorResponse(c, 404, err.Error())
+			return
+		}
+
+		matrix, err := models.GetMeshMatrix(run.NodeIDs, run.ID, run.CreatedAt)
+		if err != nil {
+			APIError(c, err)
+			return
+		}
+		SuccessResponse(c, matrix)
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(defaultMeshMatrixDays)))
+	if err != nil || days <= 0 || days > maxMeshMatrixDays {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的天数，应为1到%d天", maxMeshMatrixDays))
+		return
+	}
+
+	var ids []string
+	for _, id := range strings.Split(c.Query("nodes"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	nodeIDs, err := scheduler.MeshNodeIDs(ids, strings.TrimSpace(c.Query("tag")))
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	matrix, err := models.GetMeshMatrix(nodeIDs, "", time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+	SuccessResponse(c, matrix)
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"../config"
+	"../metrics"
+)
+
+// 输出Prometheus格式的面板指标，设置了metrics_token时需要以Bearer令牌访问
+func MetricsHandler(c *gin.Context) {
+	if token := config.GetConfig().MetricsToken; token != "" {
+		provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.String(http.StatusUnauthorized, "unauthorized\n")
+			return
+		}
+	}
+
+	families, err := metrics.Collect()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "采集指标失败: %v\n", err)
+		return
+	}
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	metrics.Write(c.Writer, families)
+}
@@ -1,6 +1,10 @@
 package api
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"strings"
@@ -8,9 +12,17 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"../../common/signature"
 	"../auth"
+	"../models"
 )
 
+// 已使用的节点请求nonce，防止重放
+var nodeNonceCache = signature.NewNonceCache(signature.MaxClockSkew)
+
+// 签名校验时读取请求体的最大长度
+const maxSignedBodySize = 10 << 20
+
 // 认证中间件
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -54,35 +66,39 @@ func AuthMiddleware() gin.HandlerFunc {
 // 节点认证中间件
 func NodeAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 从请求头中获取节点密钥
-		nodeKey := c.GetHeader("Node-Key")
-		if nodeKey == "" {
-			ErrorResponse(c, 401, "缺少节点密钥")
+		// 从签名头中获取节点ID
+		nodeID := c.GetHeader(signature.HeaderNodeID)
+		if nodeID == "" {
+			ErrorResponse(c, 401, "缺少请求签名")
 			c.Abort()
 			return
 		}
 
-		// 验证节点密钥格式
-		if !strings.HasPrefix(nodeKey, "sk_") {
-			ErrorResponse(c, 401, "无效的节点密钥格式")
+		// 启用TLS时节点必须出示与节点ID一致的证书，申请证书的请求除外
+		if err := checkNodeCertificate(c, nodeID); err != nil {
+			ErrorResponse(c, 401, err.Error())
 			c.Abort()
 			return
 		}
 
-		// 解析密钥中的节点ID
-		parts := strings.Split(nodeKey, "_")
-		if len(parts) < 3 {
-			ErrorResponse(c, 401, "无效的节点密钥格式")
+		// 读取请求体用于签名校验，之后还原供后续处理使用
+		body, err := ioutil.ReadAll(io.LimitReader(c.Request.Body, maxSignedBodySize))
+		if err != nil {
+			ErrorResponse(c, 400, "读取请求体失败")
 			c.Abort()
 			return
 		}
-
-		nodeID := parts[1]
-
-		// 验证节点密钥
-		// TODO: 从数据库验证节点密钥
-		if !auth.ValidateNodeKey(nodeKey, nodeID) {
-			ErrorResponse(c, 401, "无效的节点密钥")
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		// 验证请求签名
+		if err := verifyNodeSignature(c.Request, nodeID, body); err != nil {
+			log.Printf("节点 %s 请求签名校验失败: %v", nodeID, err)
+			if _, ok := err.(*signature.ClockSkewError); ok {
+				// 签名有效，只是节点时钟偏差过大，提示节点校准时间
+				ErrorResponse(c, 401, err.Error()+"，请校准节点时间")
+			} else {
+				ErrorResponse(c, 401, "无效的请求签名")
+			}
 			c.Abort()
 			return
 		}
@@ -94,6 +110,59 @@ func NodeAuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// 使用节点当前有效的密钥校验请求签名，轮换期间新旧密钥均可使用
+func verifyNodeSignature(req *http.Request, nodeID string, body []byte) error {
+	keys, err := models.GetActiveNodeKeys(nodeID)
+	if err != nil || len(keys) == 0 {
+		return fmt.Errorf("无效的节点")
+	}
+	signingKeys := make([][]byte, 0, len(keys))
+	keyIDs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		signingKey, err := auth.OpenSigningKey(key.Secret)
+		if err != nil {
+			continue
+		}
+		signingKeys = append(signingKeys, signingKey)
+		keyIDs = append(keyIDs, key.ID)
+	}
+
+	matched, err := signature.VerifyRequestKeys(req, body, signingKeys, nodeNonceCache)
+	if skewErr, ok := err.(*signature.ClockSkewError); ok {
+		// 时钟偏差超出签名允许的范围时心跳无法更新偏差，在这里记录，供时钟偏差告警使用
+		if err := models.UpdateNodeClockSkew(nodeID, skewErr.Skew.Seconds()); err != nil {
+			log.Printf("记录节点 %s 时钟偏差失败: %v", nodeID, err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := models.TouchNodeKey(keyIDs[matched]); err != nil {
+		log.Printf("更新节点密钥使用时间失败: %v", err)
+	}
+	return nil
+}
+
+// 检查节点客户端证书
+func checkNodeCertificate(c *gin.Context, nodeID string) error {
+	var peerCN string
+	if c.Request.TLS != nil && len(c.Request.TLS.PeerCertificates) > 0 {
+		peerCN = c.Request.TLS.PeerCertificates[0].Subject.CommonName
+	}
+
+	if peerCN == "" {
+		if auth.GetCA() != nil && c.Request.URL.Path != "/api/node/certificate" {
+			return fmt.Errorf("缺少节点证书")
+		}
+		return nil
+	}
+
+	if peerCN != nodeID {
+		return fmt.Errorf("节点证书与节点ID不匹配")
+	}
+	return nil
+}
+
 // 管理员权限中间件
 func AdminAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -120,7 +189,7 @@ func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, Node-Key")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Node-ID, X-Timestamp, X-Nonce, X-Signature")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
@@ -176,7 +245,6 @@ func isPublicAPI(path string) bool {
 	publicPaths := []string{
 		"/api/login",
 		"/api/register",
-		"/api/node/register",
 	}
 
 	for _, p := range publicPaths {
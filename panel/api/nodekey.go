@@ -0,0 +1,147 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"../auth"
+	"../config"
+	"../models"
+)
+
+// 轮换节点密钥请求
+type RotateNodeKeyRequest struct {
+	GracePeriod *int `json:"grace_period"` // 旧密钥的宽限期（小时），为空时使用面板配置，0表示立即失效
+}
+
+// 新密钥响应，明文密钥只在此时返回一次
+type NodeKeyResponse struct {
+	Key       string         `json:"key"`        // 明文密钥
+	NodeKey   models.NodeKey `json:"node_key"`   // 密钥信息
+	ExpiresAt *time.Time     `json:"expires_at"` // 旧密钥的失效时间
+}
+
+// 为节点生成新密钥，保存查找哈希和加密后的签名密钥，返回明文密钥
+func issueNodeKey(nodeID string) (string, *models.NodeKey, error) {
+	key, hash, secret, err := auth.GenerateNodeKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	record := &models.NodeKey{
+		NodeID: nodeID,
+		Hash:   hash,
+		Secret: secret,
+		Prefix: auth.NodeKeyPrefix(key),
+	}
+	if err := models.CreateNodeKey(record); err != nil {
+		return "", nil, err
+	}
+	return key, record, nil
+}
+
+// 生成新密钥，节点原有密钥在宽限期后失效
+func rotateNodeKey(nodeID string, gracePeriod time.Duration) (string, *models.NodeKey, time.Time, error) {
+	key, record, err := issueNodeKey(nodeID)
+	if err != nil {
+		return "", nil, time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(gracePeriod)
+	if err := models.ExpireOtherNodeKeys(nodeID, record.ID, expiresAt); err != nil {
+		return "", nil, time.Time{}, err
+	}
+	return key, record, expiresAt, nil
+}
+
+// 面板配置的密钥宽限期
+func defaultKeyGracePeriod() time.Duration {
+	hours := config.GetConfig().NodeKeyGracePeriod
+	if hours < 0 {
+		hours = 0
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// 获取节点密钥列表
+func GetNodeKeysHandler(c *gin.Context) {
+	nodeID := c.Param("id")
+	if _, err := models.GetNode(nodeID); err != nil {
+		ErrorResponse(c, 404, fmt.Sprintf("节点不存在: %s", nodeID))
+		return
+	}
+
+	keys, err := models.GetNodeKeys(nodeID)
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	now := time.Now()
+	active := 0
+	for _, key := range keys {
+		if key.Active(now) {
+			active++
+		}
+	}
+
+	SuccessResponse(c, gin.H{
+		"keys":   keys,
+		"total":  len(keys),
+		"active": active,
+	})
+}
+
+// 轮换节点密钥，旧密钥在宽限期内仍然有效，便于节点无中断切换
+func RotateNodeKeyHandler(c *gin.Context) {
+	nodeID := c.Param("id")
+	if _, err := models.GetNode(nodeID); err != nil {
+		ErrorResponse(c, 404, fmt.Sprintf("节点不存在: %s", nodeID))
+		return
+	}
+
+	var req RotateNodeKeyRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			ErrorResponse(c, 400, fmt.Sprintf("无效的请求数据: %v", err))
+			return
+		}
+	}
+
+	gracePeriod := defaultKeyGracePeriod()
+	if req.GracePeriod != nil {
+		if *req.GracePeriod < 0 {
+			ErrorResponse(c, 400, "宽限期不能为负数")
+			return
+		}
+		gracePeriod = time.Duration(*req.GracePeriod) * time.Hour
+	}
+
+	key, record, expiresAt, err := rotateNodeKey(nodeID, gracePeriod)
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	SuccessResponse(c, NodeKeyResponse{
+		Key:       key,
+		NodeKey:   *record,
+		ExpiresAt: &expiresAt,
+	})
+}
+
+// 吊销节点的指定密钥，立即失效
+func RevokeNodeKeyHandler(c *gin.Context) {
+	nodeID := c.Param("id")
+	keyID := c.Param("keyId")
+
+	if err := models.RevokeNodeKey(nodeID, keyID); err != nil {
+		ErrorResponse(c, 404, err.Error())
+		return
+	}
+
+	SuccessResponse(c, nil)
+}
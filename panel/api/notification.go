@@ -0,0 +1,241 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+
+	"../models"
+	"../notify"
+)
+
+// 返回渠道配置时隐藏的敏感字段及隐藏方式，更新时提交隐藏后的值表示保留原值。
+// 机器人的Webhook地址中包含访问令牌，只保留协议和主机；Webhook的请求头通常包含认证信息，隐藏全部值
+var secretConfigKeys = map[string]func(string) string{
+	"secret":    maskValue,
+	"password":  maskValue,
+	"bot_token": maskValue,
+	"webhook":   maskURL,
+}
+
+// 隐藏全部值的请求头字段
+const secretHeadersKey = "headers"
+
+const maskedSecret = "******"
+
+// 隐藏整个值
+func maskValue(string) string {
+	return maskedSecret
+}
+
+// 隐藏URL中主机之后的部分，无法解析时隐藏整个值
+func maskURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return maskedSecret
+	}
+	return u.Scheme + "://" + u.Host + "/" + maskedSecret
+}
+
+// 保存通知渠道请求
+type SaveNotificationChannelRequest struct {
+	Name         string          `json:"name" binding:"required"`
+	Type         string          `json:"type" binding:"required"`
+	Enabled      *bool           `json:"enabled"` // 未设置时默认启用
+	Config       json.RawMessage `json:"config"`
+	MinSeverity  string          `json:"min_severity"`
+	SendResolved *bool           `json:"send_resolved"` // 未设置时默认发送恢复通知
+	RateLimit    int             `json:"rate_limit"`
+}
+
+// 将请求内容应用到通知渠道
+func (req *SaveNotificationChannelRequest) apply(channel *models.NotificationChannel) {
+	channel.Name = req.Name
+	channel.Type = req.Type
+	channel.Enabled = req.Enabled == nil || *req.Enabled
+	channel.Config = req.Config
+	channel.MinSeverity = req.MinSeverity
+	channel.SendResolved = req.SendResolved == nil || *req.SendResolved
+	channel.RateLimit = req.RateLimit
+}
+
+// 获取所有通知渠道和支持的渠道类型
+func GetNotificationChannelsHandler(c *gin.Context) {
+	channels, err := models.GetNotificationChannels()
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+	if channels == nil {
+		channels = []models.NotificationChannel{}
+	}
+	for i := range channels {
+		maskChannelConfig(&channels[i])
+	}
+
+	SuccessResponse(c, gin.H{
+		"channels": channels,
+		"types":    notify.Types(),
+		"total":    len(channels),
+	})
+}
+
+// 获取单个通知渠道
+func GetNotificationChannelHandler(c *gin.Context) {
+	channel, err := models.GetNotificationChannel(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, 404, err.Error())
+		return
+	}
+
+	maskChannelConfig(channel)
+	SuccessResponse(c, channel)
+}
+
+// 创建通知渠道
+func CreateNotificationChannelHandler(c *gin.Context) {
+	var req SaveNotificationChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的请求数据: %v", err))
+		return
+	}
+
+	channel := &models.NotificationChannel{CreatedBy: c.GetString("username")}
+	req.apply(channel)
+	if err := notify.ValidateChannel(channel); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if err := models.SaveNotificationChannel(channel); err != nil {
+		APIError(c, err)
+		return
+	}
+
+	log.Printf("用户 %s 创建了通知渠道 %s (%s)", c.GetString("username"), channel.Name, channel.ID)
+	maskChannelConfig(channel)
+	SuccessResponse(c, channel)
+}
+
+// 更新通知渠道，配置中的敏感字段为******时保留原值
+func UpdateNotificationChannelHandler(c *gin.Context) {
+	channel, err := models.GetNotificationChannel(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, 404, err.Error())
+		return
+	}
+
+	var req SaveNotificationChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的请求数据: %v", err))
+		return
+	}
+
+	config, err := restoreSecrets(req.Config, channel.Config)
+	if err != nil {
+		ErrorResponse(c, 400, fmt.Sprintf("渠道配置无效: %v", err))
+		return
+	}
+	req.Config = config
+
+	req.apply(channel)
+	if err := notify.ValidateChannel(channel); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if err := models.SaveNotificationChannel(channel); err != nil {
+		APIError(c, err)
+		return
+	}
+
+	maskChannelConfig(channel)
+	SuccessResponse(c, channel)
+}
+
+// 删除通知渠道
+func DeleteNotificationChannelHandler(c *gin.Context) {
+	if err := models.DeleteNotificationChannel(c.Param("id")); err != nil {
+		ErrorResponse(c, 404, err.Error())
+		return
+	}
+
+	SuccessResponse(c, gin.H{"message": "通知渠道已删除"})
+}
+
+// 向通知渠道发送一条测试通知，返回发送结果
+func TestNotificationChannelHandler(c *gin.Context) {
+	channel, err := models.GetNotificationChannel(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, 404, err.Error())
+		return
+	}
+
+	if err := notify.Test(channel); err != nil {
+		ErrorResponse(c, 502, fmt.Sprintf("测试通知发送失败: %v", err))
+		return
+	}
+
+	SuccessResponse(c, gin.H{"message": "测试通知已发送"})
+}
+
+// 隐藏渠道配置中的敏感字段
+func maskChannelConfig(channel *models.NotificationChannel) {
+	var config map[string]interface{}
+	if err := json.Unmarshal(channel.Config, &config); err != nil {
+		return
+	}
+	for key, mask := range secretConfigKeys {
+		if value, ok := config[key].(string); ok && value != "" {
+			config[key] = mask(value)
+		}
+	}
+	if headers, ok := config[secretHeadersKey].(map[string]interface{}); ok {
+		for name, value := range headers {
+			if value, ok := value.(string); ok && value != "" {
+				headers[name] = maskedSecret
+			}
+		}
+	}
+	if data, err := json.Marshal(config); err == nil {
+		channel.Config = data
+	}
+}
+
+// 将新配置中仍为隐藏后的值的敏感字段替换为原配置中的值
+func restoreSecrets(config, stored json.RawMessage) (json.RawMessage, error) {
+	if len(config) == 0 {
+		return config, nil
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(config, &values); err != nil {
+		return nil, err
+	}
+	var storedValues map[string]interface{}
+	json.Unmarshal(stored, &storedValues)
+
+	for key, mask := range secretConfigKeys {
+		value, ok := values[key].(string)
+		if !ok {
+			continue
+		}
+		if stored, ok := storedValues[key].(string); ok && stored != "" && value == mask(stored) {
+			values[key] = stored
+		}
+	}
+
+	// 请求头逐个恢复，原配置中没有的请求头保持提交的值
+	headers, _ := values[secretHeadersKey].(map[string]interface{})
+	storedHeaders, _ := storedValues[secretHeadersKey].(map[string]interface{})
+	for name, value := range headers {
+		if value == maskedSecret {
+			if stored, ok := storedHeaders[name]; ok {
+				headers[name] = stored
+			}
+		}
+	}
+	return json.Marshal(values)
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"../models"
+)
+
+func TestMaskAndRestoreChannelConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		stored     string
+		wantMasked map[string]interface{}
+		// 在隐藏后的配置上修改后提交，nil表示原样提交
+		edit        func(map[string]interface{})
+		wantRestore map[string]interface{}
+	}{
+		{
+			name:   "钉钉Webhook和密钥",
+			stored: `{"webhook":"https://oapi.dingtalk.com/robot/send?access_token=abc","secret":"SEC"}`,
+			wantMasked: map[string]interface{}{
+				"webhook": "https://oapi.dingtalk.com/******",
+				"secret":  "******",
+			},
+			wantRestore: map[string]interface{}{
+				"webhook": "https://oapi.dingtalk.com/robot/send?access_token=abc",
+				"secret":  "SEC",
+			},
+		},
+		{
+			name:       "更换Webhook地址",
+			stored:     `{"webhook":"https://hooks.slack.com/services/T/B/X"}`,
+			wantMasked: map[string]interface{}{"webhook": "https://hooks.slack.com/******"},
+			edit: func(config map[string]interface{}) {
+				config["webhook"] = "https://hooks.slack.com/services/T/B/Y"
+			},
+			wantRestore: map[string]interface{}{"webhook": "https://hooks.slack.com/services/T/B/Y"},
+		},
+		{
+			name:   "Webhook请求头",
+			stored: `{"url":"https://example.com/hook","headers":{"Authorization":"Bearer t","X-Env":"prod"}}`,
+			wantMasked: map[string]interface{}{
+				"url":     "https://example.com/hook",
+				"headers": map[string]interface{}{"Authorization": "******", "X-Env": "******"},
+			},
+			edit: func(config map[string]interface{}) {
+				headers := config["headers"].(map[string]interface{})
+				headers["X-Env"] = "staging"
+				headers["X-New"] = "1"
+			},
+			wantRestore: map[string]interface{}{
+				"url":     "https://example.com/hook",
+				"headers": map[string]interface{}{"Authorization": "Bearer t", "X-Env": "staging", "X-New": "1"},
+			},
+		},
+		{
+			name:   "Telegram和邮件",
+			stored: `{"bot_token":"123:abc","chat_id":"42","password":""}`,
+			wantMasked: map[string]interface{}{
+				"bot_token": "******",
+				"chat_id":   "42",
+				"password":  "",
+			},
+			wantRestore: map[string]interface{}{
+				"bot_token": "123:abc",
+				"chat_id":   "42",
+				"password":  "",
+			},
+		},
+		{
+			name:       "原配置为空时不恢复",
+			stored:     `{}`,
+			wantMasked: map[string]interface{}{},
+			edit: func(config map[string]interface{}) {
+				config["secret"] = "******"
+			},
+			wantRestore: map[string]interface{}{"secret": "******"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := &models.NotificationChannel{Config: json.RawMessage(tt.stored)}
+			maskChannelConfig(channel)
+
+			var masked map[string]interface{}
+			if err := json.Unmarshal(channel.Config, &masked); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(masked, tt.wantMasked) {
+				t.Errorf("隐藏后 = %v, 期望 %v", masked, tt.wantMasked)
+			}
+
+			if tt.edit != nil {
+				tt.edit(masked)
+			}
+			submitted, _ := json.Marshal(masked)
+			restored, err := restoreSecrets(submitted, json.RawMessage(tt.stored))
+			if err != nil {
+				t.Fatalf("restoreSecrets: %v", err)
+			}
+			var got map[string]interface{}
+			json.Unmarshal(restored, &got)
+			if !reflect.DeepEqual(got, tt.wantRestore) {
+				t.Errorf("恢复后 = %v, 期望 %v", got, tt.wantRestore)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"../alerting"
+	"../anomaly"
+	"../exporter"
+	"../metrics"
+	"../models"
+)
+
+// 测试结果首次变为已完成时在后台处理：先做异常检测，再按告警规则评估（异常规则依赖检测结果），
+// 最后推送到远程写入和导出目标。previous为保存前的记录，已完成的结果重复上报时不再处理
+func processResult(result, previous *models.SpeedTestResult) {
+	if result.Status != models.SpeedTestStatusCompleted {
+		return
+	}
+	if previous != nil && previous.Status == models.SpeedTestStatusCompleted {
+		return
+	}
+
+	go func(result models.SpeedTestResult) {
+		anomaly.Detect(&result)
+		alerting.EvaluateResult(&result)
+		metrics.Push(&result)
+		exporter.PublishResult(&result)
+	}(*result)
+}
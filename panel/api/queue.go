@@ -0,0 +1,18 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"../scheduler"
+)
+
+// 获取调度队列状态：并发限制、各节点正在参与的测试数和按优先级排列的等待中测试
+func GetQueueHandler(c *gin.Context) {
+	state, err := scheduler.GetQueueState()
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	SuccessResponse(c, state)
+}
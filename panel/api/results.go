@@ -0,0 +1,116 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"../models"
+)
+
+// 测速结果每页的默认和最大数量
+const (
+	defaultResultLimit = 20
+	maxResultLimit     = 1000
+)
+
+// 从查询参数解析测速结果的过滤和排序条件：
+// node、source、target、type、status（逗号分隔）、from、to（RFC 3339）、tag、
+// <指标>_min、<指标>_max、sort、order（asc或desc）
+func parseResultQuery(c *gin.Context) (models.ResultQuery, error) {
+	q := models.ResultQuery{
+		NodeID:       c.Query("node"),
+		SourceNodeID: c.Query("source"),
+		TargetNodeID: c.Query("target"),
+		Type:         models.SpeedTestType(c.Query("type")),
+		Tag:          strings.TrimSpace(c.Query("tag")),
+		Sort:         c.Query("sort"),
+	}
+	// 兼容旧的nodeId参数
+	if q.NodeID == "" {
+		q.NodeID = c.Query("nodeId")
+	}
+	if q.Type != "" && !q.Type.Valid() {
+		return q, fmt.Errorf("无效的测试类型: %s", q.Type)
+	}
+
+	if value := c.Query("status"); value != "" {
+		for _, status := range strings.Split(value, ",") {
+			q.Statuses = append(q.Statuses, models.SpeedTestStatus(strings.TrimSpace(status)))
+		}
+	}
+
+	var err error
+	if value := c.Query("from"); value != "" {
+		if q.From, err = time.Parse(time.RFC3339, value); err != nil {
+			return q, fmt.Errorf("无效的开始时间: %s", value)
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if q.To, err = time.Parse(time.RFC3339, value); err != nil {
+			return q, fmt.Errorf("无效的结束时间: %s", value)
+		}
+	}
+
+	for _, metric := range models.Metrics {
+		r := models.MetricRange{Metric: metric}
+		if r.Min, err = floatQuery(c, metric+"_min"); err != nil {
+			return q, err
+		}
+		if r.Max, err = floatQuery(c, metric+"_max"); err != nil {
+			return q, err
+		}
+		if r.Min != nil || r.Max != nil {
+			q.Ranges = append(q.Ranges, r)
+		}
+	}
+
+	switch c.DefaultQuery("order", "desc") {
+	case "asc":
+		q.Asc = true
+	case "desc":
+	default:
+		return q, fmt.Errorf("无效的排序方向: %s，应为asc或desc", c.Query("order"))
+	}
+
+	return q, q.Validate()
+}
+
+// 解析数值查询参数，未设置时返回nil
+func floatQuery(c *gin.Context, key string) (*float64, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 %s: %s", key, value)
+	}
+	return &f, nil
+}
+
+// 解析分页参数：limit（兼容pageSize）和cursor，或旧的page参数按偏移量分页
+func parseResultPage(c *gin.Context, q *models.ResultQuery) (int, error) {
+	limitValue := c.Query("limit")
+	if limitValue == "" {
+		limitValue = c.DefaultQuery("pageSize", strconv.Itoa(defaultResultLimit))
+	}
+	limit, err := strconv.Atoi(limitValue)
+	if err != nil || limit <= 0 || limit > maxResultLimit {
+		return 0, fmt.Errorf("无效的数量，应为1到%d", maxResultLimit)
+	}
+	q.Limit = limit
+	q.Cursor = c.Query("cursor")
+
+	page := 0
+	if value := c.Query("page"); value != "" {
+		if page, err = strconv.Atoi(value); err != nil || page < 1 {
+			return 0, fmt.Errorf("无效的页码: %s", value)
+		}
+		q.Offset = (page - 1) * limit
+	}
+	return page, q.Validate()
+}
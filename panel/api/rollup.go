@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"../models"
+	"../rollup"
+)
+
+// 查询测速结果汇总，未指定时间范围时返回最近7天的小时汇总或最近90天的每日汇总
+func GetRollupsHandler(c *gin.Context) {
+	period := models.RollupPeriod(c.DefaultQuery("period", string(models.RollupHour)))
+	if !period.Valid() {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的时间粒度: %s，应为hour或day", period))
+		return
+	}
+	testType := models.SpeedTestType(c.Query("type"))
+	if testType != "" && !testType.Valid() {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的测试类型: %s", testType))
+		return
+	}
+	metric := c.Query("metric")
+	if metric != "" && models.MetricTestTypes(metric) == nil {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的指标: %s", metric))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "5000"))
+	if err != nil || limit <= 0 || limit > 50000 {
+		ErrorResponse(c, 400, "无效的数量，应为1到50000")
+		return
+	}
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -7)
+	if period == models.RollupDay {
+		from = to.AddDate(0, 0, -90)
+	}
+	if value := c.Query("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			ErrorResponse(c, 400, fmt.Sprintf("无效的开始时间: %s", value))
+			return
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			ErrorResponse(c, 400, fmt.Sprintf("无效的结束时间: %s", value))
+			return
+		}
+	}
+
+	rollups, err := models.GetRollups(models.RollupFilter{
+		Period:       period,
+		SourceNodeID: c.Query("source"),
+		TargetNodeID: c.Query("target"),
+		Type:         testType,
+		Metric:       metric,
+		From:         period.Start(from),
+		To:           to,
+		Limit:        limit,
+	})
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	SuccessResponse(c, gin.H{
+		"period":  period,
+		"rollups": rollups,
+		"total":   len(rollups),
+	})
+}
+
+// 立即执行一次汇总和过期数据清理
+func CompactRollupsHandler(c *gin.Context) {
+	stats, err := rollup.Compact()
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	SuccessResponse(c, stats)
+}
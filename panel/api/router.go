@@ -0,0 +1,129 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// SetupRouter 创建面板路由并注册所有接口
+func SetupRouter() *gin.Engine {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.Use(LoggerMiddleware())
+	router.Use(CORSMiddleware())
+
+	// 前端页面
+	router.StaticFile("/", "./web/index.html")
+	router.Static("/css", "./web/css")
+	router.Static("/js", "./web/js")
+	router.Static("/templates", "./web/templates")
+
+	// 安装脚本、节点程序和CA证书（公开访问）
+	router.GET("/api/install.sh", GetInstallScriptHandler)
+	router.GET("/api/download/:arch", DownloadNodeHandler)
+	router.GET("/api/ca.crt", GetCACertificateHandler)
+
+	// Prometheus指标（可选令牌认证）
+	router.GET("/metrics", MetricsHandler)
+
+	// 节点使用一次性注册令牌换取凭据（令牌认证）
+	router.POST("/api/enroll", EnrollNodeHandler)
+
+	// 节点接口（请求签名认证）
+	nodeAPI := router.Group("/api/node", NodeAuthMiddleware())
+	{
+		nodeAPI.POST("/heartbeat", NodeHeartbeatHandler)
+		nodeAPI.POST("/ping", NodePingHandler)
+		nodeAPI.POST("/certificate", IssueNodeCertificateHandler)
+		nodeAPI.POST("/speedtest/result", ReportSpeedTestResultHandler)
+		nodeAPI.GET("/update/manifest", GetReleaseManifestHandler)
+		nodeAPI.GET("/update/binary/:arch", DownloadReleaseBinaryHandler)
+	}
+
+	// 用户接口（登录认证）
+	userAPI := router.Group("/api", AuthMiddleware())
+	{
+		userAPI.POST("/login", LoginHandler)
+		userAPI.POST("/logout", LogoutHandler)
+		userAPI.POST("/register", RegisterHandler)
+		userAPI.GET("/user", GetCurrentUserHandler)
+
+		userAPI.GET("/nodes", GetNodesHandler)
+		userAPI.GET("/nodes/export", ExportNodesHandler)
+		userAPI.GET("/nodes/:id", GetNodeHandler)
+		userAPI.POST("/nodes", AdminAuthMiddleware(), RegisterNodeHandler)
+		userAPI.PUT("/nodes/:id", UpdateNodeHandler)
+		userAPI.DELETE("/nodes/:id", DeleteNodeHandler)
+		userAPI.POST("/nodes/:id/install-command", AdminAuthMiddleware(), GenerateInstallCommandHandler)
+		userAPI.GET("/nodes/:id/certificates", GetNodeCertificatesHandler)
+		userAPI.GET("/nodes/:id/keys", GetNodeKeysHandler)
+		userAPI.POST("/nodes/:id/keys/rotate", AdminAuthMiddleware(), RotateNodeKeyHandler)
+		userAPI.DELETE("/nodes/:id/keys/:keyId", AdminAuthMiddleware(), RevokeNodeKeyHandler)
+		userAPI.GET("/nodes/:id/availability", GetNodeAvailabilityHandler)
+		userAPI.GET("/availability", GetAvailabilityHandler)
+
+		userAPI.POST("/speedtest", StartSpeedTestHandler)
+		userAPI.GET("/speedtest/results", GetSpeedTestResultsHandler)
+		userAPI.GET("/speedtest/results/export", ExportSpeedTestResultsHandler)
+		userAPI.GET("/speedtest/results/:id", GetSpeedTestResultHandler)
+		userAPI.GET("/speedtest/series", GetSeriesHandler)
+		userAPI.PUT("/speedtest/results/:id", UpdateSpeedTestResultHandler)
+		userAPI.GET("/queue", GetQueueHandler)
+
+		userAPI.GET("/schedules", GetSchedulesHandler)
+		userAPI.GET("/schedules/:id", GetScheduleHandler)
+		userAPI.POST("/schedules", CreateScheduleHandler)
+		userAPI.PUT("/schedules/:id", UpdateScheduleHandler)
+		userAPI.DELETE("/schedules/:id", DeleteScheduleHandler)
+		userAPI.POST("/schedules/:id/run", RunScheduleHandler)
+
+		userAPI.GET("/mesh/runs", GetMeshRunsHandler)
+		userAPI.GET("/mesh/runs/:id", GetMeshRunHandler)
+		userAPI.POST("/mesh/runs", CreateMeshRunHandler)
+		userAPI.POST("/mesh/runs/:id/cancel", CancelMeshRunHandler)
+		userAPI.GET("/mesh/matrix", GetMeshMatrixHandler)
+
+		userAPI.GET("/anomalies", GetAnomaliesHandler)
+		userAPI.GET("/baselines", GetBaselinesHandler)
+		userAPI.GET("/rollups", GetRollupsHandler)
+		userAPI.POST("/rollups/compact", AdminAuthMiddleware(), CompactRollupsHandler)
+		userAPI.GET("/exporters", AdminAuthMiddleware(), GetExportersHandler)
+
+		// Grafana JSON数据源
+		userAPI.GET("/grafana", GrafanaTestHandler)
+		userAPI.POST("/grafana/search", GrafanaSearchHandler)
+		userAPI.POST("/grafana/query", GrafanaQueryHandler)
+
+		userAPI.GET("/alert-rules", GetAlertRulesHandler)
+		userAPI.GET("/alert-rules/:id", GetAlertRuleHandler)
+		userAPI.POST("/alert-rules", CreateAlertRuleHandler)
+		userAPI.PUT("/alert-rules/:id", UpdateAlertRuleHandler)
+		userAPI.DELETE("/alert-rules/:id", DeleteAlertRuleHandler)
+		userAPI.GET("/alerts", GetAlertsHandler)
+		userAPI.GET("/alerts/:id", GetAlertHandler)
+		userAPI.GET("/alert-silences", GetSilencesHandler)
+		userAPI.POST("/alert-silences", CreateSilenceHandler)
+		userAPI.DELETE("/alert-silences/:id", DeleteSilenceHandler)
+
+		userAPI.GET("/notification-channels", AdminAuthMiddleware(), GetNotificationChannelsHandler)
+		userAPI.GET("/notification-channels/:id", AdminAuthMiddleware(), GetNotificationChannelHandler)
+		userAPI.POST("/notification-channels", AdminAuthMiddleware(), CreateNotificationChannelHandler)
+		userAPI.PUT("/notification-channels/:id", AdminAuthMiddleware(), UpdateNotificationChannelHandler)
+		userAPI.DELETE("/notification-channels/:id", AdminAuthMiddleware(), DeleteNotificationChannelHandler)
+		userAPI.POST("/notification-channels/:id/test", AdminAuthMiddleware(), TestNotificationChannelHandler)
+
+		userAPI.GET("/enrollment-tokens", AdminAuthMiddleware(), GetEnrollmentTokensHandler)
+		userAPI.POST("/enrollment-tokens", AdminAuthMiddleware(), CreateEnrollmentTokenHandler)
+		userAPI.DELETE("/enrollment-tokens/:id", AdminAuthMiddleware(), RevokeEnrollmentTokenHandler)
+
+		userAPI.GET("/updates", AdminAuthMiddleware(), GetUpdatesHandler)
+		userAPI.PUT("/updates/rollouts", AdminAuthMiddleware(), SaveUpdateRolloutHandler)
+		userAPI.DELETE("/updates/rollouts/:group", AdminAuthMiddleware(), DeleteUpdateRolloutHandler)
+
+		userAPI.GET("/stats", GetStatsHandler)
+		userAPI.GET("/settings", GetSettingsHandler)
+		userAPI.PUT("/settings", AdminAuthMiddleware(), UpdateSettingsHandler)
+	}
+
+	return router
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"../models"
+	"../scheduler"
+)
+
+// 保存定时测速任务请求
+type SaveScheduleRequest struct {
+	Name          string                  `json:"name" binding:"required"`
+	Enabled       *bool                   `json:"enabled"` // 未设置时默认启用
+	Cron          string                  `json:"cron"`
+	Interval      int                     `json:"interval"`
+	SourceNodeIDs []string                `json:"source_node_ids"`
+	SourceTag     string                  `json:"source_tag"`
+	TargetNodeIDs []string                `json:"target_node_ids"`
+	TargetTag     string                  `json:"target_tag"`
+	Type          models.SpeedTestType    `json:"type" binding:"required"`
+	Timeout       int                     `json:"timeout"`
+	Threads       int                     `json:"threads"`
+	Size          int                     `json:"size"`
+	Jitter        int                     `json:"jitter"`
+	Blackouts     []models.BlackoutWindow `json:"blackouts"`
+}
+
+// 定时任务响应，附带下一次触发时间
+type ScheduleResponse struct {
+	models.Schedule
+	NextRunAt *time.Time `json:"next_run_at"`
+}
+
+func scheduleResponse(schedule models.Schedule) ScheduleResponse {
+	response := ScheduleResponse{Schedule: schedule}
+	if next := scheduler.NextRun(&schedule); !next.IsZero() {
+		response.NextRunAt = &next
+	}
+	return response
+}
+
+// 将请求内容应用到定时任务
+func (req *SaveScheduleRequest) apply(schedule *models.Schedule) {
+	schedule.Name = strings.TrimSpace(req.Name)
+	schedule.Enabled = req.Enabled == nil || *req.Enabled
+	schedule.Cron = strings.TrimSpace(req.Cron)
+	schedule.Interval = req.Interval
+	schedule.SourceNodeIDs = nonNilStrings(req.SourceNodeIDs)
+	schedule.SourceTag = strings.TrimSpace(req.SourceTag)
+	schedule.TargetNodeIDs = nonNilStrings(req.TargetNodeIDs)
+	schedule.TargetTag = strings.TrimSpace(req.TargetTag)
+	schedule.Type = req.Type
+	schedule.Timeout = req.Timeout
+	schedule.Threads = req.Threads
+	schedule.Size = req.Size
+	schedule.Jitter = req.Jitter
+	schedule.Blackouts = req.Blackouts
+	if schedule.Blackouts == nil {
+		schedule.Blackouts = []models.BlackoutWindow{}
+	}
+}
+
+// 未设置的列表返回空数组而不是null
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// 获取所有定时测速任务
+func GetSchedulesHandler(c *gin.Context) {
+	schedules, err := models.GetSchedules()
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	responses := make([]ScheduleResponse, 0, len(schedules))
+	for _, schedule := range schedules {
+		responses = append(responses, scheduleResponse(schedule))
+	}
+
+	SuccessResponse(c, gin.H{
+		"schedules": responses,
+		"total":     len(responses),
+	})
+}
+
+// 获取单个定时测速任务
+func GetScheduleHandler(c *gin.Context) {
+	schedule, err := models.GetSchedule(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, 404, err.Error())
+		return
+	}
+
+	SuccessResponse(c, scheduleResponse(*schedule))
+}
+
+// 创建定时测速任务
+func CreateScheduleHandler(c *gin.Context) {
+	var req SaveScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的请求数据: %v", err))
+		return
+	}
+
+	schedule := &models.Schedule{CreatedBy: c.GetString("username")}
+	req.apply(schedule)
+	if err := scheduler.ValidateSchedule(schedule); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if err := models.SaveSchedule(schedule); err != nil {
+		APIError(c, err)
+		return
+	}
+
+	log.Printf("用户 %s 创建了定时任务 %s (%s)", c.GetString("username"), schedule.Name, schedule.ID)
+	SuccessResponse(c, scheduleResponse(*schedule))
+}
+
+// 更新定时测速任务
+func UpdateScheduleHandler(c *gin.Context) {
+	schedule, err := models.GetSchedule(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, 404, err.Error())
+		return
+	}
+
+	var req SaveScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的请求数据: %v", err))
+		return
+	}
+
+	req.apply(schedule)
+	if err := scheduler.ValidateSchedule(schedule); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if err := models.SaveSchedule(schedule); err != nil {
+		APIError(c, err)
+		return
+	}
+
+	SuccessResponse(c, scheduleResponse(*schedule))
+}
+
+// 删除定时测速任务
+func DeleteScheduleHandler(c *gin.Context) {
+	if err := models.DeleteSchedule(c.Param("id")); err != nil {
+		ErrorResponse(c, 404, err.Error())
+		return
+	}
+
+	SuccessResponse(c, gin.H{"message": "定时任务已删除"})
+}
+
+// 立即执行一次定时测速任务，不检查禁止时段
+func RunScheduleHandler(c *gin.Context) {
+	schedule, err := models.GetSchedule(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, 404, err.Error())
+		return
+	}
+
+	created, skipped, err := scheduler.RunSchedule(schedule)
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	SuccessResponse(c, gin.H{
+		"created": created,
+		"skipped": skipped,
+	})
+}
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"../models"
+	"../series"
+)
+
+// 查询时间序列，返回按步长分段的统计。format=chartjs返回Chart.js数据集，
+// format=grafana返回Grafana JSON数据源的时间序列格式
+func GetSeriesHandler(c *gin.Context) {
+	q := series.Query{
+		NodeID:       c.Query("node"),
+		SourceNodeID: c.Query("source"),
+		TargetNodeID: c.Query("target"),
+		Metric:       c.Query("metric"),
+		To:           time.Now(),
+	}
+	q.From = q.To.Add(-24 * time.Hour)
+	var err error
+	if value := c.Query("from"); value != "" {
+		if q.From, err = time.Parse(time.RFC3339, value); err != nil {
+			ErrorResponse(c, 400, fmt.Sprintf("无效的开始时间: %s", value))
+			return
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if q.To, err = time.Parse(time.RFC3339, value); err != nil {
+			ErrorResponse(c, 400, fmt.Sprintf("无效的结束时间: %s", value))
+			return
+		}
+	}
+	if q.Step, err = series.ParseStep(c.Query("step")); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+	stats, err := parseSeriesStats(c.DefaultQuery("stats", series.StatAvg))
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "chartjs" && format != "grafana" {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的格式: %s，应为json、chartjs或grafana", format))
+		return
+	}
+	if err := q.Validate(); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	result, err := series.Run(q)
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	switch format {
+	case "chartjs":
+		SuccessResponse(c, chartJSData(result, stats))
+	case "grafana":
+		c.JSON(http.StatusOK, grafanaSeries(result, stats, ""))
+	default:
+		SuccessResponse(c, result)
+	}
+}
+
+// 解析以逗号分隔的统计量
+func parseSeriesStats(value string) ([]string, error) {
+	var stats []string
+	for _, stat := range strings.Split(value, ",") {
+		stat = strings.TrimSpace(stat)
+		if stat == "" {
+			continue
+		}
+		valid := false
+		for _, s := range series.Stats {
+			valid = valid || s == stat
+		}
+		if !valid {
+			return nil, fmt.Errorf("无效的统计量: %s，应为%s", stat, strings.Join(series.Stats, "、"))
+		}
+		stats = append(stats, stat)
+	}
+	if len(stats) == 0 {
+		return nil, fmt.Errorf("至少指定一个统计量")
+	}
+	return stats, nil
+}
+
+// 数据集名称，只有一个统计量时省略统计量
+func seriesLabel(s *series.Series, stat string, stats []string) string {
+	if len(stats) == 1 {
+		return s.Label
+	}
+	return s.Label + " " + stat
+}
+
+// Chart.js格式：labels为各时间段的开始时间，每个节点对的每个统计量为一个数据集，空时间段为null
+func chartJSData(result *series.Result, stats []string) gin.H {
+	labels := []string{}
+	datasets := []gin.H{}
+	for i, s := range result.Series {
+		if i == 0 {
+			for _, p := range s.Points {
+				labels = append(labels, p.Time.Format(time.RFC3339))
+			}
+		}
+		for _, stat := range stats {
+			data := make([]*float64, len(s.Points))
+			for j := range s.Points {
+				data[j] = s.Points[j].Value(stat)
+			}
+			datasets = append(datasets, gin.H{
+				"label":          seriesLabel(&result.Series[i], stat, stats),
+				"data":           data,
+				"source_node_id": s.SourceNodeID,
+				"target_node_id": s.TargetNodeID,
+				"stat":           stat,
+			})
+		}
+	}
+	return gin.H{
+		"labels":      labels,
+		"datasets":    datasets,
+		"metric":      result.Metric,
+		"step":        result.Step,
+		"sources":     result.Sources,
+		"approximate": result.Approximate,
+	}
+}
+
+// Grafana时间序列格式：datapoints为[值, 毫秒时间戳]，跳过空时间段。refID非空时附带查询的refId
+func grafanaSeries(result *series.Result, stats []string, refID string) []gin.H {
+	targets := []gin.H{}
+	for i, s := range result.Series {
+		for _, stat := range stats {
+			datapoints := [][2]interface{}{}
+			for j := range s.Points {
+				if value := s.Points[j].Value(stat); value != nil && s.Points[j].Count > 0 {
+					datapoints = append(datapoints, [2]interface{}{*value, s.Points[j].Time.UnixNano() / int64(time.Millisecond)})
+				}
+			}
+			target := gin.H{
+				"target":     seriesLabel(&result.Series[i], stat, stats),
+				"datapoints": datapoints,
+			}
+			if refID != "" {
+				target["refId"] = refID
+			}
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// Grafana JSON数据源的连接测试
+func GrafanaTestHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Grafana JSON数据源的指标列表
+func GrafanaSearchHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, models.Metrics)
+}
+
+// Grafana查询请求
+type grafanaQueryRequest struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	IntervalMs    int64 `json:"intervalMs"`
+	MaxDataPoints int   `json:"maxDataPoints"`
+	Targets       []struct {
+		RefID   string `json:"refId"`
+		Target  string `json:"target"` // 指标
+		Hide    bool   `json:"hide"`
+		Payload struct {
+			Source string `json:"source"`
+			Target string `json:"target"`
+			Node   string `json:"node"`
+			Stats  string `json:"stats"` // 以逗号分隔，默认avg
+			Step   string `json:"step"`  // 默认按Grafana的intervalMs取整到分钟
+		} `json:"payload"`
+	} `json:"targets"`
+}
+
+// Grafana JSON数据源的查询，每个target的payload指定节点对或节点
+func GrafanaQueryHandler(c *gin.Context) {
+	var req grafanaQueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "无效的请求参数"})
+		return
+	}
+
+	response := []gin.H{}
+	for _, target := range req.Targets {
+		if target.Hide {
+			continue
+		}
+		q := series.Query{
+			NodeID:       target.Payload.Node,
+			SourceNodeID: target.Payload.Source,
+			TargetNodeID: target.Payload.Target,
+			Metric:       target.Target,
+			From:         req.Range.From,
+			To:           req.Range.To,
+		}
+		var err error
+		if q.Step, err = series.ParseStep(target.Payload.Step); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		if q.Step == 0 && req.IntervalMs > 0 {
+			q.Step = (time.Duration(req.IntervalMs) * time.Millisecond).Truncate(time.Minute)
+			if q.Step < time.Minute {
+				q.Step = time.Minute
+			}
+			for q.To.Sub(q.From)/q.Step > series.MaxPoints {
+				q.Step *= 2
+			}
+		}
+		if target.Payload.Stats == "" {
+			target.Payload.Stats = series.StatAvg
+		}
+		stats, err := parseSeriesStats(target.Payload.Stats)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+
+		result, err := series.Run(q)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("%s: %v", target.RefID, err)})
+			return
+		}
+		response = append(response, grafanaSeries(result, stats, target.RefID)...)
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"../auth"
+	"../config"
+	"../models"
+)
+
+// 发布清单及其签名的文件名，位于发布目录中
+const (
+	releaseManifestFile  = "manifest.json"
+	releaseSignatureFile = "manifest.json.sig"
+)
+
+// 保存发布记录请求
+type SaveUpdateRolloutRequest struct {
+	Group   string `json:"group"`                      // 节点分组，为空时表示所有节点
+	Version string `json:"version" binding:"required"` // 目标版本
+	Paused  bool   `json:"paused"`                     // 是否暂停
+}
+
+// 发布清单响应，清单保持原始内容以便节点校验签名
+type ReleaseManifestResponse struct {
+	Manifest  string `json:"manifest"`  // 清单原文
+	Signature string `json:"signature"` // Base64编码的ed25519签名
+}
+
+// 节点程序校验结果缓存，文件未变化时不重复计算校验和
+type checksumEntry struct {
+	modTime time.Time
+	size    int64
+	sum     string
+}
+
+var (
+	checksumCache = make(map[string]checksumEntry)
+	checksumMutex sync.Mutex
+)
+
+// 读取发布清单，面板配置了发布公钥时同时校验签名
+func loadReleaseManifest() (*auth.ReleaseManifest, []byte, []byte, error) {
+	dir := config.GetConfig().ReleaseDir
+	data, err := ioutil.ReadFile(filepath.Join(dir, releaseManifestFile))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("读取发布清单失败: %v", err)
+	}
+	signature, err := ioutil.ReadFile(filepath.Join(dir, releaseSignatureFile))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("读取发布清单签名失败: %v", err)
+	}
+
+	publicKey := config.GetConfig().UpdatePublicKey
+	if publicKey == "" {
+		// 未配置公钥时只解析清单，签名由节点校验
+		var manifest auth.ReleaseManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, nil, nil, fmt.Errorf("解析发布清单失败: %v", err)
+		}
+		return &manifest, data, signature, nil
+	}
+
+	key, err := auth.ParseReleasePublicKey(publicKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	manifest, err := auth.VerifyReleaseManifest(data, signature, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return manifest, data, signature, nil
+}
+
+// 查找清单中指定架构的节点程序，并校验文件与清单一致
+func releaseBinary(manifest *auth.ReleaseManifest, arch string) (string, *auth.ReleaseBinary, error) {
+	binary, ok := manifest.Binaries[arch]
+	if !ok {
+		return "", nil, fmt.Errorf("发布清单中没有 %s 架构的节点程序", arch)
+	}
+
+	path := filepath.Join(config.GetConfig().ReleaseDir, filepath.Base(binary.File))
+	sum, err := fileChecksum(path)
+	if err != nil {
+		return "", nil, err
+	}
+	if !strings.EqualFold(sum, binary.SHA256) {
+		return "", nil, fmt.Errorf("节点程序 %s 与发布清单不一致", binary.File)
+	}
+	return path, &binary, nil
+}
+
+// 计算文件的SHA-256校验和
+func fileChecksum(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("节点程序不存在: %s", filepath.Base(path))
+	}
+
+	checksumMutex.Lock()
+	entry, ok := checksumCache[path]
+	checksumMutex.Unlock()
+	if ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		return entry.sum, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	checksumMutex.Lock()
+	checksumCache[path] = checksumEntry{modTime: info.ModTime(), size: info.Size(), sum: sum}
+	checksumMutex.Unlock()
+	return sum, nil
+}
+
+// 判断是否需要通知节点更新，返回目标版本，无需更新时返回空字符串
+func offeredUpdate(node *models.Node, heartbeat *models.NodeHeartbeat) string {
+	rollout, err := models.GetUpdateRolloutForGroup(node.Group)
+	if err != nil {
+		log.Printf("查询节点更新发布记录失败: %v", err)
+		return ""
+	}
+	if rollout == nil || rollout.Paused || rollout.Version == heartbeat.Version {
+		return ""
+	}
+
+	// 节点已回滚过该版本时不再重复推送
+	if rollout.Version == heartbeat.FailedVersion {
+		return ""
+	}
+
+	// 只推送面板当前托管的版本
+	manifest, _, _, err := loadReleaseManifest()
+	if err != nil || manifest.Version != rollout.Version {
+		return ""
+	}
+	return rollout.Version
+}
+
+// 节点获取发布清单
+func GetReleaseManifestHandler(c *gin.Context) {
+	_, data, signature, err := loadReleaseManifest()
+	if err != nil {
+		ErrorResponse(c, 404, err.Error())
+		return
+	}
+
+	SuccessResponse(c, ReleaseManifestResponse{
+		Manifest:  string(data),
+		Signature: string(signature),
+	})
+}
+
+// 节点下载清单中的节点程序
+func DownloadReleaseBinaryHandler(c *gin.Context) {
+	manifest, _, _, err := loadReleaseManifest()
+	if err != nil {
+		c.String(http.StatusNotFound, err.Error())
+		return
+	}
+
+	path, binary, err := releaseBinary(manifest, c.Param("arch"))
+	if err != nil {
+		log.Printf("节点 %s 下载节点程序失败: %v", c.GetString("nodeID"), err)
+		c.String(http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filepath.Base(path)))
+	c.Header("X-Checksum-SHA256", binary.SHA256)
+	c.File(path)
+}
+
+// 获取节点更新概况：当前托管的版本、各分组的发布记录和节点版本分布
+func GetUpdatesHandler(c *gin.Context) {
+	manifest, _, _, err := loadReleaseManifest()
+	manifestError := ""
+	if err != nil {
+		manifestError = err.Error()
+	}
+
+	rollouts, err := models.GetUpdateRollouts()
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+
+	nodes, err := models.GetAllNodes()
+	if err != nil {
+		APIError(c, err)
+		return
+	}
+	versions := make(map[string]int)
+	for _, node := range nodes {
+		versions[node.Version]++
+	}
+
+	SuccessResponse(c, gin.H{
+		"manifest":       manifest,
+		"manifest_error": manifestError,
+		"rollouts":       rollouts,
+		"versions":       versions,
+	})
+}
+
+// 设置分组的目标版本，先对少量分组发布，确认正常后再扩大范围
+func SaveUpdateRolloutHandler(c *gin.Context) {
+	var req SaveUpdateRolloutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, fmt.Sprintf("无效的请求数据: %v", err))
+		return
+	}
+
+	group := strings.TrimSpace(req.Group)
+	if group == "" {
+		group = models.RolloutAllGroups
+	}
+
+	rollout := &models.UpdateRollout{
+		Group:   group,
+		Version: strings.TrimSpace(req.Version),
+		Paused:  req.Paused,
+	}
+	if err := models.SaveUpdateRollout(rollout); err != nil {
+		APIError(c, err)
+		return
+	}
+
+	log.Printf("用户 %s 将分组 %s 的目标版本设置为 %s（暂停: %v）",
+		c.GetString("username"), rollout.Group, rollout.Version, rollout.Paused)
+	SuccessResponse(c, rollout)
+}
+
+// 删除分组的发布记录，该分组的节点改为遵循 "*" 记录
+func DeleteUpdateRolloutHandler(c *gin.Context) {
+	if err := models.DeleteUpdateRollout(c.Param("group")); err != nil {
+		ErrorResponse(c, 404, err.Error())
+		return
+	}
+
+	SuccessResponse(c, nil)
+}
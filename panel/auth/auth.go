@@ -5,7 +5,6 @@ import (
 	"encoding/base64"
 	"fmt"
 	"log"
-	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -114,20 +113,3 @@ func GenerateAPIKey(userID string) (string, error) {
 	// 添加前缀和用户ID
 	return fmt.Sprintf("nsp_%s_%s", userID, key), nil
 }
-
-// 验证节点密钥
-func ValidateNodeKey(key string, nodeID string) bool {
-	// 实际应用中应该从数据库验证
-	// 这里简化处理，检查密钥格式和前缀
-	if len(key) < 10 || key[:3] != "sk_" {
-		return false
-	}
-	
-	// 检查节点ID是否匹配
-	parts := strings.Split(key, "_")
-	if len(parts) < 2 {
-		return false
-	}
-	
-	return parts[1] == nodeID
-} 
\ No newline at end of file
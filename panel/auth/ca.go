@@ -0,0 +1,307 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// PanelCommonName 面板证书的CN，节点据此识别面板发起的连接
+const PanelCommonName = "node-speedtest-panel"
+
+// 面板自身证书的有效期和提前续期时间
+const (
+	panelCertValidity = 90 * 24 * time.Hour
+	panelCertRenewal  = 30 * 24 * time.Hour
+)
+
+// CA 面板内置的证书颁发机构，为节点和面板签发证书
+type CA struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     *ecdsa.PrivateKey
+	hosts   []string
+
+	// 面板自身的证书，到期前自动续签
+	panelCert *tls.Certificate
+	mutex     sync.Mutex
+}
+
+var ca *CA
+
+// InitCA 从目录加载CA证书和私钥，不存在时创建，hosts为面板证书的主机名
+func InitCA(dir string, hosts []string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("创建证书目录失败: %v", err)
+	}
+
+	certPath := filepath.Join(dir, "ca.crt")
+	keyPath := filepath.Join(dir, "ca.key")
+
+	if _, err := os.Stat(certPath); os.IsNotExist(err) {
+		if err := createCA(certPath, keyPath); err != nil {
+			return err
+		}
+		log.Printf("已创建面板CA: %s", certPath)
+	}
+
+	certPEM, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return fmt.Errorf("读取CA证书失败: %v", err)
+	}
+	keyPEM, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return fmt.Errorf("读取CA私钥失败: %v", err)
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return fmt.Errorf("CA证书或私钥格式无效")
+	}
+
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return fmt.Errorf("解析CA证书失败: %v", err)
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return fmt.Errorf("解析CA私钥失败: %v", err)
+	}
+
+	ca = &CA{
+		cert:    cert,
+		certPEM: certPEM,
+		key:     key,
+		hosts:   hosts,
+	}
+	log.Printf("面板CA已加载，指纹: %s", ca.Fingerprint())
+	return nil
+}
+
+// GetCA 获取面板CA，未启用TLS时返回nil
+func GetCA() *CA {
+	return ca
+}
+
+// 创建新的CA证书和私钥
+func createCA(certPath, keyPath string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("生成CA私钥失败: %v", err)
+	}
+
+	serial, err := newSerial()
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "node-speedtest CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("创建CA证书失败: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("序列化CA私钥失败: %v", err)
+	}
+
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return fmt.Errorf("保存CA私钥失败: %v", err)
+	}
+	if err := ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return fmt.Errorf("保存CA证书失败: %v", err)
+	}
+	return nil
+}
+
+// CertPEM 返回PEM格式的CA证书
+func (c *CA) CertPEM() []byte {
+	return c.certPEM
+}
+
+// Fingerprint 返回CA证书的SHA-256指纹，节点首次连接时用于校验CA
+func (c *CA) Fingerprint() string {
+	sum := sha256.Sum256(c.cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Pool 返回只包含CA证书的证书池
+func (c *CA) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.cert)
+	return pool
+}
+
+// IssueNodeCertificate 根据CSR为节点签发证书，CN为节点ID，可同时用于客户端和服务端认证
+func (c *CA) IssueNodeCertificate(nodeID, nodeIP string, csrPEM []byte, validity time.Duration) ([]byte, *x509.Certificate, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, nil, fmt.Errorf("无效的证书请求")
+	}
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("解析证书请求失败: %v", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, nil, fmt.Errorf("证书请求签名无效: %v", err)
+	}
+
+	serial, err := newSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 证书身份只取自面板记录，忽略CSR中声明的主体和SAN
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: nodeID},
+		NotBefore:    time.Now().Add(-5 * time.Minute),
+		NotAfter:     time.Now().Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(nodeIP); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else if nodeIP != "" {
+		template.DNSNames = []string{nodeIP}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, c.cert, csr.PublicKey, c.key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("签发证书失败: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), cert, nil
+}
+
+// 获取面板证书，剩余有效期不足时重新签发
+func (c *CA) getPanelCertificate() (*tls.Certificate, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.panelCert != nil && time.Until(c.panelCert.Leaf.NotAfter) > panelCertRenewal {
+		return c.panelCert, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成面板私钥失败: %v", err)
+	}
+
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: PanelCommonName},
+		NotBefore:    time.Now().Add(-5 * time.Minute),
+		NotAfter:     time.Now().Add(panelCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, host := range c.hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, c.cert, &key.PublicKey, c.key)
+	if err != nil {
+		return nil, fmt.Errorf("签发面板证书失败: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	c.panelCert = &tls.Certificate{
+		Certificate: [][]byte{der, c.cert.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+	log.Printf("已签发面板证书，有效期至 %s", leaf.NotAfter.Format("2006-01-02"))
+	return c.panelCert, nil
+}
+
+// ServerTLSConfig 面板监听使用的TLS配置，节点证书可选以便未持有证书的节点申请证书，
+// isRevoked 用于检查证书是否已被吊销
+func (c *CA) ServerTLSConfig(isRevoked func(serial string) bool) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		ClientCAs:  c.Pool(),
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return c.getPanelCertificate()
+		},
+		VerifyPeerCertificate: func(_ [][]byte, chains [][]*x509.Certificate) error {
+			for _, chain := range chains {
+				if len(chain) > 0 && isRevoked(SerialString(chain[0])) {
+					return fmt.Errorf("证书已被吊销")
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// ClientTLSConfig 面板连接节点时使用的TLS配置，出示面板证书并只信任CA签发的节点证书
+func (c *CA) ClientTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    c.Pool(),
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return c.getPanelCertificate()
+		},
+	}
+}
+
+// SerialString 返回证书序列号的十六进制表示
+func SerialString(cert *x509.Certificate) string {
+	return cert.SerialNumber.Text(16)
+}
+
+// 生成随机证书序列号
+func newSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("生成证书序列号失败: %v", err)
+	}
+	return serial, nil
+}
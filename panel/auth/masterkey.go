@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 面板主密钥，用于加密保存节点的签名密钥
+var masterKey []byte
+
+// InitMasterKey 从文件加载面板主密钥，不存在时生成。主密钥与数据库分开保存，
+// 只拿到数据库无法还原节点签名密钥
+func InitMasterKey(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("生成主密钥失败: %v", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return fmt.Errorf("创建主密钥目录失败: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+			return fmt.Errorf("保存主密钥失败: %v", err)
+		}
+		log.Printf("已生成面板主密钥: %s，请与数据库分开备份", path)
+		masterKey = key
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取主密钥失败: %v", err)
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return fmt.Errorf("主密钥格式无效: %s", path)
+	}
+	masterKey = key
+	return nil
+}
+
+// SealSigningKey 使用主密钥加密节点签名密钥（AES-256-GCM），返回Base64编码的密文
+func SealSigningKey(signingKey []byte) (string, error) {
+	aead, err := masterAEAD()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("生成nonce失败: %v", err)
+	}
+	sealed := aead.Seal(nonce, nonce, signingKey, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenSigningKey 解密保存的节点签名密钥
+func OpenSigningKey(sealed string) ([]byte, error) {
+	aead, err := masterAEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("无效的加密密钥")
+	}
+	key, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("解密签名密钥失败，主密钥可能不匹配")
+	}
+	return key, nil
+}
+
+// 创建主密钥的AEAD
+func masterAEAD() (cipher.AEAD, error) {
+	if masterKey == nil {
+		return nil, fmt.Errorf("面板主密钥未初始化")
+	}
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"encoding/hex"
+	"path/filepath"
+	"testing"
+
+	"../../common/signature"
+)
+
+func TestSealOpenSigningKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "master.key")
+	if err := InitMasterKey(path); err != nil {
+		t.Fatalf("InitMasterKey: %v", err)
+	}
+
+	key, lookup, sealed, err := GenerateNodeKey()
+	if err != nil {
+		t.Fatalf("GenerateNodeKey: %v", err)
+	}
+
+	signingKey := signature.SigningKey(key)
+	if lookup == hex.EncodeToString(signingKey) {
+		t.Fatal("查找哈希不能等于签名密钥")
+	}
+
+	opened, err := OpenSigningKey(sealed)
+	if err != nil {
+		t.Fatalf("OpenSigningKey: %v", err)
+	}
+	if string(opened) != string(signingKey) {
+		t.Fatal("解密后的签名密钥不一致")
+	}
+
+	// 重新加载同一主密钥文件后仍能解密
+	masterKey = nil
+	if err := InitMasterKey(path); err != nil {
+		t.Fatalf("reload InitMasterKey: %v", err)
+	}
+	if _, err := OpenSigningKey(sealed); err != nil {
+		t.Fatalf("reload OpenSigningKey: %v", err)
+	}
+
+	// 更换主密钥后无法解密
+	if err := InitMasterKey(filepath.Join(t.TempDir(), "other.key")); err != nil {
+		t.Fatalf("InitMasterKey: %v", err)
+	}
+	if _, err := OpenSigningKey(sealed); err == nil {
+		t.Fatal("使用其他主密钥不应解密成功")
+	}
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"../../common/signature"
+)
+
+// 节点密钥和注册令牌的前缀，便于在日志和配置中识别
+const (
+	nodeKeyPrefix         = "nk_"
+	enrollmentTokenPrefix = "et_"
+)
+
+// NodeKeyPrefixLength 列表中展示的密钥前缀长度，用于区分同一节点的多个密钥
+const NodeKeyPrefixLength = 10
+
+// GenerateNodeKey 生成随机节点密钥，返回明文密钥、用于查找的哈希和加密后的签名密钥。
+// 面板只保存后两者，查找哈希无法用于签名，签名密钥需要主密钥才能解密
+func GenerateNodeKey() (string, string, string, error) {
+	key, err := randomSecret(nodeKeyPrefix)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	signingKey := signature.SigningKey(key)
+	sealed, err := SealSigningKey(signingKey)
+	if err != nil {
+		return "", "", "", err
+	}
+	return key, lookupHash(signingKey), sealed, nil
+}
+
+// GenerateEnrollmentToken 生成一次性注册令牌，返回明文令牌及其哈希
+func GenerateEnrollmentToken() (string, string, error) {
+	token, err := randomSecret(enrollmentTokenPrefix)
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashToken(token), nil
+}
+
+// IsEnrollmentToken 判断字符串是否为注册令牌格式
+func IsEnrollmentToken(s string) bool {
+	return strings.HasPrefix(s, enrollmentTokenPrefix)
+}
+
+// 生成带前缀的随机密钥
+func randomSecret(prefix string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成密钥失败: %v", err)
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken 计算注册令牌的哈希（十六进制）
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// 由签名密钥计算用于查找的哈希，无法由该哈希还原签名密钥
+func lookupHash(signingKey []byte) string {
+	sum := sha256.Sum256(signingKey)
+	return hex.EncodeToString(sum[:])
+}
+
+// NodeKeyPrefix 返回密钥的展示前缀
+func NodeKeyPrefix(key string) string {
+	if len(key) <= NodeKeyPrefixLength {
+		return key
+	}
+	return key[:NodeKeyPrefixLength]
+}
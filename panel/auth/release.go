@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ReleaseManifest 节点程序发布清单，由发布密钥签名，节点据此校验下载的程序
+type ReleaseManifest struct {
+	Version   string                   `json:"version"`    // 发布版本
+	CreatedAt time.Time                `json:"created_at"` // 生成时间
+	Binaries  map[string]ReleaseBinary `json:"binaries"`   // 按架构（amd64、arm64、arm）区分的程序文件
+}
+
+// ReleaseBinary 单个架构的节点程序
+type ReleaseBinary struct {
+	File   string `json:"file"`   // 文件名
+	SHA256 string `json:"sha256"` // SHA-256校验和（十六进制）
+	Size   int64  `json:"size"`   // 文件大小（字节）
+}
+
+// ParseReleasePublicKey 解析Base64编码的ed25519发布公钥
+func ParseReleasePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("无效的发布公钥")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// VerifyReleaseManifest 校验清单签名并解析清单，签名为Base64编码的ed25519签名
+func VerifyReleaseManifest(data, signature []byte, publicKey ed25519.PublicKey) (*ReleaseManifest, error) {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("无效的清单签名格式")
+	}
+	if !ed25519.Verify(publicKey, data, sig) {
+		return nil, fmt.Errorf("清单签名校验失败")
+	}
+
+	var manifest ReleaseManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("解析发布清单失败: %v", err)
+	}
+	if manifest.Version == "" || len(manifest.Binaries) == 0 {
+		return nil, fmt.Errorf("发布清单缺少版本或程序文件")
+	}
+	return &manifest, nil
+}
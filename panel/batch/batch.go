@@ -0,0 +1,189 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Options 批量写入队列的参数
+type Options struct {
+	Name          string        // 日志中显示的名称
+	BufferSize    int           // 队列容量，队列满时丢弃新的数据
+	BatchSize     int           // 每次最多写入的数据数
+	FlushInterval time.Duration // 队列中的数据最多等待该时间后写入
+	MaxRetries    int           // 写入失败后的重试次数，第n次重试前等待n倍的RetryDelay
+	RetryDelay    time.Duration
+	Timeout       time.Duration // 单次写入的超时
+}
+
+// Stats 队列的写入情况
+type Stats struct {
+	Written   int64     // 已写入的数据数
+	Dropped   int64     // 队列满或重试后仍失败而丢弃的数据数
+	LastWrite time.Time // 最后一次写入成功的时间
+	LastError string    // 最后一次写入失败的错误，写入成功后清空
+}
+
+// 不可重试的错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 标记写入错误不可重试（如请求被拒绝），该批数据直接丢弃
+func Permanent(err error) error {
+	return &permanentError{err}
+}
+
+// Queue 后台批量写入队列：攒够一批或到达写入间隔时写入，失败时重试，停止时写入队列中剩余的数据
+type Queue[T any] struct {
+	opts  Options
+	write func(ctx context.Context, batch []T) error
+	queue chan T
+	stop  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+
+	mutex sync.Mutex
+	stats Stats
+}
+
+// New 创建队列并启动后台写入任务，同一队列的write不会并发调用
+func New[T any](opts Options, write func(ctx context.Context, batch []T) error) *Queue[T] {
+	q := &Queue[T]{
+		opts:  opts,
+		write: write,
+		queue: make(chan T, opts.BufferSize),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// Push 将数据加入队列，队列满时丢弃并返回false
+func (q *Queue[T]) Push(item T) bool {
+	select {
+	case q.queue <- item:
+		return true
+	default:
+	}
+
+	q.mutex.Lock()
+	q.stats.Dropped++
+	dropped := q.stats.Dropped
+	q.mutex.Unlock()
+	// 队列持续满时每1000条记录一次，避免刷屏
+	if dropped%1000 == 1 {
+		log.Printf("%s 队列已满，已丢弃 %d 条数据", q.opts.Name, dropped)
+	}
+	return false
+}
+
+// Len 返回队列中等待写入的数据数
+func (q *Queue[T]) Len() int {
+	return len(q.queue)
+}
+
+// Stats 返回队列的写入情况
+func (q *Queue[T]) Stats() Stats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.stats
+}
+
+// Done 返回后台写入任务结束时关闭的通道
+func (q *Queue[T]) Done() <-chan struct{} {
+	return q.done
+}
+
+// Stop 停止后台写入任务，在ctx结束前等待队列中剩余的数据写入完成，超时返回false。
+// 停止后不应再调用Push
+func (q *Queue[T]) Stop(ctx context.Context) bool {
+	q.once.Do(func() { close(q.stop) })
+	select {
+	case <-q.done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (q *Queue[T]) run() {
+	defer close(q.done)
+
+	ticker := time.NewTicker(q.opts.FlushInterval)
+	defer ticker.Stop()
+
+	var batch []T
+	for {
+		select {
+		case item := <-q.queue:
+			batch = append(batch, item)
+			if len(batch) < q.opts.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		case <-q.stop:
+			for {
+				select {
+				case item := <-q.queue:
+					batch = append(batch, item)
+					if len(batch) >= q.opts.BatchSize {
+						q.flush(batch)
+						batch = nil
+					}
+				default:
+					q.flush(batch)
+					return
+				}
+			}
+		}
+		q.flush(batch)
+		batch = nil
+	}
+}
+
+// 写入一批数据，失败时按递增的间隔重试，重试后仍失败时丢弃。
+// 停止后不再等待重试，剩余的重试立即进行
+func (q *Queue[T]) flush(batch []T) {
+	if len(batch) == 0 {
+		return
+	}
+
+	var err error
+	for attempt := 0; attempt <= q.opts.MaxRetries; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(time.Duration(attempt) * q.opts.RetryDelay)
+			select {
+			case <-timer.C:
+			case <-q.stop:
+				timer.Stop()
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), q.opts.Timeout)
+		err = q.write(ctx, batch)
+		cancel()
+		var permanent *permanentError
+		if err == nil || errors.As(err, &permanent) {
+			break
+		}
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if err != nil {
+		q.stats.Dropped += int64(len(batch))
+		q.stats.LastError = err.Error()
+		log.Printf("%s 写入 %d 条数据失败: %v", q.opts.Name, len(batch), err)
+		return
+	}
+	q.stats.Written += int64(len(batch))
+	q.stats.LastWrite = time.Now()
+	q.stats.LastError = ""
+}
@@ -0,0 +1,133 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录每次写入的数据，前failures次写入返回err
+type recorder struct {
+	mutex    sync.Mutex
+	batches  [][]int
+	attempts int
+	failures int
+	err      error
+}
+
+func (r *recorder) write(ctx context.Context, batch []int) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.attempts++
+	if r.attempts <= r.failures {
+		return r.err
+	}
+	r.batches = append(r.batches, append([]int(nil), batch...))
+	return nil
+}
+
+func testOptions() Options {
+	return Options{
+		Name:          "测试队列",
+		BufferSize:    100,
+		BatchSize:     3,
+		FlushInterval: time.Hour,
+		MaxRetries:    2,
+		RetryDelay:    time.Millisecond,
+		Timeout:       time.Second,
+	}
+}
+
+func stop(t *testing.T, q *Queue[int]) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !q.Stop(ctx) {
+		t.Fatal("停止队列超时")
+	}
+}
+
+func TestQueueBatchesAndDrains(t *testing.T) {
+	r := &recorder{}
+	q := New(testOptions(), r.write)
+	for i := 1; i <= 7; i++ {
+		q.Push(i)
+	}
+	stop(t, q)
+
+	total := 0
+	for _, b := range r.batches {
+		if len(b) > 3 {
+			t.Errorf("批次超过BatchSize: %v", b)
+		}
+		total += len(b)
+	}
+	if total != 7 {
+		t.Errorf("写入 %d 条，want 7: %v", total, r.batches)
+	}
+	if stats := q.Stats(); stats.Written != 7 || stats.Dropped != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestQueueRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		err      error
+		attempts int
+		written  int64
+		dropped  int64
+	}{
+		{"重试后成功", 2, errors.New("临时错误"), 3, 1, 0},
+		{"重试次数用完后丢弃", 10, errors.New("临时错误"), 3, 0, 1},
+		{"不可重试的错误直接丢弃", 10, Permanent(errors.New("请求被拒绝")), 1, 0, 1},
+	}
+	for _, tt := range tests {
+		r := &recorder{failures: tt.failures, err: tt.err}
+		q := New(testOptions(), r.write)
+		q.Push(1)
+		stop(t, q)
+
+		stats := q.Stats()
+		if r.attempts != tt.attempts || stats.Written != tt.written || stats.Dropped != tt.dropped {
+			t.Errorf("%s: attempts=%d stats=%+v, want attempts=%d written=%d dropped=%d",
+				tt.name, r.attempts, stats, tt.attempts, tt.written, tt.dropped)
+		}
+		if tt.dropped > 0 && stats.LastError == "" {
+			t.Errorf("%s: 未记录写入错误", tt.name)
+		}
+	}
+}
+
+func TestQueueDropsWhenFull(t *testing.T) {
+	block := make(chan struct{})
+	opts := testOptions()
+	opts.BufferSize = 2
+	opts.BatchSize = 1
+	q := New(opts, func(ctx context.Context, batch []int) error {
+		<-block
+		return nil
+	})
+
+	// 第一条被后台任务取出后阻塞在写入，队列再容纳两条
+	q.Push(1)
+	deadline := time.Now().Add(time.Second)
+	for q.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !q.Push(2) || !q.Push(3) {
+		t.Fatal("队列未满时拒绝了数据")
+	}
+	if q.Push(4) {
+		t.Fatal("队列已满时接受了数据")
+	}
+	close(block)
+	stop(t, q)
+
+	if stats := q.Stats(); stats.Written != 3 || stats.Dropped != 1 {
+		t.Errorf("stats = %+v, want written=3 dropped=1", stats)
+	}
+}
@@ -22,14 +22,64 @@ type Config struct {
 	// 节点配置
 	NodeTimeout    int    `json:"node_timeout"`     // 节点超时时间（秒）
 	NodeCheckInterval int  `json:"node_check_interval"` // 节点检查间隔（秒）
+	NodeKeyGracePeriod int `json:"node_key_grace_period"` // 密钥轮换后旧密钥的宽限期（小时）
+	MasterKeyPath      string `json:"master_key_path"`    // 加密节点签名密钥的主密钥文件，不存在时自动生成
 	
 	// 测速配置
 	SpeedtestTimeout int  `json:"speedtest_timeout"` // 测速超时时间（秒）
 	MaxConcurrentTests int `json:"max_concurrent_tests"` // 最大并发测试数
+	MaxTestsPerNode    int `json:"max_tests_per_node"`   // 每个节点（作为源或目标）同时参与的最大测试数
+	QueueAgingTime     int `json:"queue_aging_time"`     // 排队测试每等待该时间（秒）提升一级优先级
+
+	// 异常检测配置
+	AnomalyWindow      int     `json:"anomaly_window"`       // 基线使用的节点对最近测试次数
+	AnomalyMinSamples  int     `json:"anomaly_min_samples"`  // 基线的最少样本数，不足时不检测
+	AnomalyThreshold   float64 `json:"anomaly_threshold"`    // 偏离基线超过该倍数的标准差时标记为异常
+	AnomalySeasonHours int     `json:"anomaly_season_hours"` // 优先与一天中前后该小时数内的历史结果比较，12表示不区分时段
+
+	// 数据保留配置
+	ResultRetentionDays       int `json:"result_retention_days"`        // 原始测速结果的保留天数，0表示永久保留
+	HourlyRollupRetentionDays int `json:"hourly_rollup_retention_days"` // 小时汇总的保留天数，0表示永久保留，每日汇总永久保留
+	CompactInterval           int `json:"compact_interval"`             // 汇总和清理的执行间隔（分钟）
+
+	// 监控指标配置
+	MetricsToken        string            `json:"metrics_token"`         // 访问/metrics的Bearer令牌，为空时不需要认证
+	RemoteWriteURL      string            `json:"remote_write_url"`      // Prometheus远程写入地址，为空时不推送
+	RemoteWriteUsername string            `json:"remote_write_username"` // 远程写入的Basic认证用户名
+	RemoteWritePassword string            `json:"remote_write_password"` // 远程写入的Basic认证密码
+	RemoteWriteHeaders  map[string]string `json:"remote_write_headers"`  // 远程写入附加的请求头，如Authorization、X-Scope-OrgID
+
+	// 导出配置
+	Exporters []ExporterConfig `json:"exporters"` // 测速结果和节点心跳的导出目标
+
+	// 关闭配置
+	ShutdownTimeout int `json:"shutdown_timeout"` // 关闭时等待进行中请求完成的时间（秒）
 	
 	// GitHub配置
 	GithubRepo    string `json:"github_repo"`     // GitHub仓库地址
 	GithubVersion string `json:"github_version"`  // GitHub发布版本
+
+	// 节点更新配置
+	ReleaseDir      string `json:"release_dir"`       // 节点程序和发布清单所在目录
+	UpdatePublicKey string `json:"update_public_key"` // 发布清单的ed25519公钥（Base64）
+
+	// TLS配置
+	TLSEnabled       bool   `json:"tls_enabled"`        // 是否启用双向TLS
+	CertDir          string `json:"cert_dir"`           // CA证书和私钥目录
+	NodeCertValidity int    `json:"node_cert_validity"` // 节点证书有效期（天）
+}
+
+// ExporterConfig 导出目标配置
+type ExporterConfig struct {
+	Name          string          `json:"name"`           // 名称，用于日志和状态
+	Type          string          `json:"type"`           // influxdb、graphite或ndjson
+	Disabled      bool            `json:"disabled"`       // 暂停导出
+	Events        []string        `json:"events"`         // 导出的数据类型：result、heartbeat，为空时全部导出
+	BufferSize    int             `json:"buffer_size"`    // 队列容量，队列满时丢弃新的数据，默认10000
+	BatchSize     int             `json:"batch_size"`     // 每次写入的最大条数，默认500
+	FlushInterval int             `json:"flush_interval"` // 写入间隔（秒），默认5
+	MaxRetries    int             `json:"max_retries"`    // 写入失败后的重试次数，默认3
+	Config        json.RawMessage `json:"config"`         // 各导出类型的配置
 }
 
 var (
@@ -57,8 +107,22 @@ func GetConfig() *Config {
 			AdminPassword:     "admin", // 默认密码，应该在首次使用时要求更改
 			NodeTimeout:       60,
 			NodeCheckInterval: 30,
+			NodeKeyGracePeriod: 24,
+			MasterKeyPath:      "./master.key",
 			SpeedtestTimeout:  120,
 			MaxConcurrentTests: 3,
+			MaxTestsPerNode:   1,
+			QueueAgingTime:    300,
+			AnomalyWindow:     50,
+			AnomalyMinSamples: 10,
+			AnomalyThreshold:  3,
+			AnomalySeasonHours: 2,
+			HourlyRollupRetentionDays: 90,
+			CompactInterval:   10,
+			ShutdownTimeout:   30,
+			ReleaseDir:        "./bin",
+			CertDir:           "./data/tls",
+			NodeCertValidity:  90,
 		}
 		
 		// 尝试从文件加载配置
@@ -0,0 +1,307 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"../batch"
+	"../config"
+	"../models"
+	"../registry"
+)
+
+// 导出的数据类型
+const (
+	KindResult    = "result"    // 成功的测速结果
+	KindHeartbeat = "heartbeat" // 节点心跳
+)
+
+// 导出队列的默认参数
+const (
+	defaultBufferSize    = 10000
+	defaultBatchSize     = 500
+	defaultFlushInterval = 5 // 秒
+	defaultMaxRetries    = 3
+	retryDelay           = time.Second
+	writeTimeout         = 10 * time.Second
+)
+
+// Tag 标签，按固定顺序输出
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// Field 数值字段
+type Field struct {
+	Key   string
+	Value float64
+}
+
+// Event 一条导出的数据，各导出目标按自己的格式输出
+type Event struct {
+	Kind   string
+	Time   time.Time
+	Tags   []Tag
+	Fields []Field
+	Data   interface{} // 原始的测速结果或心跳
+}
+
+// Sink 导出目标的写入实现，同一目标的Write不会并发调用
+type Sink interface {
+	Write(ctx context.Context, events []Event) error
+	Close() error
+}
+
+// Factory 根据导出目标的配置创建写入实现，配置无效时返回错误
+type Factory = registry.Factory[Sink]
+
+var sinks = registry.New[Sink]("导出")
+
+// Register 注册导出类型，各导出类型在init中注册
+func Register(sinkType string, factory Factory) {
+	sinks.Register(sinkType, factory)
+}
+
+// Types 返回已注册的导出类型
+func Types() []string {
+	return sinks.Types()
+}
+
+// NewSink 根据导出类型和配置创建写入实现
+func NewSink(sinkType string, config json.RawMessage) (Sink, error) {
+	return sinks.Create(sinkType, config)
+}
+
+// Status 导出目标的运行状态
+type Status struct {
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Queued    int       `json:"queued"`     // 队列中等待写入的数据数
+	Written   int64     `json:"written"`    // 已写入的数据数
+	Dropped   int64     `json:"dropped"`    // 队列满或重试后仍失败而丢弃的数据数
+	LastWrite time.Time `json:"last_write"` // 最后一次写入成功的时间
+	LastError string    `json:"last_error"` // 最后一次写入失败的错误，写入成功后清空
+}
+
+// 一个导出目标的写入实现和队列
+type pipeline struct {
+	cfg   config.ExporterConfig
+	sink  Sink
+	queue *batch.Queue[Event]
+}
+
+var (
+	pipelines []*pipeline
+	started   bool
+	mutex     sync.RWMutex
+)
+
+// Start 按配置创建导出目标并启动后台写入任务，配置无效的目标记录日志后跳过
+func Start() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if started {
+		return
+	}
+	started = true
+	for _, cfg := range config.GetConfig().Exporters {
+		if cfg.Disabled {
+			continue
+		}
+		if err := normalize(&cfg); err != nil {
+			log.Printf("导出目标 %s 配置无效: %v", cfg.Name, err)
+			continue
+		}
+		sink, err := NewSink(cfg.Type, cfg.Config)
+		if err != nil {
+			log.Printf("导出目标 %s 配置无效: %v", cfg.Name, err)
+			continue
+		}
+
+		p := &pipeline{cfg: cfg, sink: sink}
+		p.queue = batch.New(batch.Options{
+			Name:          "导出目标 " + cfg.Name,
+			BufferSize:    cfg.BufferSize,
+			BatchSize:     cfg.BatchSize,
+			FlushInterval: time.Duration(cfg.FlushInterval) * time.Second,
+			MaxRetries:    cfg.MaxRetries,
+			RetryDelay:    retryDelay,
+			Timeout:       writeTimeout,
+		}, sink.Write)
+		// 写入任务结束后才关闭写入实现，等待超时时仍在写入的数据不受影响
+		go func() {
+			<-p.queue.Done()
+			sink.Close()
+		}()
+		pipelines = append(pipelines, p)
+		log.Printf("已启用导出目标 %s (%s)", cfg.Name, cfg.Type)
+	}
+}
+
+// Stop 停止所有导出目标，在ctx结束前尽量写入队列中剩余的数据
+func Stop(ctx context.Context) {
+	mutex.Lock()
+	if !started {
+		mutex.Unlock()
+		return
+	}
+	list := pipelines
+	pipelines, started = nil, false
+	mutex.Unlock()
+
+	for _, p := range list {
+		if !p.queue.Stop(ctx) {
+			log.Printf("等待导出目标 %s 写入完成超时，未写入的数据已丢弃", p.cfg.Name)
+		}
+	}
+}
+
+// 校验导出目标的名称、类型和数据类型，并填充默认值
+func normalize(cfg *config.ExporterConfig) error {
+	if cfg.Name == "" {
+		cfg.Name = cfg.Type
+	}
+	if !sinks.Has(cfg.Type) {
+		return fmt.Errorf("未知的导出类型: %s，应为%v", cfg.Type, Types())
+	}
+	for _, kind := range cfg.Events {
+		if kind != KindResult && kind != KindHeartbeat {
+			return fmt.Errorf("无效的数据类型: %s，应为result或heartbeat", kind)
+		}
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = defaultBufferSize
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	if cfg.MaxRetries < 0 {
+		return fmt.Errorf("重试次数不能为负数")
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = defaultMaxRetries
+	}
+	return nil
+}
+
+// Statuses 返回所有导出目标的运行状态
+func Statuses() []Status {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	statuses := make([]Status, 0, len(pipelines))
+	for _, p := range pipelines {
+		stats := p.queue.Stats()
+		statuses = append(statuses, Status{
+			Name:      p.cfg.Name,
+			Type:      p.cfg.Type,
+			Queued:    p.queue.Len(),
+			Written:   stats.Written,
+			Dropped:   stats.Dropped,
+			LastWrite: stats.LastWrite,
+			LastError: stats.LastError,
+		})
+	}
+	return statuses
+}
+
+// PublishResult 将成功的测速结果加入各导出目标的队列
+func PublishResult(result *models.SpeedTestResult) {
+	if result.Status != models.SpeedTestStatusCompleted || !enabled() {
+		return
+	}
+
+	// 复制一份，后台写入时结果可能已被修改
+	data := *result
+	source, target := models.NodeName(result.SourceNodeID), models.NodeName(result.TargetNodeID)
+	event := Event{
+		Kind: KindResult,
+		Time: result.StartTime,
+		Tags: []Tag{
+			{"source", source},
+			{"source_node_id", result.SourceNodeID},
+			{"target", target},
+			{"target_node_id", result.TargetNodeID},
+			{"type", string(result.Type)},
+		},
+		Fields: []Field{{"duration_ms", float64(result.Duration)}},
+		Data:   &data,
+	}
+	for _, metric := range models.Metrics {
+		if value, ok := result.Metric(metric); ok {
+			event.Fields = append(event.Fields, Field{metric, value})
+		}
+	}
+	publish(event)
+}
+
+// PublishHeartbeat 将节点心跳加入各导出目标的队列
+func PublishHeartbeat(node *models.Node, heartbeat *models.NodeHeartbeat) {
+	if !enabled() {
+		return
+	}
+
+	data := *heartbeat
+	publish(Event{
+		Kind: KindHeartbeat,
+		Time: heartbeat.Timestamp,
+		Tags: []Tag{
+			{"node", node.Name},
+			{"node_id", node.ID},
+			{"status", string(heartbeat.NodeStatus())},
+			{"version", heartbeat.Version},
+		},
+		Fields: []Field{
+			{"cpu", heartbeat.CPU},
+			{"memory", heartbeat.Memory},
+			{"disk", heartbeat.Disk},
+			{"load1", heartbeat.Load[0]},
+			{"load5", heartbeat.Load[1]},
+			{"load15", heartbeat.Load[2]},
+			{"uptime", float64(heartbeat.Uptime)},
+			{"network_rx", float64(heartbeat.NetworkRx)},
+			{"network_tx", float64(heartbeat.NetworkTx)},
+			{"clock_skew", heartbeat.ClockSkew},
+		},
+		Data: &data,
+	})
+}
+
+func enabled() bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return len(pipelines) > 0
+}
+
+// 加入订阅该数据类型的导出目标的队列，队列满时丢弃
+func publish(event Event) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	for _, p := range pipelines {
+		if p.accepts(event.Kind) {
+			p.queue.Push(event)
+		}
+	}
+}
+
+func (p *pipeline) accepts(kind string) bool {
+	if len(p.cfg.Events) == 0 {
+		return true
+	}
+	for _, k := range p.cfg.Events {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
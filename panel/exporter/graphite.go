@@ -0,0 +1,127 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+)
+
+// Graphite纯文本协议配置
+type graphiteConfig struct {
+	Address  string `json:"address"`  // host:port，通常为2003端口
+	Protocol string `json:"protocol"` // tcp（默认）或udp
+	Prefix   string `json:"prefix"`   // 指标路径前缀，默认speedtest
+}
+
+type graphiteSink struct {
+	config graphiteConfig
+	conn   net.Conn
+}
+
+func init() {
+	Register("graphite", newGraphiteSink)
+}
+
+func newGraphiteSink(raw json.RawMessage) (Sink, error) {
+	var cfg graphiteConfig
+	if err := sinks.DecodeConfig(raw, &cfg); err != nil {
+		return nil, err
+	}
+	if _, _, err := net.SplitHostPort(cfg.Address); err != nil {
+		return nil, fmt.Errorf("address必须是host:port格式")
+	}
+	if cfg.Protocol == "" {
+		cfg.Protocol = "tcp"
+	}
+	if cfg.Protocol != "tcp" && cfg.Protocol != "udp" {
+		return nil, fmt.Errorf("无效的协议: %s，应为tcp或udp", cfg.Protocol)
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "speedtest"
+	}
+	return &graphiteSink{config: cfg}, nil
+}
+
+// 每个字段输出一行：<前缀>.result.<源节点>.<目标节点>.<字段> 或 <前缀>.heartbeat.<节点>.<字段>
+func (s *graphiteSink) Write(ctx context.Context, events []Event) error {
+	var lines [][]byte
+	for i := range events {
+		path := s.config.Prefix + "." + events[i].Kind
+		for _, tag := range events[i].Tags {
+			if tag.Key == "source" || tag.Key == "target" || tag.Key == "node" {
+				path += "." + graphitePath(tag.Value)
+			}
+		}
+		timestamp := strconv.FormatInt(events[i].Time.Unix(), 10)
+		for _, field := range events[i].Fields {
+			value := strconv.FormatFloat(field.Value, 'f', -1, 64)
+			lines = append(lines, []byte(path+"."+field.Key+" "+value+" "+timestamp+"\n"))
+		}
+	}
+
+	if s.conn == nil {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, s.config.Protocol, s.config.Address)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetWriteDeadline(deadline)
+	}
+
+	// UDP每个数据包不超过常见的MTU，TCP一次写入
+	var err error
+	if s.config.Protocol == "udp" {
+		err = writePackets(s.conn, lines, 1400)
+	} else {
+		_, err = s.conn.Write(bytes.Join(lines, nil))
+	}
+	if err != nil {
+		// 连接出错后关闭，重试时重新连接
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+func (s *graphiteSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// 按大小分包发送，单行不拆分
+func writePackets(conn net.Conn, lines [][]byte, size int) error {
+	var packet []byte
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+len(line) > size {
+			if _, err := conn.Write(packet); err != nil {
+				return err
+			}
+			packet = nil
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) == 0 {
+		return nil
+	}
+	_, err := conn.Write(packet)
+	return err
+}
+
+var graphiteUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// 指标路径的一段，点、空格等字符替换为下划线
+func graphitePath(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return graphiteUnsafe.ReplaceAllString(value, "_")
+}
@@ -0,0 +1,124 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// InfluxDB写入配置，url为写入接口地址：
+// 1.x为 http://host:8086/write?db=speedtest，2.x为 http://host:8086/api/v2/write?org=ops&bucket=speedtest
+type influxConfig struct {
+	URL               string            `json:"url"`
+	Token             string            `json:"token"`              // 2.x的API令牌
+	Username          string            `json:"username"`           // 1.x的用户名
+	Password          string            `json:"password"`           // 1.x的密码
+	MeasurementPrefix string            `json:"measurement_prefix"` // 表名前缀，表名为<前缀>result和<前缀>heartbeat
+	Tags              map[string]string `json:"tags"`               // 每条数据附加的标签
+}
+
+type influxSink struct {
+	config influxConfig
+	url    string
+	client *http.Client
+}
+
+func init() {
+	Register("influxdb", newInfluxSink)
+}
+
+func newInfluxSink(raw json.RawMessage) (Sink, error) {
+	var cfg influxConfig
+	if err := sinks.DecodeConfig(raw, &cfg); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("url必须是http或https地址")
+	}
+	if cfg.MeasurementPrefix == "" {
+		cfg.MeasurementPrefix = "speedtest_"
+	}
+
+	// 统一使用毫秒精度，1.x和2.x都支持ms
+	query := u.Query()
+	query.Set("precision", "ms")
+	u.RawQuery = query.Encode()
+	return &influxSink{config: cfg, url: u.String(), client: &http.Client{}}, nil
+}
+
+func (s *influxSink) Write(ctx context.Context, events []Event) error {
+	var body bytes.Buffer
+	for i := range events {
+		s.writeLine(&body, &events[i])
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, &body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.config.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.config.Token)
+	} else if s.config.Username != "" {
+		req.SetBasicAuth(s.config.Username, s.config.Password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+func (s *influxSink) Close() error {
+	return nil
+}
+
+// 按行协议输出一条数据：<表名>,<标签> <字段> <毫秒时间戳>，空的标签值省略
+func (s *influxSink) writeLine(w *bytes.Buffer, event *Event) {
+	w.WriteString(influxMeasurement.Replace(s.config.MeasurementPrefix + event.Kind))
+
+	tags := append([]Tag(nil), event.Tags...)
+	for key, value := range s.config.Tags {
+		tags = append(tags, Tag{key, value})
+	}
+	// InfluxDB建议标签按键排序，写入时效率更高
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].Key < tags[j].Key })
+	for _, tag := range tags {
+		if tag.Value == "" {
+			continue
+		}
+		w.WriteString("," + influxTag.Replace(tag.Key) + "=" + influxTag.Replace(tag.Value))
+	}
+
+	for i, field := range event.Fields {
+		if i == 0 {
+			w.WriteByte(' ')
+		} else {
+			w.WriteByte(',')
+		}
+		w.WriteString(influxTag.Replace(field.Key) + "=" + strconv.FormatFloat(field.Value, 'f', -1, 64))
+	}
+	w.WriteString(" " + strconv.FormatInt(event.Time.UnixNano()/1e6, 10) + "\n")
+}
+
+// 行协议的转义规则：表名转义逗号和空格，标签键、标签值和字段名还需转义等号
+var (
+	influxMeasurement = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	influxTag         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+)
@@ -0,0 +1,152 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// NDJSON配置，path和address二选一
+type ndjsonConfig struct {
+	Path    string `json:"path"`    // 追加写入的文件
+	Network string `json:"network"` // tcp（默认）、udp或unix
+	Address string `json:"address"` // 套接字地址，unix时为套接字文件路径
+}
+
+// 一行NDJSON
+type ndjsonLine struct {
+	Kind   string             `json:"kind"`
+	Time   time.Time          `json:"time"`
+	Tags   map[string]string  `json:"tags"`
+	Fields map[string]float64 `json:"fields"`
+	Data   interface{}        `json:"data"`
+}
+
+type ndjsonSink struct {
+	config ndjsonConfig
+	file   *os.File
+	conn   net.Conn
+}
+
+func init() {
+	Register("ndjson", newNDJSONSink)
+}
+
+func newNDJSONSink(raw json.RawMessage) (Sink, error) {
+	var cfg ndjsonConfig
+	if err := sinks.DecodeConfig(raw, &cfg); err != nil {
+		return nil, err
+	}
+	if (cfg.Path == "") == (cfg.Address == "") {
+		return nil, fmt.Errorf("path和address必须且只能设置一个")
+	}
+	if cfg.Address != "" {
+		if cfg.Network == "" {
+			cfg.Network = "tcp"
+		}
+		if cfg.Network != "tcp" && cfg.Network != "udp" && cfg.Network != "unix" {
+			return nil, fmt.Errorf("无效的网络类型: %s，应为tcp、udp或unix", cfg.Network)
+		}
+	}
+	return &ndjsonSink{config: cfg}, nil
+}
+
+func (s *ndjsonSink) Write(ctx context.Context, events []Event) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for i := range events {
+		line := ndjsonLine{
+			Kind:   events[i].Kind,
+			Time:   events[i].Time,
+			Tags:   make(map[string]string),
+			Fields: make(map[string]float64),
+			Data:   events[i].Data,
+		}
+		for _, tag := range events[i].Tags {
+			line.Tags[tag.Key] = tag.Value
+		}
+		for _, field := range events[i].Fields {
+			line.Fields[field.Key] = field.Value
+		}
+		if err := encoder.Encode(&line); err != nil {
+			return err
+		}
+	}
+
+	if s.config.Path != "" {
+		return s.writeFile(body.Bytes())
+	}
+	return s.writeSocket(ctx, body.Bytes())
+}
+
+// 追加写入文件，文件被移走（如日志轮转）后在原路径重新创建
+func (s *ndjsonSink) writeFile(data []byte) error {
+	if s.file != nil {
+		if _, err := os.Stat(s.config.Path); err != nil {
+			s.file.Close()
+			s.file = nil
+		}
+	}
+	if s.file == nil {
+		if err := os.MkdirAll(filepath.Dir(s.config.Path), 0755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(s.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		s.file = file
+	}
+	_, err := s.file.Write(data)
+	return err
+}
+
+// 写入套接字，连接出错后关闭，重试时重新连接
+func (s *ndjsonSink) writeSocket(ctx context.Context, data []byte) error {
+	if s.conn == nil {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, s.config.Network, s.config.Address)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetWriteDeadline(deadline)
+	}
+
+	var err error
+	if s.config.Network == "udp" {
+		// UDP每行一个数据包
+		for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+			if len(line) == 0 {
+				continue
+			}
+			if _, err = s.conn.Write(line); err != nil {
+				break
+			}
+		}
+	} else {
+		_, err = s.conn.Write(data)
+	}
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+func (s *ndjsonSink) Close() error {
+	if s.file != nil {
+		return s.file.Close()
+	}
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
@@ -1,47 +1,30 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
+
+	"./api"
+	"./auth"
+	"./config"
+	"./exporter"
+	"./metrics"
+	"./models"
+	"./monitor"
+	"./notify"
+	"./rollup"
+	"./scheduler"
 )
 
-// 配置结构体
-type Config struct {
-	ListenPort        string `json:"listen_port"`
-	DatabasePath      string `json:"database_path"`
-	LogPath           string `json:"log_path"`
-	SecretKey         string `json:"secret_key"`
-	AdminUsername     string `json:"admin_username"`
-	AdminPassword     string `json:"admin_password"`
-	PanelURL          string `json:"panel_url"`
-	NodeTimeout       int    `json:"node_timeout"`
-	NodeCheckInterval int    `json:"node_check_interval"`
-	SpeedtestTimeout  int    `json:"speedtest_timeout"`
-	MaxConcurrentTests int   `json:"max_concurrent_tests"`
-	GithubRepo        string `json:"github_repo"`
-	GithubVersion     string `json:"github_version"`
-}
-
-// 全局配置变量
-var config Config
-
-// 加载配置文件
-func loadConfig(configPath string) error {
-	file, err := os.Open(configPath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	decoder := json.NewDecoder(file)
-	return decoder.Decode(&config)
-}
-
 // 初始化日志
 func initLogger(logPath string) (*os.File, error) {
 	// 确保日志目录存在
@@ -73,13 +56,11 @@ func main() {
 	flag.Parse()
 
 	// 加载配置
-	if err := loadConfig(*configPath); err != nil {
-		fmt.Printf("加载配置失败: %v\n", err)
-		os.Exit(1)
-	}
+	config.SetConfigPath(*configPath)
+	cfg := config.GetConfig()
 
 	// 初始化日志
-	logFile, err := initLogger(config.LogPath)
+	logFile, err := initLogger(cfg.LogPath)
 	if err != nil {
 		fmt.Printf("初始化日志失败: %v\n", err)
 		os.Exit(1)
@@ -87,27 +68,96 @@ func main() {
 	defer logFile.Close()
 
 	log.Println("面板服务启动")
-	log.Printf("配置加载成功，监听端口: %s", config.ListenPort)
+	log.Printf("配置加载成功，监听端口: %s", cfg.ListenPort)
 
-	// 设置HTTP路由
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintf(w, "节点管理测速系统 - 面板服务正在运行")
-	})
+	// 初始化认证和数据库
+	auth.InitJWTSecret(cfg.SecretKey)
+	if err := auth.InitMasterKey(cfg.MasterKeyPath); err != nil {
+		log.Fatalf("初始化主密钥失败: %v", err)
+	}
+	if err := models.InitDB(cfg.DatabasePath); err != nil {
+		log.Fatalf("初始化数据库失败: %v", err)
+	}
 
-	http.HandleFunc("/api/status", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status": "running",
-			"version": "v1.0.0",
-		})
-	})
+	// 启动节点存活检查、定时测速任务、测速结果汇总、远程写入和数据导出
+	monitor.StartLivenessChecker()
+	scheduler.Start()
+	rollup.Start()
+	metrics.StartRemoteWrite()
+	exporter.Start()
+
+	serverAddr := ":" + cfg.ListenPort
+	server := &http.Server{
+		Addr:    serverAddr,
+		Handler: api.SetupRouter(),
+	}
+
+	// 启用TLS时由内置CA签发面板证书，并校验节点出示的证书
+	scheme := "http"
+	if cfg.TLSEnabled {
+		if err := auth.InitCA(cfg.CertDir, panelHosts(cfg.PanelURL)); err != nil {
+			log.Fatalf("初始化CA失败: %v", err)
+		}
+		server.TLSConfig = auth.GetCA().ServerTLSConfig(models.IsCertificateRevoked)
+		scheme = "https"
+	}
 
 	// 启动HTTP服务器
-	serverAddr := ":" + config.ListenPort
-	fmt.Printf("面板服务启动，监听地址: http://localhost%s\n", serverAddr)
-	log.Printf("面板服务启动，监听地址: http://localhost%s", serverAddr)
-	
-	if err := http.ListenAndServe(serverAddr, nil); err != nil {
-		log.Fatalf("服务器启动失败: %v", err)
+	fmt.Printf("面板服务启动，监听地址: %s://localhost%s\n", scheme, serverAddr)
+	log.Printf("面板服务启动，监听地址: %s://localhost%s", scheme, serverAddr)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		var err error
+		if cfg.TLSEnabled {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		serverErr <- err
+	}()
+
+	// 收到SIGINT或SIGTERM时停止接受新连接，等待进行中的请求完成后关闭数据库
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serverErr:
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("服务器启动失败: %v", err)
+		}
+	case sig := <-sigCh:
+		log.Printf("收到%v信号，开始关闭面板服务", sig)
+		fmt.Println("正在关闭面板服务...")
+		shutdown(server, time.Duration(cfg.ShutdownTimeout)*time.Second)
+	}
+}
+
+// 优雅关闭HTTP服务并关闭数据库
+func shutdown(server *http.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("等待请求完成超时，强制关闭: %v", err)
+		server.Close()
+	}
+
+	scheduler.Stop()
+	monitor.StopLivenessChecker()
+	rollup.Stop()
+	notify.Wait(ctx)
+	metrics.StopRemoteWrite(ctx)
+	exporter.Stop(ctx)
+	if err := models.CloseDB(); err != nil {
+		log.Printf("关闭数据库失败: %v", err)
+	}
+	log.Println("面板服务已关闭")
+}
+
+// 面板证书包含的主机名
+func panelHosts(panelURL string) []string {
+	hosts := []string{"localhost", "127.0.0.1"}
+	if u, err := url.Parse(panelURL); err == nil && u.Hostname() != "" {
+		hosts = append(hosts, u.Hostname())
 	}
-} 
\ No newline at end of file
+	return hosts
+}
\ No newline at end of file
@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"io"
+	"time"
+
+	"../../common/promtext"
+	"../models"
+)
+
+// 指标类型
+const (
+	typeGauge = "gauge"
+)
+
+// Label 标签
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample 一个标签组合的取值
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// Family 一组同名指标
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// 每个指标对应的Prometheus指标名，/metrics和远程写入使用相同的名称
+var metricNames = map[string]string{
+	models.MetricDownloadSpeed: "panel_speedtest_download_mbps",
+	models.MetricUploadSpeed:   "panel_speedtest_upload_mbps",
+	models.MetricPing:          "panel_speedtest_ping_ms",
+	models.MetricJitter:        "panel_speedtest_jitter_ms",
+	models.MetricPacketLoss:    "panel_speedtest_packet_loss_percent",
+}
+
+var metricHelp = map[string]string{
+	models.MetricDownloadSpeed: "节点对最近一次测速的下载速度（Mbps）",
+	models.MetricUploadSpeed:   "节点对最近一次测速的上传速度（Mbps）",
+	models.MetricPing:          "节点对最近一次测速的Ping延迟（毫秒）",
+	models.MetricJitter:        "节点对最近一次测速的抖动（毫秒）",
+	models.MetricPacketLoss:    "节点对最近一次测速的丢包率（百分比）",
+}
+
+// Collect 从数据库采集面板指标：每个节点对各指标最近一次的测速结果、节点在线状态和心跳间隔、按类型和状态统计的测试数量
+func Collect() ([]Family, error) {
+	nodes, err := models.GetAllNodes()
+	if err != nil {
+		return nil, err
+	}
+	latest, err := models.GetLatestSpeedTestResults()
+	if err != nil {
+		return nil, err
+	}
+	counts, err := models.CountSpeedTestResultsByStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string)
+	for _, node := range nodes {
+		names[node.ID] = node.Name
+	}
+	now := time.Now()
+
+	var families []Family
+	// 结果按开始时间排序，同一节点对同一指标取最后一条，即不同测试类型中最新的一次
+	for _, metric := range models.Metrics {
+		values := make(map[[2]string]float64)
+		for i := range latest {
+			if value, ok := latest[i].Metric(metric); ok {
+				values[[2]string{latest[i].SourceNodeID, latest[i].TargetNodeID}] = value
+			}
+		}
+		family := Family{Name: metricNames[metric], Help: metricHelp[metric], Type: typeGauge}
+		for pair, value := range values {
+			family.Samples = append(family.Samples, Sample{Labels: pairLabels(pair[0], pair[1], names), Value: value})
+		}
+		families = append(families, family)
+	}
+
+	lastResult := make(map[[2]string]time.Time)
+	for i := range latest {
+		lastResult[[2]string{latest[i].SourceNodeID, latest[i].TargetNodeID}] = resultTime(&latest[i])
+	}
+	family := Family{Name: "panel_speedtest_last_result_timestamp_seconds", Help: "节点对最近一次成功测速的完成时间（Unix时间戳）", Type: typeGauge}
+	for pair, t := range lastResult {
+		family.Samples = append(family.Samples, Sample{Labels: pairLabels(pair[0], pair[1], names), Value: float64(t.Unix())})
+	}
+	families = append(families, family)
+
+	up := Family{Name: "panel_node_up", Help: "节点是否在线，1为在线", Type: typeGauge}
+	age := Family{Name: "panel_node_heartbeat_age_seconds", Help: "距节点最后一次心跳的时间（秒）", Type: typeGauge}
+	for _, node := range nodes {
+		labels := []Label{{"node", node.Name}, {"node_id", node.ID}}
+		value := 0.0
+		if node.Status == models.NodeStatusOnline {
+			value = 1
+		}
+		up.Samples = append(up.Samples, Sample{Labels: labels, Value: value})
+		if !node.LastSeen.IsZero() {
+			age.Samples = append(age.Samples, Sample{Labels: labels, Value: now.Sub(node.LastSeen).Seconds()})
+		}
+	}
+	families = append(families, up, age)
+
+	tests := Family{Name: "panel_speedtest_tests", Help: "按类型和状态统计当前保存的测试数量，清理过期结果后会减少", Type: typeGauge}
+	for _, count := range counts {
+		labels := []Label{{"status", string(count.Status)}, {"type", string(count.Type)}}
+		tests.Samples = append(tests.Samples, Sample{Labels: labels, Value: float64(count.Count)})
+	}
+	families = append(families, tests)
+
+	return families, nil
+}
+
+// 节点对的标签，节点已删除时名称为空
+func pairLabels(source, target string, names map[string]string) []Label {
+	return []Label{
+		{"source", names[source]},
+		{"source_node_id", source},
+		{"target", names[target]},
+		{"target_node_id", target},
+	}
+}
+
+// 测试的完成时间，没有结束时间时使用开始时间
+func resultTime(result *models.SpeedTestResult) time.Time {
+	if result.EndTime.IsZero() {
+		return result.StartTime
+	}
+	return result.EndTime
+}
+
+// Write 按Prometheus文本格式输出指标
+func Write(w io.Writer, families []Family) {
+	for _, f := range families {
+		lines := make([]string, 0, len(f.Samples))
+		for _, s := range f.Samples {
+			lines = append(lines, f.Name+formatLabels(s.Labels)+" "+promtext.FormatValue(s.Value))
+		}
+		promtext.WriteFamily(w, f.Name, f.Help, f.Type, lines)
+	}
+}
+
+// 格式化标签
+func formatLabels(labels []Label) string {
+	names := make([]string, len(labels))
+	values := make([]string, len(labels))
+	for i, label := range labels {
+		names[i], values[i] = label.Name, label.Value
+	}
+	return promtext.FormatLabels(names, values)
+}
@@ -0,0 +1,275 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"../batch"
+	"../config"
+	"../models"
+)
+
+const (
+	// 待发送队列的容量（时间序列数），队列满时丢弃新的数据
+	queueSize = 10000
+	// 每次请求最多发送的时间序列数
+	batchSize = 500
+	// 队列中的数据最多等待该时间后发送
+	flushInterval = 5 * time.Second
+	// 每批数据失败后的重试次数、重试间隔和单次请求超时
+	sendRetries = 2
+	retryDelay  = time.Second
+	sendTimeout = 10 * time.Second
+)
+
+// 一个时间序列的样本
+type point struct {
+	value     float64
+	timestamp int64 // 毫秒
+}
+
+// 远程写入的时间序列
+type timeSeries struct {
+	labels  []Label
+	samples []point
+}
+
+// 远程写入请求失败，不可重试的错误（如4xx）不再重发
+type sendError struct {
+	status int
+	body   string
+}
+
+func (e *sendError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.status, e.body)
+}
+
+func (e *sendError) retryable() bool {
+	return e.status == http.StatusTooManyRequests || e.status >= 500
+}
+
+var (
+	queue *batch.Queue[timeSeries]
+	mutex sync.Mutex
+
+	httpClient = &http.Client{}
+)
+
+// StartRemoteWrite 配置了远程写入地址时启动后台发送任务，新的测速结果按Prometheus远程写入协议推送
+func StartRemoteWrite() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	cfg := config.GetConfig()
+	if queue != nil || cfg.RemoteWriteURL == "" {
+		return
+	}
+	queue = batch.New(batch.Options{
+		Name:          "远程写入",
+		BufferSize:    queueSize,
+		BatchSize:     batchSize,
+		FlushInterval: flushInterval,
+		MaxRetries:    sendRetries,
+		RetryDelay:    retryDelay,
+		Timeout:       sendTimeout,
+	}, flush)
+	log.Printf("已启用远程写入: %s", cfg.RemoteWriteURL)
+}
+
+// StopRemoteWrite 停止后台发送任务，在ctx结束前尽量发送队列中剩余的数据
+func StopRemoteWrite(ctx context.Context) {
+	mutex.Lock()
+	if queue == nil {
+		mutex.Unlock()
+		return
+	}
+	q := queue
+	queue = nil
+	mutex.Unlock()
+
+	if !q.Stop(ctx) {
+		log.Printf("等待远程写入完成超时，未发送的数据已丢弃")
+	}
+}
+
+// Push 将成功的测速结果加入远程写入队列，未启用远程写入时忽略
+func Push(result *models.SpeedTestResult) {
+	if result.Status != models.SpeedTestStatusCompleted {
+		return
+	}
+
+	if config.GetConfig().RemoteWriteURL == "" {
+		return
+	}
+
+	names := make(map[string]string)
+	for _, id := range []string{result.SourceNodeID, result.TargetNodeID} {
+		if node, err := models.GetNode(id); err == nil {
+			names[id] = node.Name
+		}
+	}
+	labels := pairLabels(result.SourceNodeID, result.TargetNodeID, names)
+	timestamp := resultTime(result)
+	sample := func(name string, value float64) timeSeries {
+		return timeSeries{
+			labels:  append([]Label{{"__name__", name}}, labels...),
+			samples: []point{{value, timestamp.UnixNano() / int64(time.Millisecond)}},
+		}
+	}
+
+	series := []timeSeries{sample("panel_speedtest_last_result_timestamp_seconds", float64(timestamp.Unix()))}
+	for _, metric := range models.Metrics {
+		if value, ok := result.Metric(metric); ok {
+			series = append(series, sample(metricNames[metric], value))
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if queue == nil {
+		return
+	}
+	for _, s := range series {
+		if !queue.Push(s) {
+			return
+		}
+	}
+}
+
+// 发送一批数据，网络错误、429和5xx时由队列重试
+func flush(ctx context.Context, series []timeSeries) error {
+	err := send(ctx, encodeSnappy(encodeWriteRequest(merge(series))))
+	if e, ok := err.(*sendError); ok && !e.retryable() {
+		return batch.Permanent(err)
+	}
+	return err
+}
+
+// 发送一次远程写入请求
+func send(ctx context.Context, body []byte) error {
+	cfg := config.GetConfig()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.RemoteWriteURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "node-speedtest-panel")
+	if cfg.RemoteWriteUsername != "" {
+		req.SetBasicAuth(cfg.RemoteWriteUsername, cfg.RemoteWritePassword)
+	}
+	for key, value := range cfg.RemoteWriteHeaders {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return &sendError{status: resp.StatusCode, body: string(data)}
+	}
+	return nil
+}
+
+// 合并标签相同的时间序列，样本按时间排序，接收端拒绝同一序列中时间倒退的样本
+func merge(series []timeSeries) []timeSeries {
+	index := make(map[string]int)
+	var merged []timeSeries
+	for _, s := range series {
+		sort.Slice(s.labels, func(i, j int) bool { return s.labels[i].Name < s.labels[j].Name })
+		key := formatLabels(s.labels)
+		if i, ok := index[key]; ok {
+			merged[i].samples = append(merged[i].samples, s.samples...)
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, s)
+	}
+	for i := range merged {
+		samples := merged[i].samples
+		sort.SliceStable(samples, func(a, b int) bool { return samples[a].timestamp < samples[b].timestamp })
+	}
+	return merged
+}
+
+// 按protobuf编码WriteRequest：
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []timeSeries) []byte {
+	var request []byte
+	for _, s := range series {
+		var ts []byte
+		for _, label := range s.labels {
+			var l []byte
+			l = appendBytes(l, 1, []byte(label.Name))
+			l = appendBytes(l, 2, []byte(label.Value))
+			ts = appendBytes(ts, 1, l)
+		}
+		for _, p := range s.samples {
+			var sample []byte
+			sample = appendVarint(sample, 1<<3|1)
+			sample = binary.LittleEndian.AppendUint64(sample, math.Float64bits(p.value))
+			sample = appendVarint(sample, 2<<3|0)
+			sample = appendVarint(sample, uint64(p.timestamp))
+			ts = appendBytes(ts, 2, sample)
+		}
+		request = appendBytes(request, 1, ts)
+	}
+	return request
+}
+
+// 追加长度前缀的字段
+func appendBytes(b []byte, field uint64, data []byte) []byte {
+	b = appendVarint(b, field<<3|2)
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// 按snappy块格式编码。只使用字面量，不做压缩：请求体本身不大，
+// 接收端要求snappy格式但不要求压缩率，这样不需要引入依赖
+func encodeSnappy(src []byte) []byte {
+	dst := appendVarint(nil, uint64(len(src)))
+	for len(src) > 0 {
+		n := len(src)
+		if n > 65536 {
+			n = 65536
+		}
+		switch length := n - 1; {
+		case length < 60:
+			dst = append(dst, byte(length)<<2)
+		case length < 1<<8:
+			dst = append(dst, 60<<2, byte(length))
+		default:
+			dst = append(dst, 61<<2, byte(length), byte(length>>8))
+		}
+		dst = append(dst, src[:n]...)
+		src = src[n:]
+	}
+	return dst
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// 解码只包含字面量的snappy块
+func decodeSnappy(t *testing.T, src []byte) []byte {
+	t.Helper()
+	length, n := binary.Uvarint(src)
+	if n <= 0 {
+		t.Fatalf("无效的长度前缀")
+	}
+	src = src[n:]
+
+	var dst []byte
+	for len(src) > 0 {
+		tag := src[0]
+		if tag&3 != 0 {
+			t.Fatalf("不是字面量: %#x", tag)
+		}
+		var size int
+		switch tag >> 2 {
+		case 60:
+			size, src = int(src[1])+1, src[2:]
+		case 61:
+			size, src = int(src[1])|int(src[2])<<8+1, src[3:]
+		default:
+			size, src = int(tag>>2)+1, src[1:]
+		}
+		dst = append(dst, src[:size]...)
+		src = src[size:]
+	}
+	if uint64(len(dst)) != length {
+		t.Fatalf("解码长度 %d，前缀为 %d", len(dst), length)
+	}
+	return dst
+}
+
+func TestEncodeSnappy(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		header []byte
+	}{
+		{"空", 0, []byte{0}},
+		{"短字面量", 3, []byte{3, 2 << 2}},
+		{"一字节长度", 100, []byte{100, 60 << 2, 99}},
+		{"两字节长度", 1000, []byte{0xe8, 0x07, 61 << 2, 0xe7, 0x03}},
+		{"超过64KB分块", 70000, []byte{0xf0, 0xa2, 0x04, 61 << 2, 0xff, 0xff}},
+	}
+	for _, tt := range tests {
+		src := make([]byte, tt.size)
+		for i := range src {
+			src[i] = byte(i * 7)
+		}
+		encoded := encodeSnappy(src)
+		if !bytes.HasPrefix(encoded, tt.header) {
+			t.Errorf("%s: 前缀 %x, want %x", tt.name, encoded[:len(tt.header)], tt.header)
+		}
+		if got := decodeSnappy(t, encoded); !bytes.Equal(got, src) {
+			t.Errorf("%s: 解码结果与输入不同", tt.name)
+		}
+	}
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		series []timeSeries
+		want   []byte
+	}{
+		{"空", nil, nil},
+		{
+			"一个标签一个样本",
+			[]timeSeries{{labels: []Label{{"a", "b"}}, samples: []point{{1, 2}}}},
+			[]byte{
+				0x0a, 0x15, // timeseries
+				0x0a, 0x06, 0x0a, 0x01, 'a', 0x12, 0x01, 'b', // label
+				0x12, 0x0b, 0x09, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, 0x10, 0x02, // sample
+			},
+		},
+		{
+			"大时间戳使用多字节varint",
+			[]timeSeries{{samples: []point{{0, 300}}}},
+			[]byte{0x0a, 0x0e, 0x12, 0x0c, 0x09, 0, 0, 0, 0, 0, 0, 0, 0, 0x10, 0xac, 0x02},
+		},
+	}
+	for _, tt := range tests {
+		if got := encodeWriteRequest(tt.series); !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: encodeWriteRequest = %x, want %x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	batch := []timeSeries{
+		{labels: []Label{{"__name__", "m"}, {"a", "1"}}, samples: []point{{1, 20}}},
+		{labels: []Label{{"a", "1"}, {"__name__", "m"}}, samples: []point{{2, 10}}},
+		{labels: []Label{{"__name__", "m"}, {"a", "2"}}, samples: []point{{3, 30}}},
+	}
+	merged := merge(batch)
+	if len(merged) != 2 {
+		t.Fatalf("合并后 %d 个时间序列，want 2", len(merged))
+	}
+	if want := []point{{2, 10}, {1, 20}}; !reflect.DeepEqual(merged[0].samples, want) {
+		t.Errorf("样本未按时间排序: %v", merged[0].samples)
+	}
+	if merged[1].labels[1].Value != "2" {
+		t.Errorf("第二个时间序列: %v", merged[1].labels)
+	}
+}
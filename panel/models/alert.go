@@ -0,0 +1,469 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// AlertState 表示告警状态
+type AlertState string
+
+const (
+	AlertStateFiring   AlertState = "firing"   // 触发中
+	AlertStateResolved AlertState = "resolved" // 已恢复
+)
+
+// 告警严重程度，从低到高
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// SeverityLevel 返回严重程度的级别，数值越大越严重，未知的严重程度返回-1
+func SeverityLevel(severity string) int {
+	switch severity {
+	case SeverityInfo:
+		return 0
+	case SeverityWarning:
+		return 1
+	case SeverityCritical:
+		return 2
+	}
+	return -1
+}
+
+// AlertRule 告警规则：对节点对最近若干次测试的指标做聚合，连续多次超过阈值时触发告警
+type AlertRule struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Enabled     bool    `json:"enabled"`
+	Metric      string  `json:"metric"`      // 指标：download_speed、upload_speed、ping、jitter、packet_loss
+	Aggregation string  `json:"aggregation"` // 聚合方式：last、avg、min、max、p95
+	Window      int     `json:"window"`      // 参与聚合的最近测试次数，last时忽略
+	Operator    string  `json:"operator"`    // 比较运算符：<、<=、>、>=
+	Threshold   float64 `json:"threshold"`
+	Consecutive int     `json:"consecutive"` // 连续超过阈值多少次后触发
+	Severity    string  `json:"severity"`    // 严重程度：info、warning、critical
+
+	// 适用范围，都为空时适用于所有节点对
+	SourceNodeID string `json:"source_node_id"`
+	TargetNodeID string `json:"target_node_id"`
+	Tag          string `json:"tag"` // 源节点或目标节点带有该标签
+
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Alert 一次告警，从触发到恢复为一条记录，同一规则和节点对同时只有一条触发中的告警
+type Alert struct {
+	ID              string     `json:"id"`
+	RuleID          string     `json:"rule_id"`
+	RuleName        string     `json:"rule_name"`
+	Severity        string     `json:"severity"`
+	SourceNodeID    string     `json:"source_node_id"`
+	TargetNodeID    string     `json:"target_node_id"`
+	State           AlertState `json:"state"`
+	Value           float64    `json:"value"`      // 触发时的指标值
+	LastValue       float64    `json:"last_value"` // 最近一次评估的指标值
+	Threshold       float64    `json:"threshold"`
+	Message         string     `json:"message"`
+	Silenced        bool       `json:"silenced"` // 触发时处于静默期，不发送通知
+	ResultID        string     `json:"result_id"`
+	StartedAt       time.Time  `json:"started_at"`
+	LastEvaluatedAt time.Time  `json:"last_evaluated_at"`
+	ResolvedAt      time.Time  `json:"resolved_at"`
+}
+
+// Silence 静默规则，在生效期间触发的告警不发送通知，各条件为空时不限制
+type Silence struct {
+	ID           string    `json:"id"`
+	RuleID       string    `json:"rule_id"`
+	SourceNodeID string    `json:"source_node_id"`
+	TargetNodeID string    `json:"target_node_id"`
+	Tag          string    `json:"tag"`
+	Comment      string    `json:"comment"`
+	StartsAt     time.Time `json:"starts_at"`
+	EndsAt       time.Time `json:"ends_at"`
+	CreatedBy    string    `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// AlertFilter 告警历史的查询条件
+type AlertFilter struct {
+	State  AlertState
+	RuleID string
+	NodeID string // 源节点或目标节点
+	Limit  int
+}
+
+// 保存告警规则
+func SaveAlertRule(rule *AlertRule) error {
+	if rule.ID == "" {
+		rule.ID = generateID()
+	}
+	if rule.CreatedAt.IsZero() {
+		rule.CreatedAt = time.Now()
+	}
+	rule.UpdatedAt = time.Now()
+
+	_, err := db.Exec(`
+	INSERT OR REPLACE INTO alert_rules (
+		id, name, enabled, metric, aggregation, window_size, operator, threshold, consecutive, severity,
+		source_node_id, target_node_id, tag, created_by, created_at, updated_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rule.ID, rule.Name, rule.Enabled, rule.Metric, rule.Aggregation, rule.Window, rule.Operator,
+		rule.Threshold, rule.Consecutive, rule.Severity, rule.SourceNodeID, rule.TargetNodeID, rule.Tag,
+		rule.CreatedBy, rule.CreatedAt, rule.UpdatedAt)
+
+	return err
+}
+
+// 获取告警规则
+func GetAlertRule(id string) (*AlertRule, error) {
+	rows, err := db.Query(alertRuleSelect+" WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules, err := scanAlertRules(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("告警规则不存在: %s", id)
+	}
+	return &rules[0], nil
+}
+
+// 获取所有告警规则
+func GetAlertRules() ([]AlertRule, error) {
+	rows, err := db.Query(alertRuleSelect + " ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanAlertRules(rows)
+}
+
+// 删除告警规则及其评估状态，告警历史保留
+func DeleteAlertRule(id string) error {
+	result, err := db.Exec("DELETE FROM alert_rules WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("告警规则不存在: %s", id)
+	}
+
+	return ResetAlertRuleStates(id)
+}
+
+const alertRuleSelect = `
+	SELECT id, name, enabled, metric, aggregation, window_size, operator, threshold, consecutive, severity,
+		source_node_id, target_node_id, tag, created_by, created_at, updated_at
+	FROM alert_rules`
+
+func scanAlertRules(rows *sql.Rows) ([]AlertRule, error) {
+	var rules []AlertRule
+	for rows.Next() {
+		var rule AlertRule
+		var sourceNodeID, targetNodeID, tag, createdBy sql.NullString
+
+		err := rows.Scan(&rule.ID, &rule.Name, &rule.Enabled, &rule.Metric, &rule.Aggregation, &rule.Window,
+			&rule.Operator, &rule.Threshold, &rule.Consecutive, &rule.Severity,
+			&sourceNodeID, &targetNodeID, &tag, &createdBy, &rule.CreatedAt, &rule.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		rule.SourceNodeID = sourceNodeID.String
+		rule.TargetNodeID = targetNodeID.String
+		rule.Tag = tag.String
+		rule.CreatedBy = createdBy.String
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// 增加或清零规则在节点对上连续超过阈值的次数，返回更新后的次数
+func UpdateAlertRuleState(ruleID, sourceNodeID, targetNodeID string, breached bool) (int, error) {
+	if !breached {
+		_, err := db.Exec("DELETE FROM alert_rule_states WHERE rule_id = ? AND source_node_id = ? AND target_node_id = ?",
+			ruleID, sourceNodeID, targetNodeID)
+		return 0, err
+	}
+
+	_, err := db.Exec(`
+	INSERT INTO alert_rule_states (rule_id, source_node_id, target_node_id, breaches, updated_at)
+	VALUES (?, ?, ?, 1, ?)
+	ON CONFLICT (rule_id, source_node_id, target_node_id)
+	DO UPDATE SET breaches = breaches + 1, updated_at = excluded.updated_at`,
+		ruleID, sourceNodeID, targetNodeID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	var breaches int
+	err = db.QueryRow("SELECT breaches FROM alert_rule_states WHERE rule_id = ? AND source_node_id = ? AND target_node_id = ?",
+		ruleID, sourceNodeID, targetNodeID).Scan(&breaches)
+	return breaches, err
+}
+
+// 清除规则的评估状态，规则修改或删除后重新计数
+func ResetAlertRuleStates(ruleID string) error {
+	_, err := db.Exec("DELETE FROM alert_rule_states WHERE rule_id = ?", ruleID)
+	return err
+}
+
+// 保存告警
+func SaveAlert(alert *Alert) error {
+	if alert.ID == "" {
+		alert.ID = generateID()
+	}
+
+	_, err := db.Exec(`
+	INSERT OR REPLACE INTO alerts (
+		id, rule_id, rule_name, severity, source_node_id, target_node_id, state, value, last_value, threshold,
+		message, silenced, result_id, started_at, last_evaluated_at, resolved_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		alert.ID, alert.RuleID, alert.RuleName, alert.Severity, alert.SourceNodeID, alert.TargetNodeID,
+		alert.State, alert.Value, alert.LastValue, alert.Threshold, alert.Message, alert.Silenced,
+		alert.ResultID, alert.StartedAt, alert.LastEvaluatedAt, alert.ResolvedAt)
+
+	return err
+}
+
+// 获取告警
+func GetAlert(id string) (*Alert, error) {
+	rows, err := db.Query(alertSelect+" WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts, err := scanAlerts(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(alerts) == 0 {
+		return nil, fmt.Errorf("告警不存在: %s", id)
+	}
+	return &alerts[0], nil
+}
+
+// 获取规则在节点对上触发中的告警，没有时返回nil
+func GetFiringAlert(ruleID, sourceNodeID, targetNodeID string) (*Alert, error) {
+	rows, err := db.Query(alertSelect+" WHERE rule_id = ? AND source_node_id = ? AND target_node_id = ? AND state = ?",
+		ruleID, sourceNodeID, targetNodeID, AlertStateFiring)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts, err := scanAlerts(rows)
+	if err != nil || len(alerts) == 0 {
+		return nil, err
+	}
+	return &alerts[0], nil
+}
+
+// 按条件查询告警历史，按触发时间倒序
+func GetAlerts(filter AlertFilter) ([]Alert, error) {
+	query := alertSelect + " WHERE 1 = 1"
+	var args []interface{}
+	if filter.State != "" {
+		query += " AND state = ?"
+		args = append(args, filter.State)
+	}
+	if filter.RuleID != "" {
+		query += " AND rule_id = ?"
+		args = append(args, filter.RuleID)
+	}
+	if filter.NodeID != "" {
+		query += " AND (source_node_id = ? OR target_node_id = ?)"
+		args = append(args, filter.NodeID, filter.NodeID)
+	}
+	query += " ORDER BY started_at DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanAlerts(rows)
+}
+
+// 将规则触发中的告警标记为已恢复，返回这些告警
+func ResolveRuleAlerts(ruleID, message string) ([]Alert, error) {
+	alerts, err := GetAlerts(AlertFilter{State: AlertStateFiring, RuleID: ruleID, Limit: -1})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for i := range alerts {
+		alerts[i].State = AlertStateResolved
+		alerts[i].ResolvedAt = now
+		alerts[i].Message = message
+		if err := SaveAlert(&alerts[i]); err != nil {
+			return nil, err
+		}
+	}
+	return alerts, nil
+}
+
+const alertSelect = `
+	SELECT id, rule_id, rule_name, severity, source_node_id, target_node_id, state, value, last_value, threshold,
+		message, silenced, result_id, started_at, last_evaluated_at, resolved_at
+	FROM alerts`
+
+func scanAlerts(rows *sql.Rows) ([]Alert, error) {
+	alerts := []Alert{}
+	for rows.Next() {
+		var alert Alert
+		var targetNodeID, message, resultID sql.NullString
+		var lastEvaluatedAt, resolvedAt sql.NullTime
+
+		err := rows.Scan(&alert.ID, &alert.RuleID, &alert.RuleName, &alert.Severity, &alert.SourceNodeID,
+			&targetNodeID, &alert.State, &alert.Value, &alert.LastValue, &alert.Threshold, &message,
+			&alert.Silenced, &resultID, &alert.StartedAt, &lastEvaluatedAt, &resolvedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		alert.TargetNodeID = targetNodeID.String
+		alert.Message = message.String
+		alert.ResultID = resultID.String
+		alert.LastEvaluatedAt = lastEvaluatedAt.Time
+		alert.ResolvedAt = resolvedAt.Time
+		alerts = append(alerts, alert)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// 保存静默规则
+func SaveSilence(silence *Silence) error {
+	if silence.ID == "" {
+		silence.ID = generateID()
+	}
+	if silence.CreatedAt.IsZero() {
+		silence.CreatedAt = time.Now()
+	}
+
+	_, err := db.Exec(`
+	INSERT OR REPLACE INTO alert_silences (
+		id, rule_id, source_node_id, target_node_id, tag, comment, starts_at, ends_at, created_by, created_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		silence.ID, silence.RuleID, silence.SourceNodeID, silence.TargetNodeID, silence.Tag, silence.Comment,
+		silence.StartsAt, silence.EndsAt, silence.CreatedBy, silence.CreatedAt)
+
+	return err
+}
+
+// 获取静默规则，activeAt不为零值时只返回该时间生效的静默规则
+func GetSilences(activeAt time.Time) ([]Silence, error) {
+	query := `
+	SELECT id, rule_id, source_node_id, target_node_id, tag, comment, starts_at, ends_at, created_by, created_at
+	FROM alert_silences`
+	var args []interface{}
+	if !activeAt.IsZero() {
+		query += " WHERE starts_at <= ? AND ends_at > ?"
+		args = append(args, activeAt, activeAt)
+	}
+	query += " ORDER BY ends_at DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	silences := []Silence{}
+	for rows.Next() {
+		var silence Silence
+		var ruleID, sourceNodeID, targetNodeID, tag, comment, createdBy sql.NullString
+
+		err := rows.Scan(&silence.ID, &ruleID, &sourceNodeID, &targetNodeID, &tag, &comment,
+			&silence.StartsAt, &silence.EndsAt, &createdBy, &silence.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		silence.RuleID = ruleID.String
+		silence.SourceNodeID = sourceNodeID.String
+		silence.TargetNodeID = targetNodeID.String
+		silence.Tag = tag.String
+		silence.Comment = comment.String
+		silence.CreatedBy = createdBy.String
+		silences = append(silences, silence)
+	}
+	return silences, rows.Err()
+}
+
+// 删除静默规则
+func DeleteSilence(id string) error {
+	result, err := db.Exec("DELETE FROM alert_silences WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("静默规则不存在: %s", id)
+	}
+	return nil
+}
+
+// 获取节点对最近的成功测试，只包含提供该指标的测试类型，按时间倒序
+func GetRecentMetricResults(sourceNodeID, targetNodeID, metric string, limit int) ([]SpeedTestResult, error) {
+	types := MetricTestTypes(metric)
+	if len(types) == 0 {
+		return nil, fmt.Errorf("未知的指标: %s", metric)
+	}
+
+	rows, err := db.Query(`
+	SELECT id, type, start_time, download_speed, upload_speed, ping, jitter, packet_loss
+	FROM speedtest_results
+	WHERE source_node_id = ? AND target_node_id = ? AND status = ? AND type IN (?, ?)
+	ORDER BY start_time DESC LIMIT ?`,
+		sourceNodeID, targetNodeID, SpeedTestStatusCompleted, types[0], types[1], limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SpeedTestResult
+	for rows.Next() {
+		result := SpeedTestResult{SourceNodeID: sourceNodeID, TargetNodeID: targetNodeID}
+		err := rows.Scan(&result.ID, &result.Type, &result.StartTime, &result.DownloadSpeed,
+			&result.UploadSpeed, &result.Ping, &result.Jitter, &result.PacketLoss)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
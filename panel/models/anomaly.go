@@ -0,0 +1,201 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// AnomalyScore 一次测试结果的某个指标相对于节点对基线的偏离程度
+type AnomalyScore struct {
+	ResultID     string    `json:"result_id"`
+	SourceNodeID string    `json:"source_node_id"`
+	TargetNodeID string    `json:"target_node_id"`
+	Metric       string    `json:"metric"`
+	Value        float64   `json:"value"`
+	Baseline     float64   `json:"baseline"`  // 基线（历史结果的中位数）
+	Deviation    float64   `json:"deviation"` // 基线的稳健标准差（1.4826倍MAD）
+	Score        float64   `json:"score"`     // (value - baseline) / deviation
+	Samples      int       `json:"samples"`   // 基线的样本数
+	Seasonal     bool      `json:"seasonal"`  // 基线是否只使用相同时段的历史结果
+	Anomalous    bool      `json:"anomalous"` // 偏离超过阈值
+	Degraded     bool      `json:"degraded"`  // 偏离方向是否为变差：速度降低或延迟、抖动、丢包升高
+	StartTime    time.Time `json:"start_time"`
+}
+
+// AnomalyFilter 异常查询条件
+type AnomalyFilter struct {
+	NodeID       string // 源节点或目标节点
+	SourceNodeID string
+	TargetNodeID string
+	Metric       string
+	Since        time.Time
+	Limit        int
+}
+
+// 保存测试结果各指标的偏离程度，覆盖该结果之前的记录
+func SaveAnomalyScores(resultID string, scores []AnomalyScore) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM anomaly_scores WHERE result_id = ?", resultID); err != nil {
+		return err
+	}
+	for _, score := range scores {
+		_, err := tx.Exec(`
+		INSERT INTO anomaly_scores (
+			result_id, source_node_id, target_node_id, metric, value, baseline, deviation, score,
+			samples, seasonal, anomalous, degraded, start_time
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			score.ResultID, score.SourceNodeID, score.TargetNodeID, score.Metric, score.Value,
+			score.Baseline, score.Deviation, score.Score, score.Samples, score.Seasonal,
+			score.Anomalous, score.Degraded, score.StartTime.UTC())
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// 获取测试结果某个指标的偏离程度，没有记录（样本不足）时返回nil
+func GetAnomalyScore(resultID, metric string) (*AnomalyScore, error) {
+	rows, err := db.Query(anomalyScoreSelect+" WHERE result_id = ? AND metric = ?", resultID, metric)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scores, err := scanAnomalyScores(rows)
+	if err != nil || len(scores) == 0 {
+		return nil, err
+	}
+	return &scores[0], nil
+}
+
+// 查询异常结果，按时间倒序
+func GetAnomalies(filter AnomalyFilter) ([]AnomalyScore, error) {
+	query := anomalyScoreSelect + " WHERE anomalous = 1"
+	var args []interface{}
+	if filter.NodeID != "" {
+		query += " AND (source_node_id = ? OR target_node_id = ?)"
+		args = append(args, filter.NodeID, filter.NodeID)
+	}
+	if filter.SourceNodeID != "" {
+		query += " AND source_node_id = ?"
+		args = append(args, filter.SourceNodeID)
+	}
+	if filter.TargetNodeID != "" {
+		query += " AND target_node_id = ?"
+		args = append(args, filter.TargetNodeID)
+	}
+	if filter.Metric != "" {
+		query += " AND metric = ?"
+		args = append(args, filter.Metric)
+	}
+	if !filter.Since.IsZero() {
+		query += " AND start_time >= ?"
+		args = append(args, filter.Since.UTC())
+	}
+	query += " ORDER BY start_time DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scores, err := scanAnomalyScores(rows)
+	if scores == nil {
+		scores = []AnomalyScore{}
+	}
+	return scores, err
+}
+
+// 为测试结果填充异常指标
+func AttachAnomalies(results []SpeedTestResult) error {
+	index := make(map[string]int, len(results))
+	ids := make([]interface{}, 0, len(results))
+	for i := range results {
+		index[results[i].ID] = i
+		ids = append(ids, results[i].ID)
+	}
+
+	// SQLite单条语句的参数个数有限，分批查询
+	const batch = 500
+	for start := 0; start < len(ids); start += batch {
+		end := start + batch
+		if end > len(ids) {
+			end = len(ids)
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", end-start), ",")
+		rows, err := db.Query(anomalyScoreSelect+" WHERE anomalous = 1 AND result_id IN ("+placeholders+") ORDER BY metric",
+			ids[start:end]...)
+		if err != nil {
+			return err
+		}
+		scores, err := scanAnomalyScores(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		for _, score := range scores {
+			i := index[score.ResultID]
+			results[i].Anomalies = append(results[i].Anomalies, score)
+		}
+	}
+	return nil
+}
+
+// 获取节点对在before之前提供该指标的成功测试，按时间倒序
+func GetMetricHistory(sourceNodeID, targetNodeID, metric string, before time.Time, limit int) ([]SpeedTestResult, error) {
+	types := MetricTestTypes(metric)
+	rows, err := db.Query(`
+	SELECT id, type, start_time, download_speed, upload_speed, ping, jitter, packet_loss
+	FROM speedtest_results
+	WHERE source_node_id = ? AND target_node_id = ? AND status = ? AND type IN (?, ?) AND start_time < ?
+	ORDER BY start_time DESC LIMIT ?`,
+		sourceNodeID, targetNodeID, SpeedTestStatusCompleted, types[0], types[1], before.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SpeedTestResult
+	for rows.Next() {
+		var result SpeedTestResult
+		err := rows.Scan(&result.ID, &result.Type, &result.StartTime, &result.DownloadSpeed, &result.UploadSpeed,
+			&result.Ping, &result.Jitter, &result.PacketLoss)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+const anomalyScoreSelect = `
+	SELECT result_id, source_node_id, target_node_id, metric, value, baseline, deviation, score,
+		samples, seasonal, anomalous, degraded, start_time
+	FROM anomaly_scores`
+
+func scanAnomalyScores(rows *sql.Rows) ([]AnomalyScore, error) {
+	var scores []AnomalyScore
+	for rows.Next() {
+		var score AnomalyScore
+		err := rows.Scan(&score.ResultID, &score.SourceNodeID, &score.TargetNodeID, &score.Metric, &score.Value,
+			&score.Baseline, &score.Deviation, &score.Score, &score.Samples, &score.Seasonal,
+			&score.Anomalous, &score.Degraded, &score.StartTime)
+		if err != nil {
+			return nil, err
+		}
+		scores = append(scores, score)
+	}
+	return scores, rows.Err()
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"time"
+)
+
+// NodeCertificate 表示面板为节点签发的证书
+type NodeCertificate struct {
+	Serial    string    `json:"serial"`     // 证书序列号（十六进制）
+	NodeID    string    `json:"node_id"`    // 节点ID
+	NotBefore time.Time `json:"not_before"` // 生效时间
+	NotAfter  time.Time `json:"not_after"`  // 过期时间
+	Revoked   bool      `json:"revoked"`    // 是否已吊销
+	RevokedAt time.Time `json:"revoked_at"` // 吊销时间
+	CreatedAt time.Time `json:"created_at"` // 签发时间
+}
+
+// 保存节点证书
+func SaveNodeCertificate(cert *NodeCertificate) error {
+	if cert.CreatedAt.IsZero() {
+		cert.CreatedAt = time.Now()
+	}
+
+	_, err := db.Exec(`
+	INSERT OR REPLACE INTO node_certificates (
+		serial, node_id, not_before, not_after, revoked, revoked_at, created_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		cert.Serial, cert.NodeID, cert.NotBefore, cert.NotAfter, cert.Revoked, cert.RevokedAt, cert.CreatedAt)
+
+	return err
+}
+
+// 获取节点的所有证书
+func GetNodeCertificates(nodeID string) ([]NodeCertificate, error) {
+	rows, err := db.Query(`
+	SELECT serial, node_id, not_before, not_after, revoked, revoked_at, created_at
+	FROM node_certificates WHERE node_id = ? ORDER BY created_at DESC`, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var certs []NodeCertificate
+	for rows.Next() {
+		var cert NodeCertificate
+
+		err := rows.Scan(&cert.Serial, &cert.NodeID, &cert.NotBefore, &cert.NotAfter,
+			&cert.Revoked, &cert.RevokedAt, &cert.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		certs = append(certs, cert)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return certs, nil
+}
+
+// 吊销节点的所有证书
+func RevokeNodeCertificates(nodeID string) error {
+	_, err := db.Exec("UPDATE node_certificates SET revoked = 1, revoked_at = ? WHERE node_id = ? AND revoked = 0",
+		time.Now(), nodeID)
+	return err
+}
+
+// 获取已吊销且尚未过期的证书序列号，节点据此拒绝其他节点出示的已吊销证书
+func GetRevokedCertificateSerials() ([]string, error) {
+	rows, err := db.Query("SELECT serial, not_after FROM node_certificates WHERE revoked = 1")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// 过期的证书握手时即被拒绝，不需要下发
+	now := time.Now()
+	serials := []string{}
+	for rows.Next() {
+		var serial string
+		var notAfter time.Time
+		if err := rows.Scan(&serial, &notAfter); err != nil {
+			return nil, err
+		}
+		if now.Before(notAfter) {
+			serials = append(serials, serial)
+		}
+	}
+	return serials, rows.Err()
+}
+
+// 检查证书是否已被吊销，面板未签发过的证书同样视为无效
+func IsCertificateRevoked(serial string) bool {
+	var revoked bool
+	err := db.QueryRow("SELECT revoked FROM node_certificates WHERE serial = ?", serial).Scan(&revoked)
+	if err != nil {
+		return true
+	}
+	return revoked
+}
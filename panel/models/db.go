@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strconv"
 	"sync"
 	"time"
 
@@ -48,6 +49,14 @@ func InitDB(dbPath string) error {
 	return err
 }
 
+// CloseDB 关闭数据库连接，面板退出前调用
+func CloseDB() error {
+	if db == nil {
+		return nil
+	}
+	return db.Close()
+}
+
 // 创建数据库表
 func createTables() error {
 	// 创建节点表
@@ -72,11 +81,27 @@ func createTables() error {
 		network_rx INTEGER,
 		network_tx INTEGER,
 		version TEXT,
-		secret_key TEXT
+		secret_key TEXT,
+		node_group TEXT,
+		update_status TEXT,
+		listen_port TEXT,
+		clock_skew REAL
 	)`)
 	if err != nil {
 		return fmt.Errorf("创建节点表失败: %v", err)
 	}
+	if err := addColumnIfMissing("nodes", "node_group", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("nodes", "update_status", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("nodes", "listen_port", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("nodes", "clock_skew", "REAL"); err != nil {
+		return err
+	}
 
 	// 创建测速结果表
 	_, err = db.Exec(`
@@ -95,12 +120,36 @@ func createTables() error {
 		jitter REAL,
 		packet_loss REAL,
 		error_message TEXT,
+		schedule_id TEXT,
+		timeout INTEGER,
+		threads INTEGER,
+		size INTEGER,
+		mesh_run_id TEXT,
 		FOREIGN KEY (source_node_id) REFERENCES nodes (id),
 		FOREIGN KEY (target_node_id) REFERENCES nodes (id)
 	)`)
 	if err != nil {
 		return fmt.Errorf("创建测速结果表失败: %v", err)
 	}
+	if err := addColumnIfMissing("speedtest_results", "schedule_id", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("speedtest_results", "timeout", "INTEGER"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("speedtest_results", "threads", "INTEGER"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("speedtest_results", "size", "INTEGER"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("speedtest_results", "mesh_run_id", "TEXT"); err != nil {
+		return err
+	}
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_speedtest_results_status ON speedtest_results (status, source_node_id)")
+	if err != nil {
+		return fmt.Errorf("创建测速结果索引失败: %v", err)
+	}
 
 	// 创建用户表
 	_, err = db.Exec(`
@@ -128,6 +177,378 @@ func createTables() error {
 		return fmt.Errorf("创建系统设置表失败: %v", err)
 	}
 
+	// 创建节点证书表
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS node_certificates (
+		serial TEXT PRIMARY KEY,
+		node_id TEXT NOT NULL,
+		not_before TIMESTAMP NOT NULL,
+		not_after TIMESTAMP NOT NULL,
+		revoked INTEGER NOT NULL DEFAULT 0,
+		revoked_at TIMESTAMP,
+		created_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("创建节点证书表失败: %v", err)
+	}
+
+	// 创建节点密钥表，不保存明文密钥：key_hash 只用于查找，签名密钥使用面板主密钥加密保存
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS node_keys (
+		id TEXT PRIMARY KEY,
+		node_id TEXT NOT NULL,
+		key_hash TEXT UNIQUE NOT NULL,
+		key_secret TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		last_used_at TIMESTAMP,
+		expires_at TIMESTAMP,
+		revoked INTEGER NOT NULL DEFAULT 0,
+		revoked_at TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("创建节点密钥表失败: %v", err)
+	}
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_node_keys_node_id ON node_keys (node_id)")
+	if err != nil {
+		return fmt.Errorf("创建节点密钥索引失败: %v", err)
+	}
+
+	// 创建节点状态变更历史表，用于计算可用率
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS node_status_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		node_id TEXT NOT NULL,
+		previous_status TEXT NOT NULL,
+		status TEXT NOT NULL,
+		reason TEXT,
+		changed_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("创建节点状态历史表失败: %v", err)
+	}
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_node_status_history_node ON node_status_history (node_id, changed_at)")
+	if err != nil {
+		return fmt.Errorf("创建节点状态历史索引失败: %v", err)
+	}
+
+	// 创建定时测速任务表
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS schedules (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		enabled INTEGER NOT NULL DEFAULT 1,
+		cron TEXT,
+		interval_seconds INTEGER,
+		source_node_ids TEXT,
+		source_tag TEXT,
+		target_node_ids TEXT,
+		target_tag TEXT,
+		type TEXT NOT NULL,
+		timeout INTEGER,
+		threads INTEGER,
+		size INTEGER,
+		jitter INTEGER,
+		blackouts TEXT,
+		last_run_at TIMESTAMP,
+		created_by TEXT,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("创建定时测速任务表失败: %v", err)
+	}
+
+	// 创建全网格测速表
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS mesh_runs (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		node_ids TEXT NOT NULL,
+		type TEXT NOT NULL,
+		timeout INTEGER NOT NULL DEFAULT 0,
+		threads INTEGER NOT NULL DEFAULT 0,
+		size INTEGER NOT NULL DEFAULT 0,
+		status TEXT NOT NULL,
+		round INTEGER NOT NULL DEFAULT 0,
+		total_rounds INTEGER NOT NULL DEFAULT 0,
+		created_by TEXT,
+		created_at TIMESTAMP NOT NULL,
+		finished_at TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("创建全网格测速表失败: %v", err)
+	}
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_speedtest_results_mesh_run ON speedtest_results (mesh_run_id)")
+	if err != nil {
+		return fmt.Errorf("创建测速结果索引失败: %v", err)
+	}
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_speedtest_results_start_time ON speedtest_results (start_time)")
+	if err != nil {
+		return fmt.Errorf("创建测速结果时间索引失败: %v", err)
+	}
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_speedtest_results_pair ON speedtest_results (source_node_id, target_node_id, start_time)")
+	if err != nil {
+		return fmt.Errorf("创建测速结果节点对索引失败: %v", err)
+	}
+	// 按源节点或目标节点查询时按时间排序，按状态过滤使用 idx_speedtest_results_status
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_speedtest_results_source ON speedtest_results (source_node_id, start_time)")
+	if err != nil {
+		return fmt.Errorf("创建测速结果源节点索引失败: %v", err)
+	}
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_speedtest_results_target ON speedtest_results (target_node_id, start_time)")
+	if err != nil {
+		return fmt.Errorf("创建测速结果目标节点索引失败: %v", err)
+	}
+
+	// 创建告警规则表
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS alert_rules (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		enabled BOOLEAN NOT NULL DEFAULT 1,
+		metric TEXT NOT NULL,
+		aggregation TEXT NOT NULL,
+		window_size INTEGER NOT NULL DEFAULT 1,
+		operator TEXT NOT NULL,
+		threshold REAL NOT NULL,
+		consecutive INTEGER NOT NULL DEFAULT 1,
+		severity TEXT NOT NULL,
+		source_node_id TEXT,
+		target_node_id TEXT,
+		tag TEXT,
+		created_by TEXT,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("创建告警规则表失败: %v", err)
+	}
+
+	// 创建告警规则评估状态表，记录每个节点对连续超过阈值的次数
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS alert_rule_states (
+		rule_id TEXT NOT NULL,
+		source_node_id TEXT NOT NULL,
+		target_node_id TEXT NOT NULL,
+		breaches INTEGER NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (rule_id, source_node_id, target_node_id)
+	)`)
+	if err != nil {
+		return fmt.Errorf("创建告警规则状态表失败: %v", err)
+	}
+
+	// 创建告警历史表
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS alerts (
+		id TEXT PRIMARY KEY,
+		rule_id TEXT NOT NULL,
+		rule_name TEXT NOT NULL,
+		severity TEXT NOT NULL,
+		source_node_id TEXT NOT NULL,
+		target_node_id TEXT,
+		state TEXT NOT NULL,
+		value REAL NOT NULL,
+		last_value REAL NOT NULL,
+		threshold REAL NOT NULL,
+		message TEXT,
+		silenced BOOLEAN NOT NULL DEFAULT 0,
+		result_id TEXT,
+		started_at TIMESTAMP NOT NULL,
+		last_evaluated_at TIMESTAMP,
+		resolved_at TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("创建告警表失败: %v", err)
+	}
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_alerts_rule_state ON alerts (rule_id, state)")
+	if err != nil {
+		return fmt.Errorf("创建告警索引失败: %v", err)
+	}
+
+	// 创建告警静默表
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS alert_silences (
+		id TEXT PRIMARY KEY,
+		rule_id TEXT,
+		source_node_id TEXT,
+		target_node_id TEXT,
+		tag TEXT,
+		comment TEXT,
+		starts_at TIMESTAMP NOT NULL,
+		ends_at TIMESTAMP NOT NULL,
+		created_by TEXT,
+		created_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("创建告警静默表失败: %v", err)
+	}
+
+	// 创建异常检测结果表，记录每个测试结果各指标相对基线的偏离程度
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS anomaly_scores (
+		result_id TEXT NOT NULL,
+		source_node_id TEXT NOT NULL,
+		target_node_id TEXT NOT NULL,
+		metric TEXT NOT NULL,
+		value REAL NOT NULL,
+		baseline REAL NOT NULL,
+		deviation REAL NOT NULL,
+		score REAL NOT NULL,
+		samples INTEGER NOT NULL,
+		seasonal BOOLEAN NOT NULL DEFAULT 0,
+		anomalous BOOLEAN NOT NULL DEFAULT 0,
+		degraded BOOLEAN NOT NULL DEFAULT 0,
+		start_time TIMESTAMP NOT NULL,
+		PRIMARY KEY (result_id, metric)
+	)`)
+	if err != nil {
+		return fmt.Errorf("创建异常检测结果表失败: %v", err)
+	}
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_anomaly_scores_anomalous ON anomaly_scores (anomalous, start_time)")
+	if err != nil {
+		return fmt.Errorf("创建异常检测结果索引失败: %v", err)
+	}
+
+	// 创建测速结果小时汇总表，原始结果按保留期限删除后仍保留汇总
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS speedtest_rollups_hourly (
+		bucket TIMESTAMP NOT NULL,
+		source_node_id TEXT NOT NULL,
+		target_node_id TEXT NOT NULL,
+		type TEXT NOT NULL,
+		metric TEXT NOT NULL,
+		count INTEGER NOT NULL,
+		failed INTEGER NOT NULL,
+		min REAL NOT NULL,
+		avg REAL NOT NULL,
+		max REAL NOT NULL,
+		p50 REAL NOT NULL,
+		p95 REAL NOT NULL,
+		p99 REAL NOT NULL,
+		PRIMARY KEY (bucket, source_node_id, target_node_id, type, metric)
+	)`)
+	if err != nil {
+		return fmt.Errorf("创建测速结果小时汇总表失败: %v", err)
+	}
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_speedtest_rollups_hourly_pair ON speedtest_rollups_hourly (source_node_id, target_node_id, bucket)")
+	if err != nil {
+		return fmt.Errorf("创建测速结果小时汇总索引失败: %v", err)
+	}
+
+	// 创建测速结果每日汇总表，原始结果按保留期限删除后仍保留汇总
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS speedtest_rollups_daily (
+		bucket TIMESTAMP NOT NULL,
+		source_node_id TEXT NOT NULL,
+		target_node_id TEXT NOT NULL,
+		type TEXT NOT NULL,
+		metric TEXT NOT NULL,
+		count INTEGER NOT NULL,
+		failed INTEGER NOT NULL,
+		min REAL NOT NULL,
+		avg REAL NOT NULL,
+		max REAL NOT NULL,
+		p50 REAL NOT NULL,
+		p95 REAL NOT NULL,
+		p99 REAL NOT NULL,
+		PRIMARY KEY (bucket, source_node_id, target_node_id, type, metric)
+	)`)
+	if err != nil {
+		return fmt.Errorf("创建测速结果每日汇总表失败: %v", err)
+	}
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_speedtest_rollups_daily_pair ON speedtest_rollups_daily (source_node_id, target_node_id, bucket)")
+	if err != nil {
+		return fmt.Errorf("创建测速结果每日汇总索引失败: %v", err)
+	}
+
+	// 创建待重新汇总的时间段表，记录时间段结束后才上报或结束的测试所在的时间段
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS rollup_dirty (
+		period TEXT NOT NULL,
+		bucket INTEGER NOT NULL,
+		PRIMARY KEY (period, bucket)
+	)`)
+	if err != nil {
+		return fmt.Errorf("创建待重新汇总时间段表失败: %v", err)
+	}
+
+	// 创建通知渠道表
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS notification_channels (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL,
+		enabled BOOLEAN NOT NULL DEFAULT 1,
+		config TEXT,
+		min_severity TEXT,
+		send_resolved BOOLEAN NOT NULL DEFAULT 1,
+		rate_limit INTEGER NOT NULL DEFAULT 0,
+		last_sent_at TIMESTAMP,
+		last_error TEXT,
+		created_by TEXT,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("创建通知渠道表失败: %v", err)
+	}
+
+	// 创建节点更新发布表，每个分组一条记录，"*" 表示所有节点
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS update_rollouts (
+		group_name TEXT PRIMARY KEY,
+		version TEXT NOT NULL,
+		paused INTEGER NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("创建节点更新发布表失败: %v", err)
+	}
+
+	// 创建节点注册令牌表，只保存令牌哈希
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS enrollment_tokens (
+		id TEXT PRIMARY KEY,
+		token_hash TEXT UNIQUE NOT NULL,
+		prefix TEXT NOT NULL,
+		node_name TEXT,
+		tags TEXT,
+		node_group TEXT,
+		max_uses INTEGER NOT NULL,
+		uses INTEGER NOT NULL DEFAULT 0,
+		expires_at TIMESTAMP NOT NULL,
+		created_by TEXT,
+		created_at TIMESTAMP NOT NULL,
+		last_used_at TIMESTAMP,
+		revoked INTEGER NOT NULL DEFAULT 0,
+		revoked_at TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("创建节点注册令牌表失败: %v", err)
+	}
+
+	// 旧版本以明文保存的可预测密钥不再有效，需要在面板中为节点重新生成密钥
+	result, err := db.Exec("UPDATE nodes SET secret_key = NULL WHERE secret_key IS NOT NULL AND secret_key != ''")
+	if err != nil {
+		return fmt.Errorf("清理旧节点密钥失败: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("已清除 %d 个旧格式节点密钥，请为这些节点重新生成密钥", n)
+	}
+
+	// 旧版本按写入时的时区保存测试时间，转换为UTC后才能按文本比较和排序
+	for _, column := range []struct{ table, name string }{
+		{"speedtest_results", "start_time"},
+		{"speedtest_results", "end_time"},
+		{"anomaly_scores", "start_time"},
+	} {
+		if err := normalizeTimeColumn(column.table, column.name); err != nil {
+			return err
+		}
+	}
+
 	// 检查是否存在默认管理员用户，如果不存在则创建
 	var count int
 	err = db.QueryRow("SELECT COUNT(*) FROM users WHERE role = 'admin'").Scan(&count)
@@ -154,6 +575,77 @@ func createTables() error {
 	return nil
 }
 
+// 将时间列中不是UTC的值转换为UTC
+func normalizeTimeColumn(table, column string) error {
+	rows, err := db.Query(fmt.Sprintf("SELECT rowid, %s FROM %s WHERE %s NOT LIKE '%%+00:00'", column, table, column))
+	if err != nil {
+		return fmt.Errorf("查询 %s.%s 失败: %v", table, column, err)
+	}
+	values := make(map[int64]time.Time)
+	for rows.Next() {
+		var rowid int64
+		var t time.Time
+		if err := rows.Scan(&rowid, &t); err != nil {
+			rows.Close()
+			return fmt.Errorf("读取 %s.%s 失败: %v", table, column, err)
+		}
+		values[rowid] = t.UTC()
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("读取 %s.%s 失败: %v", table, column, err)
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for rowid, t := range values {
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET %s = ? WHERE rowid = ?", table, column), t, rowid); err != nil {
+			return fmt.Errorf("转换 %s.%s 失败: %v", table, column, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("已将 %d 条 %s.%s 转换为UTC时间", len(values), table, column)
+	return nil
+}
+
+// 为旧数据库补充新增的列
+func addColumnIfMissing(table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("查询表结构失败: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("查询表结构失败: %v", err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("查询表结构失败: %v", err)
+	}
+	rows.Close()
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("添加 %s.%s 列失败: %v", table, column, err)
+	}
+	return nil
+}
+
 // 保存节点
 func SaveNode(node *Node) error {
 	if node.ID == "" {
@@ -169,28 +661,41 @@ func SaveNode(node *Node) error {
 	_, err := db.Exec(`
 	INSERT OR REPLACE INTO nodes (
 		id, name, ip, location, status, last_seen, created_at, description, tags,
-		cpu, memory, disk, uptime, load1, load5, load15, network_rx, network_tx, version, secret_key
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		cpu, memory, disk, uptime, load1, load5, load15, network_rx, network_tx, version, node_group, update_status,
+		listen_port, clock_skew
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		node.ID, node.Name, node.IP, node.Location, node.Status, node.LastSeen, node.CreatedAt,
 		node.Description, tags, node.CPU, node.Memory, node.Disk, node.Uptime,
-		node.Load[0], node.Load[1], node.Load[2], node.NetworkRx, node.NetworkTx, node.Version, node.SecretKey)
+		node.Load[0], node.Load[1], node.Load[2], node.NetworkRx, node.NetworkTx, node.Version, node.Group, node.UpdateStatus,
+		node.ListenPort, node.ClockSkew)
 
 	return err
 }
 
+// NodeName 返回节点名称，节点不存在或未命名时返回ID
+func NodeName(id string) string {
+	if node, err := GetNode(id); err == nil && node.Name != "" {
+		return node.Name
+	}
+	return id
+}
+
 // 获取节点
 func GetNode(id string) (*Node, error) {
 	var node Node
 	var tags string
+	var group, updateStatus, listenPort sql.NullString
 	var load1, load5, load15 float64
 
 	err := db.QueryRow(`
 	SELECT id, name, ip, location, status, last_seen, created_at, description, tags,
-		cpu, memory, disk, uptime, load1, load5, load15, network_rx, network_tx, version, secret_key
+		cpu, memory, disk, uptime, load1, load5, load15, network_rx, network_tx, version, node_group, update_status,
+		listen_port, COALESCE(clock_skew, 0)
 	FROM nodes WHERE id = ?`, id).Scan(
 		&node.ID, &node.Name, &node.IP, &node.Location, &node.Status, &node.LastSeen, &node.CreatedAt,
 		&node.Description, &tags, &node.CPU, &node.Memory, &node.Disk, &node.Uptime,
-		&load1, &load5, &load15, &node.NetworkRx, &node.NetworkTx, &node.Version, &node.SecretKey)
+		&load1, &load5, &load15, &node.NetworkRx, &node.NetworkTx, &node.Version, &group, &updateStatus,
+		&listenPort, &node.ClockSkew)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -202,6 +707,9 @@ func GetNode(id string) (*Node, error) {
 	// 解析标签
 	node.Tags = splitTags(tags)
 	node.Load = [3]float64{load1, load5, load15}
+	node.Group = group.String
+	node.UpdateStatus = updateStatus.String
+	node.ListenPort = listenPort.String
 
 	return &node, nil
 }
@@ -210,7 +718,8 @@ func GetNode(id string) (*Node, error) {
 func GetAllNodes() ([]Node, error) {
 	rows, err := db.Query(`
 	SELECT id, name, ip, location, status, last_seen, created_at, description, tags,
-		cpu, memory, disk, uptime, load1, load5, load15, network_rx, network_tx, version, secret_key
+		cpu, memory, disk, uptime, load1, load5, load15, network_rx, network_tx, version, node_group, update_status,
+		listen_port, COALESCE(clock_skew, 0)
 	FROM nodes ORDER BY name`)
 	if err != nil {
 		return nil, err
@@ -221,12 +730,14 @@ func GetAllNodes() ([]Node, error) {
 	for rows.Next() {
 		var node Node
 		var tags string
+		var group, updateStatus, listenPort sql.NullString
 		var load1, load5, load15 float64
 
 		err := rows.Scan(
 			&node.ID, &node.Name, &node.IP, &node.Location, &node.Status, &node.LastSeen, &node.CreatedAt,
 			&node.Description, &tags, &node.CPU, &node.Memory, &node.Disk, &node.Uptime,
-			&load1, &load5, &load15, &node.NetworkRx, &node.NetworkTx, &node.Version, &node.SecretKey)
+			&load1, &load5, &load15, &node.NetworkRx, &node.NetworkTx, &node.Version, &group, &updateStatus,
+		&listenPort, &node.ClockSkew)
 		if err != nil {
 			return nil, err
 		}
@@ -234,6 +745,9 @@ func GetAllNodes() ([]Node, error) {
 		// 解析标签
 		node.Tags = splitTags(tags)
 		node.Load = [3]float64{load1, load5, load15}
+		node.Group = group.String
+		node.UpdateStatus = updateStatus.String
+		node.ListenPort = listenPort.String
 
 		nodes = append(nodes, node)
 	}
@@ -248,6 +762,11 @@ func GetAllNodes() ([]Node, error) {
 // 删除节点
 func DeleteNode(id string) error {
 	_, err := db.Exec("DELETE FROM nodes WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("DELETE FROM node_status_history WHERE node_id = ?", id)
 	return err
 }
 
@@ -258,8 +777,16 @@ func UpdateNodeStatus(id string, status NodeStatus) error {
 	return err
 }
 
-// 更新节点心跳
+// 记录节点的时钟偏差（秒），节点时钟偏差过大导致请求被拒绝时使用，不更新心跳时间和状态
+func UpdateNodeClockSkew(nodeID string, skew float64) error {
+	_, err := db.Exec("UPDATE nodes SET clock_skew = ? WHERE id = ?", skew, nodeID)
+	return err
+}
+
+// 更新节点心跳，节点通知即将关闭时标记为维护中
 func UpdateNodeHeartbeat(heartbeat *NodeHeartbeat) error {
+	status := heartbeat.NodeStatus()
+
 	_, err := db.Exec(`
 	UPDATE nodes SET 
 		last_seen = ?,
@@ -272,10 +799,14 @@ func UpdateNodeHeartbeat(heartbeat *NodeHeartbeat) error {
 		load5 = ?,
 		load15 = ?,
 		network_rx = ?,
-		network_tx = ?
+		network_tx = ?,
+		version = COALESCE(NULLIF(?, ''), version),
+		update_status = ?,
+		listen_port = COALESCE(NULLIF(?, ''), listen_port),
+		clock_skew = ?
 	WHERE id = ?`,
 		heartbeat.Timestamp,
-		NodeStatusOnline,
+		status,
 		heartbeat.CPU,
 		heartbeat.Memory,
 		heartbeat.Disk,
@@ -285,6 +816,10 @@ func UpdateNodeHeartbeat(heartbeat *NodeHeartbeat) error {
 		heartbeat.Load[2],
 		heartbeat.NetworkRx,
 		heartbeat.NetworkTx,
+		heartbeat.Version,
+		heartbeat.UpdateStatus,
+		heartbeat.ListenPort,
+		heartbeat.ClockSkew,
 		heartbeat.ID)
 	return err
 }
@@ -294,17 +829,28 @@ func SaveSpeedTestResult(result *SpeedTestResult) error {
 	if result.ID == "" {
 		result.ID = generateID()
 	}
+	// 统一以UTC保存，按文本比较时间时不受节点和面板时区影响
+	result.StartTime = result.StartTime.UTC()
+	result.EndTime = result.EndTime.UTC()
 
 	_, err := db.Exec(`
 	INSERT OR REPLACE INTO speedtest_results (
 		id, source_node_id, target_node_id, type, status, start_time, end_time,
-		duration, download_speed, upload_speed, ping, jitter, packet_loss, error_message
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		duration, download_speed, upload_speed, ping, jitter, packet_loss, error_message,
+		schedule_id, timeout, threads, size, mesh_run_id
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		result.ID, result.SourceNodeID, result.TargetNodeID, result.Type, result.Status,
 		result.StartTime, result.EndTime, result.Duration, result.DownloadSpeed,
-		result.UploadSpeed, result.Ping, result.Jitter, result.PacketLoss, result.ErrorMessage)
+		result.UploadSpeed, result.Ping, result.Jitter, result.PacketLoss, result.ErrorMessage,
+		result.ScheduleID, result.Timeout, result.Threads, result.Size, result.MeshRunID)
+	if err != nil {
+		return err
+	}
 
-	return err
+	if rollupStatus(result.Status) {
+		return markRollupDirty(result.StartTime, time.Now())
+	}
+	return nil
 }
 
 // 获取测速结果
@@ -313,11 +859,14 @@ func GetSpeedTestResult(id string) (*SpeedTestResult, error) {
 
 	err := db.QueryRow(`
 	SELECT id, source_node_id, target_node_id, type, status, start_time, end_time,
-		duration, download_speed, upload_speed, ping, jitter, packet_loss, error_message
+		duration, download_speed, upload_speed, ping, jitter, packet_loss, error_message,
+		COALESCE(schedule_id, ''), COALESCE(timeout, 0), COALESCE(threads, 0), COALESCE(size, 0),
+		COALESCE(mesh_run_id, '')
 	FROM speedtest_results WHERE id = ?`, id).Scan(
 		&result.ID, &result.SourceNodeID, &result.TargetNodeID, &result.Type, &result.Status,
 		&result.StartTime, &result.EndTime, &result.Duration, &result.DownloadSpeed,
-		&result.UploadSpeed, &result.Ping, &result.Jitter, &result.PacketLoss, &result.ErrorMessage)
+		&result.UploadSpeed, &result.Ping, &result.Jitter, &result.PacketLoss, &result.ErrorMessage,
+		&result.ScheduleID, &result.Timeout, &result.Threads, &result.Size, &result.MeshRunID)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -329,74 +878,6 @@ func GetSpeedTestResult(id string) (*SpeedTestResult, error) {
 	return &result, nil
 }
 
-// 获取所有测速结果
-func GetAllSpeedTestResults() ([]SpeedTestResult, error) {
-	rows, err := db.Query(`
-	SELECT id, source_node_id, target_node_id, type, status, start_time, end_time,
-		duration, download_speed, upload_speed, ping, jitter, packet_loss, error_message
-	FROM speedtest_results ORDER BY start_time DESC`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var results []SpeedTestResult
-	for rows.Next() {
-		var result SpeedTestResult
-
-		err := rows.Scan(
-			&result.ID, &result.SourceNodeID, &result.TargetNodeID, &result.Type, &result.Status,
-			&result.StartTime, &result.EndTime, &result.Duration, &result.DownloadSpeed,
-			&result.UploadSpeed, &result.Ping, &result.Jitter, &result.PacketLoss, &result.ErrorMessage)
-		if err != nil {
-			return nil, err
-		}
-
-		results = append(results, result)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return results, nil
-}
-
-// 获取节点的测速结果
-func GetNodeSpeedTestResults(nodeID string) ([]SpeedTestResult, error) {
-	rows, err := db.Query(`
-	SELECT id, source_node_id, target_node_id, type, status, start_time, end_time,
-		duration, download_speed, upload_speed, ping, jitter, packet_loss, error_message
-	FROM speedtest_results 
-	WHERE source_node_id = ? OR target_node_id = ?
-	ORDER BY start_time DESC`, nodeID, nodeID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var results []SpeedTestResult
-	for rows.Next() {
-		var result SpeedTestResult
-
-		err := rows.Scan(
-			&result.ID, &result.SourceNodeID, &result.TargetNodeID, &result.Type, &result.Status,
-			&result.StartTime, &result.EndTime, &result.Duration, &result.DownloadSpeed,
-			&result.UploadSpeed, &result.Ping, &result.Jitter, &result.PacketLoss, &result.ErrorMessage)
-		if err != nil {
-			return nil, err
-		}
-
-		results = append(results, result)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return results, nil
-}
-
 // 验证用户登录
 func ValidateUser(username, password string) (bool, string, error) {
 	var id string
@@ -444,6 +925,34 @@ func SaveSetting(key, value string) error {
 	return err
 }
 
+// 获取整数设置值，未设置或无效时返回默认值
+func GetIntSetting(key string, fallback int) int {
+	value, err := GetSetting(key)
+	if err != nil || value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("设置 %s 的值无效: %q，使用默认值 %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// 获取数值设置，未设置或不是正数时返回fallback
+func GetFloatSetting(key string, fallback float64) float64 {
+	value, err := GetSetting(key)
+	if err != nil || value == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f <= 0 {
+		log.Printf("设置 %s 的值无效: %q，使用默认值 %g", key, value, fallback)
+		return fallback
+	}
+	return f
+}
+
 // 生成唯一ID
 func generateID() string {
 	return fmt.Sprintf("%d", time.Now().UnixNano())
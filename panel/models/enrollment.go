@@ -0,0 +1,153 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// EnrollmentToken 表示节点安装使用的一次性注册令牌，面板只保存令牌哈希
+type EnrollmentToken struct {
+	ID         string     `json:"id"`           // 令牌ID
+	Hash       string     `json:"-"`            // 令牌哈希（不输出到JSON）
+	Prefix     string     `json:"prefix"`       // 令牌前缀，用于区分多个令牌
+	NodeName   string     `json:"node_name"`    // 预设节点名称，为空时使用节点主机名
+	Tags       []string   `json:"tags"`         // 预设节点标签
+	Group      string     `json:"group"`        // 预设节点分组
+	MaxUses    int        `json:"max_uses"`     // 最大使用次数
+	Uses       int        `json:"uses"`         // 已使用次数
+	ExpiresAt  time.Time  `json:"expires_at"`   // 过期时间
+	CreatedBy  string     `json:"created_by"`   // 创建者用户名
+	CreatedAt  time.Time  `json:"created_at"`   // 创建时间
+	LastUsedAt *time.Time `json:"last_used_at"` // 最后使用时间
+	Revoked    bool       `json:"revoked"`      // 是否已吊销
+	RevokedAt  *time.Time `json:"revoked_at"`   // 吊销时间
+}
+
+// Usable 判断令牌当前是否仍可使用
+func (t *EnrollmentToken) Usable(now time.Time) bool {
+	return !t.Revoked && t.Uses < t.MaxUses && now.Before(t.ExpiresAt)
+}
+
+// 保存注册令牌
+func CreateEnrollmentToken(token *EnrollmentToken) error {
+	if token.ID == "" {
+		token.ID = generateID()
+	}
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+
+	_, err := db.Exec(`
+	INSERT INTO enrollment_tokens (
+		id, token_hash, prefix, node_name, tags, node_group, max_uses, uses, expires_at, created_by, created_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?, ?, ?)`,
+		token.ID, token.Hash, token.Prefix, token.NodeName, joinTags(token.Tags), token.Group,
+		token.MaxUses, token.ExpiresAt, token.CreatedBy, token.CreatedAt)
+
+	return err
+}
+
+// 获取所有注册令牌
+func GetEnrollmentTokens() ([]EnrollmentToken, error) {
+	rows, err := db.Query(`
+	SELECT id, token_hash, prefix, node_name, tags, node_group, max_uses, uses, expires_at,
+		created_by, created_at, last_used_at, revoked, revoked_at
+	FROM enrollment_tokens ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []EnrollmentToken
+	for rows.Next() {
+		token, err := scanEnrollmentToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// 使用注册令牌，成功时占用一次使用次数并返回令牌，
+// 使用次数在同一条语句中检查和递增，并发注册不会超过上限
+func UseEnrollmentToken(hash string) (*EnrollmentToken, error) {
+	now := time.Now()
+	result, err := db.Exec(`
+	UPDATE enrollment_tokens SET uses = uses + 1, last_used_at = ?
+	WHERE token_hash = ? AND revoked = 0 AND uses < max_uses AND expires_at > ?`,
+		now, hash, now)
+	if err != nil {
+		return nil, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, fmt.Errorf("注册令牌无效、已过期或已用完")
+	}
+
+	row := db.QueryRow(`
+	SELECT id, token_hash, prefix, node_name, tags, node_group, max_uses, uses, expires_at,
+		created_by, created_at, last_used_at, revoked, revoked_at
+	FROM enrollment_tokens WHERE token_hash = ?`, hash)
+	return scanEnrollmentToken(row)
+}
+
+// 归还一次使用次数，用于令牌已占用但节点创建失败的情况
+func ReleaseEnrollmentToken(id string) error {
+	_, err := db.Exec("UPDATE enrollment_tokens SET uses = uses - 1 WHERE id = ? AND uses > 0", id)
+	return err
+}
+
+// 吊销注册令牌
+func RevokeEnrollmentToken(id string) error {
+	result, err := db.Exec("UPDATE enrollment_tokens SET revoked = 1, revoked_at = ? WHERE id = ? AND revoked = 0",
+		time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("注册令牌不存在或已吊销: %s", id)
+	}
+	return nil
+}
+
+// 扫描一行注册令牌记录
+func scanEnrollmentToken(row interface{ Scan(...interface{}) error }) (*EnrollmentToken, error) {
+	var token EnrollmentToken
+	var nodeName, tags, group, createdBy sql.NullString
+	var lastUsedAt, revokedAt sql.NullTime
+
+	err := row.Scan(&token.ID, &token.Hash, &token.Prefix, &nodeName, &tags, &group,
+		&token.MaxUses, &token.Uses, &token.ExpiresAt, &createdBy, &token.CreatedAt,
+		&lastUsedAt, &token.Revoked, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	token.NodeName = nodeName.String
+	token.Tags = splitTags(tags.String)
+	token.Group = group.String
+	token.CreatedBy = createdBy.String
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return &token, nil
+}
@@ -0,0 +1,283 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MeshRunStatus 表示全网格测速的状态
+type MeshRunStatus string
+
+const (
+	MeshRunStatusRunning   MeshRunStatus = "running"   // 运行中
+	MeshRunStatusCompleted MeshRunStatus = "completed" // 已完成
+	MeshRunStatusCancelled MeshRunStatus = "cancelled" // 已取消
+)
+
+// MeshRun 表示一次全网格测速：对选定节点中的每个有序节点对各测试一次，
+// 测试按轮次下发，同一轮中每个节点最多参与一个测试
+type MeshRun struct {
+	ID          string        `json:"id"`
+	Name        string        `json:"name"`
+	NodeIDs     []string      `json:"node_ids"`
+	Type        SpeedTestType `json:"type"`
+	Timeout     int           `json:"timeout"`
+	Threads     int           `json:"threads"`
+	Size        int           `json:"size"`
+	Status      MeshRunStatus `json:"status"`
+	Round       int           `json:"round"`        // 当前轮次（从1开始），尚未下发时为0
+	TotalRounds int           `json:"total_rounds"` // 总轮次
+	CreatedBy   string        `json:"created_by"`
+	CreatedAt   time.Time     `json:"created_at"`
+	FinishedAt  time.Time     `json:"finished_at"`
+}
+
+// MeshCell 矩阵中一个有序节点对的最新测速数据，没有对应数据的指标为nil
+type MeshCell struct {
+	Ping          *float64        `json:"ping"`
+	Jitter        *float64        `json:"jitter"`
+	PacketLoss    *float64        `json:"packet_loss"`
+	DownloadSpeed *float64        `json:"download_speed"`
+	UploadSpeed   *float64        `json:"upload_speed"`
+	Status        SpeedTestStatus `json:"status"`        // 最近一次测试的状态
+	Error         string          `json:"error_message"` // 最近一次测试失败的原因
+	TestedAt      time.Time       `json:"tested_at"`     // 最近一次测试的时间
+}
+
+// MeshMatrix 节点之间的测速矩阵，Cells[i][j]为Nodes[i]到Nodes[j]的数据，没有测试过时为nil
+type MeshMatrix struct {
+	Nodes []MeshNode    `json:"nodes"`
+	Cells [][]*MeshCell `json:"cells"`
+	Since time.Time     `json:"since"`
+	RunID string        `json:"run_id,omitempty"`
+}
+
+// MeshNode 矩阵中的节点
+type MeshNode struct {
+	ID     string     `json:"id"`
+	Name   string     `json:"name"`
+	Status NodeStatus `json:"status"`
+}
+
+// 保存全网格测速
+func SaveMeshRun(run *MeshRun) error {
+	if run.ID == "" {
+		run.ID = generateID()
+	}
+	if run.CreatedAt.IsZero() {
+		run.CreatedAt = time.Now()
+	}
+
+	_, err := db.Exec(`
+	INSERT OR REPLACE INTO mesh_runs (
+		id, name, node_ids, type, timeout, threads, size, status, round, total_rounds,
+		created_by, created_at, finished_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.ID, run.Name, joinTags(run.NodeIDs), run.Type, run.Timeout, run.Threads, run.Size,
+		run.Status, run.Round, run.TotalRounds, run.CreatedBy, run.CreatedAt, run.FinishedAt)
+
+	return err
+}
+
+// 获取全网格测速
+func GetMeshRun(id string) (*MeshRun, error) {
+	rows, err := db.Query(meshRunSelect+" WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs, err := scanMeshRuns(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("全网格测速不存在: %s", id)
+	}
+	return &runs[0], nil
+}
+
+// 获取最近的全网格测速
+func GetMeshRuns(limit int) ([]MeshRun, error) {
+	rows, err := db.Query(meshRunSelect+" ORDER BY created_at DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanMeshRuns(rows)
+}
+
+// 获取运行中的全网格测速
+func GetRunningMeshRuns() ([]MeshRun, error) {
+	rows, err := db.Query(meshRunSelect+" WHERE status = ? ORDER BY created_at", MeshRunStatusRunning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanMeshRuns(rows)
+}
+
+const meshRunSelect = `
+	SELECT id, name, node_ids, type, timeout, threads, size, status, round, total_rounds,
+		created_by, created_at, finished_at
+	FROM mesh_runs`
+
+func scanMeshRuns(rows *sql.Rows) ([]MeshRun, error) {
+	var runs []MeshRun
+	for rows.Next() {
+		var run MeshRun
+		var nodeIDs, createdBy sql.NullString
+		var finishedAt sql.NullTime
+
+		err := rows.Scan(&run.ID, &run.Name, &nodeIDs, &run.Type, &run.Timeout, &run.Threads, &run.Size,
+			&run.Status, &run.Round, &run.TotalRounds, &createdBy, &run.CreatedAt, &finishedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		run.NodeIDs = splitTags(nodeIDs.String)
+		run.CreatedBy = createdBy.String
+		run.FinishedAt = finishedAt.Time
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// 统计全网格测速中各状态的测试数量
+func CountMeshRunTests(runID string) (map[SpeedTestStatus]int, error) {
+	rows, err := db.Query("SELECT status, COUNT(*) FROM speedtest_results WHERE mesh_run_id = ? GROUP BY status", runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[SpeedTestStatus]int)
+	for rows.Next() {
+		var status SpeedTestStatus
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+	return counts, rows.Err()
+}
+
+// 取消全网格测速中尚未下发的测试，返回取消的数量
+func CancelPendingMeshTests(runID string) (int64, error) {
+	result, err := db.Exec(`
+	UPDATE speedtest_results SET status = ?, error_message = ?, end_time = ?
+	WHERE mesh_run_id = ? AND status = ?`,
+		SpeedTestStatusCancelled, "全网格测速已取消", time.Now().UTC(), runID, SpeedTestStatusPending)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// 生成节点之间的测速矩阵。指定runID时只使用该次全网格测速的结果，
+// 否则使用since之后的所有测试；每个指标取提供该指标的最近一次成功测试
+func GetMeshMatrix(nodeIDs []string, runID string, since time.Time) (*MeshMatrix, error) {
+	matrix := &MeshMatrix{Since: since, RunID: runID, Nodes: []MeshNode{}, Cells: [][]*MeshCell{}}
+	if len(nodeIDs) == 0 {
+		return matrix, nil
+	}
+
+	index := make(map[string]int, len(nodeIDs))
+	for _, id := range nodeIDs {
+		node, err := GetNode(id)
+		if err != nil {
+			// 已删除的节点不显示
+			continue
+		}
+		index[id] = len(matrix.Nodes)
+		matrix.Nodes = append(matrix.Nodes, MeshNode{ID: node.ID, Name: node.Name, Status: node.Status})
+	}
+	for range matrix.Nodes {
+		matrix.Cells = append(matrix.Cells, make([]*MeshCell, len(matrix.Nodes)))
+	}
+	if len(matrix.Nodes) == 0 {
+		return matrix, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(matrix.Nodes)), ",")
+	args := make([]interface{}, 0, 2*len(matrix.Nodes)+2)
+	for _, node := range matrix.Nodes {
+		args = append(args, node.ID)
+	}
+	for _, node := range matrix.Nodes {
+		args = append(args, node.ID)
+	}
+
+	query := `
+	SELECT source_node_id, target_node_id, type, status, start_time, end_time,
+		download_speed, upload_speed, ping, jitter, packet_loss, error_message
+	FROM speedtest_results
+	WHERE source_node_id IN (` + placeholders + `) AND target_node_id IN (` + placeholders + `)`
+	if runID != "" {
+		query += " AND mesh_run_id = ?"
+		args = append(args, runID)
+	} else {
+		query += " AND start_time >= ?"
+		args = append(args, since.UTC())
+	}
+	query += " ORDER BY start_time DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r SpeedTestResult
+		var errorMessage sql.NullString
+		err := rows.Scan(&r.SourceNodeID, &r.TargetNodeID, &r.Type, &r.Status, &r.StartTime, &r.EndTime,
+			&r.DownloadSpeed, &r.UploadSpeed, &r.Ping, &r.Jitter, &r.PacketLoss, &errorMessage)
+		if err != nil {
+			return nil, err
+		}
+		r.ErrorMessage = errorMessage.String
+
+		i, ok1 := index[r.SourceNodeID]
+		j, ok2 := index[r.TargetNodeID]
+		if !ok1 || !ok2 {
+			continue
+		}
+
+		cell := matrix.Cells[i][j]
+		if cell == nil {
+			// 结果按时间倒序，第一条即为最近一次测试
+			cell = &MeshCell{Status: r.Status, Error: r.ErrorMessage, TestedAt: r.StartTime}
+			matrix.Cells[i][j] = cell
+		}
+		if r.Status == SpeedTestStatusCompleted {
+			cell.fill(&r)
+		}
+	}
+	return matrix, rows.Err()
+}
+
+// 用一次成功测试补充单元格中尚未取得的指标
+func (c *MeshCell) fill(r *SpeedTestResult) {
+	fields := map[string]**float64{
+		MetricPing:          &c.Ping,
+		MetricJitter:        &c.Jitter,
+		MetricPacketLoss:    &c.PacketLoss,
+		MetricDownloadSpeed: &c.DownloadSpeed,
+		MetricUploadSpeed:   &c.UploadSpeed,
+	}
+	for metric, field := range fields {
+		if value, ok := r.Metric(metric); ok && *field == nil {
+			*field = &value
+		}
+	}
+}
@@ -11,6 +11,8 @@ const (
 	NodeStatusOnline  NodeStatus = "online"  // 在线
 	NodeStatusOffline NodeStatus = "offline" // 离线
 	NodeStatusError   NodeStatus = "error"   // 错误
+
+	NodeStatusMaintenance NodeStatus = "maintenance" // 维护中（节点主动关闭）
 )
 
 // Node 表示一个节点
@@ -24,6 +26,7 @@ type Node struct {
 	CreatedAt   time.Time  `json:"created_at"`   // 创建时间
 	Description string     `json:"description"`  // 节点描述
 	Tags        []string   `json:"tags"`         // 节点标签
+	Group       string     `json:"group"`        // 节点分组
 	
 	// 系统信息
 	CPU         float64    `json:"cpu"`          // CPU使用率
@@ -38,9 +41,13 @@ type Node struct {
 	
 	// 版本信息
 	Version     string     `json:"version"`      // 节点客户端版本
-	
-	// 安全信息
-	SecretKey   string     `json:"-"`           // 节点密钥（不输出到JSON）
+	UpdateStatus string    `json:"update_status"` // 最近一次自动更新的状态
+
+	// 节点监听端口，其他节点对其测速时使用
+	ListenPort string `json:"listen_port"`
+
+	// 节点时钟与面板时钟的偏差（秒），节点时钟较快时为正
+	ClockSkew float64 `json:"clock_skew"`
 }
 
 // NodeList 表示节点列表
@@ -60,6 +67,31 @@ type NodeHeartbeat struct {
 	Load      [3]float64 `json:"load"`       // 系统负载
 	NetworkRx int64      `json:"network_rx"` // 网络接收
 	NetworkTx int64      `json:"network_tx"` // 网络发送
+
+	// 更新信息
+	Version       string `json:"version"`        // 节点当前版本
+	UpdateStatus  string `json:"update_status"`  // 最近一次自动更新的状态
+	FailedVersion string `json:"failed_version"` // 更新失败并已回滚的版本
+
+	// 节点监听端口，作为测速目标时使用
+	ListenPort string `json:"listen_port"`
+
+	// 时钟偏差（秒），由面板根据节点上报的时间计算
+	ClockSkew float64 `json:"-"`
+
+	// 节点服务正在运行，可以领取面板下发的测试
+	AcceptTests bool `json:"accept_tests"`
+
+	// 节点即将关闭（重启或升级），面板将其标记为维护中
+	Shutdown bool `json:"shutdown"`
+}
+
+// NodeStatus 返回心跳对应的节点状态
+func (h *NodeHeartbeat) NodeStatus() NodeStatus {
+	if h.Shutdown {
+		return NodeStatusMaintenance
+	}
+	return NodeStatusOnline
 }
 
 // NodeRegisterRequest 表示节点注册请求
@@ -69,11 +101,12 @@ type NodeRegisterRequest struct {
 	Location    string   `json:"location"`    // 地理位置
 	Description string   `json:"description"` // 描述
 	Tags        []string `json:"tags"`        // 标签
+	Group       string   `json:"group"`       // 分组
 	Version     string   `json:"version"`     // 版本
 }
 
 // NodeRegisterResponse 表示节点注册响应
 type NodeRegisterResponse struct {
 	ID        string `json:"id"`        // 分配的节点ID
-	SecretKey string `json:"secretKey"` // 用于认证的密钥
+	SecretKey string `json:"secretKey"` // 用于认证的密钥，只在创建时返回一次
 } 
\ No newline at end of file
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// NodeKey 表示节点的认证密钥，面板只保存用于查找的哈希和使用主密钥加密的签名密钥
+type NodeKey struct {
+	ID         string     `json:"id"`           // 密钥ID
+	NodeID     string     `json:"node_id"`      // 节点ID
+	Hash       string     `json:"-"`            // 密钥哈希（不输出到JSON）
+	Secret     string     `json:"-"`            // 加密后的签名密钥（不输出到JSON）
+	Prefix     string     `json:"prefix"`       // 密钥前缀，用于区分多个密钥
+	CreatedAt  time.Time  `json:"created_at"`   // 创建时间
+	LastUsedAt *time.Time `json:"last_used_at"` // 最后使用时间
+	ExpiresAt  *time.Time `json:"expires_at"`   // 过期时间，轮换后旧密钥在宽限期结束时失效
+	Revoked    bool       `json:"revoked"`      // 是否已吊销
+	RevokedAt  *time.Time `json:"revoked_at"`   // 吊销时间
+}
+
+// Active 判断密钥当前是否有效
+func (k *NodeKey) Active(now time.Time) bool {
+	if k.Revoked {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+// 保存节点密钥
+func CreateNodeKey(key *NodeKey) error {
+	if key.ID == "" {
+		key.ID = generateID()
+	}
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+
+	_, err := db.Exec(`
+	INSERT INTO node_keys (id, node_id, key_hash, key_secret, prefix, created_at, expires_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		key.ID, key.NodeID, key.Hash, key.Secret, key.Prefix, key.CreatedAt, key.ExpiresAt)
+
+	return err
+}
+
+// 获取节点的所有密钥，包括已失效的密钥
+func GetNodeKeys(nodeID string) ([]NodeKey, error) {
+	rows, err := db.Query(`
+	SELECT id, node_id, key_hash, key_secret, prefix, created_at, last_used_at, expires_at, revoked, revoked_at
+	FROM node_keys WHERE node_id = ? ORDER BY created_at DESC`, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []NodeKey
+	for rows.Next() {
+		key, err := scanNodeKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// 获取节点当前有效的密钥
+func GetActiveNodeKeys(nodeID string) ([]NodeKey, error) {
+	keys, err := GetNodeKeys(nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	active := make([]NodeKey, 0, len(keys))
+	for _, key := range keys {
+		if key.Active(now) {
+			active = append(active, key)
+		}
+	}
+	return active, nil
+}
+
+// 根据密钥哈希查找有效密钥
+func GetActiveNodeKeyByHash(hash string) (*NodeKey, error) {
+	row := db.QueryRow(`
+	SELECT id, node_id, key_hash, key_secret, prefix, created_at, last_used_at, expires_at, revoked, revoked_at
+	FROM node_keys WHERE key_hash = ?`, hash)
+
+	key, err := scanNodeKey(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("无效的节点密钥")
+		}
+		return nil, err
+	}
+	if !key.Active(time.Now()) {
+		return nil, fmt.Errorf("节点密钥已失效")
+	}
+	return key, nil
+}
+
+// 记录密钥最后使用时间
+func TouchNodeKey(id string) error {
+	_, err := db.Exec("UPDATE node_keys SET last_used_at = ? WHERE id = ?", time.Now(), id)
+	return err
+}
+
+// 设置节点其他有效密钥的过期时间，用于轮换时保留旧密钥一段宽限期
+func ExpireOtherNodeKeys(nodeID, keepID string, expiresAt time.Time) error {
+	_, err := db.Exec(`
+	UPDATE node_keys SET expires_at = ?
+	WHERE node_id = ? AND id != ? AND revoked = 0 AND (expires_at IS NULL OR expires_at > ?)`,
+		expiresAt, nodeID, keepID, expiresAt)
+	return err
+}
+
+// 吊销节点的指定密钥
+func RevokeNodeKey(nodeID, id string) error {
+	result, err := db.Exec("UPDATE node_keys SET revoked = 1, revoked_at = ? WHERE node_id = ? AND id = ? AND revoked = 0",
+		time.Now(), nodeID, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("密钥不存在或已吊销: %s", id)
+	}
+	return nil
+}
+
+// 删除节点的所有密钥
+func DeleteNodeKeys(nodeID string) error {
+	_, err := db.Exec("DELETE FROM node_keys WHERE node_id = ?", nodeID)
+	return err
+}
+
+// 扫描一行密钥记录
+func scanNodeKey(row interface{ Scan(...interface{}) error }) (*NodeKey, error) {
+	var key NodeKey
+	var lastUsedAt, expiresAt, revokedAt sql.NullTime
+
+	err := row.Scan(&key.ID, &key.NodeID, &key.Hash, &key.Secret, &key.Prefix, &key.CreatedAt,
+		&lastUsedAt, &expiresAt, &key.Revoked, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return &key, nil
+}
@@ -0,0 +1,239 @@
+package models
+
+import (
+	"time"
+)
+
+// NodeStatusChange 节点状态变更记录
+type NodeStatusChange struct {
+	ID             int64      `json:"id"`
+	NodeID         string     `json:"node_id"`
+	PreviousStatus NodeStatus `json:"previous_status"` // 变更前的状态
+	Status         NodeStatus `json:"status"`          // 变更后的状态
+	Reason         string     `json:"reason"`          // 变更原因
+	ChangedAt      time.Time  `json:"changed_at"`      // 变更时间
+}
+
+// NodeAvailability 节点在统计窗口内的可用情况
+type NodeAvailability struct {
+	NodeID string `json:"node_id"`
+	// 在线时长占比（百分比），维护时间不计入统计，窗口内全部处于维护时为nil
+	UptimePercent *float64 `json:"uptime_percent"`
+	Online        int64    `json:"online_seconds"`      // 在线时长（秒）
+	Offline       int64    `json:"offline_seconds"`     // 离线或错误时长（秒）
+	Maintenance   int64    `json:"maintenance_seconds"` // 维护时长（秒）
+	Transitions   int      `json:"transitions"`         // 窗口内的状态变更次数
+}
+
+// 记录节点状态变更
+func RecordNodeStatusChange(nodeID string, previous, status NodeStatus, reason string, at time.Time) error {
+	_, err := db.Exec(`
+	INSERT INTO node_status_history (node_id, previous_status, status, reason, changed_at)
+	VALUES (?, ?, ?, ?, ?)`,
+		nodeID, previous, status, reason, at)
+	return err
+}
+
+// 获取节点在指定时间之后的状态变更记录，按时间先后排序
+func GetNodeStatusHistory(nodeID string, since time.Time) ([]NodeStatusChange, error) {
+	rows, err := db.Query(`
+	SELECT id, node_id, previous_status, status, reason, changed_at
+	FROM node_status_history WHERE node_id = ? AND changed_at >= ?
+	ORDER BY changed_at, id`, nodeID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanNodeStatusChanges(rows)
+}
+
+// 获取所有节点在指定时间之后的状态变更记录，按节点分组
+func getAllNodeStatusHistory(since time.Time) (map[string][]NodeStatusChange, error) {
+	rows, err := db.Query(`
+	SELECT id, node_id, previous_status, status, reason, changed_at
+	FROM node_status_history WHERE changed_at >= ?
+	ORDER BY changed_at, id`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes, err := scanNodeStatusChanges(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make(map[string][]NodeStatusChange)
+	for _, change := range changes {
+		history[change.NodeID] = append(history[change.NodeID], change)
+	}
+	return history, nil
+}
+
+func scanNodeStatusChanges(rows interface {
+	Next() bool
+	Scan(...interface{}) error
+	Err() error
+}) ([]NodeStatusChange, error) {
+	var changes []NodeStatusChange
+	for rows.Next() {
+		var change NodeStatusChange
+		var reason *string
+		if err := rows.Scan(&change.ID, &change.NodeID, &change.PreviousStatus, &change.Status, &reason, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		if reason != nil {
+			change.Reason = *reason
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// 将超过截止时间未发送心跳的在线节点标记为离线，返回被标记的节点
+func MarkStaleNodesOffline(cutoff time.Time, reason string) ([]Node, error) {
+	nodes, err := GetAllNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var stale []Node
+	for _, node := range nodes {
+		// 维护中的节点是主动关闭的，不视为故障
+		if node.Status != NodeStatusOnline && node.Status != NodeStatusError {
+			continue
+		}
+		if !node.LastSeen.Before(cutoff) {
+			continue
+		}
+
+		// 仅当状态未被并发的心跳更新时才标记离线
+		result, err := db.Exec("UPDATE nodes SET status = ? WHERE id = ? AND status = ? AND last_seen < ?",
+			NodeStatusOffline, node.ID, node.Status, cutoff)
+		if err != nil {
+			return stale, err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			continue
+		}
+
+		if err := RecordNodeStatusChange(node.ID, node.Status, NodeStatusOffline, reason, now); err != nil {
+			return stale, err
+		}
+		node.Status = NodeStatusOffline
+		stale = append(stale, node)
+	}
+	return stale, nil
+}
+
+// 将涉及离线节点的等待中和运行中的测试标记为失败，返回更新的数量
+func FailTestsOnOfflineNodes(message string) (int64, error) {
+	const where = `
+	WHERE status IN (?, ?) AND (
+		source_node_id IN (SELECT id FROM nodes WHERE status = ?) OR
+		target_node_id IN (SELECT id FROM nodes WHERE status = ?))`
+	args := []interface{}{SpeedTestStatusPending, SpeedTestStatusRunning, NodeStatusOffline, NodeStatusOffline}
+
+	// 先记录开始时间，更新后标记需要重新汇总的时间段
+	rows, err := db.Query("SELECT DISTINCT start_time FROM speedtest_results"+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	var starts []time.Time
+	for rows.Next() {
+		var start time.Time
+		if err := rows.Scan(&start); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		starts = append(starts, start)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	result, err := db.Exec("UPDATE speedtest_results SET status = ?, error_message = ?, end_time = ?"+where,
+		append([]interface{}{SpeedTestStatusFailed, message, now.UTC()}, args...)...)
+	if err != nil {
+		return 0, err
+	}
+	for _, start := range starts {
+		if err := markRollupDirty(start, now); err != nil {
+			return 0, err
+		}
+	}
+	return result.RowsAffected()
+}
+
+// 计算节点在窗口内的可用情况
+func GetNodeAvailability(node *Node, since, now time.Time) (*NodeAvailability, error) {
+	history, err := GetNodeStatusHistory(node.ID, since)
+	if err != nil {
+		return nil, err
+	}
+	return computeAvailability(node, history, since, now), nil
+}
+
+// 计算所有节点在窗口内的可用情况，按节点ID索引
+func GetAllNodeAvailability(nodes []Node, since, now time.Time) (map[string]*NodeAvailability, error) {
+	history, err := getAllNodeStatusHistory(since)
+	if err != nil {
+		return nil, err
+	}
+
+	availability := make(map[string]*NodeAvailability, len(nodes))
+	for i := range nodes {
+		availability[nodes[i].ID] = computeAvailability(&nodes[i], history[nodes[i].ID], since, now)
+	}
+	return availability, nil
+}
+
+// 按状态变更记录累计各状态的时长，窗口起点的状态取第一条记录的变更前状态，
+// 窗口内没有变更时整个窗口都处于当前状态
+func computeAvailability(node *Node, history []NodeStatusChange, since, now time.Time) *NodeAvailability {
+	availability := &NodeAvailability{NodeID: node.ID, Transitions: len(history)}
+
+	start := since
+	if node.CreatedAt.After(start) {
+		start = node.CreatedAt
+	}
+	status := node.Status
+	if len(history) > 0 {
+		status = history[0].PreviousStatus
+	}
+
+	add := func(status NodeStatus, from, to time.Time) {
+		if !to.After(from) {
+			return
+		}
+		seconds := int64(to.Sub(from).Seconds())
+		switch status {
+		case NodeStatusOnline:
+			availability.Online += seconds
+		case NodeStatusMaintenance:
+			availability.Maintenance += seconds
+		default:
+			availability.Offline += seconds
+		}
+	}
+
+	at := start
+	for _, change := range history {
+		add(status, at, change.ChangedAt)
+		status = change.Status
+		if change.ChangedAt.After(at) {
+			at = change.ChangedAt
+		}
+	}
+	add(status, at, now)
+
+	if counted := availability.Online + availability.Offline; counted > 0 {
+		percent := float64(availability.Online) * 100 / float64(counted)
+		availability.UptimePercent = &percent
+	}
+	return availability
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeAvailability(t *testing.T) {
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := since.Add(10 * time.Hour)
+	at := func(hours float64) time.Time {
+		return since.Add(time.Duration(hours * float64(time.Hour)))
+	}
+	change := func(hours float64, previous, status NodeStatus) NodeStatusChange {
+		return NodeStatusChange{PreviousStatus: previous, Status: status, ChangedAt: at(hours)}
+	}
+	const hour = 3600
+
+	tests := []struct {
+		name        string
+		node        Node
+		history     []NodeStatusChange
+		online      int64
+		offline     int64
+		maintenance int64
+		uptime      float64 // 负数表示没有统计值
+	}{
+		{
+			"没有变更时整个窗口处于当前状态",
+			Node{Status: NodeStatusOnline}, nil,
+			10 * hour, 0, 0, 100,
+		},
+		{
+			"窗口起点的状态取第一条记录的变更前状态",
+			Node{Status: NodeStatusOnline},
+			[]NodeStatusChange{change(2, NodeStatusOffline, NodeStatusOnline)},
+			8 * hour, 2 * hour, 0, 80,
+		},
+		{
+			"错误状态计为离线",
+			Node{Status: NodeStatusOnline},
+			[]NodeStatusChange{
+				change(5, NodeStatusOnline, NodeStatusError),
+				change(6, NodeStatusError, NodeStatusOnline),
+			},
+			9 * hour, 1 * hour, 0, 90,
+		},
+		{
+			"维护时间不计入在线率",
+			Node{Status: NodeStatusOnline},
+			[]NodeStatusChange{
+				change(4, NodeStatusOnline, NodeStatusMaintenance),
+				change(9, NodeStatusMaintenance, NodeStatusOffline),
+			},
+			4 * hour, 1 * hour, 5 * hour, 80,
+		},
+		{
+			"全部处于维护时没有在线率",
+			Node{Status: NodeStatusMaintenance}, nil,
+			0, 0, 10 * hour, -1,
+		},
+		{
+			"窗口内创建的节点从创建时间开始统计",
+			Node{Status: NodeStatusOnline, CreatedAt: at(6)}, nil,
+			4 * hour, 0, 0, 100,
+		},
+	}
+	for _, tt := range tests {
+		got := computeAvailability(&tt.node, tt.history, since, now)
+		if got.Online != tt.online || got.Offline != tt.offline || got.Maintenance != tt.maintenance {
+			t.Errorf("%s: online=%d offline=%d maintenance=%d, want %d %d %d",
+				tt.name, got.Online, got.Offline, got.Maintenance, tt.online, tt.offline, tt.maintenance)
+		}
+		if got.Transitions != len(tt.history) {
+			t.Errorf("%s: transitions=%d, want %d", tt.name, got.Transitions, len(tt.history))
+		}
+		switch {
+		case tt.uptime < 0 && got.UptimePercent != nil:
+			t.Errorf("%s: uptime=%v, want nil", tt.name, *got.UptimePercent)
+		case tt.uptime >= 0 && (got.UptimePercent == nil || *got.UptimePercent != tt.uptime):
+			t.Errorf("%s: uptime=%v, want %v", tt.name, got.UptimePercent, tt.uptime)
+		}
+	}
+}
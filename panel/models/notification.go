@@ -0,0 +1,137 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// NotificationChannel 通知渠道，告警触发和恢复时按渠道类型发送通知
+type NotificationChannel struct {
+	ID           string          `json:"id"`
+	Name         string          `json:"name"`
+	Type         string          `json:"type"` // 渠道类型：webhook、email、telegram、dingtalk、feishu、wecom、slack
+	Enabled      bool            `json:"enabled"`
+	Config       json.RawMessage `json:"config"`        // 渠道类型对应的配置
+	MinSeverity  string          `json:"min_severity"`  // 只发送不低于该严重程度的告警
+	SendResolved bool            `json:"send_resolved"` // 告警恢复时是否发送通知
+	RateLimit    int             `json:"rate_limit"`    // 每分钟最多发送的通知数，0表示不限制
+
+	LastSentAt time.Time `json:"last_sent_at"` // 最近一次发送成功的时间
+	LastError  string    `json:"last_error"`   // 最近一次发送失败的原因，发送成功后清空
+
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// 保存通知渠道
+func SaveNotificationChannel(channel *NotificationChannel) error {
+	if channel.ID == "" {
+		channel.ID = generateID()
+	}
+	if channel.CreatedAt.IsZero() {
+		channel.CreatedAt = time.Now()
+	}
+	channel.UpdatedAt = time.Now()
+
+	_, err := db.Exec(`
+	INSERT OR REPLACE INTO notification_channels (
+		id, name, type, enabled, config, min_severity, send_resolved, rate_limit,
+		last_sent_at, last_error, created_by, created_at, updated_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		channel.ID, channel.Name, channel.Type, channel.Enabled, string(channel.Config), channel.MinSeverity,
+		channel.SendResolved, channel.RateLimit, channel.LastSentAt, channel.LastError,
+		channel.CreatedBy, channel.CreatedAt, channel.UpdatedAt)
+
+	return err
+}
+
+// 获取通知渠道
+func GetNotificationChannel(id string) (*NotificationChannel, error) {
+	rows, err := db.Query(notificationChannelSelect+" WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels, err := scanNotificationChannels(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("通知渠道不存在: %s", id)
+	}
+	return &channels[0], nil
+}
+
+// 获取所有通知渠道
+func GetNotificationChannels() ([]NotificationChannel, error) {
+	rows, err := db.Query(notificationChannelSelect + " ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanNotificationChannels(rows)
+}
+
+// 删除通知渠道
+func DeleteNotificationChannel(id string) error {
+	result, err := db.Exec("DELETE FROM notification_channels WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("通知渠道不存在: %s", id)
+	}
+	return nil
+}
+
+// 记录通知渠道的发送结果，sendErr为空表示发送成功
+func UpdateNotificationDelivery(id string, sendErr error) error {
+	if sendErr != nil {
+		_, err := db.Exec("UPDATE notification_channels SET last_error = ? WHERE id = ?", sendErr.Error(), id)
+		return err
+	}
+	_, err := db.Exec("UPDATE notification_channels SET last_sent_at = ?, last_error = '' WHERE id = ?", time.Now(), id)
+	return err
+}
+
+const notificationChannelSelect = `
+	SELECT id, name, type, enabled, config, min_severity, send_resolved, rate_limit,
+		last_sent_at, last_error, created_by, created_at, updated_at
+	FROM notification_channels`
+
+func scanNotificationChannels(rows *sql.Rows) ([]NotificationChannel, error) {
+	var channels []NotificationChannel
+	for rows.Next() {
+		var channel NotificationChannel
+		var config, minSeverity, lastError, createdBy sql.NullString
+		var lastSentAt sql.NullTime
+
+		err := rows.Scan(&channel.ID, &channel.Name, &channel.Type, &channel.Enabled, &config, &minSeverity,
+			&channel.SendResolved, &channel.RateLimit, &lastSentAt, &lastError,
+			&createdBy, &channel.CreatedAt, &channel.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		channel.Config = json.RawMessage(config.String)
+		if len(channel.Config) == 0 {
+			channel.Config = json.RawMessage("{}")
+		}
+		channel.MinSeverity = minSeverity.String
+		channel.LastSentAt = lastSentAt.Time
+		channel.LastError = lastError.String
+		channel.CreatedBy = createdBy.String
+		channels = append(channels, channel)
+	}
+	return channels, rows.Err()
+}
@@ -0,0 +1,343 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MetricRange 指标的取值范围，Min和Max为nil时不限制
+type MetricRange struct {
+	Metric string
+	Min    *float64
+	Max    *float64
+}
+
+// ResultQuery 测速结果的查询条件、排序和分页
+type ResultQuery struct {
+	NodeID       string // 源节点或目标节点
+	SourceNodeID string
+	TargetNodeID string
+	Type         SpeedTestType
+	Statuses     []SpeedTestStatus
+	From         time.Time // 开始时间不早于From
+	To           time.Time // 开始时间早于To
+	Tag          string    // 源节点或目标节点带有该标签
+	Ranges       []MetricRange
+
+	Sort   string // 排序字段：start_time（默认）、duration或指标名
+	Asc    bool   // 默认按降序排列
+	Cursor string // 上一页返回的游标，为空时从第一条开始
+	Offset int    // 按偏移量分页，不能与Cursor同时使用
+	Limit  int
+}
+
+// 可排序的非指标字段
+var resultSortColumns = map[string]bool{
+	"start_time": true,
+	"duration":   true,
+}
+
+// 分页游标：上一页最后一条记录的排序字段值和ID
+type resultCursor struct {
+	Value json.RawMessage `json:"v"`
+	ID    string          `json:"id"`
+}
+
+// Validate 校验排序字段和指标范围，并为未设置的排序字段填充默认值
+func (q *ResultQuery) Validate() error {
+	if q.Sort == "" {
+		q.Sort = "start_time"
+	}
+	if !resultSortColumns[q.Sort] && MetricTestTypes(q.Sort) == nil {
+		return fmt.Errorf("无效的排序字段: %s", q.Sort)
+	}
+	for _, r := range q.Ranges {
+		if MetricTestTypes(r.Metric) == nil {
+			return fmt.Errorf("无效的指标: %s", r.Metric)
+		}
+	}
+	if q.Cursor != "" {
+		if q.Offset > 0 {
+			return fmt.Errorf("游标和偏移量不能同时使用")
+		}
+		if _, _, err := q.decodeCursor(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 生成WHERE子句，不包含游标条件
+func (q *ResultQuery) where() (string, []interface{}) {
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+
+	if q.NodeID != "" {
+		conditions = append(conditions, "(source_node_id = ? OR target_node_id = ?)")
+		args = append(args, q.NodeID, q.NodeID)
+	}
+	if q.SourceNodeID != "" {
+		conditions = append(conditions, "source_node_id = ?")
+		args = append(args, q.SourceNodeID)
+	}
+	if q.TargetNodeID != "" {
+		conditions = append(conditions, "target_node_id = ?")
+		args = append(args, q.TargetNodeID)
+	}
+	if q.Type != "" {
+		conditions = append(conditions, "type = ?")
+		args = append(args, q.Type)
+	}
+	if len(q.Statuses) > 0 {
+		conditions = append(conditions, "status IN ("+placeholderList(len(q.Statuses))+")")
+		for _, status := range q.Statuses {
+			args = append(args, status)
+		}
+	}
+	if !q.From.IsZero() {
+		conditions = append(conditions, "start_time >= ?")
+		args = append(args, q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		conditions = append(conditions, "start_time < ?")
+		args = append(args, q.To.UTC())
+	}
+	if q.Tag != "" {
+		// 标签以逗号分隔保存，前后补逗号后按完整标签匹配
+		tagged := "SELECT id FROM nodes WHERE instr(',' || REPLACE(COALESCE(tags, ''), ' ', '') || ',', ?) > 0"
+		conditions = append(conditions, "(source_node_id IN ("+tagged+") OR target_node_id IN ("+tagged+"))")
+		tag := "," + strings.Replace(q.Tag, " ", "", -1) + ","
+		args = append(args, tag, tag)
+	}
+
+	// 按指标过滤或排序时只包含提供该指标的测试类型
+	metrics := []string{}
+	for _, r := range q.Ranges {
+		metrics = append(metrics, r.Metric)
+		if r.Min != nil {
+			conditions = append(conditions, r.Metric+" >= ?")
+			args = append(args, *r.Min)
+		}
+		if r.Max != nil {
+			conditions = append(conditions, r.Metric+" <= ?")
+			args = append(args, *r.Max)
+		}
+	}
+	if !resultSortColumns[q.Sort] {
+		metrics = append(metrics, q.Sort)
+	}
+	for _, metric := range metrics {
+		types := MetricTestTypes(metric)
+		conditions = append(conditions, "type IN (?, ?)")
+		args = append(args, types[0], types[1])
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// QuerySpeedTestResults 按条件查询测速结果，返回本页结果和下一页的游标，没有更多结果时游标为空
+func QuerySpeedTestResults(q ResultQuery) ([]SpeedTestResult, string, error) {
+	if err := q.Validate(); err != nil {
+		return nil, "", err
+	}
+	where, args := q.where()
+
+	direction, compare := "DESC", "<"
+	if q.Asc {
+		direction, compare = "ASC", ">"
+	}
+	if q.Cursor != "" {
+		cursor, value, err := q.decodeCursor()
+		if err != nil {
+			return nil, "", err
+		}
+		where += fmt.Sprintf(" AND (%s %s ? OR (%s = ? AND id %s ?))", q.Sort, compare, q.Sort, compare)
+		args = append(args, value, value, cursor.ID)
+	}
+
+	query := resultSelect + " WHERE " + where +
+		fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT ?", q.Sort, direction, direction)
+	// 多取一条判断是否还有下一页
+	args = append(args, q.Limit+1)
+	if q.Offset > 0 {
+		query += " OFFSET ?"
+		args = append(args, q.Offset)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	results := []SpeedTestResult{}
+	for rows.Next() {
+		var result SpeedTestResult
+		err := rows.Scan(
+			&result.ID, &result.SourceNodeID, &result.TargetNodeID, &result.Type, &result.Status,
+			&result.StartTime, &result.EndTime, &result.Duration, &result.DownloadSpeed,
+			&result.UploadSpeed, &result.Ping, &result.Jitter, &result.PacketLoss, &result.ErrorMessage,
+			&result.ScheduleID, &result.Timeout, &result.Threads, &result.Size, &result.MeshRunID)
+		if err != nil {
+			return nil, "", err
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(results) <= q.Limit {
+		return results, "", nil
+	}
+	results = results[:q.Limit]
+	next, err := q.encodeCursor(&results[len(results)-1])
+	return results, next, err
+}
+
+// CountSpeedTestResults 统计符合条件的测速结果数，忽略排序和分页
+func CountSpeedTestResults(q ResultQuery) (int, error) {
+	if err := q.Validate(); err != nil {
+		return 0, err
+	}
+	where, args := q.where()
+
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM speedtest_results WHERE "+where, args...).Scan(&count)
+	return count, err
+}
+
+const resultSelect = `
+	SELECT id, source_node_id, target_node_id, type, status, start_time, end_time,
+		duration, download_speed, upload_speed, ping, jitter, packet_loss, error_message,
+		COALESCE(schedule_id, ''), COALESCE(timeout, 0), COALESCE(threads, 0), COALESCE(size, 0),
+		COALESCE(mesh_run_id, '')
+	FROM speedtest_results`
+
+// 生成指向该结果之后的游标
+func (q *ResultQuery) encodeCursor(last *SpeedTestResult) (string, error) {
+	var value interface{}
+	switch q.Sort {
+	case "start_time":
+		value = last.StartTime
+	case "duration":
+		value = last.Duration
+	default:
+		value, _ = last.Metric(q.Sort)
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(resultCursor{Value: raw, ID: last.ID})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// 解析游标，返回游标和排序字段的值
+func (q *ResultQuery) decodeCursor() (*resultCursor, interface{}, error) {
+	invalid := fmt.Errorf("无效的游标，排序方式改变后需要从第一页重新查询")
+
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, nil, invalid
+	}
+	var cursor resultCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" {
+		return nil, nil, invalid
+	}
+
+	switch q.Sort {
+	case "start_time":
+		var t time.Time
+		if err := json.Unmarshal(cursor.Value, &t); err != nil {
+			return nil, nil, invalid
+		}
+		return &cursor, t.UTC(), nil
+	case "duration":
+		var n int64
+		if err := json.Unmarshal(cursor.Value, &n); err != nil {
+			return nil, nil, invalid
+		}
+		return &cursor, n, nil
+	default:
+		var f float64
+		if err := json.Unmarshal(cursor.Value, &f); err != nil {
+			return nil, nil, invalid
+		}
+		return &cursor, f, nil
+	}
+}
+
+// 生成n个以逗号分隔的占位符
+func placeholderList(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// GetLatestSpeedTestResults 获取每个节点对每种测试类型最近一次成功的测速结果
+func GetLatestSpeedTestResults() ([]SpeedTestResult, error) {
+	rows, err := db.Query(`
+		SELECT r.id, r.source_node_id, r.target_node_id, r.type, r.start_time, r.end_time,
+			r.download_speed, r.upload_speed, r.ping, r.jitter, r.packet_loss
+		FROM speedtest_results r
+		JOIN (
+			SELECT source_node_id, target_node_id, type, MAX(start_time) AS start_time
+			FROM speedtest_results
+			WHERE status = ?
+			GROUP BY source_node_id, target_node_id, type
+		) latest ON r.source_node_id = latest.source_node_id AND r.target_node_id = latest.target_node_id
+			AND r.type = latest.type AND r.start_time = latest.start_time
+		WHERE r.status = ?
+		ORDER BY r.start_time`,
+		SpeedTestStatusCompleted, SpeedTestStatusCompleted,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SpeedTestResult
+	for rows.Next() {
+		result := SpeedTestResult{Status: SpeedTestStatusCompleted}
+		err := rows.Scan(&result.ID, &result.SourceNodeID, &result.TargetNodeID, &result.Type,
+			&result.StartTime, &result.EndTime, &result.DownloadSpeed, &result.UploadSpeed,
+			&result.Ping, &result.Jitter, &result.PacketLoss)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// SpeedTestCount 按测试类型和状态统计的测试数量
+type SpeedTestCount struct {
+	Type   SpeedTestType
+	Status SpeedTestStatus
+	Count  int
+}
+
+// CountSpeedTestResultsByStatus 按测试类型和状态统计当前保存的测速结果数
+func CountSpeedTestResultsByStatus() ([]SpeedTestCount, error) {
+	rows, err := db.Query("SELECT type, status, COUNT(*) FROM speedtest_results GROUP BY type, status")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []SpeedTestCount
+	for rows.Next() {
+		var count SpeedTestCount
+		if err := rows.Scan(&count.Type, &count.Status, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
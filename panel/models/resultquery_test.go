@@ -0,0 +1,84 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestResultCursorRoundTrip(t *testing.T) {
+	start := time.Date(2026, 5, 1, 20, 30, 15, 123456789, time.FixedZone("UTC+8", 8*3600))
+	last := &SpeedTestResult{
+		ID:            "r1",
+		Type:          SpeedTestTypeFull,
+		StartTime:     start,
+		Duration:      1500,
+		DownloadSpeed: 93.25,
+		Ping:          12.5,
+	}
+
+	tests := []struct {
+		sort string
+		want interface{}
+	}{
+		// 时间统一转换为UTC，与数据库中保存的格式一致
+		{"start_time", start.UTC()},
+		{"duration", int64(1500)},
+		{MetricDownloadSpeed, 93.25},
+		{MetricPing, 12.5},
+	}
+	for _, tt := range tests {
+		q := &ResultQuery{Sort: tt.sort}
+		cursor, err := q.encodeCursor(last)
+		if err != nil {
+			t.Fatalf("%s: encodeCursor: %v", tt.sort, err)
+		}
+		q.Cursor = cursor
+		decoded, value, err := q.decodeCursor()
+		if err != nil {
+			t.Fatalf("%s: decodeCursor: %v", tt.sort, err)
+		}
+		if decoded.ID != "r1" {
+			t.Errorf("%s: id = %s, want r1", tt.sort, decoded.ID)
+		}
+		if got, ok := value.(time.Time); ok {
+			want := tt.want.(time.Time)
+			if !got.Equal(want) || got.Location() != time.UTC {
+				t.Errorf("%s: value = %v, want %v", tt.sort, got, want)
+			}
+			continue
+		}
+		if value != tt.want {
+			t.Errorf("%s: value = %#v, want %#v", tt.sort, value, tt.want)
+		}
+	}
+}
+
+func TestResultCursorInvalid(t *testing.T) {
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+	}{
+		{"不是base64", "start_time", "!!!"},
+		{"不是JSON", "start_time", encode("abc")},
+		{"缺少ID", "start_time", encode(`{"v":"2026-05-01T00:00:00Z"}`)},
+		{"排序方式改变后时间字段无效", "start_time", encode(`{"v":1500,"id":"r1"}`)},
+		{"排序方式改变后数值字段无效", "duration", encode(`{"v":"2026-05-01T00:00:00Z","id":"r1"}`)},
+		{"指标排序", MetricPing, encode(`{"v":"x","id":"r1"}`)},
+	}
+	for _, tt := range tests {
+		q := &ResultQuery{Sort: tt.sort, Cursor: tt.cursor}
+		if _, _, err := q.decodeCursor(); err == nil {
+			t.Errorf("%s: 应返回错误", tt.name)
+		}
+	}
+
+	q := &ResultQuery{Cursor: encode(`{"v":"2026-05-01T00:00:00Z","id":"r1"}`), Offset: 20}
+	if err := q.Validate(); err == nil {
+		t.Errorf("游标和偏移量同时使用时应返回错误")
+	}
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// RolloutAllGroups 适用于所有节点的发布记录，分组没有单独记录时使用
+const RolloutAllGroups = "*"
+
+// UpdateRollout 表示某个节点分组的目标版本，用于按分组分批升级节点
+type UpdateRollout struct {
+	Group     string    `json:"group"`      // 节点分组，"*" 表示所有节点
+	Version   string    `json:"version"`    // 目标版本
+	Paused    bool      `json:"paused"`     // 是否暂停发布
+	UpdatedAt time.Time `json:"updated_at"` // 更新时间
+}
+
+// 保存分组的发布记录
+func SaveUpdateRollout(rollout *UpdateRollout) error {
+	rollout.UpdatedAt = time.Now()
+
+	_, err := db.Exec(`
+	INSERT OR REPLACE INTO update_rollouts (group_name, version, paused, updated_at)
+	VALUES (?, ?, ?, ?)`,
+		rollout.Group, rollout.Version, rollout.Paused, rollout.UpdatedAt)
+
+	return err
+}
+
+// 获取所有发布记录
+func GetUpdateRollouts() ([]UpdateRollout, error) {
+	rows, err := db.Query("SELECT group_name, version, paused, updated_at FROM update_rollouts ORDER BY group_name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rollouts []UpdateRollout
+	for rows.Next() {
+		var rollout UpdateRollout
+		if err := rows.Scan(&rollout.Group, &rollout.Version, &rollout.Paused, &rollout.UpdatedAt); err != nil {
+			return nil, err
+		}
+		rollouts = append(rollouts, rollout)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rollouts, nil
+}
+
+// 获取节点分组适用的发布记录，分组没有单独记录时使用 "*" 记录，均不存在时返回nil
+func GetUpdateRolloutForGroup(group string) (*UpdateRollout, error) {
+	var rollout UpdateRollout
+	err := db.QueryRow(`
+	SELECT group_name, version, paused, updated_at FROM update_rollouts
+	WHERE group_name IN (?, ?)
+	ORDER BY CASE WHEN group_name = ? THEN 0 ELSE 1 END LIMIT 1`,
+		group, RolloutAllGroups, group).Scan(&rollout.Group, &rollout.Version, &rollout.Paused, &rollout.UpdatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &rollout, nil
+}
+
+// 删除分组的发布记录
+func DeleteUpdateRollout(group string) error {
+	result, err := db.Exec("DELETE FROM update_rollouts WHERE group_name = ?", group)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("发布记录不存在: %s", group)
+	}
+	return nil
+}
@@ -0,0 +1,355 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// RollupPeriod 汇总的时间粒度
+type RollupPeriod string
+
+const (
+	RollupHour RollupPeriod = "hour" // 按小时汇总
+	RollupDay  RollupPeriod = "day"  // 按天（面板本地时间）汇总
+)
+
+// Valid 判断是否为有效的时间粒度
+func (p RollupPeriod) Valid() bool {
+	return p == RollupHour || p == RollupDay
+}
+
+// Start 返回t所在时间段的开始时间
+func (p RollupPeriod) Start(t time.Time) time.Time {
+	if p == RollupDay {
+		t = t.Local()
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	}
+	return t.Truncate(time.Hour)
+}
+
+// Next 返回下一个时间段的开始时间
+func (p RollupPeriod) Next(start time.Time) time.Time {
+	if p == RollupDay {
+		return start.AddDate(0, 0, 1)
+	}
+	return start.Add(time.Hour)
+}
+
+func (p RollupPeriod) table() string {
+	if p == RollupDay {
+		return "speedtest_rollups_daily"
+	}
+	return "speedtest_rollups_hourly"
+}
+
+// Rollup 节点对某种测试类型的一个指标在一个时间段内的汇总
+type Rollup struct {
+	Bucket       time.Time     `json:"bucket"` // 时间段的开始时间
+	SourceNodeID string        `json:"source_node_id"`
+	TargetNodeID string        `json:"target_node_id"`
+	Type         SpeedTestType `json:"type"`
+	Metric       string        `json:"metric"`
+	Count        int           `json:"count"`  // 成功测试数
+	Failed       int           `json:"failed"` // 该类型失败或超时的测试数，同一时间段各指标相同
+	Min          float64       `json:"min"`
+	Avg          float64       `json:"avg"`
+	Max          float64       `json:"max"`
+	P50          float64       `json:"p50"`
+	P95          float64       `json:"p95"`
+	P99          float64       `json:"p99"`
+}
+
+// RollupFilter 汇总数据的查询条件
+type RollupFilter struct {
+	Period       RollupPeriod
+	NodeID       string // 源节点或目标节点
+	SourceNodeID string
+	TargetNodeID string
+	Type         SpeedTestType
+	Metric       string
+	From         time.Time
+	To           time.Time
+	Limit        int
+}
+
+// 获取开始时间在[from, to)内已结束的测试，用于计算汇总
+func GetRollupInputs(from, to time.Time) ([]SpeedTestResult, error) {
+	rows, err := db.Query(`
+	SELECT source_node_id, target_node_id, type, status, start_time,
+		download_speed, upload_speed, ping, jitter, packet_loss
+	FROM speedtest_results
+	WHERE start_time >= ? AND start_time < ? AND status IN (?, ?, ?)`,
+		from.UTC(), to.UTC(), SpeedTestStatusCompleted, SpeedTestStatusFailed, SpeedTestStatusTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SpeedTestResult
+	for rows.Next() {
+		var result SpeedTestResult
+		err := rows.Scan(&result.SourceNodeID, &result.TargetNodeID, &result.Type, &result.Status, &result.StartTime,
+			&result.DownloadSpeed, &result.UploadSpeed, &result.Ping, &result.Jitter, &result.PacketLoss)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// 判断该状态的测试是否计入汇总
+func rollupStatus(status SpeedTestStatus) bool {
+	return status == SpeedTestStatusCompleted || status == SpeedTestStatusFailed || status == SpeedTestStatusTimeout
+}
+
+// 测试在所在时间段结束后才结束时，标记该时间段需要重新汇总
+func markRollupDirty(start, now time.Time) error {
+	for _, period := range []RollupPeriod{RollupHour, RollupDay} {
+		bucket := period.Start(start)
+		if period.Next(bucket).After(now) {
+			continue
+		}
+		if err := MarkDirtyRollup(period, bucket); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 标记时间段需要重新汇总
+func MarkDirtyRollup(period RollupPeriod, bucket time.Time) error {
+	_, err := db.Exec("INSERT OR IGNORE INTO rollup_dirty (period, bucket) VALUES (?, ?)", period, bucket.Unix())
+	return err
+}
+
+// 获取需要重新汇总的时间段，按时间排序
+func GetDirtyRollups(period RollupPeriod) ([]time.Time, error) {
+	rows, err := db.Query("SELECT bucket FROM rollup_dirty WHERE period = ? ORDER BY bucket", period)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []time.Time
+	for rows.Next() {
+		var bucket int64
+		if err := rows.Scan(&bucket); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, period.Start(time.Unix(bucket, 0)))
+	}
+	return buckets, rows.Err()
+}
+
+// 清除时间段的重新汇总标记
+func ClearDirtyRollup(period RollupPeriod, bucket time.Time) error {
+	_, err := db.Exec("DELETE FROM rollup_dirty WHERE period = ? AND bucket = ?", period, bucket.Unix())
+	return err
+}
+
+// 替换一个时间段的全部汇总数据
+func ReplaceRollups(period RollupPeriod, bucket time.Time, rollups []Rollup) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM "+period.table()+" WHERE bucket = ?", bucket); err != nil {
+		return err
+	}
+	for _, r := range rollups {
+		_, err := tx.Exec(`
+		INSERT INTO `+period.table()+` (
+			bucket, source_node_id, target_node_id, type, metric, count, failed, min, avg, max, p50, p95, p99
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			bucket, r.SourceNodeID, r.TargetNodeID, r.Type, r.Metric, r.Count, r.Failed,
+			r.Min, r.Avg, r.Max, r.P50, r.P95, r.P99)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// 查询汇总数据，按时间段和节点对排序
+func GetRollups(filter RollupFilter) ([]Rollup, error) {
+	if !filter.Period.Valid() {
+		return nil, fmt.Errorf("无效的时间粒度: %s", filter.Period)
+	}
+
+	query := `
+	SELECT bucket, source_node_id, target_node_id, type, metric, count, failed, min, avg, max, p50, p95, p99
+	FROM ` + filter.Period.table() + " WHERE 1 = 1"
+	var args []interface{}
+	if filter.NodeID != "" {
+		query += " AND (source_node_id = ? OR target_node_id = ?)"
+		args = append(args, filter.NodeID, filter.NodeID)
+	}
+	if filter.SourceNodeID != "" {
+		query += " AND source_node_id = ?"
+		args = append(args, filter.SourceNodeID)
+	}
+	if filter.TargetNodeID != "" {
+		query += " AND target_node_id = ?"
+		args = append(args, filter.TargetNodeID)
+	}
+	if filter.Type != "" {
+		query += " AND type = ?"
+		args = append(args, filter.Type)
+	}
+	if filter.Metric != "" {
+		query += " AND metric = ?"
+		args = append(args, filter.Metric)
+	}
+	if !filter.From.IsZero() {
+		query += " AND bucket >= ?"
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		query += " AND bucket < ?"
+		args = append(args, filter.To)
+	}
+	query += " ORDER BY bucket, source_node_id, target_node_id, type, metric"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rollups := []Rollup{}
+	for rows.Next() {
+		var r Rollup
+		err := rows.Scan(&r.Bucket, &r.SourceNodeID, &r.TargetNodeID, &r.Type, &r.Metric, &r.Count, &r.Failed,
+			&r.Min, &r.Avg, &r.Max, &r.P50, &r.P95, &r.P99)
+		if err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, r)
+	}
+	return rollups, rows.Err()
+}
+
+// 删除时间段开始时间早于before的汇总数据
+func DeleteRollupsBefore(period RollupPeriod, before time.Time) (int64, error) {
+	result, err := db.Exec("DELETE FROM "+period.table()+" WHERE bucket < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// 获取最早的已结束测试的开始时间，没有测试时返回零值
+func GetOldestFinishedResultTime() (time.Time, error) {
+	var start time.Time
+	err := db.QueryRow(`
+	SELECT start_time FROM speedtest_results
+	WHERE status IN (?, ?, ?)
+	ORDER BY start_time LIMIT 1`,
+		SpeedTestStatusCompleted, SpeedTestStatusFailed, SpeedTestStatusTimeout).Scan(&start)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return start, err
+}
+
+// 分批删除开始时间早于before的已结束测试及其异常检测记录，返回删除的测试数。
+// 进行中的测试不删除
+func PruneSpeedTestResults(before time.Time, batchSize int) (int64, error) {
+	var total int64
+	for {
+		result, err := db.Exec(`
+		DELETE FROM speedtest_results WHERE rowid IN (
+			SELECT rowid FROM speedtest_results
+			WHERE start_time < ? AND status NOT IN (?, ?)
+			LIMIT ?
+		)`, before.UTC(), SpeedTestStatusPending, SpeedTestStatusRunning, batchSize)
+		if err != nil {
+			return total, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += affected
+		if affected < int64(batchSize) {
+			break
+		}
+	}
+
+	if _, err := db.Exec("DELETE FROM anomaly_scores WHERE start_time < ?", before.UTC()); err != nil {
+		return total, err
+	}
+	return total, nil
+}
+
+// 获取汇总已完成的位置，该时间之前的时间段都已汇总，没有汇总时返回零值
+func GetRollupWatermark(period RollupPeriod) time.Time {
+	value, err := GetSetting(fmt.Sprintf("rollup_%s_watermark", period))
+	if err != nil || value == "" {
+		return time.Time{}
+	}
+	watermark, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return watermark
+}
+
+// MetricSample 一次成功测试的指标值
+type MetricSample struct {
+	SourceNodeID string
+	TargetNodeID string
+	StartTime    time.Time
+	Value        float64
+}
+
+// 获取开始时间在[from, to)内提供该指标的成功测试的指标值，按开始时间排序
+func GetMetricSamples(nodeID, sourceNodeID, targetNodeID, metric string, from, to time.Time) ([]MetricSample, error) {
+	types := MetricTestTypes(metric)
+	if types == nil {
+		return nil, fmt.Errorf("无效的指标: %s", metric)
+	}
+
+	query := `
+	SELECT source_node_id, target_node_id, start_time, ` + metric + `
+	FROM speedtest_results
+	WHERE status = ? AND type IN (?, ?) AND start_time >= ? AND start_time < ?`
+	args := []interface{}{SpeedTestStatusCompleted, types[0], types[1], from.UTC(), to.UTC()}
+	if nodeID != "" {
+		query += " AND (source_node_id = ? OR target_node_id = ?)"
+		args = append(args, nodeID, nodeID)
+	}
+	if sourceNodeID != "" {
+		query += " AND source_node_id = ?"
+		args = append(args, sourceNodeID)
+	}
+	if targetNodeID != "" {
+		query += " AND target_node_id = ?"
+		args = append(args, targetNodeID)
+	}
+	query += " ORDER BY start_time"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []MetricSample
+	for rows.Next() {
+		var sample MetricSample
+		if err := rows.Scan(&sample.SourceNodeID, &sample.TargetNodeID, &sample.StartTime, &sample.Value); err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+	return samples, rows.Err()
+}
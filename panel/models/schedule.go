@@ -0,0 +1,175 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// BlackoutWindow 禁止执行定时测速的时间段，结束时间早于开始时间时表示跨越午夜
+type BlackoutWindow struct {
+	Start string `json:"start"`          // 开始时间，格式 HH:MM（面板本地时间）
+	End   string `json:"end"`            // 结束时间，格式 HH:MM
+	Days  []int  `json:"days,omitempty"` // 生效的星期（0表示周日），为空时每天生效
+}
+
+// Schedule 表示一个定时测速任务，每次触发时对所有源节点和目标节点的组合发起测试
+type Schedule struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Enabled  bool   `json:"enabled"`
+	Cron     string `json:"cron"`     // Cron表达式（分 时 日 月 周），与Interval二选一
+	Interval int    `json:"interval"` // 执行间隔（秒）
+
+	// 源节点和目标节点，按节点ID或标签选择，两者同时设置时取并集
+	SourceNodeIDs []string `json:"source_node_ids"`
+	SourceTag     string   `json:"source_tag"`
+	TargetNodeIDs []string `json:"target_node_ids"`
+	TargetTag     string   `json:"target_tag"`
+
+	// 测试参数
+	Type    SpeedTestType `json:"type"`
+	Timeout int           `json:"timeout"` // 超时时间（秒），为0时使用面板设置
+	Threads int           `json:"threads"` // 线程数，为0时使用节点默认值
+	Size    int           `json:"size"`    // 下载测速的数据量（MB），为0时使用节点默认值
+
+	Jitter    int              `json:"jitter"`    // 随机延迟上限（秒），避免多个任务同时触发
+	Blackouts []BlackoutWindow `json:"blackouts"` // 禁止执行的时间段
+
+	LastRunAt time.Time `json:"last_run_at"` // 最近一次触发时间
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// 保存定时测速任务
+func SaveSchedule(schedule *Schedule) error {
+	if schedule.ID == "" {
+		schedule.ID = generateID()
+	}
+	if schedule.CreatedAt.IsZero() {
+		schedule.CreatedAt = time.Now()
+	}
+	schedule.UpdatedAt = time.Now()
+
+	blackouts, err := json.Marshal(schedule.Blackouts)
+	if err != nil {
+		return fmt.Errorf("序列化禁止时段失败: %v", err)
+	}
+
+	_, err = db.Exec(`
+	INSERT OR REPLACE INTO schedules (
+		id, name, enabled, cron, interval_seconds, source_node_ids, source_tag, target_node_ids, target_tag,
+		type, timeout, threads, size, jitter, blackouts, last_run_at, created_by, created_at, updated_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		schedule.ID, schedule.Name, schedule.Enabled, schedule.Cron, schedule.Interval,
+		joinTags(schedule.SourceNodeIDs), schedule.SourceTag, joinTags(schedule.TargetNodeIDs), schedule.TargetTag,
+		schedule.Type, schedule.Timeout, schedule.Threads, schedule.Size, schedule.Jitter, string(blackouts),
+		schedule.LastRunAt, schedule.CreatedBy, schedule.CreatedAt, schedule.UpdatedAt)
+
+	return err
+}
+
+// 获取定时测速任务
+func GetSchedule(id string) (*Schedule, error) {
+	rows, err := db.Query(scheduleSelect+" WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules, err := scanSchedules(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(schedules) == 0 {
+		return nil, fmt.Errorf("定时任务不存在: %s", id)
+	}
+	return &schedules[0], nil
+}
+
+// 获取所有定时测速任务
+func GetSchedules() ([]Schedule, error) {
+	rows, err := db.Query(scheduleSelect + " ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSchedules(rows)
+}
+
+// 删除定时测速任务，已创建的测试保留
+func DeleteSchedule(id string) error {
+	result, err := db.Exec("DELETE FROM schedules WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("定时任务不存在: %s", id)
+	}
+	return nil
+}
+
+// 更新定时任务最近一次触发时间，不修改更新时间以免调度器重新计算计划
+func UpdateScheduleLastRun(id string, at time.Time) error {
+	_, err := db.Exec("UPDATE schedules SET last_run_at = ? WHERE id = ?", at, id)
+	return err
+}
+
+const scheduleSelect = `
+	SELECT id, name, enabled, cron, interval_seconds, source_node_ids, source_tag, target_node_ids, target_tag,
+		type, timeout, threads, size, jitter, blackouts, last_run_at, created_by, created_at, updated_at
+	FROM schedules`
+
+func scanSchedules(rows *sql.Rows) ([]Schedule, error) {
+	var schedules []Schedule
+	for rows.Next() {
+		var schedule Schedule
+		var cron, sourceIDs, sourceTag, targetIDs, targetTag, blackouts, createdBy sql.NullString
+		var interval, timeout, threads, size, jitter sql.NullInt64
+		var lastRunAt sql.NullTime
+
+		err := rows.Scan(
+			&schedule.ID, &schedule.Name, &schedule.Enabled, &cron, &interval, &sourceIDs, &sourceTag,
+			&targetIDs, &targetTag, &schedule.Type, &timeout, &threads, &size, &jitter, &blackouts,
+			&lastRunAt, &createdBy, &schedule.CreatedAt, &schedule.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		schedule.Cron = cron.String
+		schedule.Interval = int(interval.Int64)
+		schedule.SourceNodeIDs = splitTags(sourceIDs.String)
+		schedule.SourceTag = sourceTag.String
+		schedule.TargetNodeIDs = splitTags(targetIDs.String)
+		schedule.TargetTag = targetTag.String
+		schedule.Timeout = int(timeout.Int64)
+		schedule.Threads = int(threads.Int64)
+		schedule.Size = int(size.Int64)
+		schedule.Jitter = int(jitter.Int64)
+		schedule.LastRunAt = lastRunAt.Time
+		schedule.CreatedBy = createdBy.String
+		if blackouts.String != "" {
+			if err := json.Unmarshal([]byte(blackouts.String), &schedule.Blackouts); err != nil {
+				return nil, fmt.Errorf("解析定时任务 %s 的禁止时段失败: %v", schedule.ID, err)
+			}
+		}
+		if schedule.Blackouts == nil {
+			schedule.Blackouts = []BlackoutWindow{}
+		}
+
+		schedules = append(schedules, schedule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
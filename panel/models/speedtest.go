@@ -13,6 +13,7 @@ const (
 	SpeedTestStatusCompleted SpeedTestStatus = "completed" // 已完成
 	SpeedTestStatusFailed    SpeedTestStatus = "failed"    // 失败
 	SpeedTestStatusTimeout   SpeedTestStatus = "timeout"   // 超时
+	SpeedTestStatusCancelled SpeedTestStatus = "cancelled" // 节点关闭时取消
 )
 
 // SpeedTestType 表示测速类型枚举
@@ -45,6 +46,16 @@ type SpeedTestResult struct {
 	
 	// 错误信息
 	ErrorMessage  string         `json:"error_message"`  // 错误信息
+
+	// 测试参数，由面板下发给源节点
+	ScheduleID string `json:"schedule_id,omitempty"` // 创建该测试的定时任务ID，手动测试为空
+	MeshRunID  string `json:"mesh_run_id,omitempty"` // 创建该测试的全网格测速ID
+	Timeout    int    `json:"timeout,omitempty"`     // 超时时间（秒）
+	Threads    int    `json:"threads,omitempty"`     // 线程数
+	Size       int    `json:"size,omitempty"`        // 下载测速的数据量（MB）
+
+	// 偏离基线超过阈值的指标，由API按需填充
+	Anomalies []AnomalyScore `json:"anomalies,omitempty"`
 }
 
 // SpeedTestRequest 表示测速请求
@@ -53,6 +64,72 @@ type SpeedTestRequest struct {
 	TargetNodeID string        `json:"target_node_id"` // 目标节点ID
 	Type         SpeedTestType `json:"type"`           // 测试类型
 	Timeout      int           `json:"timeout"`        // 超时时间（秒）
+	Threads      int           `json:"threads"`        // 线程数，为0时使用节点默认值
+	Size         int           `json:"size"`           // 下载测速的数据量（MB），为0时使用节点默认值
+
+	// 测试来源，由面板内部设置
+	ScheduleID string `json:"-"`
+	MeshRunID  string `json:"-"`
+}
+
+// 检查测试类型是否有效
+func (t SpeedTestType) Valid() bool {
+	switch t {
+	case SpeedTestTypeDownload, SpeedTestTypeUpload, SpeedTestTypePing, SpeedTestTypeFull:
+		return true
+	}
+	return false
+}
+
+// 测速指标
+const (
+	MetricDownloadSpeed = "download_speed"
+	MetricUploadSpeed   = "upload_speed"
+	MetricPing          = "ping"
+	MetricJitter        = "jitter"
+	MetricPacketLoss    = "packet_loss"
+)
+
+// Metrics 所有测速指标
+var Metrics = []string{MetricDownloadSpeed, MetricUploadSpeed, MetricPing, MetricJitter, MetricPacketLoss}
+
+// 返回提供该指标的测试类型，未知指标返回nil
+func MetricTestTypes(metric string) []SpeedTestType {
+	switch metric {
+	case MetricDownloadSpeed:
+		return []SpeedTestType{SpeedTestTypeDownload, SpeedTestTypeFull}
+	case MetricUploadSpeed:
+		return []SpeedTestType{SpeedTestTypeUpload, SpeedTestTypeFull}
+	case MetricPing, MetricJitter, MetricPacketLoss:
+		return []SpeedTestType{SpeedTestTypePing, SpeedTestTypeFull}
+	}
+	return nil
+}
+
+// 返回测试结果中的指标值，该类型的测试不提供此指标时第二个返回值为false
+func (r *SpeedTestResult) Metric(metric string) (float64, bool) {
+	provided := false
+	for _, t := range MetricTestTypes(metric) {
+		if r.Type == t {
+			provided = true
+		}
+	}
+	if !provided {
+		return 0, false
+	}
+
+	switch metric {
+	case MetricDownloadSpeed:
+		return r.DownloadSpeed, true
+	case MetricUploadSpeed:
+		return r.UploadSpeed, true
+	case MetricPing:
+		return r.Ping, true
+	case MetricJitter:
+		return r.Jitter, true
+	default:
+		return r.PacketLoss, true
+	}
 }
 
 // SpeedTestResponse 表示测速请求响应
@@ -66,4 +143,121 @@ type SpeedTestResponse struct {
 type SpeedTestResultList struct {
 	Results []SpeedTestResult `json:"results"`
 	Total   int              `json:"total"`
-} 
\ No newline at end of file
+}
+
+// 检查节点对之间是否已有等待中或运行中的测试
+func HasActiveSpeedTest(sourceNodeID, targetNodeID string) (bool, error) {
+	var count int
+	err := db.QueryRow(`
+	SELECT COUNT(*) FROM speedtest_results
+	WHERE source_node_id = ? AND target_node_id = ? AND status IN (?, ?)`,
+		sourceNodeID, targetNodeID, SpeedTestStatusPending, SpeedTestStatusRunning).Scan(&count)
+	return count > 0, err
+}
+
+// 获取等待中和运行中的测试，按创建或开始时间排序
+func GetActiveSpeedTests() ([]SpeedTestResult, error) {
+	rows, err := db.Query(`
+	SELECT id, source_node_id, target_node_id, type, status, start_time, end_time,
+		duration, download_speed, upload_speed, ping, jitter, packet_loss, error_message,
+		COALESCE(schedule_id, ''), COALESCE(timeout, 0), COALESCE(threads, 0), COALESCE(size, 0),
+		COALESCE(mesh_run_id, '')
+	FROM speedtest_results WHERE status IN (?, ?)
+	ORDER BY start_time`, SpeedTestStatusPending, SpeedTestStatusRunning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var active []SpeedTestResult
+	for rows.Next() {
+		var result SpeedTestResult
+		err := rows.Scan(
+			&result.ID, &result.SourceNodeID, &result.TargetNodeID, &result.Type, &result.Status,
+			&result.StartTime, &result.EndTime, &result.Duration, &result.DownloadSpeed,
+			&result.UploadSpeed, &result.Ping, &result.Jitter, &result.PacketLoss, &result.ErrorMessage,
+			&result.ScheduleID, &result.Timeout, &result.Threads, &result.Size, &result.MeshRunID)
+		if err != nil {
+			return nil, err
+		}
+		active = append(active, result)
+	}
+	return active, rows.Err()
+}
+
+// 领取等待中的测试，领取后标记为运行中并更新开始时间，返回实际领取的测试
+func ClaimSpeedTests(pending []SpeedTestResult) ([]SpeedTestResult, error) {
+	now := time.Now()
+	var claimed []SpeedTestResult
+	for _, result := range pending {
+		// 状态已被其他请求修改时跳过，避免同一测试下发两次
+		res, err := db.Exec("UPDATE speedtest_results SET status = ?, start_time = ? WHERE id = ? AND status = ?",
+			SpeedTestStatusRunning, now.UTC(), result.ID, SpeedTestStatusPending)
+		if err != nil {
+			return claimed, err
+		}
+		if affected, _ := res.RowsAffected(); affected == 0 {
+			continue
+		}
+		result.Status = SpeedTestStatusRunning
+		result.StartTime = now
+		claimed = append(claimed, result)
+	}
+	return claimed, nil
+}
+
+// 将超过超时时间仍未上报结果的运行中测试标记为超时，未设置超时时间的测试使用defaultTimeout，
+// grace为等待节点上报结果的额外时间，返回更新的数量
+func TimeoutStaleSpeedTests(defaultTimeout, grace time.Duration, message string) (int64, error) {
+	rows, err := db.Query(`
+	SELECT id, start_time, COALESCE(timeout, 0) FROM speedtest_results WHERE status = ?`,
+		SpeedTestStatusRunning)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	var stale []string
+	starts := make(map[string]time.Time)
+	for rows.Next() {
+		var id string
+		var startTime time.Time
+		var timeout int
+		if err := rows.Scan(&id, &startTime, &timeout); err != nil {
+			return 0, err
+		}
+
+		limit := defaultTimeout
+		if timeout > 0 {
+			limit = time.Duration(timeout) * time.Second
+		}
+		if now.Sub(startTime) > limit+grace {
+			stale = append(stale, id)
+			starts[id] = startTime
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	rows.Close()
+
+	var updated int64
+	for _, id := range stale {
+		result, err := db.Exec(`
+		UPDATE speedtest_results SET status = ?, error_message = ?, end_time = ?
+		WHERE id = ? AND status = ?`,
+			SpeedTestStatusTimeout, message, now.UTC(), id, SpeedTestStatusRunning)
+		if err != nil {
+			return updated, err
+		}
+		affected, _ := result.RowsAffected()
+		if affected > 0 {
+			if err := markRollupDirty(starts[id], now); err != nil {
+				return updated, err
+			}
+		}
+		updated += affected
+	}
+	return updated, nil
+}
@@ -0,0 +1,123 @@
+package monitor
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"../alerting"
+	"../config"
+	"../models"
+)
+
+const (
+	// 检查间隔的下限，避免设置过小时频繁查询数据库
+	minCheckInterval = 5 * time.Second
+	// 测试超时后等待节点上报结果的时间，节点上报前可能还在重试
+	resultGracePeriod = 2 * time.Minute
+)
+
+var (
+	stop  chan struct{}
+	done  chan struct{}
+	mutex sync.Mutex
+)
+
+// StartLivenessChecker 启动节点存活检查，定期将超时未发送心跳的节点标记为离线，
+// 并将涉及离线节点的未完成测试标记为失败
+func StartLivenessChecker() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if stop != nil {
+		return
+	}
+	stop = make(chan struct{})
+	done = make(chan struct{})
+	go run(stop, done)
+}
+
+// StopLivenessChecker 停止节点存活检查，等待进行中的检查完成
+func StopLivenessChecker() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+	stop = nil
+	done = nil
+}
+
+func run(stop, done chan struct{}) {
+	defer close(done)
+
+	for {
+		// 每轮重新读取设置，修改超时时间和检查间隔后无需重启面板
+		timeout, interval := livenessSettings()
+		CheckNodes(timeout)
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// CheckNodes 执行一次存活检查
+func CheckNodes(timeout time.Duration) {
+	now := time.Now()
+	reason := fmt.Sprintf("超过 %v 未收到心跳", timeout)
+	nodes, err := models.MarkStaleNodesOffline(now.Add(-timeout), reason)
+	for _, node := range nodes {
+		log.Printf("节点 %s (%s) %s，标记为离线", node.Name, node.ID, reason)
+	}
+	if err != nil {
+		log.Printf("检查节点状态失败: %v", err)
+		return
+	}
+
+	// 按节点告警规则评估离线时长、资源使用率、版本和时钟偏差
+	if all, err := models.GetAllNodes(); err != nil {
+		log.Printf("读取节点失败: %v", err)
+	} else {
+		alerting.EvaluateNodes(all)
+	}
+
+	failed, err := models.FailTestsOnOfflineNodes("节点离线")
+	if err != nil {
+		log.Printf("更新离线节点的测试状态失败: %v", err)
+		return
+	}
+	if failed > 0 {
+		log.Printf("%d 个涉及离线节点的测试已标记为失败", failed)
+	}
+
+	// 已下发但节点迟迟未上报结果的测试按超时处理
+	defaultTimeout := time.Duration(models.GetIntSetting("speedtest_timeout", config.GetConfig().SpeedtestTimeout)) * time.Second
+	expired, err := models.TimeoutStaleSpeedTests(defaultTimeout, resultGracePeriod, "节点未在超时时间内上报结果")
+	if err != nil {
+		log.Printf("更新超时测试状态失败: %v", err)
+		return
+	}
+	if expired > 0 {
+		log.Printf("%d 个测试未在超时时间内上报结果，已标记为超时", expired)
+	}
+}
+
+// 获取生效的节点超时时间和检查间隔，面板设置优先于配置文件
+func livenessSettings() (time.Duration, time.Duration) {
+	cfg := config.GetConfig()
+	timeout := time.Duration(models.GetIntSetting("node_timeout", cfg.NodeTimeout)) * time.Second
+	interval := time.Duration(models.GetIntSetting("node_check_interval", cfg.NodeCheckInterval)) * time.Second
+	if interval < minCheckInterval {
+		interval = minCheckInterval
+	}
+	return timeout, interval
+}
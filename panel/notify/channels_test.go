@@ -0,0 +1,322 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 存根服务器收到的请求
+type capturedRequest struct {
+	Method string
+	Path   string
+	Query  map[string][]string
+	Header http.Header
+	Body   []byte
+}
+
+// 启动记录请求并返回固定响应的存根服务器
+func stubServer(t *testing.T, status int, response string) (*httptest.Server, <-chan capturedRequest) {
+	requests := make(chan capturedRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- capturedRequest{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query(), Header: r.Header, Body: body}
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func testMessage() *Message {
+	return &Message{
+		Title:    "[告警][critical] 延迟过高",
+		Text:     "节点: a -> b\n当前值: 120.00",
+		State:    "firing",
+		Severity: "critical",
+		Time:     time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+// 创建渠道并发送测试消息
+func send(t *testing.T, channelType string, config map[string]interface{}) error {
+	raw, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err := NewSender(channelType, raw)
+	if err != nil {
+		t.Fatalf("NewSender(%s): %v", channelType, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return sender.Send(ctx, testMessage())
+}
+
+func TestWebhookChannel(t *testing.T) {
+	server, requests := stubServer(t, http.StatusOK, "")
+	err := send(t, "webhook", map[string]interface{}{
+		"url":      server.URL + "/hook",
+		"method":   "put",
+		"headers":  map[string]string{"Authorization": "Bearer token"},
+		"template": `{"title":{{json .Title}},"state":"{{upper .State}}"}`,
+		"secret":   "s3cret",
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	req := <-requests
+	if req.Method != http.MethodPut || req.Path != "/hook" {
+		t.Errorf("请求 = %s %s", req.Method, req.Path)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Authorization = %q", got)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		t.Fatalf("请求体不是JSON: %s", req.Body)
+	}
+	if body["title"] != testMessage().Title || body["state"] != "FIRING" {
+		t.Errorf("请求体 = %v", body)
+	}
+
+	timestamp := req.Header.Get("X-Signature-Timestamp")
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(timestamp + "." + string(req.Body)))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); req.Header.Get("X-Signature") != want {
+		t.Errorf("X-Signature = %q, want %q", req.Header.Get("X-Signature"), want)
+	}
+}
+
+func TestWebhookChannelHTTPError(t *testing.T) {
+	server, _ := stubServer(t, http.StatusInternalServerError, "boom")
+	err := send(t, "webhook", map[string]interface{}{"url": server.URL})
+	if err == nil || !strings.Contains(err.Error(), "HTTP 500") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestDingTalkChannel(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		wantErr  bool
+	}{
+		{name: "成功", response: `{"errcode":0,"errmsg":"ok"}`},
+		{name: "返回错误", response: `{"errcode":310000,"errmsg":"sign not match"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := stubServer(t, http.StatusOK, tt.response)
+			err := send(t, "dingtalk", map[string]interface{}{
+				"webhook": server.URL + "/robot/send?access_token=abc",
+				"secret":  "SEC123",
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			req := <-requests
+			if req.Query["access_token"][0] != "abc" {
+				t.Errorf("access_token = %v", req.Query["access_token"])
+			}
+			timestamp := req.Query["timestamp"][0]
+			mac := hmac.New(sha256.New, []byte("SEC123"))
+			mac.Write([]byte(timestamp + "\n" + "SEC123"))
+			if want := base64.StdEncoding.EncodeToString(mac.Sum(nil)); req.Query["sign"][0] != want {
+				t.Errorf("sign = %q, want %q", req.Query["sign"][0], want)
+			}
+			var body struct {
+				MsgType  string            `json:"msgtype"`
+				Markdown map[string]string `json:"markdown"`
+			}
+			json.Unmarshal(req.Body, &body)
+			if body.MsgType != "markdown" || !strings.Contains(body.Markdown["text"], "当前值: 120.00") {
+				t.Errorf("请求体 = %s", req.Body)
+			}
+		})
+	}
+}
+
+func TestFeishuChannel(t *testing.T) {
+	server, requests := stubServer(t, http.StatusOK, `{"code":0,"msg":"success"}`)
+	if err := send(t, "feishu", map[string]interface{}{"webhook": server.URL, "secret": "fs"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	req := <-requests
+	var body struct {
+		MsgType   string `json:"msg_type"`
+		Timestamp string `json:"timestamp"`
+		Sign      string `json:"sign"`
+	}
+	json.Unmarshal(req.Body, &body)
+	mac := hmac.New(sha256.New, []byte(body.Timestamp+"\nfs"))
+	if want := base64.StdEncoding.EncodeToString(mac.Sum(nil)); body.MsgType != "text" || body.Sign != want {
+		t.Errorf("请求体 = %s", req.Body)
+	}
+
+	server, _ = stubServer(t, http.StatusOK, `{"code":19021,"msg":"sign match fail"}`)
+	if err := send(t, "feishu", map[string]interface{}{"webhook": server.URL}); err == nil {
+		t.Fatal("飞书返回错误时应失败")
+	}
+}
+
+func TestWeComChannel(t *testing.T) {
+	server, requests := stubServer(t, http.StatusOK, `{"errcode":0}`)
+	if err := send(t, "wecom", map[string]interface{}{"webhook": server.URL + "/cgi-bin/webhook/send?key=k"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	req := <-requests
+	if req.Query["key"][0] != "k" || !strings.Contains(string(req.Body), `"msgtype":"markdown"`) {
+		t.Errorf("请求 = %v %s", req.Query, req.Body)
+	}
+
+	server, _ = stubServer(t, http.StatusOK, `{"errcode":93000,"errmsg":"invalid webhook url"}`)
+	if err := send(t, "wecom", map[string]interface{}{"webhook": server.URL}); err == nil {
+		t.Fatal("企业微信返回错误时应失败")
+	}
+}
+
+func TestSlackChannel(t *testing.T) {
+	server, requests := stubServer(t, http.StatusOK, "ok")
+	if err := send(t, "slack", map[string]interface{}{"webhook": server.URL + "/services/T/B/X"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	req := <-requests
+	var body map[string]string
+	json.Unmarshal(req.Body, &body)
+	if req.Path != "/services/T/B/X" || !strings.HasPrefix(body["text"], "*"+testMessage().Title+"*") {
+		t.Errorf("请求 = %s %s", req.Path, req.Body)
+	}
+}
+
+func TestTelegramChannel(t *testing.T) {
+	server, requests := stubServer(t, http.StatusOK, `{"ok":true}`)
+	if err := send(t, "telegram", map[string]interface{}{"bot_token": "123:abc", "chat_id": "42", "api_url": server.URL + "/"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	req := <-requests
+	if req.Path != "/bot123:abc/sendMessage" || !strings.Contains(string(req.Body), `"chat_id":"42"`) {
+		t.Errorf("请求 = %s %s", req.Path, req.Body)
+	}
+
+	// 错误信息中不能包含bot_token
+	server, _ = stubServer(t, http.StatusUnauthorized, `{"ok":false,"description":"Unauthorized"}`)
+	err := send(t, "telegram", map[string]interface{}{"bot_token": "123:abc", "chat_id": "42", "api_url": server.URL})
+	if err == nil || strings.Contains(err.Error(), "123:abc") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestRequestErrorHidesURL(t *testing.T) {
+	// 关闭的端口，连接失败时错误信息中不能包含Webhook地址中的令牌
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	err = send(t, "dingtalk", map[string]interface{}{"webhook": "http://" + addr + "/robot/send?access_token=topsecret"})
+	if err == nil || strings.Contains(err.Error(), "topsecret") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestEmailChannel(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// 最简单的SMTP存根，记录收件人和邮件内容
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		var lines []string
+		reply("220 stub ESMTP")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			command := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 stub")
+			case strings.HasPrefix(command, "MAIL FROM"), strings.HasPrefix(command, "RCPT TO"):
+				lines = append(lines, line)
+				reply("250 OK")
+			case command == "DATA":
+				reply("354 go ahead")
+				for {
+					data, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					data = strings.TrimRight(data, "\r\n")
+					if data == "." {
+						break
+					}
+					lines = append(lines, data)
+				}
+				reply("250 queued")
+			case command == "QUIT":
+				reply("221 bye")
+				received <- lines
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	err = send(t, "email", map[string]interface{}{
+		"host":     host,
+		"port":     portNumber,
+		"from":     "panel@example.com",
+		"to":       []string{"ops@example.com", "oncall@example.com"},
+		"security": "none",
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	lines := strings.Join(<-received, "\n")
+	for _, want := range []string{
+		"MAIL FROM:<panel@example.com>",
+		"RCPT TO:<ops@example.com>",
+		"RCPT TO:<oncall@example.com>",
+		"To: ops@example.com, oncall@example.com",
+		"当前值: 120.00",
+	} {
+		if !strings.Contains(lines, want) {
+			t.Errorf("邮件中缺少 %q:\n%s", want, lines)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register("email", newEmail)
+}
+
+// SMTP邮件配置
+type emailConfig struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"` // 默认按security选择：tls为465，其余为587
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Security string   `json:"security"` // 连接加密方式：starttls（默认）、tls、none
+}
+
+// 通过SMTP发送纯文本邮件
+type emailSender struct {
+	config emailConfig
+}
+
+func newEmail(raw json.RawMessage) (Sender, error) {
+	var config emailConfig
+	if err := senders.DecodeConfig(raw, &config); err != nil {
+		return nil, err
+	}
+	if config.Host == "" {
+		return nil, fmt.Errorf("SMTP服务器地址不能为空")
+	}
+	if config.From == "" || len(config.To) == 0 {
+		return nil, fmt.Errorf("发件人和收件人不能为空")
+	}
+	if config.Security == "" {
+		config.Security = "starttls"
+	}
+	switch config.Security {
+	case "starttls", "none":
+		if config.Port == 0 {
+			config.Port = 587
+		}
+	case "tls":
+		if config.Port == 0 {
+			config.Port = 465
+		}
+	default:
+		return nil, fmt.Errorf("无效的加密方式: %s", config.Security)
+	}
+	if config.Port < 1 || config.Port > 65535 {
+		return nil, fmt.Errorf("无效的端口: %d", config.Port)
+	}
+	return &emailSender{config: config}, nil
+}
+
+func (s *emailSender) Send(ctx context.Context, msg *Message) error {
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	tlsConfig := &tls.Config{ServerName: s.config.Host}
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if s.config.Security == "tls" {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if s.config.Security == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP服务器不支持STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if s.config.Username != "" {
+		auth := smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(s.config.From); err != nil {
+		return err
+	}
+	for _, to := range s.config.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("收件人 %s 被拒绝: %v", to, err)
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(s.message(msg)); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// 生成邮件内容
+func (s *emailSender) message(msg *Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", s.config.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(s.config.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Title))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.Replace(msg.Text, "\n", "\r\n", -1))
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
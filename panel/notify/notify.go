@@ -0,0 +1,326 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"../models"
+	"../registry"
+)
+
+// 发送失败时的重试策略：最多发送maxAttempts次，每次重试的等待时间翻倍
+const (
+	maxAttempts = 3
+	retryDelay  = 2 * time.Second
+	sendTimeout = 10 * time.Second
+)
+
+// Message 一条待发送的通知，各渠道按自己的格式渲染
+type Message struct {
+	Title      string        `json:"title"`
+	Text       string        `json:"text"`
+	State      string        `json:"state"` // firing、resolved，测试发送时为test
+	Severity   string        `json:"severity"`
+	SourceNode string        `json:"source_node"` // 源节点名称
+	TargetNode string        `json:"target_node"` // 目标节点名称，节点告警时为空
+	Alert      *models.Alert `json:"alert,omitempty"`
+	Time       time.Time     `json:"time"`
+}
+
+// Sender 通知渠道的发送实现
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Factory 根据渠道配置创建发送实现，配置无效时返回错误
+type Factory = registry.Factory[Sender]
+
+var senders = registry.New[Sender]("渠道")
+
+// Register 注册渠道类型，各渠道类型在init中注册
+func Register(channelType string, factory Factory) {
+	senders.Register(channelType, factory)
+}
+
+// Types 返回已注册的渠道类型
+func Types() []string {
+	return senders.Types()
+}
+
+// NewSender 根据渠道类型和配置创建发送实现
+func NewSender(channelType string, config json.RawMessage) (Sender, error) {
+	return senders.Create(channelType, config)
+}
+
+// ValidateChannel 校验通知渠道的名称、类型、配置和严重程度，并填充默认值
+func ValidateChannel(channel *models.NotificationChannel) error {
+	channel.Name = strings.TrimSpace(channel.Name)
+	if channel.Name == "" {
+		return fmt.Errorf("渠道名称不能为空")
+	}
+	if len(channel.Config) == 0 {
+		channel.Config = json.RawMessage("{}")
+	}
+	if _, err := NewSender(channel.Type, channel.Config); err != nil {
+		return err
+	}
+	if channel.MinSeverity == "" {
+		channel.MinSeverity = models.SeverityInfo
+	}
+	if models.SeverityLevel(channel.MinSeverity) < 0 {
+		return fmt.Errorf("无效的严重程度: %s", channel.MinSeverity)
+	}
+	if channel.RateLimit < 0 {
+		return fmt.Errorf("发送频率限制不能为负数")
+	}
+	return nil
+}
+
+// 进行中的发送，关闭面板时等待完成
+var pending sync.WaitGroup
+
+// SendAlert 将告警异步发送到所有匹配的通知渠道，发送失败时重试
+func SendAlert(alert *models.Alert) {
+	channels, err := models.GetNotificationChannels()
+	if err != nil {
+		log.Printf("读取通知渠道失败: %v", err)
+		return
+	}
+
+	var msg *Message
+	for i := range channels {
+		channel := channels[i]
+		if !channel.Enabled || models.SeverityLevel(alert.Severity) < models.SeverityLevel(channel.MinSeverity) {
+			continue
+		}
+		if alert.State == models.AlertStateResolved && !channel.SendResolved {
+			continue
+		}
+
+		sender, err := NewSender(channel.Type, channel.Config)
+		if err != nil {
+			log.Printf("通知渠道 %s 配置无效: %v", channel.Name, err)
+			models.UpdateNotificationDelivery(channel.ID, err)
+			continue
+		}
+		if msg == nil {
+			msg = alertMessage(alert)
+		}
+
+		pending.Add(1)
+		go deliver(channel, sender, msg)
+	}
+}
+
+// Test 立即向通知渠道发送一条测试通知，不重试也不受频率限制
+func Test(channel *models.NotificationChannel) error {
+	sender, err := NewSender(channel.Type, channel.Config)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	msg := &Message{
+		Title:    "[测试] 通知渠道 " + channel.Name,
+		Text:     fmt.Sprintf("这是一条来自节点测速面板的测试通知\n时间: %s", now.Format("2006-01-02 15:04:05")),
+		State:    "test",
+		Severity: models.SeverityInfo,
+		Time:     now,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	err = sender.Send(ctx, msg)
+	if recordErr := models.UpdateNotificationDelivery(channel.ID, err); recordErr != nil {
+		log.Printf("记录通知渠道 %s 发送结果失败: %v", channel.Name, recordErr)
+	}
+	return err
+}
+
+// Wait 等待进行中的发送完成，ctx到期时返回
+func Wait(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("等待通知发送完成超时")
+	}
+}
+
+// 按频率限制发送一条通知，失败时重试
+func deliver(channel models.NotificationChannel, sender Sender, msg *Message) {
+	defer pending.Done()
+
+	if !allow(channel.ID, channel.RateLimit, time.Now()) {
+		err := fmt.Errorf("超过每分钟 %d 条的发送频率限制，通知已丢弃", channel.RateLimit)
+		log.Printf("通知渠道 %s %v: %s", channel.Name, err, msg.Title)
+		models.UpdateNotificationDelivery(channel.ID, err)
+		return
+	}
+
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err = sender.Send(ctx, msg)
+		cancel()
+		if err == nil {
+			break
+		}
+
+		log.Printf("通知渠道 %s 第 %d 次发送失败: %v", channel.Name, attempt, err)
+		if attempt < maxAttempts {
+			time.Sleep(retryDelay << uint(attempt-1))
+		}
+	}
+
+	if recordErr := models.UpdateNotificationDelivery(channel.ID, err); recordErr != nil {
+		log.Printf("记录通知渠道 %s 发送结果失败: %v", channel.Name, recordErr)
+	}
+}
+
+// 每个渠道当前分钟内已发送的通知数
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+var (
+	rateMutex   sync.Mutex
+	rateWindows = make(map[string]*rateWindow)
+)
+
+// 判断渠道在当前分钟内是否还能发送，perMinute不大于0时不限制
+func allow(channelID string, perMinute int, now time.Time) bool {
+	if perMinute <= 0 {
+		return true
+	}
+
+	rateMutex.Lock()
+	defer rateMutex.Unlock()
+
+	window, ok := rateWindows[channelID]
+	if !ok || now.Sub(window.start) >= time.Minute {
+		window = &rateWindow{start: now}
+		rateWindows[channelID] = window
+	}
+	if window.count >= perMinute {
+		return false
+	}
+	window.count++
+	return true
+}
+
+// 根据告警生成通知内容
+func alertMessage(alert *models.Alert) *Message {
+	msg := &Message{
+		State:      string(alert.State),
+		Severity:   alert.Severity,
+		SourceNode: models.NodeName(alert.SourceNodeID),
+		Alert:      alert,
+		Time:       alert.LastEvaluatedAt,
+	}
+	subject := msg.SourceNode
+	if alert.TargetNodeID != "" {
+		msg.TargetNode = models.NodeName(alert.TargetNodeID)
+		subject += " -> " + msg.TargetNode
+	}
+
+	lines := []string{"节点: " + subject}
+	if alert.State == models.AlertStateResolved {
+		msg.Title = fmt.Sprintf("[恢复] %s", alert.RuleName)
+		msg.Time = alert.ResolvedAt
+		lines = append(lines, fmt.Sprintf("当前值: %.2f", alert.LastValue))
+	} else {
+		msg.Title = fmt.Sprintf("[告警][%s] %s", alert.Severity, alert.RuleName)
+		lines = append(lines, fmt.Sprintf("当前值: %.2f，阈值: %.2f", alert.Value, alert.Threshold))
+	}
+	if alert.Message != "" {
+		lines = append(lines, alert.Message)
+	}
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+	lines = append(lines,
+		"开始时间: "+alert.StartedAt.Format("2006-01-02 15:04:05"),
+		"时间: "+msg.Time.Format("2006-01-02 15:04:05"))
+	msg.Text = strings.Join(lines, "\n")
+	return msg
+}
+
+var httpClient = &http.Client{Timeout: sendTimeout}
+
+// 发送HTTP请求，非2xx状态码视为失败，返回响应内容
+func doRequest(ctx context.Context, method, rawURL string, body []byte, header http.Header) ([]byte, error) {
+	req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		// 错误信息会保存并显示在渠道列表中，去掉其中可能包含访问令牌的URL
+		if urlErr, ok := err.(*url.Error); ok {
+			return nil, fmt.Errorf("请求失败: %v", urlErr.Err)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return data, fmt.Errorf("HTTP %d: %s", resp.StatusCode, truncate(string(data), 200))
+	}
+	return data, nil
+}
+
+// 以JSON格式POST请求
+func postJSON(ctx context.Context, url string, payload interface{}) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	return doRequest(ctx, http.MethodPost, url, body, header)
+}
+
+// 检查URL是否为http或https地址
+func checkURL(name, value string) error {
+	if value == "" {
+		return fmt.Errorf("%s不能为空", name)
+	}
+	if !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+		return fmt.Errorf("%s必须是http或https地址", name)
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,159 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 群聊机器人：钉钉、飞书、企业微信和Slack兼容的Incoming Webhook，都通过机器人的Webhook地址发送
+func init() {
+	Register("dingtalk", newRobot(sendDingTalk))
+	Register("feishu", newRobot(sendFeishu))
+	Register("wecom", newRobot(sendWeCom))
+	Register("slack", newRobot(sendSlack))
+}
+
+// 群聊机器人配置
+type robotConfig struct {
+	Webhook string `json:"webhook"`
+	Secret  string `json:"secret"` // 钉钉和飞书的加签密钥，未开启加签时为空
+}
+
+type robotSender struct {
+	config robotConfig
+	send   func(ctx context.Context, config robotConfig, msg *Message) error
+}
+
+func (s *robotSender) Send(ctx context.Context, msg *Message) error {
+	return s.send(ctx, s.config, msg)
+}
+
+func newRobot(send func(ctx context.Context, config robotConfig, msg *Message) error) Factory {
+	return func(raw json.RawMessage) (Sender, error) {
+		var config robotConfig
+		if err := senders.DecodeConfig(raw, &config); err != nil {
+			return nil, err
+		}
+		if err := checkURL("webhook", config.Webhook); err != nil {
+			return nil, err
+		}
+		return &robotSender{config: config, send: send}, nil
+	}
+}
+
+// 钉钉和企业微信的响应
+type robotResponse struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+// 钉钉自定义机器人，加签方式：对"毫秒时间戳\n密钥"做HMAC-SHA256后Base64编码，附加到URL的timestamp和sign参数
+func sendDingTalk(ctx context.Context, config robotConfig, msg *Message) error {
+	webhook := config.Webhook
+	if config.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+		mac := hmac.New(sha256.New, []byte(config.Secret))
+		mac.Write([]byte(timestamp + "\n" + config.Secret))
+		sign := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		webhook = appendQuery(webhook, "timestamp="+timestamp+"&sign="+url.QueryEscape(sign))
+	}
+
+	data, err := postJSON(ctx, webhook, map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"title": msg.Title,
+			"text":  "### " + msg.Title + "\n\n" + markdownLines(msg.Text),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return checkRobotResponse("钉钉", data)
+}
+
+// 飞书自定义机器人，加签方式：以"秒级时间戳\n密钥"为密钥对空字符串做HMAC-SHA256后Base64编码，放在请求体中
+func sendFeishu(ctx context.Context, config robotConfig, msg *Message) error {
+	payload := map[string]interface{}{
+		"msg_type": "text",
+		"content": map[string]string{
+			"text": msg.Title + "\n" + msg.Text,
+		},
+	}
+	if config.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(timestamp+"\n"+config.Secret))
+		payload["timestamp"] = timestamp
+		payload["sign"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	data, err := postJSON(ctx, config.Webhook, payload)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return fmt.Errorf("解析飞书响应失败: %v", err)
+	}
+	if resp.Code != 0 {
+		return fmt.Errorf("飞书返回错误 %d: %s", resp.Code, resp.Msg)
+	}
+	return nil
+}
+
+// 企业微信群机器人
+func sendWeCom(ctx context.Context, config robotConfig, msg *Message) error {
+	data, err := postJSON(ctx, config.Webhook, map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"content": "**" + msg.Title + "**\n" + msg.Text,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return checkRobotResponse("企业微信", data)
+}
+
+// Slack兼容的Incoming Webhook（Mattermost、Rocket.Chat等），返回2xx即视为成功
+func sendSlack(ctx context.Context, config robotConfig, msg *Message) error {
+	_, err := postJSON(ctx, config.Webhook, map[string]string{
+		"text": "*" + msg.Title + "*\n" + msg.Text,
+	})
+	return err
+}
+
+// 检查钉钉和企业微信的响应，errcode不为0时返回错误
+func checkRobotResponse(name string, data []byte) error {
+	var resp robotResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return fmt.Errorf("解析%s响应失败: %v", name, err)
+	}
+	if resp.ErrCode != 0 {
+		return fmt.Errorf("%s返回错误 %d: %s", name, resp.ErrCode, resp.ErrMsg)
+	}
+	return nil
+}
+
+// 在URL后追加查询参数
+func appendQuery(rawURL, query string) string {
+	if strings.Contains(rawURL, "?") {
+		return rawURL + "&" + query
+	}
+	return rawURL + "?" + query
+}
+
+// Markdown中单个换行不会换行，在行尾加两个空格强制换行
+func markdownLines(text string) string {
+	return strings.Replace(text, "\n", "  \n", -1)
+}
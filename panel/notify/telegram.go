@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+func init() {
+	Register("telegram", newTelegram)
+}
+
+// Telegram机器人配置
+type telegramConfig struct {
+	BotToken string `json:"bot_token"`
+	ChatID   string `json:"chat_id"`
+	APIURL   string `json:"api_url"` // Bot API地址，默认https://api.telegram.org
+}
+
+// 通过Telegram Bot API的sendMessage发送通知
+type telegramSender struct {
+	config telegramConfig
+}
+
+func newTelegram(raw json.RawMessage) (Sender, error) {
+	var config telegramConfig
+	if err := senders.DecodeConfig(raw, &config); err != nil {
+		return nil, err
+	}
+	if config.BotToken == "" || config.ChatID == "" {
+		return nil, fmt.Errorf("bot_token和chat_id不能为空")
+	}
+	if config.APIURL == "" {
+		config.APIURL = "https://api.telegram.org"
+	}
+	if err := checkURL("api_url", config.APIURL); err != nil {
+		return nil, err
+	}
+	config.APIURL = strings.TrimRight(config.APIURL, "/")
+	return &telegramSender{config: config}, nil
+}
+
+func (s *telegramSender) Send(ctx context.Context, msg *Message) error {
+	url := fmt.Sprintf("%s/bot%s/sendMessage", s.config.APIURL, s.config.BotToken)
+	data, err := postJSON(ctx, url, map[string]interface{}{
+		"chat_id":                  s.config.ChatID,
+		"text":                     msg.Title + "\n\n" + msg.Text,
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		// 不在错误信息中暴露bot_token
+		return fmt.Errorf("%s", strings.Replace(err.Error(), s.config.BotToken, "***", -1))
+	}
+
+	var resp struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return fmt.Errorf("解析Telegram响应失败: %v", err)
+	}
+	if !resp.OK {
+		return fmt.Errorf("Telegram返回错误: %s", resp.Description)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+func init() {
+	Register("webhook", newWebhook)
+}
+
+// 通用Webhook配置
+type webhookConfig struct {
+	URL         string            `json:"url"`
+	Method      string            `json:"method"`       // 默认POST
+	Headers     map[string]string `json:"headers"`      // 附加的请求头
+	ContentType string            `json:"content_type"` // 默认application/json
+	Template    string            `json:"template"`     // 请求体模板（text/template），为空时发送Message的JSON
+	Secret      string            `json:"secret"`       // 设置后对请求体做HMAC-SHA256签名
+}
+
+// 以通用JSON Webhook发送通知，设置secret时在请求头中附带签名：
+// X-Signature-Timestamp为Unix时间戳，X-Signature为"sha256="加上对"时间戳.请求体"的HMAC-SHA256十六进制值
+type webhookSender struct {
+	config   webhookConfig
+	template *template.Template
+}
+
+// 模板函数，json将值编码为JSON，用于在JSON模板中安全地嵌入字符串
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"upper": strings.ToUpper,
+	"time": func(t time.Time) string {
+		return t.Format("2006-01-02 15:04:05")
+	},
+}
+
+func newWebhook(raw json.RawMessage) (Sender, error) {
+	var config webhookConfig
+	if err := senders.DecodeConfig(raw, &config); err != nil {
+		return nil, err
+	}
+	if err := checkURL("url", config.URL); err != nil {
+		return nil, err
+	}
+	config.Method = strings.ToUpper(config.Method)
+	if config.Method == "" {
+		config.Method = http.MethodPost
+	}
+	if config.Method != http.MethodPost && config.Method != http.MethodPut {
+		return nil, fmt.Errorf("不支持的请求方法: %s", config.Method)
+	}
+	if config.ContentType == "" {
+		config.ContentType = "application/json"
+	}
+
+	sender := &webhookSender{config: config}
+	if config.Template != "" {
+		tmpl, err := template.New("webhook").Funcs(templateFuncs).Parse(config.Template)
+		if err != nil {
+			return nil, fmt.Errorf("请求体模板无效: %v", err)
+		}
+		sender.template = tmpl
+	}
+	return sender, nil
+}
+
+func (s *webhookSender) Send(ctx context.Context, msg *Message) error {
+	var body []byte
+	if s.template != nil {
+		var buf bytes.Buffer
+		if err := s.template.Execute(&buf, msg); err != nil {
+			return fmt.Errorf("渲染请求体模板失败: %v", err)
+		}
+		body = buf.Bytes()
+	} else {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		body = data
+	}
+
+	header := http.Header{}
+	for key, value := range s.config.Headers {
+		header.Set(key, value)
+	}
+	header.Set("Content-Type", s.config.ContentType)
+	if s.config.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		header.Set("X-Signature-Timestamp", timestamp)
+		header.Set("X-Signature", "sha256="+webhookSignature(s.config.Secret, timestamp, body))
+	}
+
+	_, err := doRequest(ctx, s.config.Method, s.config.URL, body, header)
+	return err
+}
+
+// 计算Webhook签名
+func webhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,66 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Factory 根据JSON配置创建实现，配置无效时返回错误
+type Factory[T any] func(config json.RawMessage) (T, error)
+
+// Registry 按类型名称注册的实现，各类型在init中注册，注册完成后只读
+type Registry[T any] struct {
+	kind      string // 错误信息中的名称，如"渠道"、"导出"
+	factories map[string]Factory[T]
+}
+
+// New 创建注册表，kind用于错误信息
+func New[T any](kind string) *Registry[T] {
+	return &Registry[T]{kind: kind, factories: make(map[string]Factory[T])}
+}
+
+// Register 注册类型
+func (r *Registry[T]) Register(name string, factory Factory[T]) {
+	r.factories[name] = factory
+}
+
+// Has 判断类型是否已注册
+func (r *Registry[T]) Has(name string) bool {
+	_, ok := r.factories[name]
+	return ok
+}
+
+// Types 返回已注册的类型，按名称排序
+func (r *Registry[T]) Types() []string {
+	types := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Create 根据类型和配置创建实现，配置为空时按空对象处理
+func (r *Registry[T]) Create(name string, config json.RawMessage) (T, error) {
+	factory, ok := r.factories[name]
+	if !ok {
+		var zero T
+		return zero, fmt.Errorf("未知的%s类型: %s", r.kind, name)
+	}
+	if len(config) == 0 {
+		config = json.RawMessage("{}")
+	}
+	return factory(config)
+}
+
+// DecodeConfig 解析配置，不允许未知字段
+func (r *Registry[T]) DecodeConfig(config json.RawMessage, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(config))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("%s配置无效: %v", r.kind, err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package registry
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testConfig struct {
+	URL string `json:"url"`
+}
+
+func newTestRegistry() *Registry[string] {
+	r := New[string]("测试")
+	r.Register("b", func(config json.RawMessage) (string, error) {
+		var cfg testConfig
+		if err := r.DecodeConfig(config, &cfg); err != nil {
+			return "", err
+		}
+		return "b:" + cfg.URL, nil
+	})
+	r.Register("a", func(config json.RawMessage) (string, error) {
+		return "a:" + string(config), nil
+	})
+	return r
+}
+
+func TestRegistry(t *testing.T) {
+	r := newTestRegistry()
+	if types := r.Types(); !reflect.DeepEqual(types, []string{"a", "b"}) {
+		t.Errorf("Types() = %v", types)
+	}
+	if !r.Has("a") || r.Has("c") {
+		t.Errorf("Has 结果错误")
+	}
+
+	tests := []struct {
+		name    string
+		typ     string
+		config  string
+		want    string
+		wantErr string
+	}{
+		{"空配置按空对象处理", "a", "", "a:{}", ""},
+		{"解析配置", "b", `{"url":"http://x"}`, "b:http://x", ""},
+		{"未知字段", "b", `{"url":"http://x","extra":1}`, "", "测试配置无效"},
+		{"未知类型", "c", `{}`, "", "未知的测试类型: c"},
+	}
+	for _, tt := range tests {
+		got, err := r.Create(tt.typ, json.RawMessage(tt.config))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: Create = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
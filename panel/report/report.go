@@ -0,0 +1,139 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 导出格式
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatXLSX   = "xlsx"
+)
+
+// 表格中时间的显示格式，使用面板本地时区
+const timeLayout = "2006-01-02 15:04:05"
+
+// Column 一列，Key用于NDJSON的字段名，Title为CSV和Excel的表头
+type Column struct {
+	Key   string
+	Title string
+}
+
+// Writer 逐行写出表格，单元格的值可以是string、float64、int64、time.Time或nil（空单元格）
+type Writer interface {
+	Header(columns []Column) error
+	Row(values []interface{}) error
+	Close() error
+}
+
+// NewWriter 创建指定格式的Writer，sheet为Excel工作表名称
+func NewWriter(format string, w io.Writer, sheet string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatNDJSON:
+		return &ndjsonWriter{encoder: json.NewEncoder(w)}, nil
+	case FormatXLSX:
+		return newXLSXWriter(w, sheet)
+	}
+	return nil, fmt.Errorf("无效的导出格式: %s，应为csv、ndjson或xlsx", format)
+}
+
+// ContentType 返回导出格式的MIME类型
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}
+
+// CSV，带UTF-8 BOM以便Excel正确识别中文
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	if _, err := io.WriteString(w, "\xEF\xBB\xBF"); err != nil {
+		return nil, err
+	}
+	return &csvWriter{writer: csv.NewWriter(w)}, nil
+}
+
+func (w *csvWriter) Header(columns []Column) error {
+	titles := make([]string, len(columns))
+	for i, column := range columns {
+		titles[i] = column.Title
+	}
+	return w.writer.Write(titles)
+}
+
+func (w *csvWriter) Row(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case string:
+			// 以=、+、-、@开头的文本在电子表格中会被当作公式，加单引号前缀
+			if v != "" && strings.ContainsRune("=+-@", rune(v[0])) {
+				v = "'" + v
+			}
+			record[i] = v
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case int64:
+			record[i] = strconv.FormatInt(v, 10)
+		case time.Time:
+			if !v.IsZero() {
+				record[i] = v.Local().Format(timeLayout)
+			}
+		}
+	}
+	if err := w.writer.Write(record); err != nil {
+		return err
+	}
+	// 每行及时写出，导出大量数据时客户端可以边下载边接收
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+func (w *csvWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// NDJSON，每行一个以列Key为字段名的对象，时间为RFC 3339格式
+type ndjsonWriter struct {
+	encoder *json.Encoder
+	columns []Column
+}
+
+func (w *ndjsonWriter) Header(columns []Column) error {
+	w.columns = columns
+	return nil
+}
+
+func (w *ndjsonWriter) Row(values []interface{}) error {
+	object := make(map[string]interface{}, len(values))
+	for i, value := range values {
+		if t, ok := value.(time.Time); ok && t.IsZero() {
+			value = nil
+		}
+		object[w.columns[i].Key] = value
+	}
+	return w.encoder.Encode(object)
+}
+
+func (w *ndjsonWriter) Close() error {
+	return nil
+}
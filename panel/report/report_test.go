@@ -0,0 +1,201 @@
+package report
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testColumns = []Column{{"name", "名称"}, {"speed", "速度"}, {"count", "次数"}, {"time", "时间"}, {"note", "备注"}}
+
+func testRows() [][]interface{} {
+	at := time.Date(2026, 5, 1, 12, 30, 15, 0, time.UTC)
+	return [][]interface{}{
+		{"节点A", 93.25, int64(3), at, nil},
+		{"=SUM(A1)", 0.0, int64(-1), time.Time{}, "a,\"b\"\nc"},
+	}
+}
+
+func writeAll(t *testing.T, format string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(format, &buf, "结果")
+	if err != nil {
+		t.Fatalf("NewWriter(%s): %v", format, err)
+	}
+	if err := w.Header(testColumns); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range testRows() {
+		if err := w.Row(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestNewWriterInvalidFormat(t *testing.T) {
+	if _, err := NewWriter("pdf", &bytes.Buffer{}, ""); err == nil {
+		t.Error("无效的格式应返回错误")
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	local := time.Date(2026, 5, 1, 12, 30, 15, 0, time.UTC).Local().Format(timeLayout)
+	want := "\xEF\xBB\xBF" +
+		"名称,速度,次数,时间,备注\n" +
+		"节点A,93.25,3," + local + ",\n" +
+		"'=SUM(A1),0,-1,,\"a,\"\"b\"\"\nc\"\n"
+	if got := string(writeAll(t, FormatCSV)); got != want {
+		t.Errorf("CSV =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestCSVFormulaPrefix(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"abc", "abc"},
+		{"=1+1", "'=1+1"},
+		{"+86", "'+86"},
+		{"-5", "'-5"},
+		{"@cmd", "'@cmd"},
+		{"a=b", "a=b"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w, _ := newCSVWriter(&buf)
+		w.Row([]interface{}{tt.value})
+		got := strings.TrimSuffix(strings.TrimPrefix(buf.String(), "\xEF\xBB\xBF"), "\n")
+		if got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	want := `{"count":3,"name":"节点A","note":null,"speed":93.25,"time":"2026-05-01T12:30:15Z"}` + "\n" +
+		`{"count":-1,"name":"=SUM(A1)","note":"a,\"b\"\nc","speed":0,"time":null}` + "\n"
+	if got := string(writeAll(t, FormatNDJSON)); got != want {
+		t.Errorf("NDJSON =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// 工作表中的单元格
+type xlsxCell struct {
+	Style  string `xml:"s,attr"`
+	Type   string `xml:"t,attr"`
+	Value  string `xml:"v"`
+	Inline string `xml:"is>t"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		R     string     `xml:"r,attr"`
+		Cells []xlsxCell `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func TestXLSXWriter(t *testing.T) {
+	data := writeAll(t, FormatXLSX)
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("不是有效的压缩包: %v", err)
+	}
+	files := make(map[string][]byte)
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], _ = ioutil.ReadAll(r)
+		r.Close()
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("缺少 %s", name)
+		}
+	}
+	if !bytes.Contains(files["xl/workbook.xml"], []byte(`<sheet name="结果"`)) {
+		t.Errorf("工作表名称错误: %s", files["xl/workbook.xml"])
+	}
+
+	var sheet xlsxSheet
+	if err := xml.Unmarshal(files["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatalf("工作表不是有效的XML: %v", err)
+	}
+	if len(sheet.Rows) != 3 {
+		t.Fatalf("行数 = %d, want 3", len(sheet.Rows))
+	}
+
+	header := sheet.Rows[0].Cells
+	if header[0].Inline != "名称" || header[0].Style != "1" {
+		t.Errorf("表头 = %+v", header[0])
+	}
+	row := sheet.Rows[1].Cells
+	if sheet.Rows[1].R != "2" || row[0].Inline != "节点A" || row[1].Value != "93.25" || row[2].Value != "3" {
+		t.Errorf("第二行 = %+v", row)
+	}
+	at := time.Date(2026, 5, 1, 12, 30, 15, 0, time.UTC)
+	if want := strconv.FormatFloat(excelTime(at), 'f', -1, 64); row[3].Style != "2" || row[3].Value != want {
+		t.Errorf("时间单元格 = %+v, want %s", row[3], want)
+	}
+	if row[4] != (xlsxCell{}) {
+		t.Errorf("空单元格 = %+v", row[4])
+	}
+	row = sheet.Rows[2].Cells
+	// Excel不执行内联字符串中的公式，不需要加前缀
+	if row[0].Inline != "=SUM(A1)" || row[3] != (xlsxCell{}) || row[4].Inline != "a,\"b\"\nc" {
+		t.Errorf("第三行 = %+v", row)
+	}
+}
+
+func TestExcelTime(t *testing.T) {
+	loc := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = loc }()
+
+	tests := []struct {
+		t    time.Time
+		want float64
+	}{
+		{time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC), 0},
+		{time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC), 2},
+		{time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC), 46143.5},
+		{time.Date(2026, 5, 1, 0, 0, 0, 1500000, time.UTC), 46143 + 2.0/86400000},
+		// 按本地时间换算，不同时区的同一时刻结果相同
+		{time.Date(2026, 5, 1, 20, 0, 0, 0, time.FixedZone("UTC+8", 8*3600)), 46143.5},
+	}
+	for _, tt := range tests {
+		if got := excelTime(tt.t); got != tt.want {
+			t.Errorf("excelTime(%v) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestSheetName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"", "Sheet1"},
+		{"测速结果", "测速结果"},
+		{"a/b:c[1]?*\\", "a_b_c_1____"},
+		{strings.Repeat("节", 40), strings.Repeat("节", 31)},
+	}
+	for _, tt := range tests {
+		if got := sheetName(tt.name); got != tt.want {
+			t.Errorf("sheetName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package rollup
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"../config"
+	"../models"
+)
+
+const (
+	// 执行间隔的下限
+	minInterval = time.Minute
+	// 原始结果至少保留的天数，保证每日汇总计算完成后才删除
+	minRetentionDays = 2
+	// 已删除原始结果的位置，该时间之前的时间段无法重新汇总
+	prunedBeforeKey = "rollup_pruned_before"
+	// 每批删除的原始结果数，避免长时间锁住数据库
+	pruneBatchSize = 5000
+)
+
+// Stats 一次汇总和清理的结果
+type Stats struct {
+	HourlyBuckets int   `json:"hourly_buckets"` // 计算的小时数
+	DailyBuckets  int   `json:"daily_buckets"`  // 计算的天数
+	PrunedResults int64 `json:"pruned_results"` // 删除的原始结果数
+	PrunedRollups int64 `json:"pruned_rollups"` // 删除的过期小时汇总数
+}
+
+var (
+	stop  chan struct{}
+	done  chan struct{}
+	mutex sync.Mutex
+
+	// 串行执行汇总，后台任务和手动触发不同时进行
+	compactMutex sync.Mutex
+)
+
+// Start 启动后台汇总任务，定期计算已结束时间段的小时和每日汇总，并按保留期限删除原始结果
+func Start() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if stop != nil {
+		return
+	}
+	stop = make(chan struct{})
+	done = make(chan struct{})
+	go run(stop, done)
+}
+
+// Stop 停止后台汇总任务，进行中的汇总在当前时间段完成后退出
+func Stop() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+	stop = nil
+	done = nil
+}
+
+func run(stop, done chan struct{}) {
+	defer close(done)
+
+	for {
+		stats, err := compact(time.Now(), stop)
+		if err != nil {
+			log.Printf("汇总测速结果失败: %v", err)
+		} else if stats.PrunedResults > 0 || stats.PrunedRollups > 0 {
+			log.Printf("已删除 %d 条过期的测速结果和 %d 条过期的小时汇总", stats.PrunedResults, stats.PrunedRollups)
+		}
+
+		interval := time.Duration(config.GetConfig().CompactInterval) * time.Minute
+		if interval < minInterval {
+			interval = minInterval
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Compact 立即执行一次汇总和清理
+func Compact() (Stats, error) {
+	return compact(time.Now(), nil)
+}
+
+func compact(now time.Time, stop chan struct{}) (Stats, error) {
+	compactMutex.Lock()
+	defer compactMutex.Unlock()
+
+	var stats Stats
+	prunedBefore := getTime(prunedBeforeKey)
+
+	hourly, hourEnd, err := compactPeriod(models.RollupHour, now, prunedBefore, stop)
+	stats.HourlyBuckets = hourly
+	if err != nil {
+		return stats, err
+	}
+	daily, dayEnd, err := compactPeriod(models.RollupDay, now, prunedBefore, stop)
+	stats.DailyBuckets = daily
+	if err != nil {
+		return stats, err
+	}
+	if stopped(stop) {
+		return stats, nil
+	}
+
+	cfg := config.GetConfig()
+	if cfg.ResultRetentionDays > 0 {
+		days := cfg.ResultRetentionDays
+		if days < minRetentionDays {
+			days = minRetentionDays
+		}
+		// 尚未汇总的时间段必须保留原始结果
+		cutoff := now.AddDate(0, 0, -days)
+		if hourEnd.Before(cutoff) {
+			cutoff = hourEnd
+		}
+		if dayEnd.Before(cutoff) {
+			cutoff = dayEnd
+		}
+		if stats.PrunedResults, err = models.PruneSpeedTestResults(cutoff, pruneBatchSize); err != nil {
+			return stats, fmt.Errorf("删除过期测速结果失败: %v", err)
+		}
+		if cutoff.After(prunedBefore) {
+			if err := models.SaveSetting(prunedBeforeKey, cutoff.Format(time.RFC3339Nano)); err != nil {
+				return stats, err
+			}
+		}
+	}
+	if cfg.HourlyRollupRetentionDays > 0 {
+		cutoff := now.AddDate(0, 0, -cfg.HourlyRollupRetentionDays)
+		if stats.PrunedRollups, err = models.DeleteRollupsBefore(models.RollupHour, cutoff); err != nil {
+			return stats, fmt.Errorf("删除过期小时汇总失败: %v", err)
+		}
+	}
+	return stats, nil
+}
+
+// 计算从上次汇总位置到当前时间段之前的所有汇总，再重新计算被标记的时间段，
+// 返回计算的时间段数和汇总位置，汇总位置保存在系统设置中。
+// prunedBefore之前的时间段原始结果已删除，不再重新计算
+func compactPeriod(period models.RollupPeriod, now, prunedBefore time.Time, stop chan struct{}) (int, time.Time, error) {
+	key := fmt.Sprintf("rollup_%s_watermark", period)
+	end := period.Start(now)
+
+	from := getTime(key)
+	if from.IsZero() {
+		oldest, err := models.GetOldestFinishedResultTime()
+		if err != nil || oldest.IsZero() {
+			return 0, end, err
+		}
+		from = period.Start(oldest)
+	}
+
+	buckets := 0
+	for ; from.Before(end); from = period.Next(from) {
+		if stopped(stop) {
+			return buckets, from, nil
+		}
+		if err := replaceBucket(period, from); err != nil {
+			return buckets, from, err
+		}
+		if err := models.SaveSetting(key, period.Next(from).Format(time.RFC3339Nano)); err != nil {
+			return buckets, from, err
+		}
+		buckets++
+	}
+
+	dirty, err := models.GetDirtyRollups(period)
+	if err != nil {
+		return buckets, from, err
+	}
+	for _, bucket := range dirty {
+		if stopped(stop) {
+			return buckets, from, nil
+		}
+		// 先清除标记，重新计算期间结束的测试会再次标记
+		if err := models.ClearDirtyRollup(period, bucket); err != nil {
+			return buckets, from, err
+		}
+		if bucket.Before(prunedBefore) {
+			log.Printf("%s 汇总 %s 的原始结果已删除，忽略之后结束的测试", period, bucket.Format(time.RFC3339))
+			continue
+		}
+		if err := replaceBucket(period, bucket); err != nil {
+			models.MarkDirtyRollup(period, bucket)
+			return buckets, from, err
+		}
+		buckets++
+	}
+	return buckets, from, nil
+}
+
+// 根据原始结果重新计算一个时间段的汇总
+func replaceBucket(period models.RollupPeriod, bucket time.Time) error {
+	results, err := models.GetRollupInputs(bucket, period.Next(bucket))
+	if err != nil {
+		return err
+	}
+	return models.ReplaceRollups(period, bucket, summarize(results))
+}
+
+// 读取系统设置中保存的时间，未设置或无效时返回零值
+func getTime(key string) time.Time {
+	value, err := models.GetSetting(key)
+	if err != nil || value == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		log.Printf("系统设置 %s 无效: %q", key, value)
+		return time.Time{}
+	}
+	return t
+}
+
+func stopped(stop chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// 汇总的分组：节点对和测试类型
+type groupKey struct {
+	source, target string
+	testType       models.SpeedTestType
+}
+
+// 按节点对、测试类型和指标汇总测试结果
+func summarize(results []models.SpeedTestResult) []models.Rollup {
+	failed := make(map[groupKey]int)
+	values := make(map[groupKey]map[string][]float64)
+	for i := range results {
+		result := &results[i]
+		key := groupKey{result.SourceNodeID, result.TargetNodeID, result.Type}
+		if values[key] == nil {
+			values[key] = make(map[string][]float64)
+		}
+		if result.Status != models.SpeedTestStatusCompleted {
+			failed[key]++
+			continue
+		}
+		for _, metric := range models.Metrics {
+			if value, ok := result.Metric(metric); ok {
+				values[key][metric] = append(values[key][metric], value)
+			}
+		}
+	}
+
+	var rollups []models.Rollup
+	for key, metricValues := range values {
+		// 只有失败测试的分组也为该类型的每个指标记录一条，以保留失败次数
+		probe := models.SpeedTestResult{Type: key.testType}
+		for _, metric := range models.Metrics {
+			if _, ok := probe.Metric(metric); !ok {
+				continue
+			}
+			rollup := models.Rollup{
+				SourceNodeID: key.source,
+				TargetNodeID: key.target,
+				Type:         key.testType,
+				Metric:       metric,
+				Failed:       failed[key],
+			}
+			fill(&rollup, metricValues[metric])
+			rollups = append(rollups, rollup)
+		}
+	}
+	return rollups
+}
+
+// Aggregate 计算一组指标值的数量、最小值、平均值、最大值和百分位数
+func Aggregate(values []float64) models.Rollup {
+	var rollup models.Rollup
+	fill(&rollup, values)
+	return rollup
+}
+
+// 计算数量、最小值、平均值、最大值和百分位数
+func fill(rollup *models.Rollup, values []float64) {
+	rollup.Count = len(values)
+	if len(values) == 0 {
+		return
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	rollup.Min = sorted[0]
+	rollup.Max = sorted[len(sorted)-1]
+	rollup.Avg = sum / float64(len(sorted))
+	rollup.P50 = percentile(sorted, 0.50)
+	rollup.P95 = percentile(sorted, 0.95)
+	rollup.P99 = percentile(sorted, 0.99)
+}
+
+// 按最近秩法计算已排序数据的百分位数
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
@@ -0,0 +1,102 @@
+package rollup
+
+import (
+	"testing"
+
+	"../models"
+)
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name   string
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{"单个值", []float64{7}, 0.95, 7},
+		{"p0取最小值", []float64{1, 2, 3}, 0, 1},
+		{"中位数", []float64{1, 2, 3, 4}, 0.50, 2},
+		{"奇数个中位数", []float64{1, 2, 3, 4, 5}, 0.50, 3},
+		{"p95最近秩", []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 0.95, 10},
+		{"p90刚好整秩", []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 0.90, 9},
+		{"p100取最大值", []float64{1, 2, 3}, 1, 3},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.sorted, tt.p); got != tt.want {
+			t.Errorf("%s: percentile(%v, %v) = %v, want %v", tt.name, tt.sorted, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   models.Rollup
+	}{
+		{"空", nil, models.Rollup{}},
+		{"单个值", []float64{5}, models.Rollup{Count: 1, Min: 5, Avg: 5, Max: 5, P50: 5, P95: 5, P99: 5}},
+		{"未排序", []float64{30, 10, 20, 40}, models.Rollup{Count: 4, Min: 10, Avg: 25, Max: 40, P50: 20, P95: 40, P99: 40}},
+	}
+	for _, tt := range tests {
+		if got := Aggregate(tt.values); got != tt.want {
+			t.Errorf("%s: Aggregate(%v) = %+v, want %+v", tt.name, tt.values, got, tt.want)
+		}
+	}
+
+	values := []float64{3, 1, 2}
+	Aggregate(values)
+	if values[0] != 3 || values[1] != 1 || values[2] != 2 {
+		t.Errorf("Aggregate 修改了输入: %v", values)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	results := []models.SpeedTestResult{
+		{SourceNodeID: "a", TargetNodeID: "b", Type: models.SpeedTestTypePing, Status: models.SpeedTestStatusCompleted, Ping: 10, Jitter: 1},
+		{SourceNodeID: "a", TargetNodeID: "b", Type: models.SpeedTestTypePing, Status: models.SpeedTestStatusCompleted, Ping: 30, Jitter: 3},
+		{SourceNodeID: "a", TargetNodeID: "b", Type: models.SpeedTestTypePing, Status: models.SpeedTestStatusTimeout},
+		{SourceNodeID: "a", TargetNodeID: "c", Type: models.SpeedTestTypeDownload, Status: models.SpeedTestStatusFailed},
+		{SourceNodeID: "b", TargetNodeID: "a", Type: models.SpeedTestTypeDownload, Status: models.SpeedTestStatusCompleted, DownloadSpeed: 100, Ping: 99},
+	}
+
+	type key struct {
+		source, target, metric string
+	}
+	got := make(map[key]models.Rollup)
+	for _, r := range summarize(results) {
+		k := key{r.SourceNodeID, r.TargetNodeID, r.Metric}
+		if _, ok := got[k]; ok {
+			t.Fatalf("重复的汇总: %+v", k)
+		}
+		got[k] = r
+	}
+
+	tests := []struct {
+		key    key
+		count  int
+		failed int
+		avg    float64
+	}{
+		{key{"a", "b", models.MetricPing}, 2, 1, 20},
+		{key{"a", "b", models.MetricJitter}, 2, 1, 2},
+		{key{"a", "b", models.MetricPacketLoss}, 2, 1, 0},
+		// 只有失败测试的分组也保留失败次数
+		{key{"a", "c", models.MetricDownloadSpeed}, 0, 1, 0},
+		{key{"b", "a", models.MetricDownloadSpeed}, 1, 0, 100},
+	}
+	for _, tt := range tests {
+		r, ok := got[tt.key]
+		if !ok {
+			t.Errorf("缺少汇总 %+v", tt.key)
+			continue
+		}
+		if r.Count != tt.count || r.Failed != tt.failed || r.Avg != tt.avg {
+			t.Errorf("%+v: count=%d failed=%d avg=%v, want count=%d failed=%d avg=%v",
+				tt.key, r.Count, r.Failed, r.Avg, tt.count, tt.failed, tt.avg)
+		}
+	}
+	if len(got) != len(tests) {
+		t.Errorf("汇总数 = %d, want %d（下载测试不应汇总延迟）", len(got), len(tests))
+	}
+}
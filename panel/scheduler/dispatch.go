@@ -0,0 +1,167 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+
+	"../../common/signature"
+	"../auth"
+	"../config"
+	"../models"
+)
+
+// 节点未上报监听端口时使用的默认端口，与节点默认配置一致
+const defaultNodePort = "8081"
+
+// Assignment 随心跳响应下发给源节点的测试
+type Assignment struct {
+	ID            string               `json:"id"`
+	SourceNodeID  string               `json:"source_node_id"`
+	TargetNodeID  string               `json:"target_node_id"`
+	TargetBaseURL string               `json:"target_base_url"` // 目标节点测速接口的地址
+	TargetToken   string               `json:"target_token"`    // 访问目标节点测速接口的令牌
+	Type          models.SpeedTestType `json:"type"`
+	Timeout       int                  `json:"timeout"`
+	Threads       int                  `json:"threads,omitempty"`
+	Size          int                  `json:"size,omitempty"`
+}
+
+// Enqueue 校验测速请求并创建等待中的测试，源节点在下一次心跳时领取，
+// 手动测试、定时测试和全网格测速都通过这里创建
+func Enqueue(req models.SpeedTestRequest) (*models.SpeedTestResult, error) {
+	if !req.Type.Valid() {
+		return nil, fmt.Errorf("无效的测试类型: %s", req.Type)
+	}
+	if req.SourceNodeID == req.TargetNodeID {
+		return nil, fmt.Errorf("源节点和目标节点不能相同")
+	}
+	if _, err := models.GetNode(req.SourceNodeID); err != nil {
+		return nil, fmt.Errorf("源节点不存在: %s", req.SourceNodeID)
+	}
+	if _, err := models.GetNode(req.TargetNodeID); err != nil {
+		return nil, fmt.Errorf("目标节点不存在: %s", req.TargetNodeID)
+	}
+
+	result := &models.SpeedTestResult{
+		ID:           uuid.New().String(),
+		SourceNodeID: req.SourceNodeID,
+		TargetNodeID: req.TargetNodeID,
+		Type:         req.Type,
+		Status:       models.SpeedTestStatusPending,
+		StartTime:    time.Now(),
+		ScheduleID:   req.ScheduleID,
+		MeshRunID:    req.MeshRunID,
+		Timeout:      req.Timeout,
+		Threads:      req.Threads,
+		Size:         req.Size,
+	}
+	if err := models.SaveSpeedTestResult(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Claim 领取调度队列允许源节点开始的测试，转换为下发给节点的格式
+func Claim(node *models.Node) []Assignment {
+	tests, err := claimQueued(node.ID)
+	if err != nil {
+		log.Printf("领取节点 %s 的测试失败: %v", node.ID, err)
+	}
+	if len(tests) == 0 {
+		return nil
+	}
+
+	cfg := config.GetConfig()
+	defaultTimeout := models.GetIntSetting("speedtest_timeout", cfg.SpeedtestTimeout)
+
+	assignments := make([]Assignment, 0, len(tests))
+	for _, test := range tests {
+		target, err := models.GetNode(test.TargetNodeID)
+		if err != nil {
+			failTest(test, fmt.Sprintf("目标节点不存在: %s", test.TargetNodeID))
+			continue
+		}
+
+		timeout := test.Timeout
+		if timeout <= 0 {
+			timeout = defaultTimeout
+		}
+
+		token, err := targetToken(test, timeout)
+		if err != nil {
+			failTest(test, fmt.Sprintf("签发目标令牌失败: %v", err))
+			continue
+		}
+
+		assignments = append(assignments, Assignment{
+			ID:            test.ID,
+			SourceNodeID:  test.SourceNodeID,
+			TargetNodeID:  test.TargetNodeID,
+			TargetBaseURL: targetBaseURL(target, cfg.TLSEnabled),
+			TargetToken:   token,
+			Type:          test.Type,
+			Timeout:       timeout,
+			Threads:       test.Threads,
+			Size:          test.Size,
+		})
+	}
+	return assignments
+}
+
+// 目标节点测速接口的地址，启用TLS时节点之间使用面板签发的证书认证
+func targetBaseURL(node *models.Node, tlsEnabled bool) string {
+	scheme := "http"
+	if tlsEnabled {
+		scheme = "https"
+	}
+	port := node.ListenPort
+	if port == "" {
+		port = defaultNodePort
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(node.IP, port))
+}
+
+// 签发访问目标节点测速接口的令牌，有效期为测试超时时间加上允许的时钟偏差。
+// 使用目标节点最近使用的密钥签发，轮换期间节点可能仍在使用旧密钥
+func targetToken(test models.SpeedTestResult, timeout int) (string, error) {
+	keys, err := models.GetActiveNodeKeys(test.TargetNodeID)
+	if err != nil {
+		return "", err
+	}
+
+	var current *models.NodeKey
+	for i := range keys {
+		key := &keys[i]
+		if current == nil || (key.LastUsedAt != nil && (current.LastUsedAt == nil || key.LastUsedAt.After(*current.LastUsedAt))) {
+			current = key
+		}
+	}
+	if current == nil {
+		return "", fmt.Errorf("目标节点没有有效的密钥")
+	}
+
+	signingKey, err := auth.OpenSigningKey(current.Secret)
+	if err != nil {
+		return "", err
+	}
+	return signature.SignTargetToken(signingKey, signature.TargetClaims{
+		TestID:       test.ID,
+		SourceNodeID: test.SourceNodeID,
+		TargetNodeID: test.TargetNodeID,
+		ExpiresAt:    time.Now().Add(time.Duration(timeout)*time.Second + signature.MaxClockSkew).Unix(),
+	})
+}
+
+// 将无法下发的测试标记为失败
+func failTest(test models.SpeedTestResult, message string) {
+	test.Status = models.SpeedTestStatusFailed
+	test.ErrorMessage = message
+	test.EndTime = time.Now()
+	if err := models.SaveSpeedTestResult(&test); err != nil {
+		log.Printf("更新测试 %s 状态失败: %v", test.ID, err)
+	}
+}
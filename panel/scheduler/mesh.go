@@ -0,0 +1,282 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"../models"
+)
+
+// 全网格测速最多包含的节点数
+const maxMeshNodes = 50
+
+// 串行推进全网格测速，避免定时检查和结果上报同时下发同一轮测试
+var meshMutex sync.Mutex
+
+// MeshRounds 将节点之间的所有有序节点对分配到各轮次。
+// 吞吐量测试使用循环赛编排（圆桌法），每轮中每个节点最多参与一个测试，
+// 前 n-1 轮覆盖每对节点的一个方向，后 n-1 轮覆盖反方向；
+// Ping测试占用带宽很少，所有节点对在同一轮完成
+func MeshRounds(nodeIDs []string, testType models.SpeedTestType) [][][2]string {
+	if len(nodeIDs) < 2 {
+		return nil
+	}
+
+	if testType == models.SpeedTestTypePing {
+		var round [][2]string
+		for _, source := range nodeIDs {
+			for _, target := range nodeIDs {
+				if source != target {
+					round = append(round, [2]string{source, target})
+				}
+			}
+		}
+		return [][][2]string{round}
+	}
+
+	// 节点数为奇数时补一个空位，与空位配对的节点本轮轮空
+	ids := append([]string(nil), nodeIDs...)
+	if len(ids)%2 == 1 {
+		ids = append(ids, "")
+	}
+	n := len(ids)
+
+	forward := make([][][2]string, 0, n-1)
+	for r := 0; r < n-1; r++ {
+		var round [][2]string
+		for i := 0; i < n/2; i++ {
+			a, b := ids[i], ids[n-1-i]
+			if a == "" || b == "" {
+				continue
+			}
+			// 交替方向，使每个节点作为源节点的次数大致相同
+			if (r+i)%2 == 1 {
+				a, b = b, a
+			}
+			round = append(round, [2]string{a, b})
+		}
+		forward = append(forward, round)
+
+		// 第一个节点固定，其余节点顺时针轮转一位
+		last := ids[n-1]
+		copy(ids[2:], ids[1:n-1])
+		ids[1] = last
+	}
+
+	rounds := forward
+	for _, round := range forward {
+		reversed := make([][2]string, len(round))
+		for i, pair := range round {
+			reversed[i] = [2]string{pair[1], pair[0]}
+		}
+		rounds = append(rounds, reversed)
+	}
+	return rounds
+}
+
+// MeshNodeIDs 按节点ID或标签选择全网格测速的节点，指定ID时保持请求中的顺序
+func MeshNodeIDs(ids []string, tag string) ([]string, error) {
+	if len(ids) > 0 {
+		return ids, nil
+	}
+	if tag == "" {
+		return nil, fmt.Errorf("需要指定节点或节点标签")
+	}
+
+	nodes, err := models.GetAllNodes()
+	if err != nil {
+		return nil, err
+	}
+	var selected []string
+	for _, node := range selectNodes(nodes, nil, tag) {
+		selected = append(selected, node.ID)
+	}
+	return selected, nil
+}
+
+// StartMeshRun 校验并保存全网格测速，立即下发第一轮测试
+func StartMeshRun(run *models.MeshRun) error {
+	if len(run.NodeIDs) < 2 {
+		return fmt.Errorf("全网格测速至少需要 2 个节点")
+	}
+	if len(run.NodeIDs) > maxMeshNodes {
+		return fmt.Errorf("全网格测速最多包含 %d 个节点", maxMeshNodes)
+	}
+	seen := make(map[string]bool, len(run.NodeIDs))
+	for _, id := range run.NodeIDs {
+		if seen[id] {
+			return fmt.Errorf("节点重复: %s", id)
+		}
+		seen[id] = true
+		if _, err := models.GetNode(id); err != nil {
+			return fmt.Errorf("节点不存在: %s", id)
+		}
+	}
+
+	if !run.Type.Valid() {
+		return fmt.Errorf("无效的测试类型: %s", run.Type)
+	}
+	if run.Timeout < 0 || run.Timeout > 3600 {
+		return fmt.Errorf("超时时间应为 0-3600 秒")
+	}
+	if run.Threads < 0 || run.Threads > 64 {
+		return fmt.Errorf("线程数应为 0-64")
+	}
+	if run.Size < 0 || run.Size > 1000 {
+		return fmt.Errorf("下载数据量应为 0-1000 MB")
+	}
+
+	run.Status = models.MeshRunStatusRunning
+	run.Round = 0
+	run.TotalRounds = len(MeshRounds(run.NodeIDs, run.Type))
+	if err := models.SaveMeshRun(run); err != nil {
+		return err
+	}
+
+	meshMutex.Lock()
+	defer meshMutex.Unlock()
+	return advanceMeshRun(run)
+}
+
+// CancelMeshRun 取消全网格测速，尚未下发的测试标记为已取消，已下发的测试继续运行
+func CancelMeshRun(id string) (*models.MeshRun, error) {
+	meshMutex.Lock()
+	defer meshMutex.Unlock()
+
+	run, err := models.GetMeshRun(id)
+	if err != nil {
+		return nil, err
+	}
+	if run.Status != models.MeshRunStatusRunning {
+		return nil, fmt.Errorf("全网格测速已结束")
+	}
+
+	if _, err := models.CancelPendingMeshTests(run.ID); err != nil {
+		return nil, err
+	}
+	run.Status = models.MeshRunStatusCancelled
+	run.FinishedAt = time.Now()
+	if err := models.SaveMeshRun(run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// AdvanceMeshRuns 检查运行中的全网格测速，当前轮次的测试都结束后下发下一轮
+func AdvanceMeshRuns() {
+	runs, err := models.GetRunningMeshRuns()
+	if err != nil {
+		log.Printf("读取全网格测速失败: %v", err)
+		return
+	}
+	for i := range runs {
+		AdvanceMeshRun(runs[i].ID)
+	}
+}
+
+// AdvanceMeshRun 推进单个全网格测速，测试结果上报后调用可以减少轮次之间的等待
+func AdvanceMeshRun(id string) {
+	meshMutex.Lock()
+	defer meshMutex.Unlock()
+
+	run, err := models.GetMeshRun(id)
+	if err != nil {
+		log.Printf("读取全网格测速 %s 失败: %v", id, err)
+		return
+	}
+	if run.Status != models.MeshRunStatusRunning {
+		return
+	}
+	if err := advanceMeshRun(run); err != nil {
+		log.Printf("推进全网格测速 %s 失败: %v", run.Name, err)
+	}
+}
+
+// 当前轮次没有等待中和运行中的测试时下发下一轮，全部轮次结束后标记为已完成。
+// 调用方需要持有meshMutex
+func advanceMeshRun(run *models.MeshRun) error {
+	counts, err := models.CountMeshRunTests(run.ID)
+	if err != nil {
+		return err
+	}
+	if counts[models.SpeedTestStatusPending]+counts[models.SpeedTestStatusRunning] > 0 {
+		return nil
+	}
+
+	rounds := MeshRounds(run.NodeIDs, run.Type)
+	for run.Round < len(rounds) {
+		run.Round++
+		created, err := dispatchMeshRound(run, rounds[run.Round-1])
+		if err != nil {
+			return err
+		}
+		// 本轮的节点都不在线时没有需要等待的测试，直接进入下一轮
+		if created > 0 {
+			return models.SaveMeshRun(run)
+		}
+	}
+
+	run.Status = models.MeshRunStatusCompleted
+	run.FinishedAt = time.Now()
+	log.Printf("全网格测速 %s 已完成", run.Name)
+	return models.SaveMeshRun(run)
+}
+
+// 下发一轮测试，节点不在线的节点对直接记录为失败，返回实际下发的测试数量
+func dispatchMeshRound(run *models.MeshRun, round [][2]string) (int, error) {
+	created := 0
+	for _, pair := range round {
+		req := models.SpeedTestRequest{
+			SourceNodeID: pair[0],
+			TargetNodeID: pair[1],
+			Type:         run.Type,
+			Timeout:      run.Timeout,
+			Threads:      run.Threads,
+			Size:         run.Size,
+			MeshRunID:    run.ID,
+		}
+
+		if reason := meshPairUnavailable(pair); reason != "" {
+			now := time.Now()
+			result := &models.SpeedTestResult{
+				ID:           uuid.New().String(),
+				SourceNodeID: req.SourceNodeID,
+				TargetNodeID: req.TargetNodeID,
+				Type:         req.Type,
+				Status:       models.SpeedTestStatusFailed,
+				StartTime:    now,
+				EndTime:      now,
+				ErrorMessage: reason,
+				MeshRunID:    run.ID,
+			}
+			if err := models.SaveSpeedTestResult(result); err != nil {
+				return created, err
+			}
+			continue
+		}
+
+		if _, err := Enqueue(req); err != nil {
+			return created, err
+		}
+		created++
+	}
+	return created, nil
+}
+
+// 节点对无法测试的原因，节点都在线时返回空字符串
+func meshPairUnavailable(pair [2]string) string {
+	for _, id := range pair {
+		node, err := models.GetNode(id)
+		if err != nil {
+			return fmt.Sprintf("节点不存在: %s", id)
+		}
+		if node.Status != models.NodeStatusOnline {
+			return fmt.Sprintf("节点 %s 不在线", node.Name)
+		}
+	}
+	return ""
+}
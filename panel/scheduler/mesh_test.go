@@ -0,0 +1,65 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+
+	"../models"
+)
+
+func TestMeshRounds(t *testing.T) {
+	tests := []struct {
+		nodes    int
+		testType models.SpeedTestType
+		rounds   int
+	}{
+		{0, models.SpeedTestTypeFull, 0},
+		{1, models.SpeedTestTypeFull, 0},
+		{2, models.SpeedTestTypeFull, 2},
+		{3, models.SpeedTestTypeDownload, 6},
+		{4, models.SpeedTestTypeUpload, 6},
+		{5, models.SpeedTestTypeFull, 10},
+		{8, models.SpeedTestTypeFull, 14},
+		{1, models.SpeedTestTypePing, 0},
+		{5, models.SpeedTestTypePing, 1},
+	}
+	for _, tt := range tests {
+		ids := make([]string, tt.nodes)
+		for i := range ids {
+			ids[i] = fmt.Sprintf("n%d", i)
+		}
+		rounds := MeshRounds(ids, tt.testType)
+		if len(rounds) != tt.rounds {
+			t.Errorf("%d 个节点 %s: %d 轮，want %d", tt.nodes, tt.testType, len(rounds), tt.rounds)
+			continue
+		}
+
+		// 每个有向节点对恰好测试一次
+		seen := make(map[[2]string]bool)
+		for r, round := range rounds {
+			busy := make(map[string]bool)
+			for _, pair := range round {
+				if pair[0] == pair[1] || pair[0] == "" || pair[1] == "" {
+					t.Errorf("%d 个节点 %s: 无效的节点对 %v", tt.nodes, tt.testType, pair)
+				}
+				if seen[pair] {
+					t.Errorf("%d 个节点 %s: 节点对 %v 重复", tt.nodes, tt.testType, pair)
+				}
+				seen[pair] = true
+
+				// 吞吐量测试每轮中每个节点最多参与一个测试
+				if tt.testType != models.SpeedTestTypePing {
+					for _, id := range pair {
+						if busy[id] {
+							t.Errorf("%d 个节点 %s: 节点 %s 在第 %d 轮参与多个测试", tt.nodes, tt.testType, id, r+1)
+						}
+						busy[id] = true
+					}
+				}
+			}
+		}
+		if want := tt.nodes * (tt.nodes - 1); len(seen) != want && tt.nodes > 1 {
+			t.Errorf("%d 个节点 %s: 覆盖 %d 个节点对，want %d", tt.nodes, tt.testType, len(seen), want)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"../config"
+	"../models"
+)
+
+// JobClass 测试的来源，决定在调度队列中的基础优先级
+type JobClass string
+
+const (
+	JobClassManual    JobClass = "manual"    // 手动发起
+	JobClassMesh      JobClass = "mesh"      // 全网格测速
+	JobClassScheduled JobClass = "scheduled" // 定时任务
+)
+
+// 各来源的基础优先级，数值越小越优先
+var classPriority = map[JobClass]int{
+	JobClassManual:    0,
+	JobClassMesh:      1,
+	JobClassScheduled: 2,
+}
+
+// 排队测试的状态
+const (
+	JobStateReady   = "ready"   // 可以开始，等待源节点下一次心跳领取
+	JobStateBlocked = "blocked" // 受并发限制或优先级更高的测试阻塞
+)
+
+// QueueLimits 调度队列的并发限制
+type QueueLimits struct {
+	MaxConcurrent int `json:"max_concurrent_tests"` // 全局同时运行的最大测试数
+	MaxPerNode    int `json:"max_tests_per_node"`   // 每个节点同时参与的最大测试数
+	AgingTime     int `json:"queue_aging_time"`     // 每等待该时间（秒）提升一级优先级
+}
+
+// QueuedJob 调度队列中的测试
+type QueuedJob struct {
+	ID           string               `json:"id"`
+	SourceNodeID string               `json:"source_node_id"`
+	TargetNodeID string               `json:"target_node_id"`
+	Type         models.SpeedTestType `json:"type"`
+	Class        JobClass             `json:"class"`
+	ScheduleID   string               `json:"schedule_id,omitempty"`
+	MeshRunID    string               `json:"mesh_run_id,omitempty"`
+	EnqueuedAt   time.Time            `json:"enqueued_at"`
+	WaitSeconds  int64                `json:"wait_seconds"`
+	Priority     float64              `json:"priority"` // 计入等待时间后的优先级，数值越小越优先
+	Position     int                  `json:"position"` // 在队列中的位置，从1开始
+	State        string               `json:"state"`
+	Reason       string               `json:"reason,omitempty"` // 阻塞原因
+}
+
+// QueueState 调度队列的当前状态
+type QueueState struct {
+	Limits      QueueLimits    `json:"limits"`
+	Running     int            `json:"running"`
+	Pending     int            `json:"pending"`
+	NodeRunning map[string]int `json:"node_running"` // 各节点正在参与的测试数
+	Jobs        []QueuedJob    `json:"jobs"`
+}
+
+// 领取和计算队列状态时加锁，避免多个节点同时心跳时超过并发限制
+var queueMutex sync.Mutex
+
+// 配置文件中的并发限制无效时使用的默认值
+const (
+	defaultMaxConcurrent = 3
+	defaultMaxPerNode    = 1
+	defaultAgingTime     = 300
+)
+
+// 读取当前的并发限制，面板设置优先于配置文件。
+// 配置文件中的值未经校验，不是正整数时使用默认值，避免队列永远阻塞或计算优先级时除以0
+func queueLimits() QueueLimits {
+	cfg := config.GetConfig()
+	return QueueLimits{
+		MaxConcurrent: positiveOr(models.GetIntSetting("max_concurrent_tests", cfg.MaxConcurrentTests), defaultMaxConcurrent),
+		MaxPerNode:    positiveOr(models.GetIntSetting("max_tests_per_node", cfg.MaxTestsPerNode), defaultMaxPerNode),
+		AgingTime:     positiveOr(models.GetIntSetting("queue_aging_time", cfg.QueueAgingTime), defaultAgingTime),
+	}
+}
+
+// 不是正数时返回默认值
+func positiveOr(value, fallback int) int {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// GetQueueState 返回调度队列的当前状态
+func GetQueueState() (*QueueState, error) {
+	queueMutex.Lock()
+	defer queueMutex.Unlock()
+
+	active, online, err := loadQueue()
+	if err != nil {
+		return nil, err
+	}
+	return planQueue(active, online, queueLimits(), time.Now()), nil
+}
+
+// 领取调度队列中可以开始且源节点为nodeID的测试
+func claimQueued(nodeID string) ([]models.SpeedTestResult, error) {
+	queueMutex.Lock()
+	defer queueMutex.Unlock()
+
+	active, online, err := loadQueue()
+	if err != nil {
+		return nil, err
+	}
+	state := planQueue(active, online, queueLimits(), time.Now())
+
+	ready := make(map[string]bool)
+	for _, job := range state.Jobs {
+		if job.State == JobStateReady && job.SourceNodeID == nodeID {
+			ready[job.ID] = true
+		}
+	}
+	if len(ready) == 0 {
+		return nil, nil
+	}
+
+	var tests []models.SpeedTestResult
+	for _, test := range active {
+		if ready[test.ID] {
+			tests = append(tests, test)
+		}
+	}
+	return models.ClaimSpeedTests(tests)
+}
+
+// 读取等待中和运行中的测试以及在线节点
+func loadQueue() ([]models.SpeedTestResult, map[string]bool, error) {
+	active, err := models.GetActiveSpeedTests()
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes, err := models.GetAllNodes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	online := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		if node.Status == models.NodeStatusOnline {
+			online[node.ID] = true
+		}
+	}
+	return active, online, nil
+}
+
+// 按优先级排列等待中的测试，并根据全局和节点并发限制判断哪些测试可以开始。
+// 被节点并发限制阻塞的测试会预留其源节点和目标节点，优先级更低的测试不能占用，
+// 排队时间计入优先级，定时测试等待足够长后也会排到手动测试之前，不会一直被插队。
+// 节点不在线的测试不占用并发和预留，等待下一次存活检查将其标记为失败
+func planQueue(active []models.SpeedTestResult, online map[string]bool, limits QueueLimits, now time.Time) *QueueState {
+	state := &QueueState{
+		Limits:      limits,
+		NodeRunning: make(map[string]int),
+		Jobs:        []QueuedJob{},
+	}
+
+	for _, test := range active {
+		if test.Status != models.SpeedTestStatusRunning {
+			continue
+		}
+		state.Running++
+		state.NodeRunning[test.SourceNodeID]++
+		state.NodeRunning[test.TargetNodeID]++
+	}
+
+	for _, test := range active {
+		if test.Status != models.SpeedTestStatusPending {
+			continue
+		}
+		class := jobClass(&test)
+		wait := now.Sub(test.StartTime)
+		if wait < 0 {
+			wait = 0
+		}
+		state.Jobs = append(state.Jobs, QueuedJob{
+			ID:           test.ID,
+			SourceNodeID: test.SourceNodeID,
+			TargetNodeID: test.TargetNodeID,
+			Type:         test.Type,
+			Class:        class,
+			ScheduleID:   test.ScheduleID,
+			MeshRunID:    test.MeshRunID,
+			EnqueuedAt:   test.StartTime,
+			WaitSeconds:  int64(wait / time.Second),
+			Priority:     float64(classPriority[class]) - wait.Seconds()/float64(limits.AgingTime),
+		})
+	}
+	state.Pending = len(state.Jobs)
+
+	sort.SliceStable(state.Jobs, func(i, j int) bool {
+		a, b := state.Jobs[i], state.Jobs[j]
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return a.EnqueuedAt.Before(b.EnqueuedAt)
+	})
+
+	slots := limits.MaxConcurrent - state.Running
+	busy := make(map[string]int, len(state.NodeRunning))
+	for id, n := range state.NodeRunning {
+		busy[id] = n
+	}
+	reserved := make(map[string]bool)
+
+	for i := range state.Jobs {
+		job := &state.Jobs[i]
+		job.Position = i + 1
+		job.State = JobStateBlocked
+
+		switch {
+		case !online[job.SourceNodeID]:
+			job.Reason = fmt.Sprintf("源节点 %s 不在线", job.SourceNodeID)
+			continue
+		case !online[job.TargetNodeID]:
+			job.Reason = fmt.Sprintf("目标节点 %s 不在线", job.TargetNodeID)
+			continue
+		case slots <= 0:
+			job.Reason = fmt.Sprintf("运行中的测试已达到上限 %d", limits.MaxConcurrent)
+		case state.NodeRunning[job.SourceNodeID] >= limits.MaxPerNode:
+			job.Reason = fmt.Sprintf("源节点 %s 正在测试", job.SourceNodeID)
+		case state.NodeRunning[job.TargetNodeID] >= limits.MaxPerNode:
+			job.Reason = fmt.Sprintf("目标节点 %s 正在测试", job.TargetNodeID)
+		case busy[job.SourceNodeID] >= limits.MaxPerNode || busy[job.TargetNodeID] >= limits.MaxPerNode ||
+			reserved[job.SourceNodeID] || reserved[job.TargetNodeID]:
+			job.Reason = "等待优先级更高的测试"
+		default:
+			job.State = JobStateReady
+			slots--
+			busy[job.SourceNodeID]++
+			busy[job.TargetNodeID]++
+			continue
+		}
+
+		reserved[job.SourceNodeID] = true
+		reserved[job.TargetNodeID] = true
+	}
+	return state
+}
+
+// 按测试的来源确定类别
+func jobClass(test *models.SpeedTestResult) JobClass {
+	switch {
+	case test.MeshRunID != "":
+		return JobClassMesh
+	case test.ScheduleID != "":
+		return JobClassScheduled
+	default:
+		return JobClassManual
+	}
+}
@@ -0,0 +1,156 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"../models"
+)
+
+func TestPlanQueue(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	limits := QueueLimits{MaxConcurrent: 3, MaxPerNode: 1, AgingTime: 300}
+
+	test := func(id, source, target string, status models.SpeedTestStatus, age time.Duration, scheduleID string) models.SpeedTestResult {
+		return models.SpeedTestResult{
+			ID:           id,
+			SourceNodeID: source,
+			TargetNodeID: target,
+			Type:         models.SpeedTestTypePing,
+			Status:       status,
+			StartTime:    now.Add(-age),
+			ScheduleID:   scheduleID,
+		}
+	}
+	pending := models.SpeedTestStatusPending
+	running := models.SpeedTestStatusRunning
+	allOnline := map[string]bool{"a": true, "b": true, "c": true, "d": true, "e": true}
+
+	tests := []struct {
+		name      string
+		active    []models.SpeedTestResult
+		online    map[string]bool
+		limits    QueueLimits
+		wantOrder []string
+		wantReady []string
+	}{
+		{
+			name: "手动测试优先于定时测试",
+			active: []models.SpeedTestResult{
+				test("s1", "a", "b", pending, time.Minute, "sched"),
+				test("m1", "c", "d", pending, 0, ""),
+			},
+			online:    allOnline,
+			limits:    limits,
+			wantOrder: []string{"m1", "s1"},
+			wantReady: []string{"m1", "s1"},
+		},
+		{
+			name: "节点并发限制",
+			active: []models.SpeedTestResult{
+				test("r1", "a", "b", running, time.Minute, ""),
+				test("p1", "a", "c", pending, time.Minute, ""),
+				test("p2", "d", "e", pending, 0, ""),
+			},
+			online:    allOnline,
+			limits:    limits,
+			wantOrder: []string{"p1", "p2"},
+			wantReady: []string{"p2"},
+		},
+		{
+			name: "全局并发限制",
+			active: []models.SpeedTestResult{
+				test("r1", "a", "b", running, time.Minute, ""),
+				test("p1", "c", "d", pending, 0, ""),
+			},
+			online:    allOnline,
+			limits:    QueueLimits{MaxConcurrent: 1, MaxPerNode: 1, AgingTime: 300},
+			wantOrder: []string{"p1"},
+			wantReady: nil,
+		},
+		{
+			name: "被阻塞的测试预留节点",
+			active: []models.SpeedTestResult{
+				test("r1", "b", "c", running, time.Minute, ""),
+				test("m1", "a", "b", pending, 0, ""),
+				test("s1", "a", "d", pending, 0, "sched"),
+			},
+			online:    allOnline,
+			limits:    limits,
+			wantOrder: []string{"m1", "s1"},
+			wantReady: nil,
+		},
+		{
+			name: "等待时间提升优先级",
+			active: []models.SpeedTestResult{
+				test("m1", "a", "b", pending, 0, ""),
+				test("s1", "a", "c", pending, 12*time.Minute, "sched"),
+			},
+			online:    allOnline,
+			limits:    limits,
+			wantOrder: []string{"s1", "m1"},
+			wantReady: []string{"s1"},
+		},
+		{
+			name: "离线节点不占用预留",
+			active: []models.SpeedTestResult{
+				test("m1", "a", "b", pending, time.Minute, ""),
+				test("m2", "c", "b", pending, 0, ""),
+			},
+			online:    map[string]bool{"b": true, "c": true},
+			limits:    limits,
+			wantOrder: []string{"m1", "m2"},
+			wantReady: []string{"m2"},
+		},
+		{
+			name: "同等优先级按入队时间排序",
+			active: []models.SpeedTestResult{
+				test("m2", "c", "d", pending, time.Second, ""),
+				test("m1", "a", "b", pending, time.Second, ""),
+			},
+			online:    allOnline,
+			limits:    QueueLimits{MaxConcurrent: 1, MaxPerNode: 1, AgingTime: 1 << 30},
+			wantOrder: []string{"m2", "m1"},
+			wantReady: []string{"m2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := planQueue(tt.active, tt.online, tt.limits, now)
+
+			var order, ready []string
+			for i, job := range state.Jobs {
+				if job.Position != i+1 {
+					t.Errorf("%s 的位置 = %d, 期望 %d", job.ID, job.Position, i+1)
+				}
+				if job.State != JobStateReady && job.Reason == "" {
+					t.Errorf("%s 被阻塞但没有原因", job.ID)
+				}
+				order = append(order, job.ID)
+				if job.State == JobStateReady {
+					ready = append(ready, job.ID)
+				}
+			}
+			if !reflect.DeepEqual(order, tt.wantOrder) {
+				t.Errorf("队列顺序 = %v, 期望 %v", order, tt.wantOrder)
+			}
+			if !reflect.DeepEqual(ready, tt.wantReady) {
+				t.Errorf("可开始的测试 = %v, 期望 %v", ready, tt.wantReady)
+			}
+		})
+	}
+}
+
+func TestPositiveOr(t *testing.T) {
+	for _, tt := range []struct{ value, fallback, want int }{
+		{value: 5, fallback: 1, want: 5},
+		{value: 0, fallback: 1, want: 1},
+		{value: -3, fallback: 300, want: 300},
+	} {
+		if got := positiveOr(tt.value, tt.fallback); got != tt.want {
+			t.Errorf("positiveOr(%d, %d) = %d, 期望 %d", tt.value, tt.fallback, got, tt.want)
+		}
+	}
+}
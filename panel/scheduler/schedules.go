@@ -0,0 +1,421 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"../../common/cron"
+	"../models"
+)
+
+const (
+	// 调度器检查定时任务的间隔
+	tickInterval = 10 * time.Second
+	// 按间隔执行的任务的最小间隔
+	minScheduleInterval = 60
+)
+
+// 定时任务的下一次执行计划
+type plan struct {
+	updatedAt time.Time // 计算计划时任务的更新时间，任务被修改后重新计算
+	base      time.Time // 按Cron表达式或间隔计算的触发时间
+	at        time.Time // 加上随机延迟后的实际触发时间
+}
+
+var (
+	stop  chan struct{}
+	done  chan struct{}
+	plans = make(map[string]plan)
+	mutex sync.Mutex
+)
+
+// ValidateSchedule 校验定时任务的执行时间、节点选择和测试参数
+func ValidateSchedule(s *models.Schedule) error {
+	if strings.TrimSpace(s.Name) == "" {
+		return fmt.Errorf("任务名称不能为空")
+	}
+
+	switch {
+	case s.Cron != "" && s.Interval != 0:
+		return fmt.Errorf("Cron表达式和执行间隔只能设置一个")
+	case s.Cron != "":
+		if _, err := cron.Parse(s.Cron); err != nil {
+			return err
+		}
+	case s.Interval < minScheduleInterval:
+		return fmt.Errorf("执行间隔不能小于 %d 秒", minScheduleInterval)
+	}
+
+	if len(s.SourceNodeIDs) == 0 && s.SourceTag == "" {
+		return fmt.Errorf("需要指定源节点或源节点标签")
+	}
+	if len(s.TargetNodeIDs) == 0 && s.TargetTag == "" {
+		return fmt.Errorf("需要指定目标节点或目标节点标签")
+	}
+
+	if !s.Type.Valid() {
+		return fmt.Errorf("无效的测试类型: %s", s.Type)
+	}
+	if s.Timeout < 0 || s.Timeout > 3600 {
+		return fmt.Errorf("超时时间应为 0-3600 秒")
+	}
+	if s.Threads < 0 || s.Threads > 64 {
+		return fmt.Errorf("线程数应为 0-64")
+	}
+	if s.Size < 0 || s.Size > 1000 {
+		return fmt.Errorf("下载数据量应为 0-1000 MB")
+	}
+	if s.Jitter < 0 || s.Jitter > 3600 {
+		return fmt.Errorf("随机延迟应为 0-3600 秒")
+	}
+
+	for i, window := range s.Blackouts {
+		if _, err := parseClock(window.Start); err != nil {
+			return fmt.Errorf("第 %d 个禁止时段的开始时间无效: %v", i+1, err)
+		}
+		if _, err := parseClock(window.End); err != nil {
+			return fmt.Errorf("第 %d 个禁止时段的结束时间无效: %v", i+1, err)
+		}
+		for _, day := range window.Days {
+			if day < 0 || day > 6 {
+				return fmt.Errorf("第 %d 个禁止时段的星期无效: %d", i+1, day)
+			}
+		}
+	}
+	return nil
+}
+
+// Start 启动定时任务调度器
+func Start() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if stop != nil {
+		return
+	}
+	stop = make(chan struct{})
+	done = make(chan struct{})
+	go run(stop, done)
+}
+
+// Stop 停止定时任务调度器，等待进行中的调度完成
+func Stop() {
+	mutex.Lock()
+	if stop == nil {
+		mutex.Unlock()
+		return
+	}
+	close(stop)
+	ch := done
+	stop = nil
+	done = nil
+	mutex.Unlock()
+
+	<-ch
+}
+
+// NextRun 返回定时任务的下一次触发时间，调度器尚未计算时按当前时间估算，任务未启用时返回零值
+func NextRun(s *models.Schedule) time.Time {
+	if !s.Enabled {
+		return time.Time{}
+	}
+	if p, ok := getPlan(s.ID); ok && p.updatedAt.Equal(s.UpdatedAt) {
+		return p.at
+	}
+	next, err := firstRun(s, time.Now())
+	if err != nil {
+		return time.Time{}
+	}
+	return next
+}
+
+func run(stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	tick(time.Now())
+	AdvanceMeshRuns()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			tick(now)
+			AdvanceMeshRuns()
+		}
+	}
+}
+
+// 检查所有定时任务，触发到期的任务并计算下一次执行时间
+func tick(now time.Time) {
+	schedules, err := models.GetSchedules()
+	if err != nil {
+		log.Printf("读取定时任务失败: %v", err)
+		return
+	}
+
+	seen := make(map[string]bool, len(schedules))
+	for i := range schedules {
+		s := &schedules[i]
+		seen[s.ID] = true
+		if !s.Enabled {
+			setPlan(s.ID, nil)
+			continue
+		}
+
+		p, ok := getPlan(s.ID)
+		if !ok || !p.updatedAt.Equal(s.UpdatedAt) {
+			base, err := firstRun(s, now)
+			if err != nil {
+				log.Printf("计算定时任务 %s 的执行时间失败: %v", s.Name, err)
+				setPlan(s.ID, nil)
+				continue
+			}
+			p = newPlan(s, base)
+			setPlan(s.ID, &p)
+		}
+		if now.Before(p.at) {
+			continue
+		}
+
+		if window := activeBlackout(s.Blackouts, now); window != nil {
+			log.Printf("定时任务 %s 处于禁止时段 %s-%s，跳过本次执行", s.Name, window.Start, window.End)
+		} else {
+			created, skipped, err := RunSchedule(s)
+			if err != nil {
+				log.Printf("执行定时任务 %s 失败: %v", s.Name, err)
+			} else {
+				log.Printf("定时任务 %s 已创建 %d 个测试，跳过 %d 个", s.Name, created, skipped)
+			}
+		}
+
+		next, err := nextRun(s, p.base, now)
+		if err != nil {
+			log.Printf("计算定时任务 %s 的执行时间失败: %v", s.Name, err)
+			setPlan(s.ID, nil)
+			continue
+		}
+		p = newPlan(s, next)
+		setPlan(s.ID, &p)
+	}
+
+	// 清理已删除的任务
+	mutex.Lock()
+	for id := range plans {
+		if !seen[id] {
+			delete(plans, id)
+		}
+	}
+	mutex.Unlock()
+}
+
+func getPlan(id string) (plan, bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	p, ok := plans[id]
+	return p, ok
+}
+
+func setPlan(id string, p *plan) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if p == nil {
+		delete(plans, id)
+		return
+	}
+	plans[id] = *p
+}
+
+// 加上随机延迟生成执行计划
+func newPlan(s *models.Schedule, base time.Time) plan {
+	at := base
+	if s.Jitter > 0 {
+		at = at.Add(time.Duration(rand.Int63n(int64(s.Jitter)*int64(time.Second) + 1)))
+	}
+	return plan{updatedAt: s.UpdatedAt, base: base, at: at}
+}
+
+// 任务新建、修改或面板重启后的第一次触发时间，按间隔执行的任务错过的执行只补一次
+func firstRun(s *models.Schedule, now time.Time) (time.Time, error) {
+	if s.Cron != "" {
+		return nextCron(s.Cron, now)
+	}
+	if s.LastRunAt.IsZero() {
+		return now, nil
+	}
+	next := s.LastRunAt.Add(time.Duration(s.Interval) * time.Second)
+	if next.Before(now) {
+		return now, nil
+	}
+	return next, nil
+}
+
+// 本次触发后的下一次触发时间，按间隔执行的任务以计划时间为基准，随机延迟不会累积
+func nextRun(s *models.Schedule, base, now time.Time) (time.Time, error) {
+	if s.Cron != "" {
+		return nextCron(s.Cron, now)
+	}
+	interval := time.Duration(s.Interval) * time.Second
+	next := base.Add(interval)
+	if !next.After(now) {
+		next = now.Add(interval)
+	}
+	return next, nil
+}
+
+func nextCron(expr string, after time.Time) (time.Time, error) {
+	schedule, err := cron.Parse(expr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := schedule.Next(after)
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("Cron表达式 %q 在一年内没有匹配的时间", expr)
+	}
+	return next, nil
+}
+
+// RunSchedule 立即对定时任务选中的所有节点对创建测试，不检查禁止时段。
+// 测试进入调度队列，由队列控制并发，同一节点对上一次测试未结束时跳过，
+// 返回创建和跳过的测试数量
+func RunSchedule(s *models.Schedule) (int, int, error) {
+	nodes, err := models.GetAllNodes()
+	if err != nil {
+		return 0, 0, err
+	}
+	pairs, offline := schedulePairs(s, nodes)
+
+	created, skipped := 0, offline
+	for _, pair := range pairs {
+		busy, err := models.HasActiveSpeedTest(pair[0], pair[1])
+		if err != nil {
+			return created, skipped, err
+		}
+		if busy {
+			skipped++
+			continue
+		}
+
+		_, err = Enqueue(models.SpeedTestRequest{
+			SourceNodeID: pair[0],
+			TargetNodeID: pair[1],
+			Type:         s.Type,
+			Timeout:      s.Timeout,
+			Threads:      s.Threads,
+			Size:         s.Size,
+			ScheduleID:   s.ID,
+		})
+		if err != nil {
+			return created, skipped, err
+		}
+		created++
+	}
+
+	if err := models.UpdateScheduleLastRun(s.ID, time.Now()); err != nil {
+		log.Printf("更新定时任务 %s 的执行时间失败: %v", s.Name, err)
+	}
+	return created, skipped, nil
+}
+
+// 计算任务选中的源节点和目标节点组合，只包含在线节点，同时返回因节点不在线跳过的组合数量
+func schedulePairs(s *models.Schedule, nodes []models.Node) ([][2]string, int) {
+	sources := selectNodes(nodes, s.SourceNodeIDs, s.SourceTag)
+	targets := selectNodes(nodes, s.TargetNodeIDs, s.TargetTag)
+
+	var pairs [][2]string
+	offline := 0
+	for _, source := range sources {
+		for _, target := range targets {
+			if source.ID == target.ID {
+				continue
+			}
+			if source.Status != models.NodeStatusOnline || target.Status != models.NodeStatusOnline {
+				offline++
+				continue
+			}
+			pairs = append(pairs, [2]string{source.ID, target.ID})
+		}
+	}
+	return pairs, offline
+}
+
+// 按节点ID或标签选择节点，保持节点列表的顺序
+func selectNodes(nodes []models.Node, ids []string, tag string) []models.Node {
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	var selected []models.Node
+	for _, node := range nodes {
+		if wanted[node.ID] || (tag != "" && hasTag(node.Tags, tag)) {
+			selected = append(selected, node)
+		}
+	}
+	return selected
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.TrimSpace(t) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// 返回当前时间所在的禁止时段，不在任何禁止时段时返回nil
+func activeBlackout(windows []models.BlackoutWindow, now time.Time) *models.BlackoutWindow {
+	minute := now.Hour()*60 + now.Minute()
+	for i := range windows {
+		window := &windows[i]
+		start, err1 := parseClock(window.Start)
+		end, err2 := parseClock(window.End)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+
+		// 跨越午夜的时段按开始当天的星期判断
+		day := now.Weekday()
+		var inWindow bool
+		if start <= end {
+			inWindow = minute >= start && minute < end
+		} else {
+			inWindow = minute >= start || minute < end
+			if minute < end {
+				day = (day + 6) % 7
+			}
+		}
+		if inWindow && matchesDay(window.Days, day) {
+			return window
+		}
+	}
+	return nil
+}
+
+func matchesDay(days []int, day time.Weekday) bool {
+	if len(days) == 0 {
+		return true
+	}
+	for _, d := range days {
+		if time.Weekday(d) == day {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析 HH:MM 格式的时间，返回当天的分钟数
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("应为 HH:MM 格式: %q", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
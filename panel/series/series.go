@@ -0,0 +1,355 @@
+package series
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"../models"
+	"../rollup"
+)
+
+// 单次查询的最大数据点数
+const MaxPoints = 5000
+
+// 自动选择步长时的候选值和目标数据点数
+var autoSteps = []time.Duration{
+	time.Minute, 5 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour,
+	24 * time.Hour, 7 * 24 * time.Hour,
+}
+
+const autoPoints = 300
+
+// 统计量
+const (
+	StatCount = "count"
+	StatMin   = "min"
+	StatAvg   = "avg"
+	StatMax   = "max"
+	StatP50   = "p50"
+	StatP95   = "p95"
+)
+
+// Stats 所有统计量
+var Stats = []string{StatCount, StatMin, StatAvg, StatMax, StatP50, StatP95}
+
+// 数据来源
+const (
+	SourceRaw    = "raw"
+	SourceHourly = "hourly"
+	SourceDaily  = "daily"
+)
+
+// Query 时间序列查询，指定节点对或节点，节点查询按与该节点相关的每个节点对分别返回一条序列
+type Query struct {
+	NodeID       string
+	SourceNodeID string
+	TargetNodeID string
+	Metric       string
+	From         time.Time
+	To           time.Time
+	Step         time.Duration // 为0时按时间范围自动选择
+}
+
+// Point 一个时间段的统计，没有数据时各统计量为null
+type Point struct {
+	Time  time.Time `json:"time"`
+	Count int       `json:"count"`
+	Min   *float64  `json:"min"`
+	Avg   *float64  `json:"avg"`
+	Max   *float64  `json:"max"`
+	P50   *float64  `json:"p50"`
+	P95   *float64  `json:"p95"`
+}
+
+// Value 返回统计量的值
+func (p *Point) Value(stat string) *float64 {
+	switch stat {
+	case StatCount:
+		count := float64(p.Count)
+		return &count
+	case StatMin:
+		return p.Min
+	case StatMax:
+		return p.Max
+	case StatP50:
+		return p.P50
+	case StatP95:
+		return p.P95
+	}
+	return p.Avg
+}
+
+// Series 一个节点对的时间序列
+type Series struct {
+	SourceNodeID string  `json:"source_node_id"`
+	TargetNodeID string  `json:"target_node_id"`
+	Label        string  `json:"label"` // 源节点名称 → 目标节点名称
+	Points       []Point `json:"points"`
+}
+
+// Result 时间序列查询结果
+type Result struct {
+	Metric      string    `json:"metric"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Step        int64     `json:"step"`        // 步长（秒）
+	Sources     []string  `json:"sources"`     // 使用的数据来源：raw、hourly、daily
+	Approximate bool      `json:"approximate"` // 部分时间段由多条汇总合并，p50和p95为按数量加权的近似值
+	Series      []Series  `json:"series"`
+}
+
+// ParseStep 解析步长，支持Go时间格式（如5m、1h）、天数（如1d、7d）和秒数
+func ParseStep(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if strings.HasSuffix(value, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil && days > 0 {
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	} else if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second, nil
+	} else if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("无效的步长: %s", value)
+}
+
+// Validate 校验查询，并在未设置步长时按时间范围选择
+func (q *Query) Validate() error {
+	if models.MetricTestTypes(q.Metric) == nil {
+		return fmt.Errorf("无效的指标: %s", q.Metric)
+	}
+	if q.NodeID == "" && (q.SourceNodeID == "" || q.TargetNodeID == "") {
+		return fmt.Errorf("必须指定节点对（source和target）或节点（node）")
+	}
+	if !q.From.Before(q.To) {
+		return fmt.Errorf("开始时间必须早于结束时间")
+	}
+
+	if q.Step == 0 {
+		q.Step = autoSteps[len(autoSteps)-1]
+		for _, step := range autoSteps {
+			if q.To.Sub(q.From)/step <= autoPoints {
+				q.Step = step
+				break
+			}
+		}
+	}
+	if q.Step < time.Minute {
+		return fmt.Errorf("步长不能小于1分钟")
+	}
+	if q.To.Sub(q.From)/q.Step > MaxPoints {
+		return fmt.Errorf("数据点过多，最多 %d 个，请增大步长或缩小时间范围", MaxPoints)
+	}
+	return nil
+}
+
+// 一个节点对在一个时间段内收集的原始值和汇总
+type bucket struct {
+	values  []float64
+	rollups []models.Rollup
+}
+
+type pairKey struct {
+	source, target string
+}
+
+// Run 执行查询。步长为整小时或整天时，已汇总的时间段使用小时或每日汇总，其余时间段使用原始结果
+func Run(q Query) (*Result, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	starts := bucketStarts(q.From, q.To, q.Step)
+	result := &Result{
+		Metric: q.Metric,
+		From:   starts[0],
+		To:     q.To,
+		Step:   int64(q.Step / time.Second),
+	}
+	pairs := make(map[pairKey][]bucket)
+	collect := func(source, target string, t time.Time) *bucket {
+		i := sort.Search(len(starts), func(i int) bool { return starts[i].After(t) }) - 1
+		if i < 0 {
+			return nil
+		}
+		key := pairKey{source, target}
+		if pairs[key] == nil {
+			pairs[key] = make([]bucket, len(starts))
+		}
+		return &pairs[key][i]
+	}
+
+	// 汇总覆盖[From, split)，原始结果覆盖[split, To)
+	split := result.From
+	if period, name := rollupPeriod(q.Step); period != "" {
+		watermark := models.GetRollupWatermark(period)
+		if watermark.After(split) {
+			split = watermark
+			if split.After(q.To) {
+				split = q.To
+			}
+			rollups, err := models.GetRollups(models.RollupFilter{
+				Period:       period,
+				NodeID:       q.NodeID,
+				SourceNodeID: q.SourceNodeID,
+				TargetNodeID: q.TargetNodeID,
+				Metric:       q.Metric,
+				From:         result.From,
+				To:           split,
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range rollups {
+				if b := collect(r.SourceNodeID, r.TargetNodeID, r.Bucket); b != nil && r.Count > 0 {
+					b.rollups = append(b.rollups, r)
+				}
+			}
+			result.Sources = append(result.Sources, name)
+		}
+	}
+	if split.Before(q.To) {
+		samples, err := models.GetMetricSamples(q.NodeID, q.SourceNodeID, q.TargetNodeID, q.Metric, split, q.To)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range samples {
+			if b := collect(s.SourceNodeID, s.TargetNodeID, s.StartTime); b != nil {
+				b.values = append(b.values, s.Value)
+			}
+		}
+		result.Sources = append(result.Sources, SourceRaw)
+	}
+
+	names := nodeNames()
+	result.Series = []Series{}
+	for key, buckets := range pairs {
+		series := Series{
+			SourceNodeID: key.source,
+			TargetNodeID: key.target,
+			Label:        name(names, key.source) + " → " + name(names, key.target),
+			Points:       make([]Point, len(starts)),
+		}
+		for i := range buckets {
+			approximate := false
+			series.Points[i], approximate = summarize(starts[i], &buckets[i])
+			result.Approximate = result.Approximate || approximate
+		}
+		result.Series = append(result.Series, series)
+	}
+	sort.Slice(result.Series, func(i, j int) bool {
+		return result.Series[i].Label < result.Series[j].Label
+	})
+	return result, nil
+}
+
+// 步长为整天或整小时时返回对应的汇总粒度
+func rollupPeriod(step time.Duration) (models.RollupPeriod, string) {
+	switch {
+	case step%(24*time.Hour) == 0:
+		return models.RollupDay, SourceDaily
+	case step%time.Hour == 0:
+		return models.RollupHour, SourceHourly
+	}
+	return "", ""
+}
+
+// 划分时间段：整天的步长从本地零点开始，与每日汇总对齐，其余按步长对齐
+func bucketStarts(from, to time.Time, step time.Duration) []time.Time {
+	var start time.Time
+	days := 0
+	if step%(24*time.Hour) == 0 {
+		start = models.RollupDay.Start(from)
+		days = int(step / (24 * time.Hour))
+	} else {
+		start = from.Truncate(step)
+	}
+
+	var starts []time.Time
+	for t := start; t.Before(to); {
+		starts = append(starts, t)
+		if days > 0 {
+			t = t.AddDate(0, 0, days)
+		} else {
+			t = t.Add(step)
+		}
+	}
+	return starts
+}
+
+// 计算一个时间段的统计。只有原始值或只有一条汇总时是精确值，
+// 合并多条汇总（或汇总与原始值）时p50和p95为按数量加权的近似值
+func summarize(t time.Time, b *bucket) (Point, bool) {
+	point := Point{Time: t}
+	parts := b.rollups
+	if len(b.values) > 0 {
+		if len(parts) == 0 {
+			setStats(&point, rollup.Aggregate(b.values))
+			return point, false
+		}
+		parts = append(parts, rollup.Aggregate(b.values))
+	}
+	if len(parts) == 0 {
+		return point, false
+	}
+	if len(parts) == 1 {
+		setStats(&point, parts[0])
+		return point, false
+	}
+
+	merged := models.Rollup{Min: parts[0].Min, Max: parts[0].Max}
+	var sum, p50, p95 float64
+	for _, r := range parts {
+		merged.Count += r.Count
+		if r.Min < merged.Min {
+			merged.Min = r.Min
+		}
+		if r.Max > merged.Max {
+			merged.Max = r.Max
+		}
+		weight := float64(r.Count)
+		sum += r.Avg * weight
+		p50 += r.P50 * weight
+		p95 += r.P95 * weight
+	}
+	merged.Avg = sum / float64(merged.Count)
+	merged.P50 = p50 / float64(merged.Count)
+	merged.P95 = p95 / float64(merged.Count)
+	setStats(&point, merged)
+	return point, true
+}
+
+func setStats(point *Point, r models.Rollup) {
+	point.Count = r.Count
+	point.Min = &r.Min
+	point.Avg = &r.Avg
+	point.Max = &r.Max
+	point.P50 = &r.P50
+	point.P95 = &r.P95
+}
+
+// 节点ID到名称的映射
+func nodeNames() map[string]string {
+	names := make(map[string]string)
+	nodes, err := models.GetAllNodes()
+	if err != nil {
+		return names
+	}
+	for _, node := range nodes {
+		names[node.ID] = node.Name
+	}
+	return names
+}
+
+func name(names map[string]string, id string) string {
+	if n := names[id]; n != "" {
+		return n
+	}
+	return id
+}
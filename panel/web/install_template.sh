@@ -1,7 +1,9 @@
 #!/bin/bash
 
 # 节点管理测速系统 - 节点安装脚本
-# 用法: curl -L https://面板地址/api/install.sh | bash -s -- NODE_KEY NODE_NAME [--github]
+# 用法: curl -L https://面板地址/api/install.sh | bash -s -- ENROLL_TOKEN [NODE_NAME] [--github] [--ca-fingerprint=指纹]
+#       curl -L https://面板地址/api/install.sh | bash -s -- NODE_KEY NODE_NAME --node-id=节点ID [--github] [--ca-fingerprint=指纹]
+# 面板启用TLS时请使用面板生成的安装命令，命令会先下载面板CA并校验指纹
 
 set -e
 
@@ -14,25 +16,48 @@ NC='\033[0m' # 无颜色
 
 # 检查参数
 if [ $# -lt 1 ]; then
-    echo -e "${RED}错误: 缺少节点密钥参数${NC}"
-    echo "用法: curl -L https://面板地址/api/install.sh | bash -s -- NODE_KEY [NODE_NAME] [--github]"
+    echo -e "${RED}错误: 缺少注册令牌或节点密钥参数${NC}"
+    echo "用法: curl -L https://面板地址/api/install.sh | bash -s -- ENROLL_TOKEN [NODE_NAME] [--github] [--ca-fingerprint=指纹]"
     exit 1
 fi
 
 NODE_KEY="$1"
+ENROLL_TOKEN=""
 NODE_NAME="${2:-$(hostname)}"
 USE_GITHUB=false
+NODE_ID=""
+CA_FINGERPRINT=""
 
-# 检查是否使用GitHub下载
+# 检查是否使用GitHub下载，以及面板CA指纹（提供时启用双向TLS）
 for arg in "$@"; do
-    if [ "$arg" = "--github" ]; then
-        USE_GITHUB=true
-    fi
+    case "$arg" in
+        --github)
+            USE_GITHUB=true
+            ;;
+        --node-id=*)
+            NODE_ID="${arg#--node-id=}"
+            ;;
+        --ca-fingerprint=*)
+            CA_FINGERPRINT="${arg#--ca-fingerprint=}"
+            ;;
+    esac
 done
+case "$NODE_NAME" in
+    --*) NODE_NAME="$(hostname)" ;;
+esac
+
+# et_开头的参数为一次性注册令牌，安装时换取节点ID和密钥
+case "$NODE_KEY" in
+    et_*)
+        ENROLL_TOKEN="$NODE_KEY"
+        NODE_KEY=""
+        ;;
+esac
 
 PANEL_URL="{{.PanelURL}}"
 GITHUB_REPO="{{.GithubRepo}}"
 GITHUB_VERSION="{{.GithubVersion}}"
+UPDATE_PUBLIC_KEY="{{.UpdatePublicKey}}"
 INSTALL_DIR="/opt/node-speedtest"
 CONFIG_FILE="${INSTALL_DIR}/config.json"
 SERVICE_NAME="node-speedtest"
@@ -40,7 +65,6 @@ ARCH=$(uname -m)
 
 echo -e "${BLUE}=== 节点管理测速系统 - 节点安装脚本 ===${NC}"
 echo -e "${BLUE}面板地址: ${PANEL_URL}${NC}"
-echo -e "${BLUE}节点密钥: ${NODE_KEY}${NC}"
 echo -e "${BLUE}节点名称: ${NODE_NAME}${NC}"
 echo -e "${BLUE}系统架构: ${ARCH}${NC}"
 echo -e "${BLUE}安装目录: ${INSTALL_DIR}${NC}"
@@ -57,6 +81,66 @@ if [ "$(id -u)" != "0" ]; then
     exit 1
 fi
 
+# 面板启用TLS时证书由内置CA签发，下载CA并校验指纹后，之后访问面板的请求都只信任该CA
+CURL_CA=()
+if [ -n "$CA_FINGERPRINT" ]; then
+    echo -e "${YELLOW}下载并校验面板CA证书...${NC}"
+    if ! command -v openssl >/dev/null 2>&1; then
+        echo -e "${RED}错误: 校验面板CA需要openssl，请先安装openssl${NC}"
+        exit 1
+    fi
+    mkdir -p ${INSTALL_DIR}
+    PANEL_CA_FILE="${INSTALL_DIR}/panel-ca.crt"
+    curl -fsSk -o "${PANEL_CA_FILE}" "${PANEL_URL}/api/ca.crt" || {
+        echo -e "${RED}下载面板CA证书失败${NC}"
+        exit 1
+    }
+    ACTUAL_FINGERPRINT=$(openssl x509 -in "${PANEL_CA_FILE}" -outform DER | sha256sum | cut -d' ' -f1)
+    EXPECTED_FINGERPRINT=$(echo "${CA_FINGERPRINT}" | tr -d ':' | tr 'A-F' 'a-f')
+    if [ "$ACTUAL_FINGERPRINT" != "$EXPECTED_FINGERPRINT" ]; then
+        echo -e "${RED}面板CA指纹不匹配，期望 ${EXPECTED_FINGERPRINT}，实际 ${ACTUAL_FINGERPRINT}${NC}"
+        rm -f "${PANEL_CA_FILE}"
+        exit 1
+    fi
+    CURL_CA=(--cacert "${PANEL_CA_FILE}")
+fi
+
+# 使用注册令牌换取节点凭据
+if [ -n "$ENROLL_TOKEN" ]; then
+    echo -e "${YELLOW}使用注册令牌注册节点...${NC}"
+    ENROLL_DATA="{\"token\":\"${ENROLL_TOKEN}\",\"hostname\":\"${NODE_NAME}\"}"
+    ENROLL_RESULT=$(curl -s "${CURL_CA[@]}" -X POST -H "Content-Type: application/json" -d "${ENROLL_DATA}" "${PANEL_URL}/api/enroll")
+
+    NODE_ID=$(echo "${ENROLL_RESULT}" | sed -n 's/.*"node_id":"\([^"]*\)".*/\1/p')
+    NODE_KEY=$(echo "${ENROLL_RESULT}" | sed -n 's/.*"node_key":"\([^"]*\)".*/\1/p')
+    ENROLLED_NAME=$(echo "${ENROLL_RESULT}" | sed -n 's/.*"node_name":"\([^"]*\)".*/\1/p')
+    ENROLLED_FINGERPRINT=$(echo "${ENROLL_RESULT}" | sed -n 's/.*"ca_fingerprint":"\([^"]*\)".*/\1/p')
+
+    if [ -z "$NODE_ID" ] || [ -z "$NODE_KEY" ]; then
+        ENROLL_MESSAGE=$(echo "${ENROLL_RESULT}" | sed -n 's/.*"message":"\([^"]*\)".*/\1/p')
+        echo -e "${RED}节点注册失败: ${ENROLL_MESSAGE:-无法连接面板}${NC}"
+        exit 1
+    fi
+
+    if [ -n "$ENROLLED_NAME" ]; then
+        NODE_NAME="$ENROLLED_NAME"
+    fi
+    if [ -z "$CA_FINGERPRINT" ]; then
+        CA_FINGERPRINT="$ENROLLED_FINGERPRINT"
+    fi
+    echo -e "${GREEN}节点注册成功，节点ID: ${NODE_ID}${NC}"
+fi
+
+if [ -z "$NODE_ID" ]; then
+    echo -e "${RED}错误: 使用节点密钥安装时需要通过 --node-id 指定节点ID${NC}"
+    exit 1
+fi
+
+TLS_ENABLED=false
+if [ -n "$CA_FINGERPRINT" ]; then
+    TLS_ENABLED=true
+fi
+
 # 创建安装目录
 echo -e "${YELLOW}创建安装目录...${NC}"
 mkdir -p ${INSTALL_DIR}
@@ -83,6 +167,24 @@ case ${ARCH} in
         ;;
 esac
 
+# 使用节点密钥为请求签名，与节点程序的签名方式一致（HMAC-SHA256），节点密钥不会出现在URL中
+sign_request() {
+    local method="$1" path="$2"
+    local timestamp nonce body_hash signing_key canonical signature
+    timestamp=$(date +%s)
+    nonce=$(od -An -tx1 -N16 /dev/urandom | tr -d ' \n')
+    body_hash=$(printf '' | sha256sum | cut -d' ' -f1)
+    signing_key=$(printf '%s' "${NODE_KEY}" | sha256sum | cut -d' ' -f1)
+    canonical=$(printf '%s\n%s\n%s\n%s\n%s\n%s' "${method}" "${path}" "${body_hash}" "${timestamp}" "${nonce}" "${NODE_ID}")
+    signature=$(printf '%s' "${canonical}" | openssl dgst -sha256 -mac HMAC -macopt "hexkey:${signing_key}" | sed 's/^.*= //')
+    SIGN_HEADERS=(-H "X-Node-ID: ${NODE_ID}" -H "X-Timestamp: ${timestamp}" -H "X-Nonce: ${nonce}" -H "X-Signature: ${signature}")
+}
+
+if [ "$USE_GITHUB" = false ] && ! command -v openssl >/dev/null 2>&1; then
+    echo -e "${YELLOW}未找到openssl，无法对下载请求签名，改为从GitHub下载${NC}"
+    USE_GITHUB=true
+fi
+
 if [ "$USE_GITHUB" = true ]; then
     # 从GitHub下载
     GITHUB_URL="${GITHUB_REPO}/releases/download/${GITHUB_VERSION}/node-${ARCH_NAME}"
@@ -93,9 +195,11 @@ if [ "$USE_GITHUB" = true ]; then
     }
 else
     # 从面板下载
-    PANEL_DOWNLOAD_URL="${PANEL_URL}/api/download/node-${ARCH_NAME}"
+    DOWNLOAD_PATH="/api/download/node-${ARCH_NAME}"
+    PANEL_DOWNLOAD_URL="${PANEL_URL}${DOWNLOAD_PATH}"
     echo -e "${YELLOW}从面板下载节点程序: ${PANEL_DOWNLOAD_URL}${NC}"
-    curl -L -o "${INSTALL_DIR}/node-speedtest" "${PANEL_DOWNLOAD_URL}?key=${NODE_KEY}" || {
+    sign_request GET "${DOWNLOAD_PATH}"
+    curl -fL "${CURL_CA[@]}" "${SIGN_HEADERS[@]}" -o "${INSTALL_DIR}/node-speedtest" "${PANEL_DOWNLOAD_URL}" || {
         echo -e "${RED}从面板下载节点程序失败${NC}"
         echo -e "${YELLOW}尝试从GitHub下载...${NC}"
         
@@ -116,6 +220,7 @@ echo -e "${YELLOW}创建配置文件...${NC}"
 cat > ${CONFIG_FILE} << EOF
 {
   "panel_url": "${PANEL_URL}",
+  "node_id": "${NODE_ID}",
   "node_key": "${NODE_KEY}",
   "node_name": "${NODE_NAME}",
   "listen_port": "8081",
@@ -125,9 +230,13 @@ cat > ${CONFIG_FILE} << EOF
   "speedtest_timeout": 120,
   "download_threads": 4,
   "upload_threads": 2,
-  "ping_count": 10
+  "ping_count": 10,
+  "tls_enabled": ${TLS_ENABLED},
+  "panel_ca_fingerprint": "${CA_FINGERPRINT}",
+  "update_public_key": "${UPDATE_PUBLIC_KEY}"
 }
 EOF
+chmod 600 ${CONFIG_FILE}
 
 # 创建systemd服务
 echo -e "${YELLOW}创建系统服务...${NC}"
@@ -140,7 +249,7 @@ After=network.target
 Type=simple
 User=root
 WorkingDirectory=${INSTALL_DIR}
-ExecStart=${INSTALL_DIR}/node-speedtest -conf=${CONFIG_FILE}
+ExecStart=${INSTALL_DIR}/node-speedtest -config=${CONFIG_FILE}
 Restart=always
 RestartSec=10
 LimitNOFILE=65536
@@ -164,18 +273,6 @@ else
     exit 1
 fi
 
-# 注册节点到面板
-echo -e "${YELLOW}注册节点到面板...${NC}"
-REGISTER_URL="${PANEL_URL}/api/nodes/register"
-REGISTER_DATA="{\"node_key\":\"${NODE_KEY}\",\"node_name\":\"${NODE_NAME}\"}"
-
-REGISTER_RESULT=$(curl -s -X POST -H "Content-Type: application/json" -d "${REGISTER_DATA}" "${REGISTER_URL}")
-if echo "${REGISTER_RESULT}" | grep -q "success"; then
-    echo -e "${GREEN}节点已成功注册到面板!${NC}"
-else
-    echo -e "${YELLOW}节点可能已经注册或注册失败，请在面板中检查节点状态${NC}"
-fi
-
 echo -e "${GREEN}=== 安装完成 ===${NC}"
 echo -e "${GREEN}节点已成功安装并连接到面板服务器${NC}"
 echo -e "${BLUE}配置文件: ${CONFIG_FILE}${NC}"
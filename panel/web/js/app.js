@@ -47,6 +47,20 @@ function initAlpineData() {
         nodeModalMode: 'add', // 'add' 或 'edit'
         showInstallCommandModal: false,
         installCommand: '',
+        showNodeKeysModal: false,
+        nodeKeysNode: null,
+        nodeKeys: [],
+        newNodeKey: '', // 新生成的密钥只显示一次，关闭后清除
+        showEnrollmentModal: false,
+        enrollmentTokens: [],
+        enrollmentForm: {
+            node_name: '',
+            tags: '',
+            group: '',
+            max_uses: 1,
+            expires_in: 24
+        },
+        newEnrollmentCommand: '', // 新令牌的安装命令只显示一次，关闭后清除
         
         // 测速相关
         speedtestResults: [],
@@ -57,6 +71,23 @@ function initAlpineData() {
         },
         showSpeedtestModal: false,
         
+        // 全网格测速
+        meshRuns: [],
+        meshMatrix: null,
+        meshMetric: 'ping',
+        meshFilter: {
+            run: '',
+            tag: '',
+            days: 7
+        },
+        meshForm: {
+            name: '',
+            tag: '',
+            nodeIds: [],
+            type: 'ping',
+            size: 0
+        },
+        
         // 系统设置
         settings: {},
         settingsForm: {},
@@ -115,6 +146,9 @@ function initAlpineData() {
                 case 'speedtest':
                     this.loadSpeedtestResults();
                     break;
+                case 'mesh':
+                    this.loadMesh();
+                    break;
                 case 'settings':
                     this.loadSettings();
                     break;
@@ -283,6 +317,14 @@ function initAlpineData() {
                     // 保存成功，重新加载节点列表
                     this.showNodeModal = false;
                     await this.loadNodes();
+                    
+                    // 新建节点时显示一次节点密钥
+                    if (!isEdit && data.data && data.data.secretKey) {
+                        this.nodeKeysNode = { id: data.data.id, name: this.nodeForm.name };
+                        this.newNodeKey = data.data.secretKey;
+                        this.showNodeKeysModal = true;
+                        await this.loadNodeKeys();
+                    }
                 } else {
                     console.error('保存节点失败:', data.message);
                     alert(`保存节点失败: ${data.message}`);
@@ -327,10 +369,15 @@ function initAlpineData() {
         
         // 生成节点安装命令
         async generateInstallCommand(nodeId) {
+            // 安装命令包含新生成的节点密钥，已安装节点的旧密钥在宽限期后失效
+            if (!confirm('生成安装命令会为该节点生成新密钥，已安装节点的旧密钥将在宽限期后失效，确定继续吗？')) {
+                return;
+            }
             this.isLoading = true;
             
             try {
                 const response = await fetch(`${API_BASE_URL}/nodes/${nodeId}/install-command`, {
+                    method: 'POST',
                     headers: getHeaders()
                 });
                 
@@ -352,6 +399,402 @@ function initAlpineData() {
             }
         },
         
+        closeInstallCommandModal() {
+            this.showInstallCommandModal = false;
+            this.installCommand = '';
+        },
+        
+        // 节点密钥管理
+        async openNodeKeysModal(node) {
+            this.nodeKeysNode = node;
+            this.nodeKeys = [];
+            this.newNodeKey = '';
+            this.showNodeKeysModal = true;
+            await this.loadNodeKeys();
+        },
+        
+        closeNodeKeysModal() {
+            this.showNodeKeysModal = false;
+            this.newNodeKey = '';
+            this.nodeKeys = [];
+        },
+        
+        async loadNodeKeys() {
+            try {
+                const response = await fetch(`${API_BASE_URL}/nodes/${this.nodeKeysNode.id}/keys`, {
+                    headers: getHeaders()
+                });
+                
+                const data = await response.json();
+                
+                if (data.code === 0) {
+                    this.nodeKeys = data.data.keys || [];
+                } else {
+                    console.error('加载节点密钥失败:', data.message);
+                }
+            } catch (error) {
+                console.error('加载节点密钥请求失败:', error);
+            }
+        },
+        
+        async rotateNodeKey() {
+            if (!confirm('确定要生成新密钥吗？旧密钥将在宽限期结束后失效。')) {
+                return;
+            }
+            
+            this.isLoading = true;
+            
+            try {
+                const response = await fetch(`${API_BASE_URL}/nodes/${this.nodeKeysNode.id}/keys/rotate`, {
+                    method: 'POST',
+                    headers: getHeaders()
+                });
+                
+                const data = await response.json();
+                
+                if (data.code === 0) {
+                    this.newNodeKey = data.data.key;
+                    await this.loadNodeKeys();
+                } else {
+                    console.error('轮换节点密钥失败:', data.message);
+                    alert(`轮换节点密钥失败: ${data.message}`);
+                }
+            } catch (error) {
+                console.error('轮换节点密钥请求失败:', error);
+                alert('轮换节点密钥请求失败，请稍后再试');
+            } finally {
+                this.isLoading = false;
+            }
+        },
+        
+        async revokeNodeKey(key) {
+            if (!confirm(`确定要吊销密钥 ${key.prefix}… 吗？使用该密钥的节点将立即无法连接。`)) {
+                return;
+            }
+            
+            try {
+                const response = await fetch(`${API_BASE_URL}/nodes/${this.nodeKeysNode.id}/keys/${key.id}`, {
+                    method: 'DELETE',
+                    headers: getHeaders()
+                });
+                
+                const data = await response.json();
+                
+                if (data.code === 0) {
+                    await this.loadNodeKeys();
+                } else {
+                    console.error('吊销节点密钥失败:', data.message);
+                    alert(`吊销节点密钥失败: ${data.message}`);
+                }
+            } catch (error) {
+                console.error('吊销节点密钥请求失败:', error);
+                alert('吊销节点密钥请求失败，请稍后再试');
+            }
+        },
+        
+        // 节点注册令牌
+        async openEnrollmentModal() {
+            this.enrollmentForm = {
+                node_name: '',
+                tags: '',
+                group: '',
+                max_uses: 1,
+                expires_in: 24
+            };
+            this.newEnrollmentCommand = '';
+            this.showEnrollmentModal = true;
+            await this.loadEnrollmentTokens();
+        },
+        
+        closeEnrollmentModal() {
+            this.showEnrollmentModal = false;
+            this.newEnrollmentCommand = '';
+        },
+        
+        async loadEnrollmentTokens() {
+            try {
+                const response = await fetch(`${API_BASE_URL}/enrollment-tokens`, {
+                    headers: getHeaders()
+                });
+                
+                const data = await response.json();
+                
+                if (data.code === 0) {
+                    this.enrollmentTokens = data.data.tokens || [];
+                } else {
+                    console.error('加载注册令牌失败:', data.message);
+                }
+            } catch (error) {
+                console.error('加载注册令牌请求失败:', error);
+            }
+        },
+        
+        async createEnrollmentToken() {
+            this.isLoading = true;
+            
+            try {
+                const tags = this.enrollmentForm.tags
+                    .split(',')
+                    .map(tag => tag.trim())
+                    .filter(tag => tag !== '');
+                
+                const response = await fetch(`${API_BASE_URL}/enrollment-tokens`, {
+                    method: 'POST',
+                    headers: getHeaders(),
+                    body: JSON.stringify({
+                        node_name: this.enrollmentForm.node_name,
+                        tags: tags,
+                        group: this.enrollmentForm.group,
+                        max_uses: parseInt(this.enrollmentForm.max_uses, 10) || 1,
+                        expires_in: parseInt(this.enrollmentForm.expires_in, 10) || 24
+                    })
+                });
+                
+                const data = await response.json();
+                
+                if (data.code === 0) {
+                    this.newEnrollmentCommand = data.data.command;
+                    await this.loadEnrollmentTokens();
+                } else {
+                    console.error('创建注册令牌失败:', data.message);
+                    alert(`创建注册令牌失败: ${data.message}`);
+                }
+            } catch (error) {
+                console.error('创建注册令牌请求失败:', error);
+                alert('创建注册令牌请求失败，请稍后再试');
+            } finally {
+                this.isLoading = false;
+            }
+        },
+        
+        async revokeEnrollmentToken(token) {
+            if (!confirm(`确定要吊销令牌 ${token.prefix}… 吗？已注册的节点不受影响。`)) {
+                return;
+            }
+            
+            try {
+                const response = await fetch(`${API_BASE_URL}/enrollment-tokens/${token.id}`, {
+                    method: 'DELETE',
+                    headers: getHeaders()
+                });
+                
+                const data = await response.json();
+                
+                if (data.code === 0) {
+                    await this.loadEnrollmentTokens();
+                } else {
+                    console.error('吊销注册令牌失败:', data.message);
+                    alert(`吊销注册令牌失败: ${data.message}`);
+                }
+            } catch (error) {
+                console.error('吊销注册令牌请求失败:', error);
+                alert('吊销注册令牌请求失败，请稍后再试');
+            }
+        },
+        
+        enrollmentTokenStatus(token) {
+            if (token.revoked) {
+                return '已吊销';
+            }
+            if (new Date(token.expires_at) <= new Date()) {
+                return '已过期';
+            }
+            if (token.uses >= token.max_uses) {
+                return '已用完';
+            }
+            return '可用';
+        },
+        
+        formatTime(value) {
+            if (!value) {
+                return '-';
+            }
+            return new Date(value).toLocaleString();
+        },
+        
+        nodeKeyStatus(key) {
+            if (key.revoked) {
+                return '已吊销';
+            }
+            if (key.expires_at && new Date(key.expires_at) <= new Date()) {
+                return '已过期';
+            }
+            if (key.expires_at) {
+                return `宽限期至 ${this.formatTime(key.expires_at)}`;
+            }
+            return '有效';
+        },
+        
+        // 全网格测速相关方法
+        async loadMesh() {
+            await this.loadMeshRuns();
+            await this.loadMeshMatrix();
+        },
+        
+        async loadMeshRuns() {
+            try {
+                const response = await fetch(`${API_BASE_URL}/mesh/runs`, {
+                    headers: getHeaders()
+                });
+                
+                const data = await response.json();
+                
+                if (data.code === 0) {
+                    this.meshRuns = data.data.runs || [];
+                } else {
+                    console.error('加载全网格测速失败:', data.message);
+                }
+            } catch (error) {
+                console.error('加载全网格测速请求失败:', error);
+            }
+        },
+        
+        async loadMeshMatrix() {
+            const params = new URLSearchParams();
+            if (this.meshFilter.run) {
+                params.set('run', this.meshFilter.run);
+            } else if (this.meshFilter.tag.trim()) {
+                params.set('tag', this.meshFilter.tag.trim());
+                params.set('days', this.meshFilter.days);
+            } else {
+                params.set('nodes', this.nodes.map(node => node.id).join(','));
+                params.set('days', this.meshFilter.days);
+            }
+            
+            try {
+                const response = await fetch(`${API_BASE_URL}/mesh/matrix?${params}`, {
+                    headers: getHeaders()
+                });
+                
+                const data = await response.json();
+                
+                if (data.code === 0) {
+                    this.meshMatrix = data.data;
+                } else {
+                    console.error('加载测速矩阵失败:', data.message);
+                    this.meshMatrix = null;
+                }
+            } catch (error) {
+                console.error('加载测速矩阵请求失败:', error);
+            }
+        },
+        
+        async startMeshRun() {
+            this.isLoading = true;
+            
+            try {
+                const response = await fetch(`${API_BASE_URL}/mesh/runs`, {
+                    method: 'POST',
+                    headers: getHeaders(),
+                    body: JSON.stringify({
+                        name: this.meshForm.name,
+                        node_ids: this.meshForm.tag.trim() ? [] : this.meshForm.nodeIds,
+                        tag: this.meshForm.tag.trim(),
+                        type: this.meshForm.type,
+                        size: parseInt(this.meshForm.size, 10) || 0
+                    })
+                });
+                
+                const data = await response.json();
+                
+                if (data.code === 0) {
+                    this.meshFilter.run = data.data.id;
+                    await this.loadMesh();
+                } else {
+                    console.error('创建全网格测速失败:', data.message);
+                    alert(`创建全网格测速失败: ${data.message}`);
+                }
+            } catch (error) {
+                console.error('创建全网格测速请求失败:', error);
+                alert('创建全网格测速请求失败，请稍后再试');
+            } finally {
+                this.isLoading = false;
+            }
+        },
+        
+        async cancelMeshRun(run) {
+            if (!confirm(`确定要取消 ${run.name} 吗？已下发的测试会继续运行。`)) {
+                return;
+            }
+            
+            try {
+                const response = await fetch(`${API_BASE_URL}/mesh/runs/${run.id}/cancel`, {
+                    method: 'POST',
+                    headers: getHeaders()
+                });
+                
+                const data = await response.json();
+                
+                if (data.code === 0) {
+                    await this.loadMeshRuns();
+                } else {
+                    console.error('取消全网格测速失败:', data.message);
+                    alert(`取消全网格测速失败: ${data.message}`);
+                }
+            } catch (error) {
+                console.error('取消全网格测速请求失败:', error);
+                alert('取消全网格测速请求失败，请稍后再试');
+            }
+        },
+        
+        meshRunProgress(run) {
+            const tests = run.tests || {};
+            const finished = (run.total_tests || 0) - (tests.pending || 0) - (tests.running || 0);
+            return `${run.round}/${run.total_rounds} 轮，${Math.max(finished, 0)}/${run.total_tests} 个测试`;
+        },
+        
+        // 当前指标在矩阵中的取值，没有数据时返回null
+        meshCellValue(cell) {
+            if (!cell) return null;
+            const value = cell[this.meshMetric];
+            return value === undefined ? null : value;
+        },
+        
+        meshCellText(cell) {
+            const value = this.meshCellValue(cell);
+            if (value === null) {
+                return cell && cell.status !== 'completed' ? cell.status : '-';
+            }
+            switch (this.meshMetric) {
+                case 'download_speed':
+                case 'upload_speed':
+                    return this.formatSpeed(value);
+                case 'packet_loss':
+                    return value.toFixed(1) + '%';
+                default:
+                    return this.formatPing(value);
+            }
+        },
+        
+        // 按矩阵中的最小值和最大值着色，绿色最好、红色最差
+        meshCellStyle(cell) {
+            const value = this.meshCellValue(cell);
+            if (value === null || !this.meshMatrix) return '';
+            
+            const values = [];
+            this.meshMatrix.cells.forEach(row => row.forEach(c => {
+                const v = this.meshCellValue(c);
+                if (v !== null) values.push(v);
+            }));
+            const min = Math.min(...values);
+            const max = Math.max(...values);
+            let score = max === min ? 1 : (value - min) / (max - min);
+            // 延迟、抖动和丢包越低越好
+            if (!['download_speed', 'upload_speed'].includes(this.meshMetric)) {
+                score = 1 - score;
+            }
+            return `background-color: hsl(${Math.round(score * 120)}, 70%, 80%)`;
+        },
+        
+        meshCellTitle(cell) {
+            if (!cell) return '没有测试数据';
+            let title = `最近测试: ${this.formatTime(cell.tested_at)} (${cell.status})`;
+            if (cell.error_message) {
+                title += `\n${cell.error_message}`;
+            }
+            return title;
+        },
+        
         // 测速相关方法
         async loadSpeedtestResults() {
             this.isLoading = true;
@@ -494,6 +937,7 @@ function initAlpineData() {
             switch (status) {
                 case 'online': return 'bg-green-500';
                 case 'offline': return 'bg-red-500';
+                case 'maintenance': return 'bg-gray-500';
                 case 'unknown': return 'bg-gray-500';
                 default: return 'bg-gray-500';
             }
@@ -506,6 +950,7 @@ function initAlpineData() {
                 case 'running': return 'text-blue-500';
                 case 'failed': return 'text-red-500';
                 case 'timeout': return 'text-red-500';
+                case 'cancelled': return 'text-gray-500';
                 default: return 'text-gray-500';
             }
         },
@@ -513,6 +958,43 @@ function initAlpineData() {
         getNodeName(nodeId) {
             const node = this.nodes.find(n => n.id === nodeId);
             return node ? node.name : nodeId;
+        },
+        
+        // 按当前的状态过滤导出测速结果
+        exportSpeedtestResults(format) {
+            const params = {format: format};
+            if (this.testStatusFilter && this.testStatusFilter !== 'all') {
+                params.status = this.testStatusFilter;
+            }
+            this.exportFile('/speedtest/results/export', params);
+        },
+        
+        // 下载导出文件，导出接口需要认证，不能直接打开链接
+        async exportFile(path, params) {
+            try {
+                const query = new URLSearchParams(params).toString();
+                const response = await fetch(`${API_BASE_URL}${path}?${query}`, {
+                    headers: getHeaders()
+                });
+                
+                // 参数错误时返回JSON
+                if ((response.headers.get('Content-Type') || '').startsWith('application/json')) {
+                    const data = await response.json();
+                    alert(`导出失败: ${data.message}`);
+                    return;
+                }
+                
+                const disposition = response.headers.get('Content-Disposition') || '';
+                const match = disposition.match(/filename="([^"]+)"/);
+                const link = document.createElement('a');
+                link.href = URL.createObjectURL(await response.blob());
+                link.download = match ? match[1] : `export.${params.format}`;
+                link.click();
+                URL.revokeObjectURL(link.href);
+            } catch (error) {
+                console.error('导出失败:', error);
+                alert('导出请求失败，请稍后再试');
+            }
         }
     }));
 }
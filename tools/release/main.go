@@ -0,0 +1,178 @@
+// 节点程序发布工具：生成发布密钥，为节点程序生成并签名发布清单
+//
+// 用法:
+//
+//	go run ./tools/release keygen -out release.key
+//	go run ./tools/release sign -key release.key -version v1.1.0 ./bin
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 支持的节点架构，与安装脚本下载的文件名 node-<架构> 对应
+var architectures = []string{"amd64", "arm64", "arm"}
+
+// 发布清单，格式与面板和节点的 auth.ReleaseManifest 一致
+type manifest struct {
+	Version   string            `json:"version"`
+	CreatedAt time.Time         `json:"created_at"`
+	Binaries  map[string]binary `json:"binaries"`
+}
+
+type binary struct {
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "keygen":
+		err = keygen(os.Args[2:])
+	case "sign":
+		err = sign(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "用法:")
+	fmt.Fprintln(os.Stderr, "  release keygen -out 私钥文件")
+	fmt.Fprintln(os.Stderr, "  release sign -key 私钥文件 -version 版本 发布目录")
+	os.Exit(2)
+}
+
+// 生成ed25519发布密钥，私钥写入文件，公钥输出到标准输出
+func keygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	out := fs.String("out", "release.key", "私钥输出文件")
+	fs.Parse(args)
+
+	if _, err := os.Stat(*out); err == nil {
+		return fmt.Errorf("私钥文件已存在: %s", *out)
+	}
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("生成密钥失败: %v", err)
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(privateKey.Seed())
+	if err := ioutil.WriteFile(*out, []byte(encoded+"\n"), 0600); err != nil {
+		return fmt.Errorf("保存私钥失败: %v", err)
+	}
+
+	fmt.Printf("私钥已保存到 %s，请妥善保管，不要放在面板服务器上\n", *out)
+	fmt.Printf("发布公钥（填写到面板和节点配置的 update_public_key）:\n%s\n",
+		base64.StdEncoding.EncodeToString(publicKey))
+	return nil
+}
+
+// 为发布目录中的节点程序生成清单并签名
+func sign(args []string) error {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	keyPath := fs.String("key", "release.key", "私钥文件")
+	version := fs.String("version", "", "发布版本，需与节点程序 -version 输出一致")
+	fs.Parse(args)
+
+	if *version == "" || fs.NArg() != 1 {
+		usage()
+	}
+	dir := fs.Arg(0)
+
+	privateKey, err := loadPrivateKey(*keyPath)
+	if err != nil {
+		return err
+	}
+
+	m := manifest{
+		Version:   *version,
+		CreatedAt: time.Now().UTC(),
+		Binaries:  make(map[string]binary),
+	}
+	for _, arch := range architectures {
+		name := "node-" + arch
+		sum, size, err := checksum(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			fmt.Printf("跳过 %s: 文件不存在\n", name)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("读取 %s 失败: %v", name, err)
+		}
+		m.Binaries[arch] = binary{File: name, SHA256: sum, Size: size}
+		fmt.Printf("%s  %s  %d\n", name, sum, size)
+	}
+	if len(m.Binaries) == 0 {
+		return fmt.Errorf("发布目录 %s 中没有节点程序", dir)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, data))
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "manifest.json"), data, 0644); err != nil {
+		return fmt.Errorf("保存发布清单失败: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "manifest.json.sig"), []byte(signature+"\n"), 0644); err != nil {
+		return fmt.Errorf("保存清单签名失败: %v", err)
+	}
+
+	fmt.Printf("已生成 %s 的发布清单: %s\n", *version, filepath.Join(dir, "manifest.json"))
+	return nil
+}
+
+// 读取Base64编码的私钥种子
+func loadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取私钥失败: %v", err)
+	}
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("无效的私钥文件: %s", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// 计算文件的SHA-256校验和与大小
+func checksum(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}